@@ -0,0 +1,187 @@
+package mailcatcher
+
+import (
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Address is an email address with an optional display name.
+//
+// Address holds the address exactly as received. ASCII and Unicode hold the
+// same address with its domain converted to punycode (A-label) and Unicode
+// (U-label) form respectively. RFC 6531 UTF-8 local parts have no ASCII
+// equivalent and are kept unchanged in both forms.
+type Address struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+	ASCII   string `json:"ascii"`
+	Unicode string `json:"unicode"`
+}
+
+// Group is an RFC 5322 group such as "Team: a@example.com, b@example.com;"
+// or the empty "undisclosed-recipients:;".
+type Group struct {
+	Name    string    `json:"name"`
+	Members []Address `json:"members"`
+}
+
+// newAddress builds an Address and fills in its normalized forms.
+func newAddress(name, addr string) Address {
+	ascii, unicode := normalizeAddress(addr)
+	return Address{Name: name, Address: addr, ASCII: ascii, Unicode: unicode}
+}
+
+// String formats the address as "Name <address>", or just the bare
+// address when there is no display name.
+func (a Address) String() string {
+	if a.Name == "" {
+		return a.Address
+	}
+	return a.Name + " <" + a.Address + ">"
+}
+
+// Matches reports whether a refers to the same mailbox as addr.
+// The comparison is case-insensitive and accepts addr in raw, punycode or
+// Unicode form, so "user@bücher.example" matches "user@xn--bcher-kva.example".
+func (a Address) Matches(addr string) bool {
+	addr = strings.TrimSpace(addr)
+	if strings.EqualFold(a.Address, addr) {
+		return true
+	}
+	ascii, _ := normalizeAddress(addr)
+	return strings.EqualFold(a.ASCII, ascii)
+}
+
+// normalizeAddress returns addr with its domain in ASCII and Unicode form.
+// A domain that is not a valid IDN is returned unchanged.
+func normalizeAddress(addr string) (ascii, unicode string) {
+	ascii, unicode = addr, addr
+
+	at := strings.LastIndex(addr, "@")
+	if at < 0 {
+		return ascii, unicode
+	}
+	local, domain := addr[:at], addr[at+1:]
+
+	if d, err := idna.Lookup.ToASCII(domain); err == nil {
+		ascii = local + "@" + d
+	}
+	if d, err := idna.Lookup.ToUnicode(domain); err == nil {
+		unicode = local + "@" + d
+	}
+	return ascii, unicode
+}
+
+// parseAddress parses a single address such as an SMTP envelope path.
+// Unparseable input is kept verbatim as the address.
+func parseAddress(value string) Address {
+	addrs := parseAddressList(value)
+	if len(addrs) == 0 {
+		return newAddress("", strings.TrimSpace(value))
+	}
+	return addrs[0]
+}
+
+// parseAddressList parses an address list header value such as To or Cc.
+// If the value is not a valid RFC 5322 address list, each comma-separated
+// entry is kept verbatim so no recipient is silently dropped.
+func parseAddressList(value string) []Address {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	list, err := mail.ParseAddressList(value)
+	if err != nil {
+		var addrs []Address
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				addrs = append(addrs, newAddress("", part))
+			}
+		}
+		return addrs
+	}
+
+	addrs := make([]Address, 0, len(list))
+	for _, a := range list {
+		addrs = append(addrs, newAddress(a.Name, a.Address))
+	}
+	return addrs
+}
+
+// parseGroups extracts the groups from an address list header value.
+// Members of each group are also part of the flat list returned by
+// parseAddressList; this only recovers the group structure.
+func parseGroups(value string) []Group {
+	var (
+		groups     []Group
+		inQuote    bool
+		inAngle    bool
+		comment    int
+		start      int
+		groupStart = -1
+	)
+
+	closeGroup := func(end int) {
+		groups = append(groups, Group{
+			Name:    decodeGroupName(value[start : groupStart-1]),
+			Members: parseAddressList(value[groupStart:end]),
+		})
+		groupStart = -1
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case inQuote:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuote = false
+			}
+		case comment > 0:
+			if c == '\\' {
+				i++
+			} else if c == '(' {
+				comment++
+			} else if c == ')' {
+				comment--
+			}
+		case c == '"':
+			inQuote = true
+		case c == '(':
+			comment++
+		case c == '<':
+			inAngle = true
+		case c == '>':
+			inAngle = false
+		case inAngle:
+			// Colons inside angle brackets belong to obsolete source routes
+		case c == ':' && groupStart < 0:
+			groupStart = i + 1
+		case c == ';' && groupStart >= 0:
+			closeGroup(i)
+			start = i + 1
+		case c == ',' && groupStart < 0:
+			start = i + 1
+		}
+	}
+
+	// Be lenient with a group missing its terminating semicolon
+	if groupStart >= 0 {
+		closeGroup(len(value))
+	}
+	return groups
+}
+
+// decodeGroupName unquotes and RFC 2047-decodes a group display name.
+func decodeGroupName(name string) string {
+	name = strings.TrimSpace(strings.TrimLeft(name, ", \t"))
+	if len(name) >= 2 && name[0] == '"' && name[len(name)-1] == '"' {
+		name = strings.ReplaceAll(name[1:len(name)-1], `\"`, `"`)
+	}
+
+	return decodeWord(name)
+}
@@ -0,0 +1,112 @@
+package mailcatcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAddressList(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []Address
+	}{
+		{"empty", "", nil},
+		{"bare", "billing@acme.com", []Address{{Address: "billing@acme.com"}}},
+		{"display name", "Acme Billing <billing@acme.com>", []Address{{Name: "Acme Billing", Address: "billing@acme.com"}}},
+		{"quoted name", `"Doe, Jane" <jane@example.com>, bob@example.com`, []Address{
+			{Name: "Doe, Jane", Address: "jane@example.com"},
+			{Address: "bob@example.com"},
+		}},
+		{"encoded name", "=?UTF-8?Q?J=C3=B6rg?= <j@example.com>", []Address{{Name: "Jörg", Address: "j@example.com"}}},
+		{"malformed", "not an address, other", []Address{{Address: "not an address"}, {Address: "other"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAddressList(tt.value)
+			for i := range got {
+				got[i].ASCII, got[i].Unicode = "", ""
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAddressList(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressString(t *testing.T) {
+	a := Address{Name: "Acme Billing", Address: "billing@acme.com"}
+	if got := a.String(); got != "Acme Billing <billing@acme.com>" {
+		t.Errorf("Expected 'Acme Billing <billing@acme.com>', got '%s'", got)
+	}
+
+	a = Address{Address: "billing@acme.com"}
+	if got := a.String(); got != "billing@acme.com" {
+		t.Errorf("Expected 'billing@acme.com', got '%s'", got)
+	}
+}
+
+func TestInternationalizedAddress(t *testing.T) {
+	a := parseAddress("José <josé@bücher.example>")
+	if a.Address != "josé@bücher.example" {
+		t.Errorf("Expected raw address 'josé@bücher.example', got '%s'", a.Address)
+	}
+	if a.ASCII != "josé@xn--bcher-kva.example" {
+		t.Errorf("Expected ASCII form 'josé@xn--bcher-kva.example', got '%s'", a.ASCII)
+	}
+	if a.Unicode != "josé@bücher.example" {
+		t.Errorf("Expected Unicode form 'josé@bücher.example', got '%s'", a.Unicode)
+	}
+
+	p := parseAddress("info@xn--e1afmkfd.xn--p1ai")
+	if p.Unicode != "info@пример.рф" {
+		t.Errorf("Expected Unicode form 'info@пример.рф', got '%s'", p.Unicode)
+	}
+
+	for _, addr := range []string{"josé@bücher.example", "josé@xn--bcher-kva.example", "JOSÉ@BÜCHER.example"} {
+		if !a.Matches(addr) {
+			t.Errorf("Expected %s to match %s", a, addr)
+		}
+	}
+	if !p.Matches("info@пример.рф") {
+		t.Errorf("Expected %s to match info@пример.рф", p)
+	}
+	if a.Matches("jose@bucher.example") {
+		t.Errorf("Expected %s not to match jose@bucher.example", a)
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []Group
+	}{
+		{"no groups", "a@example.com, b@example.com", nil},
+		{"empty group", "undisclosed-recipients:;", []Group{{Name: "undisclosed-recipients"}}},
+		{"members", "Team: a@x.com, B <b@y.com>;", []Group{{Name: "Team", Members: []Address{
+			{Address: "a@x.com"},
+			{Name: "B", Address: "b@y.com"},
+		}}}},
+		{"mixed", `boss@example.com, "Dev: Ops": ops@example.com;, Empty:;`, []Group{
+			{Name: "Dev: Ops", Members: []Address{{Address: "ops@example.com"}}},
+			{Name: "Empty"},
+		}},
+		{"unterminated", "Team: a@x.com", []Group{{Name: "Team", Members: []Address{{Address: "a@x.com"}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseGroups(tt.value)
+			for i := range got {
+				for j := range got[i].Members {
+					got[i].Members[j].ASCII, got[i].Members[j].Unicode = "", ""
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGroups(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Alert kinds.
+const (
+	AlertRate        = "rate"
+	AlertStoreSize   = "store-size"
+	AlertMessageSize = "message-size"
+)
+
+// Thresholds flags runaway email loops and oversized mail during tests
+// instead of letting them silently fill the catcher. Zero disables a
+// threshold.
+type Thresholds struct {
+	// MessagesPerMinute alerts when more messages arrive in a minute.
+	MessagesPerMinute int `json:"messages_per_minute"`
+
+	// StoreBytes alerts when the stored messages exceed this total size.
+	// Checking it sums the store on every message.
+	StoreBytes int64 `json:"store_bytes"`
+
+	// MessageBytes alerts for every message larger than this.
+	MessageBytes int64 `json:"message_bytes"`
+
+	// WebhookURL, if set, receives every Alert as a JSON POST.
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+// Alert reports an exceeded threshold. Rate and store size alerts fire
+// once when the threshold is crossed and again only after the value has
+// dropped back below it.
+type Alert struct {
+	Kind      string    `json:"kind"`
+	Threshold int64     `json:"threshold"`
+	Value     int64     `json:"value"`
+	EmailID   string    `json:"email_id"` // the message that crossed the threshold
+	Time      time.Time `json:"time"`
+}
+
+func (a Alert) String() string {
+	switch a.Kind {
+	case AlertRate:
+		return fmt.Sprintf("%d messages in the last minute (threshold %d)", a.Value, a.Threshold)
+	case AlertStoreSize:
+		return fmt.Sprintf("store holds %d bytes (threshold %d)", a.Value, a.Threshold)
+	default:
+		return fmt.Sprintf("message %s is %d bytes (threshold %d)", a.EmailID, a.Value, a.Threshold)
+	}
+}
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// alertState tracks recent arrivals and which alerts are active.
+type alertState struct {
+	mu         sync.Mutex
+	thresholds Thresholds
+	callbacks  []func(Alert)
+	arrivals   []time.Time // within the last minute
+	rateActive bool
+	sizeActive bool
+}
+
+// SetThresholds configures volume and size alerts.
+func (s *Server) SetThresholds(t Thresholds) {
+	s.alerts.mu.Lock()
+	defer s.alerts.mu.Unlock()
+	s.alerts.thresholds = t
+}
+
+// OnAlert registers a callback for exceeded thresholds. Callbacks run
+// synchronously on the delivery path and should return quickly.
+func (s *Server) OnAlert(fn func(Alert)) {
+	s.alerts.mu.Lock()
+	defer s.alerts.mu.Unlock()
+	s.alerts.callbacks = append(s.alerts.callbacks, fn)
+}
+
+// checkThresholds is called for every stored message.
+func (s *Server) checkThresholds(email Email) {
+	a := &s.alerts
+	a.mu.Lock()
+	t := a.thresholds
+	var fired []Alert
+	now := time.Now()
+	fire := func(kind string, threshold, value int64) {
+		fired = append(fired, Alert{Kind: kind, Threshold: threshold, Value: value, EmailID: email.ID, Time: now})
+	}
+
+	if t.MessageBytes > 0 && email.Size > t.MessageBytes {
+		fire(AlertMessageSize, t.MessageBytes, email.Size)
+	}
+
+	if t.MessagesPerMinute > 0 {
+		cutoff := now.Add(-time.Minute)
+		i := 0
+		for i < len(a.arrivals) && a.arrivals[i].Before(cutoff) {
+			i++
+		}
+		a.arrivals = append(a.arrivals[i:], now)
+
+		over := len(a.arrivals) > t.MessagesPerMinute
+		if over && !a.rateActive {
+			fire(AlertRate, int64(t.MessagesPerMinute), int64(len(a.arrivals)))
+		}
+		a.rateActive = over
+	}
+	callbacks := a.callbacks
+	a.mu.Unlock()
+
+	// Summing the store may be slow, so it is done outside the lock
+	if t.StoreBytes > 0 {
+		size := s.Stats().Bytes
+		over := size > t.StoreBytes
+
+		a.mu.Lock()
+		if over && !a.sizeActive {
+			fire(AlertStoreSize, t.StoreBytes, size)
+		}
+		a.sizeActive = over
+		a.mu.Unlock()
+	}
+
+	for _, alert := range fired {
+		s.warnf("%s", alert)
+		for _, fn := range callbacks {
+			fn(alert)
+		}
+		if t.WebhookURL != "" {
+			go s.postAlert(t.WebhookURL, alert)
+		}
+	}
+}
+
+// postAlert sends an alert to the webhook.
+func (s *Server) postAlert(url string, alert Alert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		s.errorf("Failed to encode alert: %v", err)
+		return
+	}
+
+	resp, err := alertClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		s.errorf("Failed to post alert: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		s.errorf("Failed to post alert: %s returned %s", url, resp.Status)
+	}
+}
@@ -0,0 +1,72 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThresholds(t *testing.T) {
+	posted := make(chan Alert, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		json.NewDecoder(r.Body).Decode(&alert)
+		posted <- alert
+	}))
+	defer webhook.Close()
+
+	server := New(0, 0)
+	server.SetThresholds(Thresholds{
+		MessagesPerMinute: 3,
+		StoreBytes:        500,
+		MessageBytes:      300,
+		WebhookURL:        webhook.URL,
+	})
+
+	var mu sync.Mutex
+	var alerts []Alert
+	server.OnAlert(func(a Alert) {
+		mu.Lock()
+		defer mu.Unlock()
+		alerts = append(alerts, a)
+	})
+
+	small := []byte("Subject: Loop\r\n\r\nAgain\r\n")
+	for range 5 {
+		if err := server.Send("app@example.com", []string{"user@example.com"}, small); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+	big := []byte("Subject: Big\r\n\r\n" + strings.Repeat("x", 400) + "\r\n")
+	if err := server.Send("app@example.com", []string{"user@example.com"}, big); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	mu.Lock()
+	kinds := make([]string, 0, len(alerts))
+	for _, a := range alerts {
+		kinds = append(kinds, a.Kind)
+	}
+	mu.Unlock()
+
+	// The rate alert fires once on crossing, not for every later message
+	want := []string{AlertRate, AlertMessageSize, AlertStoreSize}
+	if strings.Join(kinds, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expected alerts %v, got %v", want, kinds)
+	}
+	if alerts[0].Value != 4 || alerts[0].EmailID != "msg-3" {
+		t.Errorf("Expected rate alert for the 4th message, got %+v", alerts[0])
+	}
+
+	for range want {
+		select {
+		case <-posted:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected alerts to be posted to the webhook")
+		}
+	}
+}
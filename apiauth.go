@@ -0,0 +1,102 @@
+package mailcatcher
+
+import (
+	"crypto/subtle"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// apiAuth holds the credentials accepted by the HTTP API.
+type apiAuth struct {
+	token string
+	basic *credentials
+}
+
+// SetAPIToken requires requests to /api/v1 to carry the header
+// "Authorization: Bearer <token>". It can be combined with
+// SetAPIBasicAuth, in which case either is accepted.
+func (s *Server) SetAPIToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiAuth.token = token
+}
+
+// SetAPIBasicAuth requires requests to /api/v1 to use HTTP basic
+// authentication with the given credentials. Browsers prompt for them,
+// so the web UI keeps working.
+func (s *Server) SetAPIBasicAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiAuth.basic = &credentials{username: username, password: password}
+}
+
+// apiAuthMiddleware rejects unauthenticated requests to the API. The web
+// UI files hold no mail and stay public.
+func (s *Server) apiAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		auth := s.apiAuth
+		s.mu.RUnlock()
+
+		if !strings.HasPrefix(r.URL.Path, "/api/") || auth.allows(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if auth.basic != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mailcatcher", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mailcatcher"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// allows reports whether r carries accepted credentials. Without any
+// configured credentials every request is allowed.
+func (a apiAuth) allows(r *http.Request) bool {
+	if a.token == "" && a.basic == nil {
+		return true
+	}
+
+	if a.token != "" {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if ok && strings.EqualFold(scheme, "Bearer") &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1 {
+			return true
+		}
+	}
+
+	if a.basic != nil {
+		if username, password, ok := r.BasicAuth(); ok && a.basic.match(username, password) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAPIAuth rejects r with 403 unless the API requires credentials.
+// Endpoints making the server send mail or requests elsewhere use it: the
+// API allows any origin, so without credentials any web page opened by a
+// user could call them.
+func (s *Server) requireAPIAuth(w http.ResponseWriter, what string) bool {
+	s.mu.RLock()
+	auth := s.apiAuth
+	s.mu.RUnlock()
+	if auth.token == "" && auth.basic == nil {
+		http.Error(w, what+" requires API authentication (-api-token or -api-user)", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requireJSON rejects r with 415 unless its body is JSON. Browsers send
+// other content types cross-origin without asking the server first.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
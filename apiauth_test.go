@@ -0,0 +1,62 @@
+package mailcatcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIAuth(t *testing.T) {
+	server := NewWithOptions(WithAPIToken("s3cret"), WithAPIBasicAuth("qa", "hunter2"))
+	ts := httptest.NewServer(server.HTTPServer().Handler)
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		method string
+		auth   func(*http.Request)
+		status int
+	}{
+		{"no credentials", "/api/v1/emails", http.MethodGet, func(*http.Request) {}, http.StatusUnauthorized},
+		{"wrong token", "/api/v1/emails", http.MethodGet, func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"token", "/api/v1/emails", http.MethodGet, func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusOK},
+		{"wrong password", "/api/v1/stats", http.MethodGet, func(r *http.Request) { r.SetBasicAuth("qa", "nope") }, http.StatusUnauthorized},
+		{"basic auth", "/api/v1/stats", http.MethodGet, func(r *http.Request) { r.SetBasicAuth("qa", "hunter2") }, http.StatusOK},
+		{"delete", "/api/v1/emails", http.MethodDelete, func(*http.Request) {}, http.StatusUnauthorized},
+		{"preflight", "/api/v1/emails", http.MethodOptions, func(*http.Request) {}, http.StatusNoContent},
+		{"web UI", "/", http.MethodGet, func(*http.Request) {}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+			tt.auth(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+			if tt.status == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("Expected WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestAPIAuthDisabled(t *testing.T) {
+	server := New(0, 0)
+	ts := httptest.NewServer(server.HTTPServer().Handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/emails")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 without API auth, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,94 @@
+package mailcatcher
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// archiveIndex is the name of the index in an archive.
+const archiveIndex = "index.json"
+
+// archiveEntry describes a message of an archive in its index.
+type archiveEntry struct {
+	File    string    `json:"file"`
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	From    string    `json:"from"`
+	To      []string  `json:"to"`
+	Subject string    `json:"subject"`
+	Size    int64     `json:"size"`
+}
+
+// ExportZip writes every stored email, including held ones, to w as a zip
+// archive, e.g. to attach a failed test run's mail to a CI build. Each
+// message is a <id>.eml file, and index.json lists them in the order they
+// were received with their envelope, subject and time.
+func (s *Server) ExportZip(w io.Writer) error {
+	emails, err := s.store.List(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to list emails: %w", err)
+	}
+	return exportZip(w, emails)
+}
+
+func exportZip(w io.Writer, emails []Email) error {
+	zw := zip.NewWriter(w)
+	index := make([]archiveEntry, 0, len(emails))
+	for i := range emails {
+		email := &emails[i]
+		entry := archiveEntry{
+			File:    email.ID + ".eml",
+			ID:      email.ID,
+			Time:    email.Time,
+			From:    email.Envelope.From,
+			To:      email.Envelope.To,
+			Subject: email.Subject,
+			Size:    email.Size,
+		}
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: entry.File, Method: zip.Deflate, Modified: email.Time})
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %w", email.ID, err)
+		}
+		if _, err := f.Write(email.Raw()); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", email.ID, err)
+		}
+		index = append(index, entry)
+		emails[i] = Email{} // let the archived email be collected
+	}
+
+	f, err := zw.Create(archiveIndex)
+	if err != nil {
+		return fmt.Errorf("failed to write archive index: %w", err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(index); err != nil {
+		return fmt.Errorf("failed to write archive index: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// HTTP handlers
+
+func (s *Server) handleArchiveEmails(w http.ResponseWriter, r *http.Request) {
+	emails, err := s.store.List(r.Context())
+	if err != nil {
+		s.errorf("Failed to list emails: %v", err)
+		http.Error(w, "Failed to list emails", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="mailcatcher.zip"`)
+	if err := exportZip(w, emails); err != nil {
+		// Headers are already sent; the truncated body is all we can do
+		s.errorf("%v", err)
+	}
+}
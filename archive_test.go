@@ -0,0 +1,83 @@
+package mailcatcher
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// readArchive returns the files of a zip archive by name.
+func readArchive(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		files[f.Name], err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", f.Name, err)
+		}
+	}
+	return files
+}
+
+func TestExportZip(t *testing.T) {
+	server := New(0, 0)
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: One\r\n\r\nBody\r\n"))
+	server.Send("app@example.com", []string{"boss@example.com"}, []byte("Subject: Two\r\n\r\nBody\r\n"))
+
+	var buf bytes.Buffer
+	if err := server.ExportZip(&buf); err != nil {
+		t.Fatalf("Failed to export zip: %v", err)
+	}
+	files := readArchive(t, buf.Bytes())
+
+	if len(files) != 3 {
+		t.Errorf("Expected 2 messages and an index, got %d files", len(files))
+	}
+	if got := string(files["msg-0.eml"]); got != "Subject: One\r\n\r\nBody\r\n" {
+		t.Errorf("Expected the raw message in msg-0.eml, got %q", got)
+	}
+
+	var index []archiveEntry
+	if err := json.Unmarshal(files["index.json"], &index); err != nil {
+		t.Fatalf("Failed to decode index: %v", err)
+	}
+	if len(index) != 2 || index[1].File != "msg-1.eml" || index[1].Subject != "Two" || index[1].To[0] != "boss@example.com" {
+		t.Errorf("Expected both messages in the index, got %+v", index)
+	}
+}
+
+func TestArchiveEndpoint(t *testing.T) {
+	server := New(0, 0)
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: One\r\n\r\nBody\r\n"))
+	ts := httptest.NewServer(server.HTTPServer().Handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/emails/archive")
+	if err != nil {
+		t.Fatalf("Failed to download archive: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Expected Content-Type application/zip, got %s", ct)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	if files := readArchive(t, data); files["msg-0.eml"] == nil || files["index.json"] == nil {
+		t.Errorf("Expected msg-0.eml and index.json, got %d files", len(files))
+	}
+}
@@ -0,0 +1,120 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// Attachment is a file attached to an email, decoded from its transfer
+// encoding.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"` // decoded bytes
+
+	// Content shares the bytes of the attachment's part in Email.Parts.
+	// It is not encoded, so JSON holds them once; decoding an Email
+	// links it again. Download it from
+	// /api/v1/emails/{id}/attachments/{index}.
+	Content []byte `json:"-"`
+}
+
+// attachments returns the parts of an email that are attachments.
+func attachments(parts []Part) []Attachment {
+	var list []Attachment
+	for _, p := range parts {
+		if !p.IsAttachment() {
+			continue
+		}
+		list = append(list, Attachment{
+			Filename:    p.Filename,
+			ContentType: p.ContentType,
+			Size:        int64(len(p.Content)),
+			Content:     p.Content,
+		})
+	}
+	return list
+}
+
+// UnmarshalJSON implements json.Unmarshaler, linking the attachments to
+// the contents of their parts.
+func (e *Email) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*emailFields)(e)); err != nil {
+		return err
+	}
+	e.linkAttachments()
+	return nil
+}
+
+// emailFields is Email without its JSON methods.
+type emailFields Email
+
+// linkAttachments sets the content of each attachment to that of its
+// part: attachments are the parts that are files, in order.
+func (e *Email) linkAttachments() {
+	i := 0
+	for _, p := range e.Parts {
+		if i == len(e.Attachments) {
+			return
+		}
+		if p.IsAttachment() {
+			e.Attachments[i].Content = p.Content
+			i++
+		}
+	}
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetAttachments(w http.ResponseWriter, r *http.Request) {
+	email := s.Email(r.PathValue("id"))
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	// The listing describes the files; their content is downloaded separately
+	items := email.Attachments
+	if items == nil {
+		items = []Attachment{}
+	}
+
+	response := map[string]any{
+		"total": len(items),
+		"count": len(items),
+		"items": items,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	email := s.Email(r.PathValue("id"))
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= len(email.Attachments) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	a := email.Attachments[index]
+
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(a.Content)))
+	if a.Filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	}
+	_, _ = w.Write(a.Content)
+}
@@ -0,0 +1,239 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Types of PolicyViolation.
+const (
+	// ViolationExecutable is an executable or script, by name, declared
+	// type or content.
+	ViolationExecutable = "executable"
+
+	// ViolationMacro is an Office document with macros.
+	ViolationMacro = "macro"
+
+	// ViolationDoubleExtension is a name like "invoice.pdf.exe" that
+	// disguises the real type.
+	ViolationDoubleExtension = "double-extension"
+
+	// ViolationMagicMismatch is content whose magic bytes contradict the
+	// declared Content-Type.
+	ViolationMagicMismatch = "magic-mismatch"
+)
+
+// PolicyViolation is an attachment that breaks the AttachmentPolicy.
+type PolicyViolation struct {
+	Type        string `json:"type"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Detail      string `json:"detail"`
+}
+
+// AttachmentPolicy configures the checks applied to attachments of
+// received messages. Violations are recorded on Email.PolicyViolations.
+type AttachmentPolicy struct {
+	Executables      bool
+	Macros           bool
+	DoubleExtensions bool
+	MagicBytes       bool
+
+	// BlockedExtensions replaces the default list of executable extensions
+	// (without dots, e.g. "exe") when set.
+	BlockedExtensions []string
+
+	// Reject refuses violating messages instead of only flagging them,
+	// with Reply or a default 552 5.7.0 reply naming the violation.
+	Reject bool
+	Reply  *smtp.SMTPError
+}
+
+// DefaultAttachmentPolicy enables every check and only flags violations.
+func DefaultAttachmentPolicy() AttachmentPolicy {
+	return AttachmentPolicy{Executables: true, Macros: true, DoubleExtensions: true, MagicBytes: true}
+}
+
+// executableExtensions are blocked by mail providers as executable content.
+var executableExtensions = []string{
+	"exe", "com", "bat", "cmd", "scr", "pif", "msi", "msp", "dll", "cpl",
+	"js", "jse", "vbs", "vbe", "wsf", "wsh", "ps1", "hta", "jar", "lnk",
+	"reg", "app", "sh", "apk", "iso", "img",
+}
+
+// executableTypes are content types declaring executable content.
+var executableTypes = []string{
+	"application/x-msdownload", "application/x-dosexec", "application/x-executable",
+	"application/vnd.microsoft.portable-executable", "application/x-msdos-program",
+	"application/x-sh", "application/java-archive", "application/hta",
+}
+
+// macroExtensions are the macro-enabled Office formats.
+var macroExtensions = []string{
+	"docm", "dotm", "xlsm", "xltm", "xlam", "pptm", "potm", "ppam", "ppsm", "sldm",
+}
+
+// lureExtensions are types a disguised executable pretends to be.
+var lureExtensions = []string{
+	"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "txt", "rtf", "csv",
+	"jpg", "jpeg", "png", "gif", "zip", "html", "htm", "mp3", "mp4",
+}
+
+// magic is a file signature.
+type magic struct {
+	name   string
+	prefix string
+}
+
+var (
+	magicPDF  = magic{"PDF", "%PDF-"}
+	magicZIP  = magic{"ZIP", "PK\x03\x04"}
+	magicOLE  = magic{"OLE", "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"}
+	magicPNG  = magic{"PNG", "\x89PNG\r\n\x1a\n"}
+	magicJPEG = magic{"JPEG", "\xff\xd8\xff"}
+	magicGIF  = magic{"GIF", "GIF8"}
+	magicPE   = magic{"Windows executable", "MZ"}
+	magicELF  = magic{"ELF executable", "\x7fELF"}
+	magicMach = magic{"Mach-O executable", "\xcf\xfa\xed\xfe"}
+)
+
+// knownMagic is checked in order to identify content.
+var knownMagic = []magic{magicPDF, magicZIP, magicOLE, magicPNG, magicJPEG, magicGIF, magicPE, magicELF, magicMach}
+
+// expectedMagic maps declared content types to the signature their
+// content must start with.
+var expectedMagic = map[string]magic{
+	"application/pdf":               magicPDF,
+	"application/zip":               magicZIP,
+	"application/msword":            magicOLE,
+	"application/vnd.ms-excel":      magicOLE,
+	"application/vnd.ms-powerpoint": magicOLE,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   magicZIP,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         magicZIP,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": magicZIP,
+	"image/png":  magicPNG,
+	"image/jpeg": magicJPEG,
+	"image/gif":  magicGIF,
+}
+
+func sniff(content []byte) (magic, bool) {
+	for _, m := range knownMagic {
+		if bytes.HasPrefix(content, []byte(m.prefix)) {
+			return m, true
+		}
+	}
+	return magic{}, false
+}
+
+func isExecutableMagic(m magic) bool {
+	return m == magicPE || m == magicELF || m == magicMach
+}
+
+// SetAttachmentPolicy enables attachment checks on received messages.
+func (s *Server) SetAttachmentPolicy(p AttachmentPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attachmentPolicy = &p
+}
+
+// checkAttachments records policy violations on email and returns the
+// rejection if the policy refuses it.
+func (s *Server) checkAttachments(email *Email) error {
+	s.mu.RLock()
+	policy := s.attachmentPolicy
+	s.mu.RUnlock()
+
+	if policy == nil {
+		return nil
+	}
+	for _, part := range email.Parts {
+		if part.IsAttachment() {
+			email.PolicyViolations = append(email.PolicyViolations, policy.check(part)...)
+		}
+	}
+
+	if !policy.Reject || len(email.PolicyViolations) == 0 {
+		return nil
+	}
+	if policy.Reply != nil {
+		return policy.Reply
+	}
+	v := email.PolicyViolations[0]
+	return &smtp.SMTPError{
+		Code:         552,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 0},
+		Message:      fmt.Sprintf("Message rejected: attachment %s violates policy (%s)", v.Filename, v.Type),
+	}
+}
+
+// check returns the violations of one attachment.
+func (p *AttachmentPolicy) check(part Part) []PolicyViolation {
+	var violations []PolicyViolation
+	add := func(typ, format string, args ...any) {
+		violations = append(violations, PolicyViolation{
+			Type:        typ,
+			Filename:    part.Filename,
+			ContentType: part.ContentType,
+			Detail:      fmt.Sprintf(format, args...),
+		})
+	}
+
+	blocked := p.BlockedExtensions
+	if blocked == nil {
+		blocked = executableExtensions
+	}
+
+	// "invoice.pdf   .exe" hides the extension behind padding
+	name := strings.ToLower(strings.Join(strings.Fields(part.Filename), ""))
+	exts := strings.Split(name, ".")[1:]
+	ext := strings.TrimPrefix(path.Ext(name), ".")
+	sniffed, known := sniff(part.Content)
+
+	if p.Executables {
+		switch {
+		case ext != "" && slices.Contains(blocked, ext):
+			add(ViolationExecutable, "blocked extension .%s", ext)
+		case slices.Contains(executableTypes, part.ContentType):
+			add(ViolationExecutable, "executable content type %s", part.ContentType)
+		case known && isExecutableMagic(sniffed):
+			add(ViolationExecutable, "content is a %s", sniffed.name)
+		}
+	}
+
+	if p.Macros {
+		switch {
+		case slices.Contains(macroExtensions, ext):
+			add(ViolationMacro, "macro-enabled format .%s", ext)
+		case strings.Contains(part.ContentType, "macroenabled"):
+			add(ViolationMacro, "macro-enabled content type %s", part.ContentType)
+		case known && sniffed == magicZIP && bytes.Contains(part.Content, []byte("vbaProject.bin")):
+			add(ViolationMacro, "document contains a VBA project")
+		case known && sniffed == magicOLE && bytes.Contains(part.Content, []byte("_VBA_PROJECT")):
+			add(ViolationMacro, "document contains a VBA project")
+		}
+	}
+
+	if p.DoubleExtensions && len(exts) >= 2 {
+		inner := exts[len(exts)-2]
+		if slices.Contains(lureExtensions, inner) && slices.Contains(blocked, ext) {
+			add(ViolationDoubleExtension, ".%s disguised as .%s", ext, inner)
+		}
+	}
+
+	if p.MagicBytes {
+		if want, ok := expectedMagic[part.ContentType]; ok && !bytes.HasPrefix(part.Content, []byte(want.prefix)) {
+			got := "unknown content"
+			if known {
+				got = sniffed.name
+			}
+			add(ViolationMagicMismatch, "declared %s but content is %s", part.ContentType, got)
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,95 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// multipartMessage builds a multipart/mixed message with base64 attachments
+// given as filename, content type and content triples.
+func multipartMessage(attachments ...[3]string) []byte {
+	var b strings.Builder
+	b.WriteString("Subject: Files\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=XYZ\r\n\r\n")
+	b.WriteString("--XYZ\r\nContent-Type: text/plain\r\n\r\nSee attached.\r\n")
+	for _, a := range attachments {
+		b.WriteString("--XYZ\r\nContent-Type: " + a[1] + "\r\n")
+		b.WriteString("Content-Disposition: attachment; filename=\"" + a[0] + "\"\r\n")
+		b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		b.WriteString(base64.StdEncoding.EncodeToString([]byte(a[2])) + "\r\n")
+	}
+	b.WriteString("--XYZ--\r\n")
+	return []byte(b.String())
+}
+
+func TestAttachmentPolicy(t *testing.T) {
+	server := New(0, 0)
+	server.SetAttachmentPolicy(DefaultAttachmentPolicy())
+
+	email := newEmail("sender@example.com", []string{"user@example.com"}, multipartMessage(
+		[3]string{"invoice.pdf   .exe", "application/octet-stream", "MZ\x90\x00"},
+		[3]string{"report.pdf", "application/pdf", "<html>not a pdf</html>"},
+		[3]string{"budget.xlsm", "application/vnd.ms-excel.sheet.macroEnabled.12", "PK\x03\x04xl/vbaProject.bin"},
+		[3]string{"photo.png", "image/png", "\x89PNG\r\n\x1a\n...."},
+	))
+	if err := server.checkAttachments(&email); err != nil {
+		t.Fatalf("Expected flagging without rejection, got %v", err)
+	}
+
+	got := map[string]string{}
+	for _, v := range email.PolicyViolations {
+		got[v.Filename+" "+v.Type] = v.Detail
+	}
+	for _, want := range []string{
+		"invoice.pdf   .exe executable",
+		"invoice.pdf   .exe double-extension",
+		"report.pdf magic-mismatch",
+		"budget.xlsm macro",
+	} {
+		if _, ok := got[want]; !ok {
+			t.Errorf("Expected violation %q, got %v", want, got)
+		}
+	}
+	if len(email.PolicyViolations) != 4 {
+		t.Errorf("Expected 4 violations, got %+v", email.PolicyViolations)
+	}
+}
+
+func TestAttachmentPolicyReject(t *testing.T) {
+	policy := DefaultAttachmentPolicy()
+	policy.Reject = true
+	policy.Reply, _ = ProviderReply(ProviderGmail, ReplyBlockedContent)
+
+	server := NewUnstarted()
+	server.SetAttachmentPolicy(policy)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	addr := server.SMTPAddr()
+
+	msg := multipartMessage([3]string{"setup.exe", "application/octet-stream", "MZ"})
+	err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, msg)
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != 552 || !strings.Contains(tpErr.Msg, "BlockedMessage") {
+		t.Fatalf("Expected Gmail 552 blocked content reply, got %v", err)
+	}
+
+	msg = multipartMessage([3]string{"photo.png", "image/png", "\x89PNG\r\n\x1a\n"})
+	if err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Expected clean attachment to be accepted, got %v", err)
+	}
+	if emails := server.Emails(); len(emails) != 1 {
+		t.Errorf("Expected 1 email, got %d", len(emails))
+	}
+}
@@ -0,0 +1,122 @@
+package mailcatcher
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	server := New(0, 0)
+
+	pdf := "%PDF-1.7\n\x00\x01invoice"
+	msg := multipartMessage([3]string{"invoice-42.pdf", "application/pdf", pdf})
+	if err := server.Send("billing@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	emails := server.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+	email := emails[0]
+
+	if len(email.Attachments) != 1 {
+		t.Fatalf("Expected 1 attachment, got %d", len(email.Attachments))
+	}
+	a := email.Attachments[0]
+	if a.Filename != "invoice-42.pdf" || a.ContentType != "application/pdf" {
+		t.Errorf("Expected invoice-42.pdf (application/pdf), got %s (%s)", a.Filename, a.ContentType)
+	}
+	if string(a.Content) != pdf || a.Size != int64(len(pdf)) {
+		t.Errorf("Expected decoded content %q, got %q (size %d)", pdf, a.Content, a.Size)
+	}
+
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/emails/" + email.ID + "/attachments")
+	if err != nil {
+		t.Fatalf("Failed to list attachments: %v", err)
+	}
+	var list struct {
+		Count int          `json:"count"`
+		Items []Attachment `json:"items"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if list.Count != 1 || list.Items[0].Filename != "invoice-42.pdf" {
+		t.Errorf("Expected invoice-42.pdf listed, got %+v", list)
+	}
+	if list.Items[0].Content != nil {
+		t.Error("Expected listing to omit attachment content")
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/emails/" + email.ID + "/attachments/0")
+	if err != nil {
+		t.Fatalf("Failed to download attachment: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != pdf {
+		t.Errorf("Expected downloaded content %q, got %q", pdf, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("Expected Content-Type application/pdf, got %s", ct)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename=invoice-42.pdf` {
+		t.Errorf("Expected Content-Disposition with filename, got %s", cd)
+	}
+
+	for _, path := range []string{"/api/v1/emails/" + email.ID + "/attachments/1", "/api/v1/emails/missing/attachments"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestAttachmentContentStoredOnce(t *testing.T) {
+	pdf := "%PDF-1.7\n" + strings.Repeat("invoice ", 100)
+	email := newEmail("billing@example.com", []string{"user@example.com"},
+		multipartMessage([3]string{"invoice-42.pdf", "application/pdf", pdf}))
+
+	data, err := json.Marshal(email)
+	if err != nil {
+		t.Fatalf("Failed to encode email: %v", err)
+	}
+	// Once in the raw message and once in its part
+	if n := strings.Count(string(data), base64.StdEncoding.EncodeToString([]byte(pdf))); n != 2 {
+		t.Errorf("Expected the attachment content twice in JSON, got %d times", n)
+	}
+
+	var decoded Email
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode email: %v", err)
+	}
+	stored, err := encodeEmail(email)
+	if err != nil {
+		t.Fatalf("Failed to encode email: %v", err)
+	}
+	restored, err := decodeEmail(stored)
+	if err != nil {
+		t.Fatalf("Failed to decode stored email: %v", err)
+	}
+	for name, e := range map[string]Email{"JSON": decoded, "store": restored} {
+		if len(e.Attachments) != 1 || string(e.Attachments[0].Content) != pdf {
+			t.Errorf("Expected the %s attachment to be linked to its part, got %+v", name, e.Attachments)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package mailcatcher
+
+import (
+	"crypto/subtle"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+)
+
+var (
+	errAuthRequired = &smtp.SMTPError{
+		Code:         530,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 0},
+		Message:      "Authentication required",
+	}
+	errAuthInvalid = &smtp.SMTPError{
+		Code:         535,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 8},
+		Message:      "Authentication credentials invalid",
+	}
+)
+
+// AuthInfo records how the client authenticated the session that sent an
+// email. The password is not kept: the AUTH exchange is also redacted in
+// Email.Transcript and session recordings.
+type AuthInfo struct {
+	Mechanism string `json:"mechanism"`
+	Identity  string `json:"identity,omitempty"` // authorization identity, if different
+	Username  string `json:"username"`
+}
+
+// credentials are the username and password clients must present.
+type credentials struct {
+	username string
+	password string
+}
+
+// match compares credentials in constant time.
+func (c *credentials) match(username, password string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(c.username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(c.password)) == 1
+	return userOK && passOK
+}
+
+// SetAuth requires clients to authenticate with AUTH PLAIN using the given
+// credentials before sending mail. Without it any credentials are accepted
+// and authentication is optional. Either way the username each email was
+// sent with is recorded in Email.Auth. It must be called before Start.
+func (s *Server) SetAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = &credentials{username: username, password: password}
+}
+
+// RejectAuth makes every AUTH attempt fail with reply, or with 535 5.7.8
+// if reply is nil, to test how clients handle authentication failures.
+// Mail is still accepted from clients that do not authenticate, unless
+// SetAuth requires it.
+func (s *Server) RejectAuth(reply *smtp.SMTPError) {
+	if reply == nil {
+		reply = errAuthInvalid
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authRejection = reply
+}
+
+// checkAuth reports whether the credentials are accepted.
+func (s *Server) checkAuth(username, password string) error {
+	s.mu.RLock()
+	rejection := s.authRejection
+	s.mu.RUnlock()
+	if rejection != nil {
+		return rejection
+	}
+
+	if s.auth == nil {
+		return nil
+	}
+	if !s.auth.match(username, password) {
+		return errAuthInvalid
+	}
+	return nil
+}
+
+// AuthMechanisms implements smtp.AuthSession.
+func (s *session) AuthMechanisms() []string {
+	return []string{sasl.Plain}
+}
+
+// Auth implements smtp.AuthSession.
+func (s *session) Auth(mech string) (sasl.Server, error) {
+	return sasl.NewPlainServer(func(identity, username, password string) error {
+		if err := s.server.checkAuth(username, password); err != nil {
+			s.server.infof("Rejected AUTH %s for %q", mech, username)
+			return err
+		}
+		s.auth = &AuthInfo{Mechanism: mech, Username: username}
+		if identity != username {
+			s.auth.Identity = identity
+		}
+		return nil
+	}), nil
+}
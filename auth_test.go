@@ -0,0 +1,63 @@
+package mailcatcher
+
+import (
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"testing"
+)
+
+func TestAuthRecorded(t *testing.T) {
+	server, addr := NewTestServer(t)
+	msg := []byte("Subject: Hello\r\n\r\nBody\r\n")
+
+	// Without SetAuth any credentials are accepted and recorded
+	auth := smtp.PlainAuth("", "app", "anything", "127.0.0.1")
+	if err := smtp.SendMail(addr, auth, "app@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	if err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	emails := server.Emails()
+	if len(emails) != 2 {
+		t.Fatalf("Expected 2 emails, got %d", len(emails))
+	}
+	if a := emails[0].Auth; a == nil || a.Mechanism != "PLAIN" || a.Username != "app" || a.Identity != "" {
+		t.Errorf("Expected PLAIN auth as app, got %+v", a)
+	}
+	if a := emails[1].Auth; a != nil {
+		t.Errorf("Expected no auth, got %+v", a)
+	}
+	for _, cmd := range emails[0].Transcript {
+		if cmd.Verb == "AUTH" && cmd.Args != "PLAIN "+Redacted {
+			t.Errorf("Expected the password not to be kept in the transcript, got AUTH %s", cmd.Args)
+		}
+	}
+}
+
+func TestRejectAuth(t *testing.T) {
+	server, addr := NewTestServer(t)
+	server.RejectAuth(nil)
+	msg := []byte("Subject: Hello\r\n\r\nBody\r\n")
+
+	auth := smtp.PlainAuth("", "app", "secret", "127.0.0.1")
+	err := smtp.SendMail(addr, auth, "app@example.com", []string{"user@example.com"}, msg)
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != 535 {
+		t.Fatalf("Expected 535 for rejected auth, got %v", err)
+	}
+
+	// Clients that skip AUTH still get through
+	if err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Expected unauthenticated mail to be accepted, got %v", err)
+	}
+
+	reply, _ := ParseReply("454 4.7.0 Temporary authentication failure")
+	server.RejectAuth(reply)
+	err = smtp.SendMail(addr, auth, "app@example.com", []string{"user@example.com"}, msg)
+	if !errors.As(err, &tpErr) || tpErr.Code != 454 {
+		t.Errorf("Expected 454 for rejected auth, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Behavior is the injected failure behavior of the server: random faults,
+// latency and the rejection rules of RejectRecipient and RejectSender.
+// It can be switched on a running server, e.g. by an end-to-end suite
+// refusing all mail with 554 for one test and restoring normal mode after.
+type Behavior struct {
+	Faults  Faults  `json:"faults"`
+	Latency Latency `json:"latency"`
+
+	RejectRecipients []Rejection `json:"reject_recipients,omitempty"`
+	RejectSenders    []Rejection `json:"reject_senders,omitempty"`
+}
+
+// Rejection refuses addresses matching the path.Match Pattern, e.g. "*"
+// for all, with Reply, a reply accepted by ParseReply.
+type Rejection struct {
+	Pattern string `json:"pattern"`
+	Reply   string `json:"reply"`
+}
+
+// Behavior returns the injected failure behavior.
+func (s *Server) Behavior() Behavior {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Behavior{
+		Faults:           s.faults,
+		Latency:          s.latency,
+		RejectRecipients: rejections(s.recipientRejections),
+		RejectSenders:    rejections(s.senderRejections),
+	}
+}
+
+// SetBehavior replaces the injected failure behavior as a whole, so a
+// zero Behavior restores normal mode. Nothing is changed if b is invalid.
+func (s *Server) SetBehavior(b Behavior) error {
+	if err := b.Faults.validate(); err != nil {
+		return err
+	}
+	if err := b.Latency.validate(); err != nil {
+		return err
+	}
+	recipients, err := parseRejections(b.RejectRecipients)
+	if err != nil {
+		return err
+	}
+	senders, err := parseRejections(b.RejectSenders)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = b.Faults
+	s.latency = b.Latency
+	s.recipientRejections = recipients
+	s.senderRejections = senders
+	return nil
+}
+
+func parseRejections(rules []Rejection) ([]addressRejection, error) {
+	var parsed []addressRejection
+	for _, rule := range rules {
+		if strings.TrimSpace(rule.Pattern) == "" {
+			return nil, fmt.Errorf("invalid rejection: empty pattern")
+		}
+		reply, err := ParseReply(rule.Reply)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rejection of %s: %w", rule.Pattern, err)
+		}
+		parsed = append(parsed, addressRejection{pattern: strings.ToLower(rule.Pattern), reply: reply})
+	}
+	return parsed, nil
+}
+
+func rejections(rules []addressRejection) []Rejection {
+	var list []Rejection
+	for _, r := range rules {
+		list = append(list, Rejection{Pattern: r.pattern, Reply: formatReply(r.reply)})
+	}
+	return list
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetBehavior(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Behavior()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleSetBehavior(w http.ResponseWriter, r *http.Request) {
+	var b Behavior
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&b); err != nil {
+		http.Error(w, "Invalid behavior", http.StatusBadRequest)
+		return
+	}
+	if err := s.SetBehavior(b); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.infof("Behavior changed: %d%% data failures, %d%% drops, %v latency, %d recipient and %d sender rejections",
+		int(b.Faults.DataFailureRate*100), int(b.Faults.DropRate*100), b.Latency.Reply, len(b.RejectRecipients), len(b.RejectSenders))
+	s.handleGetBehavior(w, r)
+}
@@ -0,0 +1,97 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postBehavior(t *testing.T, url, body string) (*http.Response, Behavior) {
+	t.Helper()
+	resp, err := http.Post(url+"/api/v1/behavior", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to post behavior: %v", err)
+	}
+	defer resp.Body.Close()
+	var b Behavior
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
+			t.Fatalf("Failed to decode behavior: %v", err)
+		}
+	}
+	return resp, b
+}
+
+func TestBehaviorAPI(t *testing.T) {
+	server, addr := NewTestServer(t)
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+	msg := []byte("Subject: Hello\r\n\r\nBody\r\n")
+
+	resp, b := postBehavior(t, ts.URL, `{"reject_recipients": [{"pattern": "*", "reply": "554 5.7.1 Rejected"}], "latency": {"jitter": 1000}}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if len(b.RejectRecipients) != 1 || b.RejectRecipients[0].Reply != "554 5.7.1 Rejected" || b.Latency.Jitter != time.Microsecond {
+		t.Errorf("Expected the new behavior, got %+v", b)
+	}
+
+	err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, msg)
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != 554 {
+		t.Fatalf("Expected 554, got %v", err)
+	}
+
+	// Normal mode
+	if resp, _ := postBehavior(t, ts.URL, `{}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Errorf("Expected mail to be accepted again, got %v", err)
+	}
+
+	get, err := http.Get(ts.URL + "/api/v1/behavior")
+	if err != nil {
+		t.Fatalf("Failed to get behavior: %v", err)
+	}
+	defer get.Body.Close()
+	var current Behavior
+	if err := json.NewDecoder(get.Body).Decode(&current); err != nil {
+		t.Fatalf("Failed to decode behavior: %v", err)
+	}
+	if current.RejectRecipients != nil || current.Latency != (Latency{}) {
+		t.Errorf("Expected normal mode, got %+v", current)
+	}
+}
+
+func TestBehaviorInvalid(t *testing.T) {
+	server := New(0, 0)
+	reply, err := ParseReply("550 5.7.1 Sender blocked")
+	if err != nil {
+		t.Fatalf("Failed to parse reply: %v", err)
+	}
+	server.RejectSender("*@spam.example.com", reply)
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	for _, body := range []string{
+		`{"faults": {"drop_rate": 2}}`,
+		`{"latency": {"reply": -1}}`,
+		`{"reject_senders": [{"pattern": "*", "reply": "250 OK"}]}`,
+		`{"reject_senders": [{"pattern": "", "reply": "550"}]}`,
+		`not json`,
+	} {
+		if resp, _ := postBehavior(t, ts.URL, body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+	if b := server.Behavior(); len(b.RejectSenders) != 1 || b.RejectSenders[0].Reply != "550 5.7.1 Sender blocked" {
+		t.Errorf("Expected the behavior to be unchanged, got %+v", b)
+	}
+}
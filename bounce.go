@@ -0,0 +1,189 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+// defaultBounceReply is the failure reported for a bounced recipient when
+// the rule gives none.
+var defaultBounceReply = &smtp.SMTPError{
+	Code:         550,
+	EnhancedCode: smtp.EnhancedCode{5, 1, 1},
+	Message:      "The email account that you tried to reach does not exist",
+}
+
+// bounceRule makes matching recipients bounce with reply.
+type bounceRule struct {
+	pattern string
+	reply   *smtp.SMTPError
+}
+
+// BounceRecipient accepts mail to RCPT TO addresses matching the given
+// path.Match pattern (e.g. "bounce@*") and then, like an MTA failing
+// delivery later, captures a delivery status notification (RFC 3464)
+// addressed to the envelope sender. The DSN reports reply, or 550 5.1.1
+// if nil; a 4xx reply reports a delayed instead of a failed delivery.
+// Matching is case-insensitive.
+//
+// The DSN has an empty envelope sender, as required for bounces, and its
+// BounceOf names the original email. Because it is addressed to the
+// sender, POP3 and IMAP clients logged in as the sender fetch it, so a
+// bounce-processing pipeline can be tested end to end. Mail with an empty
+// envelope sender never bounces.
+func (s *Server) BounceRecipient(pattern string, reply *smtp.SMTPError) {
+	if reply == nil {
+		reply = defaultBounceReply
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bounceRules = append(s.bounceRules, bounceRule{pattern: strings.ToLower(pattern), reply: reply})
+}
+
+// bouncedRecipients returns the envelope recipients of email matching a
+// bounce rule, with the reply of the first matching rule.
+func (s *Server) bouncedRecipients(email Email) ([]string, []*smtp.SMTPError) {
+	s.mu.RLock()
+	rules := s.bounceRules
+	s.mu.RUnlock()
+	if len(rules) == 0 || email.Envelope.From == "" {
+		return nil, nil
+	}
+
+	var rcpts []string
+	var replies []*smtp.SMTPError
+	for _, rcpt := range email.Envelope.To {
+		addr := strings.ToLower(parseAddress(rcpt).Address)
+		for _, r := range rules {
+			if ok, _ := path.Match(r.pattern, addr); ok {
+				rcpts = append(rcpts, rcpt)
+				replies = append(replies, r.reply)
+				break
+			}
+		}
+	}
+	return rcpts, replies
+}
+
+// bounce captures a DSN for the recipients of email matching a bounce
+// rule.
+func (s *Server) bounce(email Email) {
+	rcpts, replies := s.bouncedRecipients(email)
+	if len(rcpts) == 0 {
+		return
+	}
+
+	msg, err := s.buildDSN(email, rcpts, replies)
+	if err != nil {
+		s.errorf("Failed to build bounce for %s: %v", email.ID, err)
+		return
+	}
+	dsn := newEmail("", []string{email.Envelope.From}, msg)
+	dsn.BounceOf = email.ID
+	if _, err := s.addMessage(dsn); err != nil {
+		s.errorf("Failed to store bounce for %s: %v", email.ID, err)
+	}
+}
+
+// buildDSN returns a multipart/report message reporting the delivery
+// failures of email to rcpts.
+func (s *Server) buildDSN(email Email, rcpts []string, replies []*smtp.SMTPError) ([]byte, error) {
+	domain := s.smtpServer.Domain
+	now := time.Now()
+
+	var body strings.Builder
+	mw := multipart.NewWriter(&body)
+
+	// Human-readable explanation
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	failed := false
+	fmt.Fprintf(part, "This is the mail system at host %s.\r\n\r\n", domain)
+	for i, rcpt := range rcpts {
+		if replies[i].Code >= 500 {
+			failed = true
+			fmt.Fprintf(part, "Your message could not be delivered to %s:\r\n", rcpt)
+		} else {
+			fmt.Fprintf(part, "Delivery of your message to %s has been delayed:\r\n", rcpt)
+		}
+		fmt.Fprintf(part, "    %s\r\n\r\n", replyLine(replies[i]))
+	}
+
+	// Machine-readable status
+	part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"message/delivery-status"}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(part, "Reporting-MTA: dns; %s\r\n", domain)
+	fmt.Fprintf(part, "Arrival-Date: %s\r\n", email.Time.Format(time.RFC1123Z))
+	for i, rcpt := range rcpts {
+		reply := replies[i]
+		action := "delayed"
+		if reply.Code >= 500 {
+			action = "failed"
+		}
+		fmt.Fprintf(part, "\r\nFinal-Recipient: rfc822; %s\r\n", parseAddress(rcpt).Address)
+		fmt.Fprintf(part, "Action: %s\r\n", action)
+		fmt.Fprintf(part, "Status: %s\r\n", replyStatus(reply))
+		fmt.Fprintf(part, "Diagnostic-Code: smtp; %s\r\n", replyLine(reply))
+	}
+
+	// The header of the original message
+	part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/rfc822-headers"}})
+	if err != nil {
+		return nil, err
+	}
+	header, _, _ := strings.Cut(string(crlf([]byte(email.Body))), "\r\n\r\n")
+	fmt.Fprintf(part, "%s\r\n", header)
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	subject := "Delayed Mail (still being retried)"
+	if failed {
+		subject = "Undelivered Mail Returned to Sender"
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: Mail Delivery System <MAILER-DAEMON@%s>\r\n", domain)
+	fmt.Fprintf(&msg, "To: %s\r\n", email.Envelope.From)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <bounce-%s-%d@%s>\r\n", email.ID, now.UnixNano(), domain)
+	if email.MessageID != "" {
+		fmt.Fprintf(&msg, "In-Reply-To: <%s>\r\n", email.MessageID)
+	}
+	msg.WriteString("Auto-Submitted: auto-replied\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/report; report-type=delivery-status; boundary=%q\r\n\r\n", mw.Boundary())
+	msg.WriteString(body.String())
+	return []byte(msg.String()), nil
+}
+
+// hasEnhancedCode reports whether reply carries its own enhanced code.
+func hasEnhancedCode(reply *smtp.SMTPError) bool {
+	return reply.EnhancedCode != smtp.NoEnhancedCode && reply.EnhancedCode != smtp.EnhancedCodeNotSet
+}
+
+// replyStatus returns the DSN status of reply, e.g. "5.1.1".
+func replyStatus(reply *smtp.SMTPError) string {
+	if !hasEnhancedCode(reply) {
+		return fmt.Sprintf("%d.0.0", reply.Code/100)
+	}
+	return fmt.Sprintf("%d.%d.%d", reply.EnhancedCode[0], reply.EnhancedCode[1], reply.EnhancedCode[2])
+}
+
+// replyLine formats reply as sent on the wire, e.g. "550 5.1.1 No such user".
+func replyLine(reply *smtp.SMTPError) string {
+	if !hasEnhancedCode(reply) {
+		return fmt.Sprintf("%d %s", reply.Code, reply.Message)
+	}
+	return fmt.Sprintf("%d %s %s", reply.Code, replyStatus(reply), reply.Message)
+}
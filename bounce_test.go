@@ -0,0 +1,80 @@
+package mailcatcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-smtp"
+)
+
+func TestBounceRecipient(t *testing.T) {
+	server := New(0, 0)
+	server.BounceRecipient("bounce@*", nil)
+
+	msg := []byte("Subject: Hello\r\nMessage-ID: <1@app.example.com>\r\n\r\nBody\r\n")
+	if err := server.Send("app@example.com", []string{"bounce@example.com", "user@example.com"}, msg); err != nil {
+		t.Fatalf("Expected the message to be accepted, got %v", err)
+	}
+
+	emails := server.Emails()
+	if len(emails) != 2 {
+		t.Fatalf("Expected the message and its bounce, got %d emails", len(emails))
+	}
+	dsn := emails[1]
+	if dsn.BounceOf != "msg-0" || dsn.Envelope.From != "" || !dsn.HasRecipient("app@example.com") {
+		t.Errorf("Expected a bounce of msg-0 to the sender, got %+v", dsn)
+	}
+	if dsn.Subject != "Undelivered Mail Returned to Sender" || dsn.Header("In-Reply-To") != "<1@app.example.com>" {
+		t.Errorf("Unexpected bounce header %v", dsn.Headers)
+	}
+
+	var status, headers string
+	for _, p := range dsn.Parts {
+		switch p.ContentType {
+		case "message/delivery-status":
+			status = string(p.Content)
+		case "text/rfc822-headers":
+			headers = string(p.Content)
+		}
+	}
+	for _, want := range []string{"Final-Recipient: rfc822; bounce@example.com", "Action: failed", "Status: 5.1.1", "Diagnostic-Code: smtp; 550 5.1.1 "} {
+		if !strings.Contains(status, want) {
+			t.Errorf("Expected %q in the delivery status, got %q", want, status)
+		}
+	}
+	if strings.Contains(status, "user@example.com") {
+		t.Errorf("Expected only the bounced recipient, got %q", status)
+	}
+	if !strings.Contains(headers, "Subject: Hello") {
+		t.Errorf("Expected the original header, got %q", headers)
+	}
+
+	if mailbox, err := server.mailbox("app@example.com"); err != nil || len(mailbox) != 1 || mailbox[0].BounceOf != "msg-0" {
+		t.Errorf("Expected the sender's mailbox to hold the bounce, got %v, %v", mailbox, err)
+	}
+}
+
+func TestBounceDelayed(t *testing.T) {
+	server := New(0, 0)
+	server.BounceRecipient("*@slow.example.com", &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 4, 1}, Message: "Try later"})
+
+	if err := server.Send("app@example.com", []string{"user@slow.example.com"}, []byte("Subject: Hi\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	emails := server.Find(Filter{To: "app@example.com"})
+	if len(emails) != 1 || !strings.HasPrefix(emails[0].Subject, "Delayed Mail") || !strings.Contains(emails[0].Body, "Action: delayed") {
+		t.Fatalf("Expected a delay notification, got %v", emails)
+	}
+}
+
+func TestBounceNullSender(t *testing.T) {
+	server := New(0, 0)
+	server.BounceRecipient("bounce@*", nil)
+
+	if err := server.Send("", []string{"bounce@example.com"}, []byte("Subject: Hi\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if n := len(server.Emails()); n != 1 {
+		t.Errorf("Expected no bounce for a null sender, got %d emails", n)
+	}
+}
@@ -0,0 +1,118 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Capture modes, see Capture.
+const (
+	CaptureFull    = "full"
+	CaptureHeaders = "headers"
+	CaptureCount   = "count"
+)
+
+// Capture decides how much of each message is kept, so memory stays flat
+// when a performance test pushes millions of messages through the server.
+// Messages are always parsed first: the metadata of a message, such as
+// its addresses, subject and attachment names, is kept in every mode but
+// CaptureCount.
+type Capture struct {
+	// Mode is CaptureFull (the default) to keep whole messages,
+	// CaptureHeaders to keep only the header, or CaptureCount to store
+	// nothing and only count messages in Stats.
+	Mode string `json:"mode,omitempty"`
+
+	// MaxBodyBytes truncates the raw message and the text and HTML bodies
+	// to this many bytes each, and drops the content of MIME parts and
+	// attachments of larger messages. 0 keeps everything.
+	MaxBodyBytes int `json:"max_body_bytes,omitempty"`
+}
+
+// captureState counts the messages not stored in CaptureCount mode.
+type captureState struct {
+	counted      atomic.Int64
+	countedBytes atomic.Int64
+}
+
+// SetCapture sets how much of each captured message is kept.
+func (s *Server) SetCapture(c Capture) error {
+	switch c.Mode {
+	case "", CaptureFull, CaptureHeaders, CaptureCount:
+	default:
+		return fmt.Errorf("invalid capture mode %q: expected %s, %s or %s", c.Mode, CaptureFull, CaptureHeaders, CaptureCount)
+	}
+	if c.MaxBodyBytes < 0 {
+		return fmt.Errorf("invalid capture body limit %d: must not be negative", c.MaxBodyBytes)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capture = c
+	return nil
+}
+
+// applyCapture cuts email down as set by SetCapture. It reports false if
+// the email is only counted and must not be stored.
+func (s *Server) applyCapture(email *Email) bool {
+	s.mu.RLock()
+	c := s.capture
+	s.mu.RUnlock()
+
+	switch {
+	case c.Mode == CaptureCount:
+		s.captured.counted.Add(1)
+		s.captured.countedBytes.Add(email.Size)
+		return false
+	case c.Mode == CaptureHeaders:
+		email.Body = strings.Clone(email.Body[:headerEnd(email.Body)])
+		email.Text, email.HTML = "", ""
+		email.Parts = nil
+		dropContent(email.Attachments)
+		email.Truncated = true
+	case c.MaxBodyBytes > 0 && len(email.Body) > c.MaxBodyBytes:
+		// Clone, so the full message can be garbage collected
+		email.Body = strings.Clone(truncate(email.Body, c.MaxBodyBytes))
+		email.Text = strings.Clone(truncate(email.Text, c.MaxBodyBytes))
+		email.HTML = strings.Clone(truncate(email.HTML, c.MaxBodyBytes))
+		for i := range email.Parts {
+			email.Parts[i].Content = nil
+		}
+		dropContent(email.Attachments)
+		email.Truncated = true
+	}
+	return true
+}
+
+// headerEnd returns the length of the header of a raw message, including
+// the blank line ending it.
+func headerEnd(raw string) int {
+	crlf := strings.Index(raw, "\r\n\r\n")
+	lf := strings.Index(raw, "\n\n")
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf < lf):
+		return crlf + 4
+	case lf >= 0:
+		return lf + 2
+	}
+	return len(raw)
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func dropContent(attachments []Attachment) {
+	for i := range attachments {
+		attachments[i].Content = nil
+	}
+}
@@ -0,0 +1,94 @@
+package mailcatcher
+
+import (
+	"strings"
+	"testing"
+)
+
+const captureMessage = "From: app@example.com\r\nTo: user@example.com\r\nSubject: Report\r\n" +
+	"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+	"--b\r\nContent-Type: text/plain\r\n\r\nHéllo world\r\n" +
+	"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=report.pdf\r\n\r\nPDFDATA\r\n--b--\r\n"
+
+func TestCaptureHeaders(t *testing.T) {
+	server := New(0, 0)
+	if err := server.SetCapture(Capture{Mode: CaptureHeaders}); err != nil {
+		t.Fatalf("Failed to set capture mode: %v", err)
+	}
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte(captureMessage)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	email := server.Emails()[0]
+	if !strings.HasSuffix(email.Body, "boundary=b\r\n\r\n") || strings.Contains(email.Body, "world") {
+		t.Errorf("Expected only the header to be kept, got %q", email.Body)
+	}
+	if email.Subject != "Report" || email.Text != "" || len(email.Parts) != 0 {
+		t.Errorf("Expected metadata without bodies, got %+v", email)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0].Filename != "report.pdf" || email.Attachments[0].Content != nil {
+		t.Errorf("Expected the attachment without content, got %+v", email.Attachments)
+	}
+	if !email.Truncated || email.Size != int64(len(captureMessage)) {
+		t.Errorf("Expected a truncated email of %d bytes, got %v and %d", len(captureMessage), email.Truncated, email.Size)
+	}
+}
+
+func TestCaptureMaxBodyBytes(t *testing.T) {
+	server := New(0, 0)
+	if err := server.SetCapture(Capture{MaxBodyBytes: 2}); err != nil {
+		t.Fatalf("Failed to set capture mode: %v", err)
+	}
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte(captureMessage)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	email := server.Emails()[0]
+	if email.Body != "Fr" || email.Text != "H" {
+		t.Errorf("Expected body %q and text %q, got %q and %q", "Fr", "H", email.Body, email.Text)
+	}
+	if email.Parts[0].Content != nil || email.Attachments[0].Content != nil || !email.Truncated {
+		t.Errorf("Expected contents to be dropped, got %+v", email)
+	}
+
+	// Smaller messages are kept whole
+	if err := server.SetCapture(Capture{MaxBodyBytes: 1 << 20}); err != nil {
+		t.Fatalf("Failed to set capture mode: %v", err)
+	}
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte(captureMessage)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if email := server.Emails()[1]; email.Body != captureMessage || email.Truncated {
+		t.Errorf("Expected the message to be kept whole, got %q", email.Body)
+	}
+}
+
+func TestCaptureCount(t *testing.T) {
+	server := New(0, 0)
+	if err := server.SetCapture(Capture{Mode: CaptureCount}); err != nil {
+		t.Fatalf("Failed to set capture mode: %v", err)
+	}
+	for range 3 {
+		if err := server.Send("app@example.com", []string{"user@example.com"}, []byte(captureMessage)); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	if n := len(server.Emails()); n != 0 {
+		t.Errorf("Expected no stored emails, got %d", n)
+	}
+	stats := server.Stats()
+	if stats.Counted != 3 || stats.CountedBytes != 3*int64(len(captureMessage)) {
+		t.Errorf("Expected 3 counted messages of %d bytes, got %d and %d", len(captureMessage), stats.Counted, stats.CountedBytes)
+	}
+}
+
+func TestSetCaptureInvalid(t *testing.T) {
+	server := New(0, 0)
+	if err := server.SetCapture(Capture{Mode: "bodies"}); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+	if err := server.SetCapture(Capture{MaxBodyBytes: -1}); err == nil {
+		t.Error("Expected an error for a negative limit")
+	}
+}
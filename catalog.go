@@ -0,0 +1,211 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Reply kinds available in the provider catalog.
+const (
+	ReplyUnknownUser       = "unknown-user"
+	ReplyMailboxFull       = "mailbox-full"
+	ReplyMessageTooLarge   = "message-too-large"
+	ReplyTooManyRecipients = "too-many-recipients"
+	ReplyPolicyBlocked     = "policy-blocked"
+	ReplyUnauthenticated   = "unauthenticated"
+	ReplyRateLimited       = "rate-limited"
+	ReplyGreylisted        = "greylisted"
+	ReplyBlockedContent    = "blocked-content"
+)
+
+// Providers in the catalog.
+const (
+	ProviderGeneric   = "generic"
+	ProviderGmail     = "gmail"
+	ProviderOffice365 = "office365"
+	ProviderYahoo     = "yahoo"
+)
+
+func reply(code int, enhanced smtp.EnhancedCode, message string) smtp.SMTPError {
+	return smtp.SMTPError{Code: code, EnhancedCode: enhanced, Message: message}
+}
+
+// catalog holds real-world reply texts as sent by each provider, so error
+// classification logic can be tested against the strings it will see.
+var catalog = map[string]map[string]smtp.SMTPError{
+	ProviderGeneric: {
+		ReplyUnknownUser:       reply(550, smtp.EnhancedCode{5, 1, 1}, "User unknown"),
+		ReplyMailboxFull:       reply(452, smtp.EnhancedCode{4, 2, 2}, "Mailbox full"),
+		ReplyMessageTooLarge:   reply(552, smtp.EnhancedCode{5, 3, 4}, "Message too big for system"),
+		ReplyTooManyRecipients: reply(452, smtp.EnhancedCode{4, 5, 3}, "Too many recipients"),
+		ReplyPolicyBlocked:     reply(550, smtp.EnhancedCode{5, 7, 1}, "Delivery not authorized, message refused"),
+		ReplyUnauthenticated:   reply(550, smtp.EnhancedCode{5, 7, 26}, "Multiple authentication checks failed"),
+		ReplyRateLimited:       reply(421, smtp.EnhancedCode{4, 7, 0}, "Too many messages, slow down"),
+		ReplyGreylisted:        reply(451, smtp.EnhancedCode{4, 7, 1}, "Greylisted, please try again later"),
+		ReplyBlockedContent:    reply(552, smtp.EnhancedCode{5, 7, 0}, "Message content rejected"),
+	},
+	ProviderGmail: {
+		ReplyUnknownUser: reply(550, smtp.EnhancedCode{5, 1, 1},
+			"The email account that you tried to reach does not exist. Please try double-checking the recipient's email address for typos or unnecessary spaces. For more information, go to https://support.google.com/mail/?p=NoSuchUser"),
+		ReplyMailboxFull: reply(452, smtp.EnhancedCode{4, 2, 2},
+			"The recipient's inbox is out of storage space. Please direct the recipient to https://support.google.com/mail/?p=OverQuotaTemp"),
+		ReplyMessageTooLarge: reply(552, smtp.EnhancedCode{5, 3, 4},
+			"Your message exceeded Google's message size limits. Please visit https://support.google.com/mail/?p=MaxSizeError to view our size guidelines."),
+		ReplyTooManyRecipients: reply(452, smtp.EnhancedCode{4, 5, 3},
+			"Your message has too many recipients. For more information regarding Google's sending limits, visit https://support.google.com/mail/?p=TooManyRecipientsError"),
+		ReplyPolicyBlocked: reply(550, smtp.EnhancedCode{5, 7, 1},
+			"Our system has detected that this message is likely unsolicited mail. To reduce the amount of spam sent to Gmail, this message has been blocked. For more information, go to https://support.google.com/mail/?p=UnsolicitedMessageError"),
+		ReplyUnauthenticated: reply(550, smtp.EnhancedCode{5, 7, 26},
+			"This mail has been blocked because the sender is unauthenticated. Gmail requires all senders to authenticate with either SPF or DKIM. For more information, go to https://support.google.com/mail/answer/81126#authentication"),
+		ReplyRateLimited: reply(421, smtp.EnhancedCode{4, 7, 28},
+			"Our system has detected an unusual rate of unsolicited mail originating from your IP address. To protect our users from spam, mail sent from your IP address has been temporarily rate limited. For more information, go to https://support.google.com/mail/?p=UnsolicitedRateLimitError"),
+		ReplyGreylisted: reply(450, smtp.EnhancedCode{4, 2, 1},
+			"The user you are trying to contact is receiving mail at a rate that prevents additional messages from being delivered. Please resend your message at a later time. For more information, go to https://support.google.com/mail/?p=ReceivingRatePerm"),
+		ReplyBlockedContent: reply(552, smtp.EnhancedCode{5, 7, 0},
+			"This message was blocked because its content presents a potential security issue. To review our message content and attachment content guidelines, go to https://support.google.com/mail/?p=BlockedMessage"),
+	},
+	ProviderOffice365: {
+		ReplyUnknownUser: reply(550, smtp.EnhancedCode{5, 1, 10},
+			"RESOLVER.ADR.RecipientNotFound; Recipient not found by SMTP address lookup"),
+		ReplyMailboxFull: reply(452, smtp.EnhancedCode{4, 2, 2},
+			"The recipient's mailbox is full and can't accept messages now. Please try resending this message later, or contact the recipient directly."),
+		ReplyMessageTooLarge: reply(552, smtp.EnhancedCode{5, 3, 4},
+			"Message size exceeds fixed maximum message size"),
+		ReplyTooManyRecipients: reply(452, smtp.EnhancedCode{4, 5, 3},
+			"Too many recipients"),
+		ReplyPolicyBlocked: reply(550, smtp.EnhancedCode{5, 7, 606},
+			"Access denied, banned sending IP [192.0.2.1]. To request removal from this list please visit https://sender.office.com/ and follow the directions."),
+		ReplyUnauthenticated: reply(550, smtp.EnhancedCode{5, 7, 515},
+			"Access denied, sending domain example.com doesn't meet the required authentication level."),
+		ReplyRateLimited: reply(451, smtp.EnhancedCode{4, 7, 500},
+			"Server busy. Please try again later from [192.0.2.1]. (S77714)"),
+		ReplyGreylisted: reply(451, smtp.EnhancedCode{4, 7, 650},
+			"The mail server [192.0.2.1] has been temporarily rate limited due to IP reputation."),
+		ReplyBlockedContent: reply(550, smtp.EnhancedCode{5, 7, 1},
+			"Message rejected due to content restrictions. The attachment type is not allowed."),
+	},
+	ProviderYahoo: {
+		ReplyUnknownUser: reply(554, smtp.EnhancedCode{5, 7, 1},
+			"Sorry, I couldn't find a mail exchanger or IP address."),
+		ReplyMailboxFull: reply(552, smtp.EnhancedCode{5, 2, 2},
+			"Requested mail action aborted, mailbox over quota"),
+		ReplyMessageTooLarge: reply(552, smtp.EnhancedCode{5, 3, 4},
+			"Message size exceeds fixed limit"),
+		ReplyPolicyBlocked: reply(554, smtp.EnhancedCode{5, 7, 9},
+			"Message not accepted for policy reasons. See https://postmaster.yahooinc.com/error-codes"),
+		ReplyUnauthenticated: reply(550, smtp.EnhancedCode{5, 7, 9},
+			"This mail has been blocked because the sender is unauthenticated. Yahoo requires all senders to authenticate with either SPF or DKIM."),
+		ReplyRateLimited: reply(421, smtp.EnhancedCode{4, 7, 0},
+			"[TSS04] Messages from 192.0.2.1 temporarily deferred due to unexpected volume or user complaints - 4.16.55.1; see https://postmaster.yahooinc.com/error-codes"),
+		ReplyGreylisted: reply(451, smtp.EnhancedCode{4, 7, 1},
+			"[TS01] Messages from 192.0.2.1 temporarily deferred due to user complaints - 4.16.55.1; see https://postmaster.yahooinc.com/error-codes"),
+		ReplyBlockedContent: reply(554, smtp.EnhancedCode{5, 7, 9},
+			"Message not accepted for policy reasons. See https://postmaster.yahooinc.com/error-codes"),
+	},
+}
+
+// ProviderReply returns the reply a provider gives for a kind of rejection,
+// e.g. ProviderReply(ProviderGmail, ReplyPolicyBlocked). The returned
+// error may be modified by the caller.
+func ProviderReply(provider, kind string) (*smtp.SMTPError, error) {
+	replies, ok := catalog[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q (available: %v)", provider, Providers())
+	}
+	r, ok := replies[kind]
+	if !ok {
+		return nil, fmt.Errorf("provider %s has no %q reply", provider, kind)
+	}
+	return &r, nil
+}
+
+// ParseProviderReply parses a "provider:kind" reference such as
+// "office365:rate-limited".
+func ParseProviderReply(ref string) (*smtp.SMTPError, error) {
+	provider, kind, ok := strings.Cut(ref, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid reply %q, expected provider:kind", ref)
+	}
+	return ProviderReply(provider, kind)
+}
+
+// Providers returns the names of the providers in the catalog.
+func Providers() []string {
+	names := make([]string, 0, len(catalog))
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mustProviderReply is used to build the built-in profiles.
+func mustProviderReply(provider, kind string) *smtp.SMTPError {
+	r, err := ProviderReply(provider, kind)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// addressRejection refuses addresses matching a pattern.
+type addressRejection struct {
+	pattern string
+	reply   *smtp.SMTPError
+}
+
+// RejectRecipient refuses RCPT TO addresses matching the given
+// path.Match pattern (e.g. "*@blocked.example.com") with reply, typically
+// taken from ProviderReply. Matching is case-insensitive. A rule with a nil
+// reply accepts the addresses it matches.
+func (s *Server) RejectRecipient(pattern string, reply *smtp.SMTPError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recipientRejections = append(s.recipientRejections, addressRejection{
+		pattern: strings.ToLower(pattern),
+		reply:   reply,
+	})
+}
+
+// RejectSender refuses MAIL FROM addresses matching the given path.Match
+// pattern with reply, like RejectRecipient.
+func (s *Server) RejectSender(pattern string, reply *smtp.SMTPError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.senderRejections = append(s.senderRejections, addressRejection{
+		pattern: strings.ToLower(pattern),
+		reply:   reply,
+	})
+}
+
+// checkRejections returns the reply of the first rule matching rcpt.
+func (s *Server) checkRejections(rcpt string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return matchRejection(s.recipientRejections, rcpt)
+}
+
+// checkSenderRejections returns the reply of the first rule matching from.
+func (s *Server) checkSenderRejections(from string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return matchRejection(s.senderRejections, from)
+}
+
+func matchRejection(rules []addressRejection, addr string) error {
+	addr = strings.ToLower(parseAddress(addr).Address)
+	for _, r := range rules {
+		if ok, _ := path.Match(r.pattern, addr); ok {
+			if r.reply == nil {
+				// A nil *SMTPError would be a non-nil error.
+				return nil
+			}
+			return r.reply
+		}
+	}
+	return nil
+}
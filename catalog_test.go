@@ -0,0 +1,91 @@
+package mailcatcher
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProviderReply(t *testing.T) {
+	reply, err := ProviderReply(ProviderGmail, ReplyPolicyBlocked)
+	if err != nil {
+		t.Fatalf("Failed to look up reply: %v", err)
+	}
+	if reply.Code != 550 || reply.EnhancedCode != [3]int{5, 7, 1} {
+		t.Errorf("Expected Gmail 550 5.7.1, got %d %v", reply.Code, reply.EnhancedCode)
+	}
+
+	// Modifying a returned reply must not change the catalog
+	reply.Message = "changed"
+	if again, _ := ProviderReply(ProviderGmail, ReplyPolicyBlocked); again.Message == "changed" {
+		t.Error("Expected catalog to be unaffected by changes to a returned reply")
+	}
+
+	reply, err = ParseProviderReply("office365:rate-limited")
+	if err != nil {
+		t.Fatalf("Failed to parse reply: %v", err)
+	}
+	if reply.Code != 451 || !strings.Contains(reply.Message, "Server busy") {
+		t.Errorf("Expected Office365 throttling reply, got %d %s", reply.Code, reply.Message)
+	}
+
+	// The office365-like profile keeps its temporary mailbox-full reply
+	reply, _ = ProviderReply(ProviderOffice365, ReplyMailboxFull)
+	if reply.Code != 452 || reply.EnhancedCode != [3]int{4, 2, 2} {
+		t.Errorf("Expected Office365 452 4.2.2, got %d %v", reply.Code, reply.EnhancedCode)
+	}
+
+	for _, ref := range []string{"gmail", "unknown:policy-blocked", "gmail:unknown"} {
+		if _, err := ParseProviderReply(ref); err == nil {
+			t.Errorf("Expected error for %q", ref)
+		}
+	}
+}
+
+func TestRejectRecipient(t *testing.T) {
+	reply, _ := ProviderReply(ProviderGmail, ReplyPolicyBlocked)
+
+	server := New(10045, 10100)
+	server.RejectRecipient("*@Blocked.example.com", reply)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	msg := []byte("Subject: Hello\r\n\r\nBody\r\n")
+	err := smtp.SendMail("localhost:10045", nil, "sender@example.com", []string{"user@blocked.example.com"}, msg)
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != 550 {
+		t.Fatalf("Expected 550 rejection, got %v", err)
+	}
+	if !strings.Contains(tpErr.Msg, "5.7.1") || !strings.Contains(tpErr.Msg, "UnsolicitedMessageError") {
+		t.Errorf("Expected Gmail reply text, got %q", tpErr.Msg)
+	}
+
+	if err := smtp.SendMail("localhost:10045", nil, "sender@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Expected other recipients to be accepted, got %v", err)
+	}
+	if emails := server.Emails(); len(emails) != 1 {
+		t.Errorf("Expected 1 email, got %d", len(emails))
+	}
+}
+
+func TestRejectNilReply(t *testing.T) {
+	server, _ := NewTestServer(t)
+	server.RejectSender("*@example.com", nil)
+
+	msg := []byte("Subject: Hello\r\n\r\nBody\r\n")
+	if err := server.Send("sender@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Expected a rule without reply to accept, got %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package mailcatcher
+
+import (
+	"context"
+)
+
+// Catcher is the API for inspecting captured mail that an in-process
+// Server and a client.Remote share, so the same tests run against the
+// library and against mailcatcher in a container:
+//
+//	var catcher mailcatcher.Catcher
+//	if url := os.Getenv("MAILCATCHER_URL"); url != "" {
+//	    catcher = client.Connect(url)
+//	} else {
+//	    catcher, _ = mailcatcher.NewTestServer(t)
+//	}
+type Catcher interface {
+	Emails() []Email
+	Email(id string) *Email
+	Clear()
+	WaitFor(ctx context.Context, match func(Email) bool) (Email, error)
+}
+
+var _ Catcher = (*Server)(nil)
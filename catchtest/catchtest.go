@@ -0,0 +1,295 @@
+// Package catchtest provides test assertions for captured email, replacing
+// hand-written find-and-compare loops:
+//
+//	email, ok := catchtest.AssertReceived(t, server,
+//	    catchtest.To("user@example.com"),
+//	    catchtest.SubjectContains("Welcome"),
+//	)
+//	if ok {
+//	    catchtest.AssertBodyMatches(t, email, regexp.MustCompile(`code: \d{6}`))
+//	}
+//
+// When no email matches, the failure lists every captured email with the
+// reason it did not match.
+package catchtest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andmetoo/mailcatcher"
+)
+
+// maxExcerpt is the length of body excerpts shown in failures.
+const maxExcerpt = 200
+
+// Mailbox is a source of captured email, such as *mailcatcher.Server.
+type Mailbox interface {
+	Emails() []mailcatcher.Email
+}
+
+// Matcher selects emails and explains mismatches.
+type Matcher struct {
+	description string
+	mismatch    func(mailcatcher.Email) string // "" if the email matches
+}
+
+// Match returns a Matcher for a custom condition, described by
+// description in failures.
+func Match(description string, match func(mailcatcher.Email) bool) Matcher {
+	return Matcher{description: description, mismatch: func(e mailcatcher.Email) string {
+		if match(e) {
+			return ""
+		}
+		return "does not match " + description
+	}}
+}
+
+// Matches reports whether email matches.
+func (m Matcher) Matches(email mailcatcher.Email) bool {
+	return m.mismatch(email) == ""
+}
+
+// String describes what the matcher looks for.
+func (m Matcher) String() string {
+	return m.description
+}
+
+// To matches emails with addr as a To, Cc or envelope recipient, see
+// Email.HasRecipient.
+func To(addr string) Matcher {
+	return Matcher{description: "to " + addr, mismatch: func(e mailcatcher.Email) string {
+		if e.HasRecipient(addr) {
+			return ""
+		}
+		return fmt.Sprintf("recipients %s do not include %s", recipients(e), addr)
+	}}
+}
+
+// From matches emails sent from addr.
+func From(addr string) Matcher {
+	return Matcher{description: "from " + addr, mismatch: func(e mailcatcher.Email) string {
+		if e.From.Matches(addr) {
+			return ""
+		}
+		return fmt.Sprintf("sender %s is not %s", e.From, addr)
+	}}
+}
+
+// Subject matches emails with exactly the given subject.
+func Subject(subject string) Matcher {
+	return Matcher{description: fmt.Sprintf("subject %q", subject), mismatch: func(e mailcatcher.Email) string {
+		if e.Subject == subject {
+			return ""
+		}
+		return fmt.Sprintf("subject %q is not %q", e.Subject, subject)
+	}}
+}
+
+// SubjectContains matches emails whose subject contains substr, ignoring
+// case.
+func SubjectContains(substr string) Matcher {
+	return Matcher{description: fmt.Sprintf("subject containing %q", substr), mismatch: func(e mailcatcher.Email) string {
+		if strings.Contains(strings.ToLower(e.Subject), strings.ToLower(substr)) {
+			return ""
+		}
+		return fmt.Sprintf("subject %q does not contain %q", e.Subject, substr)
+	}}
+}
+
+// BodyMatches matches emails whose body matches re. The decoded text body
+// is used, or the HTML body for HTML-only messages.
+func BodyMatches(re *regexp.Regexp) Matcher {
+	return Matcher{description: fmt.Sprintf("body matching %s", re), mismatch: func(e mailcatcher.Email) string {
+		if re.MatchString(body(e)) {
+			return ""
+		}
+		return fmt.Sprintf("body %s does not match %s", excerpt(body(e)), re)
+	}}
+}
+
+// Header matches emails whose named header has the given value.
+func Header(name, value string) Matcher {
+	return Matcher{description: fmt.Sprintf("%s: %s", name, value), mismatch: func(e mailcatcher.Email) string {
+		if got := e.Header(name); got != value {
+			return fmt.Sprintf("header %s is %q, not %q", name, got, value)
+		}
+		return ""
+	}}
+}
+
+// AssertReceived reports a test failure unless a captured email matches
+// all matchers, and returns the first one that does.
+func AssertReceived(t testing.TB, mailbox Mailbox, matchers ...Matcher) (mailcatcher.Email, bool) {
+	t.Helper()
+	emails := mailbox.Emails()
+	for _, email := range emails {
+		if matchAll(email, matchers) {
+			return email, true
+		}
+	}
+	t.Errorf("No email %s\n%s", describe(matchers), report(emails, matchers))
+	return mailcatcher.Email{}, false
+}
+
+// AssertNotReceived reports a test failure if a captured email matches all
+// matchers.
+func AssertNotReceived(t testing.TB, mailbox Mailbox, matchers ...Matcher) {
+	t.Helper()
+	for _, email := range mailbox.Emails() {
+		if matchAll(email, matchers) {
+			t.Errorf("Expected no email %s, got %s", describe(matchers), summary(email))
+			return
+		}
+	}
+}
+
+// AssertCount reports a test failure unless exactly n captured emails
+// match all matchers.
+func AssertCount(t testing.TB, mailbox Mailbox, n int, matchers ...Matcher) {
+	t.Helper()
+	emails := mailbox.Emails()
+	var count int
+	for _, email := range emails {
+		if matchAll(email, matchers) {
+			count++
+		}
+	}
+	if count != n {
+		t.Errorf("Expected %d emails %s, got %d\n%s", n, describe(matchers), count, report(emails, matchers))
+	}
+}
+
+// AssertNoDuplicates reports a test failure for each captured email with
+// the same Email.Hash as an earlier one, e.g. delivered again by a
+// retrying sender.
+func AssertNoDuplicates(t testing.TB, mailbox Mailbox) {
+	t.Helper()
+	first := map[string]mailcatcher.Email{}
+	for _, email := range mailbox.Emails() {
+		if email.Hash == "" {
+			continue
+		}
+		if original, ok := first[email.Hash]; ok {
+			t.Errorf("Expected no duplicate emails, got %s, a duplicate of %s", summary(email), original.ID)
+			continue
+		}
+		first[email.Hash] = email
+	}
+}
+
+// AwaitReceived is AssertReceived for mail sent asynchronously: it waits
+// up to timeout for a matching email to arrive at server.
+func AwaitReceived(t testing.TB, server *mailcatcher.Server, timeout time.Duration, matchers ...Matcher) (mailcatcher.Email, bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	email, err := server.WaitFor(ctx, func(e mailcatcher.Email) bool { return matchAll(e, matchers) })
+	if err != nil {
+		t.Errorf("No email %s within %v\n%s", describe(matchers), timeout, report(server.Emails(), matchers))
+		return mailcatcher.Email{}, false
+	}
+	return email, true
+}
+
+// AssertSubjectContains reports a test failure unless the subject of
+// email contains substr, ignoring case.
+func AssertSubjectContains(t testing.TB, email mailcatcher.Email, substr string) {
+	t.Helper()
+	assert(t, email, SubjectContains(substr))
+}
+
+// AssertRecipient reports a test failure unless addr is a To, Cc or
+// envelope recipient of email.
+func AssertRecipient(t testing.TB, email mailcatcher.Email, addr string) {
+	t.Helper()
+	assert(t, email, To(addr))
+}
+
+// AssertBodyMatches reports a test failure unless the body of email
+// matches re, see BodyMatches.
+func AssertBodyMatches(t testing.TB, email mailcatcher.Email, re *regexp.Regexp) {
+	t.Helper()
+	assert(t, email, BodyMatches(re))
+}
+
+func assert(t testing.TB, email mailcatcher.Email, m Matcher) {
+	t.Helper()
+	if reason := m.mismatch(email); reason != "" {
+		t.Errorf("Email %s: %s", email.ID, reason)
+	}
+}
+
+func matchAll(email mailcatcher.Email, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(email) {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(matchers []Matcher) string {
+	if len(matchers) == 0 {
+		return "at all"
+	}
+	descriptions := make([]string, len(matchers))
+	for i, m := range matchers {
+		descriptions[i] = m.String()
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// report lists the captured emails with the reasons they did not match.
+func report(emails []mailcatcher.Email, matchers []Matcher) string {
+	if len(emails) == 0 {
+		return "No emails were captured"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Captured %d emails:", len(emails))
+	for _, email := range emails {
+		fmt.Fprintf(&b, "\n  %s", summary(email))
+		for _, m := range matchers {
+			if reason := m.mismatch(email); reason != "" {
+				fmt.Fprintf(&b, "\n    - %s", reason)
+			}
+		}
+	}
+	return b.String()
+}
+
+func summary(email mailcatcher.Email) string {
+	return fmt.Sprintf("%s from %s to %s, subject %q", email.ID, email.From, recipients(email), email.Subject)
+}
+
+func recipients(email mailcatcher.Email) string {
+	var addrs []string
+	for _, a := range append(append([]mailcatcher.Address{}, email.To...), email.Cc...) {
+		addrs = append(addrs, a.Address)
+	}
+	for _, to := range email.Envelope.To {
+		if !slices.Contains(addrs, to) {
+			addrs = append(addrs, to)
+		}
+	}
+	return "[" + strings.Join(addrs, ", ") + "]"
+}
+
+func body(email mailcatcher.Email) string {
+	if email.Text != "" {
+		return email.Text
+	}
+	return email.HTML
+}
+
+func excerpt(s string) string {
+	if len(s) > maxExcerpt {
+		return fmt.Sprintf("%q...", s[:maxExcerpt])
+	}
+	return fmt.Sprintf("%q", s)
+}
@@ -0,0 +1,113 @@
+package catchtest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andmetoo/mailcatcher"
+)
+
+// recorder captures the failures reported by an assertion.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func newServer(t *testing.T) *mailcatcher.Server {
+	t.Helper()
+	server := mailcatcher.New(0, 0)
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("From: app@example.com\r\nTo: user@example.com\r\nSubject: Welcome aboard\r\n\r\nYour code: 123456\r\n"))
+	server.Send("app@example.com", []string{"other@example.com"}, []byte("From: app@example.com\r\nTo: other@example.com\r\nSubject: Invoice\r\n\r\nTotal: 10 EUR\r\n"))
+	return server
+}
+
+func TestAssertReceived(t *testing.T) {
+	server := newServer(t)
+
+	email, ok := AssertReceived(t, server, To("user@example.com"), SubjectContains("welcome"))
+	if !ok || email.Subject != "Welcome aboard" {
+		t.Fatalf("Expected the welcome email, got %q", email.Subject)
+	}
+	AssertSubjectContains(t, email, "aboard")
+	AssertRecipient(t, email, "user@example.com")
+	AssertBodyMatches(t, email, regexp.MustCompile(`code: \d{6}`))
+	AssertCount(t, server, 2, From("app@example.com"))
+	AssertNotReceived(t, server, To("nobody@example.com"))
+}
+
+func TestAssertReceivedFailure(t *testing.T) {
+	server := newServer(t)
+	r := &recorder{}
+
+	if _, ok := AssertReceived(r, server, To("user@example.com"), SubjectContains("invoice")); ok {
+		t.Fatal("Expected no match")
+	}
+	if len(r.failures) != 1 {
+		t.Fatalf("Expected 1 failure, got %d", len(r.failures))
+	}
+	failure := r.failures[0]
+	for _, want := range []string{
+		`No email to user@example.com, subject containing "invoice"`,
+		"Captured 2 emails:",
+		`subject "Welcome aboard" does not contain "invoice"`,
+		"recipients [other@example.com] do not include user@example.com",
+	} {
+		if !strings.Contains(failure, want) {
+			t.Errorf("Expected failure to contain %q, got:\n%s", want, failure)
+		}
+	}
+}
+
+func TestEmailAssertionFailures(t *testing.T) {
+	email := newServer(t).Emails()[0]
+	r := &recorder{}
+
+	AssertSubjectContains(r, email, "invoice")
+	AssertRecipient(r, email, "other@example.com")
+	AssertBodyMatches(r, email, regexp.MustCompile(`EUR`))
+	if len(r.failures) != 3 {
+		t.Fatalf("Expected 3 failures, got %d: %q", len(r.failures), r.failures)
+	}
+	if want := `body "Your code: 123456\r\n" does not match EUR`; !strings.Contains(r.failures[2], want) {
+		t.Errorf("Expected %q, got %q", want, r.failures[2])
+	}
+}
+
+func TestAssertNoDuplicates(t *testing.T) {
+	server := newServer(t)
+	AssertNoDuplicates(t, server)
+
+	// A retry with a new Date and Message-ID is still a duplicate
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("From: app@example.com\r\nTo: user@example.com\r\nSubject: Welcome aboard\r\nMessage-ID: <retry@example.com>\r\nDate: Mon, 02 Jan 2006 15:04:05 +0000\r\n\r\nYour code: 123456\r\n"))
+	r := &recorder{}
+	AssertNoDuplicates(r, server)
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], "a duplicate of msg-0") {
+		t.Errorf("Expected a duplicate of msg-0, got %q", r.failures)
+	}
+}
+
+func TestAwaitReceived(t *testing.T) {
+	server := mailcatcher.New(0, 0)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Later\r\n\r\nBody\r\n"))
+	}()
+
+	if _, ok := AwaitReceived(t, server, 5*time.Second, Subject("Later")); !ok {
+		t.Error("Expected the email to arrive")
+	}
+
+	r := &recorder{}
+	if _, ok := AwaitReceived(r, server, 10*time.Millisecond, Subject("Never")); ok || len(r.failures) != 1 {
+		t.Errorf("Expected a failure for a missing email, got %q", r.failures)
+	}
+}
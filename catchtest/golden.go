@@ -0,0 +1,74 @@
+package catchtest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andmetoo/mailcatcher"
+)
+
+// UpdateGoldenEnv names the environment variable that makes MatchGolden
+// rewrite golden files instead of comparing against them:
+//
+//	MAILCATCHER_UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "MAILCATCHER_UPDATE_GOLDEN"
+
+// MatchGolden reports a test failure, with a line diff, unless email
+// matches the golden file at path. Volatile headers such as Date and
+// Message-ID, MIME boundaries and the headers named in ignore are not
+// compared; see mailcatcher.Snapshot.
+//
+// A golden file ending in .eml holds the raw message, any other file a
+// JSON snapshot. Missing golden files are written, as are all of them if
+// UpdateGoldenEnv is set, so templates can be reviewed and committed.
+func MatchGolden(t testing.TB, email mailcatcher.Email, path string, ignore ...string) bool {
+	t.Helper()
+	got := email.Snapshot(ignore...)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && os.Getenv(UpdateGoldenEnv) != "" {
+		if err := writeGolden(path, email, got); err != nil {
+			t.Errorf("Failed to write golden file: %v", err)
+			return false
+		}
+		t.Logf("Wrote golden file %s", path)
+		return true
+	}
+	if err != nil {
+		t.Errorf("Failed to read golden file: %v", err)
+		return false
+	}
+
+	want, err := mailcatcher.ParseSnapshot(data, ignore...)
+	if err != nil {
+		t.Errorf("Failed to parse golden file %s: %v", path, err)
+		return false
+	}
+	if diff := mailcatcher.DiffSnapshots(want, got); diff != "" {
+		t.Errorf("Email %s does not match %s (-want +got):\n%s", email.ID, path, diff)
+		return false
+	}
+	return true
+}
+
+// writeGolden writes the raw email to an .eml path and its snapshot to
+// any other path.
+func writeGolden(path string, email mailcatcher.Email, snap mailcatcher.Snapshot) error {
+	data := email.Raw()
+	if !strings.EqualFold(filepath.Ext(path), ".eml") {
+		var err error
+		if data, err = json.MarshalIndent(snap, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
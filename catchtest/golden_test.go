@@ -0,0 +1,47 @@
+package catchtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchGolden(t *testing.T) {
+	server := newServer(t)
+	emails := server.Emails()
+	dir := t.TempDir()
+
+	for _, name := range []string{"welcome.json", "welcome.eml"} {
+		path := filepath.Join(dir, "golden", name)
+		if !MatchGolden(t, emails[0], path) {
+			t.Fatalf("Expected a missing golden file to be written")
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("Expected %s to be written, got %v", name, err)
+		}
+		if !MatchGolden(t, emails[0], path) {
+			t.Errorf("Expected the email to match %s", name)
+		}
+
+		r := &recorder{}
+		if MatchGolden(r, emails[1], path) || len(r.failures) != 1 {
+			t.Fatalf("Expected one failure for a different email, got %v", r.failures)
+		}
+		for _, want := range []string{"does not match", "- Subject: Welcome aboard", "+ Subject: Invoice", "+ Total: 10 EUR"} {
+			if !strings.Contains(r.failures[0], want) {
+				t.Errorf("Expected %q in the failure, got %s", want, r.failures[0])
+			}
+		}
+	}
+
+	t.Setenv(UpdateGoldenEnv, "1")
+	path := filepath.Join(dir, "golden", "welcome.json")
+	if !MatchGolden(t, emails[1], path) {
+		t.Error("Expected the golden file to be updated")
+	}
+	t.Setenv(UpdateGoldenEnv, "")
+	if !MatchGolden(t, emails[1], path) {
+		t.Error("Expected the email to match the updated golden file")
+	}
+}
@@ -0,0 +1,255 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Restorer is implemented by stores that can replace their contents with
+// emails captured earlier, keeping the IDs, so Restore brings back deleted
+// emails exactly as they were.
+type Restorer interface {
+	// Restore replaces all stored emails with emails, given in the order
+	// List returned them.
+	Restore(ctx context.Context, emails []Email) error
+}
+
+var (
+	_ Restorer = (*MemoryStore)(nil)
+	_ Restorer = (*CompressedStore)(nil)
+)
+
+// Checkpoint is the mail state saved by Snapshot: every stored email,
+// including held ones, with its tags and read state.
+type Checkpoint struct {
+	emails []Email
+	time   time.Time
+}
+
+// Len returns the number of emails in the checkpoint.
+func (c *Checkpoint) Len() int {
+	return len(c.emails)
+}
+
+// maxCheckpoints is the number of checkpoints kept by the HTTP API; the
+// oldest is discarded when another is taken. Each checkpoint holds a copy
+// of every stored email, so this bounds the memory clients can pin.
+const maxCheckpoints = 16
+
+// checkpointState holds the checkpoints taken through the HTTP API.
+type checkpointState struct {
+	mu    sync.Mutex
+	saved map[string]*Checkpoint
+	order []string // IDs in saved, oldest first
+	next  int
+}
+
+// checkpointInfo is the HTTP API description of a checkpoint.
+type checkpointInfo struct {
+	ID    string    `json:"id"`
+	Count int       `json:"count"`
+	Time  time.Time `json:"time"`
+}
+
+// Snapshot saves the stored emails, so a test can run a sub-scenario and
+// roll back with Restore instead of clearing everything:
+//
+//	checkpoint, err := server.Snapshot()
+//	if err != nil {
+//	    t.Fatal(err)
+//	}
+//	t.Cleanup(func() { server.Restore(checkpoint) })
+//
+// A checkpoint can be restored any number of times. It holds a copy of
+// every stored email until it is no longer referenced.
+func (s *Server) Snapshot() (*Checkpoint, error) {
+	emails, err := s.store.List(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list emails: %w", err)
+	}
+	return &Checkpoint{emails: emails, time: time.Now()}, nil
+}
+
+// Restore puts back the emails saved by Snapshot: emails captured since are
+// removed and changed ones are reverted. With a store implementing Restorer,
+// such as the default MemoryStore, deleted emails come back with their IDs;
+// other stores add them again with new IDs at the end. Subscribers of the
+// event stream see a cleared event followed by the restored emails.
+func (s *Server) Restore(checkpoint *Checkpoint) error {
+	ctx := context.Background()
+	var err error
+	if restorer, ok := s.store.(Restorer); ok {
+		err = restorer.Restore(ctx, checkpoint.emails)
+	} else {
+		err = restoreEmails(ctx, s.store, checkpoint.emails)
+	}
+	s.forgetStoredBytes()
+	if err != nil {
+		return fmt.Errorf("failed to restore checkpoint: %w", err)
+	}
+
+	s.publish(Event{Type: EventCleared})
+	emails, err := s.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list emails: %w", err)
+	}
+	for _, email := range emails {
+		s.publish(Event{Type: EventAdded, ID: email.ID, Email: &email})
+	}
+	s.signalArrival()
+	return nil
+}
+
+// restoreEmails restores emails with the Store methods only, for stores
+// that do not implement Restorer.
+func restoreEmails(ctx context.Context, store Store, emails []Email) error {
+	current, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	saved := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		saved[email.ID] = true
+	}
+	stored := make(map[string]bool, len(current))
+	for _, email := range current {
+		if !saved[email.ID] {
+			if err := store.Delete(ctx, email.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		stored[email.ID] = true
+	}
+
+	for _, email := range emails {
+		if stored[email.ID] {
+			err = store.Update(ctx, email)
+		} else {
+			_, err = store.Add(ctx, email)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore implements Restorer. IDs are still not reused: emails added
+// later continue the sequence.
+func (m *MemoryStore) Restore(_ context.Context, emails []Email) error {
+	seqs := make([]uint64, len(emails))
+	for i, email := range emails {
+		seq, ok := idSeq(email.ID)
+		if !ok {
+			return fmt.Errorf("invalid email ID %q", email.ID)
+		}
+		seqs[i] = seq
+	}
+	if !slices.IsSorted(seqs) {
+		return fmt.Errorf("emails are not in the order added")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seqs = seqs
+	clear(m.emails)
+	clear(m.byRecipient)
+	clear(m.byWord)
+	for i, email := range emails {
+		seq := seqs[i]
+		m.emails[seq] = email
+		for _, key := range recipientKeys(&email) {
+			m.byRecipient[key] = append(m.byRecipient[key], seq)
+		}
+		for _, word := range emailWords(&email) {
+			m.byWord[word] = append(m.byWord[word], seq)
+		}
+		m.nextID = max(m.nextID, seq+1)
+	}
+	return nil
+}
+
+// Restore implements Restorer, keeping the IDs if the wrapped store does.
+func (c *CompressedStore) Restore(ctx context.Context, emails []Email) error {
+	restorer, ok := c.Store.(Restorer)
+	if !ok {
+		return restoreEmails(ctx, c, emails)
+	}
+	compressed := make([]Email, len(emails))
+	for i, email := range emails {
+		compressed[i] = c.compressEmail(email)
+	}
+	return restorer.Restore(ctx, compressed)
+}
+
+// HTTP handlers
+
+func (s *Server) handleCreateCheckpoint(w http.ResponseWriter, r *http.Request) {
+	checkpoint, err := s.Snapshot()
+	if err != nil {
+		s.errorf("Failed to create checkpoint: %v", err)
+		http.Error(w, "Failed to create checkpoint", http.StatusInternalServerError)
+		return
+	}
+
+	c := &s.checkpoints
+	c.mu.Lock()
+	if c.saved == nil {
+		c.saved = make(map[string]*Checkpoint)
+	}
+	c.next++
+	id := fmt.Sprintf("cp-%d", c.next)
+	c.saved[id] = checkpoint
+	c.order = append(c.order, id)
+	if len(c.order) > maxCheckpoints {
+		delete(c.saved, c.order[0])
+		c.order = slices.Delete(c.order, 0, 1)
+	}
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	info := checkpointInfo{ID: id, Count: checkpoint.Len(), Time: checkpoint.time}
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleRestoreCheckpoint(w http.ResponseWriter, r *http.Request) {
+	c := &s.checkpoints
+	c.mu.Lock()
+	checkpoint := c.saved[r.PathValue("id")]
+	c.mu.Unlock()
+	if checkpoint == nil {
+		http.Error(w, "Checkpoint not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.Restore(checkpoint); err != nil {
+		s.errorf("Failed to restore checkpoint: %v", err)
+		http.Error(w, "Failed to restore checkpoint", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeleteCheckpoint(w http.ResponseWriter, r *http.Request) {
+	c := &s.checkpoints
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := r.PathValue("id")
+	if c.saved[id] == nil {
+		http.Error(w, "Checkpoint not found", http.StatusNotFound)
+		return
+	}
+	delete(c.saved, id)
+	c.order = slices.DeleteFunc(c.order, func(saved string) bool { return saved == id })
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,191 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	server := New(0, 0)
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: One\r\n\r\nBody\r\n"))
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Two\r\n\r\nBody\r\n"))
+
+	checkpoint, err := server.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	if checkpoint.Len() != 2 {
+		t.Errorf("Expected 2 emails in the checkpoint, got %d", checkpoint.Len())
+	}
+
+	// A sub-scenario changes, deletes and adds mail
+	server.Tag("msg-0", "checked")
+	server.Delete("msg-1")
+	server.Send("app@example.com", []string{"other@example.com"}, []byte("Subject: Three\r\n\r\nBody\r\n"))
+
+	for range 2 { // a checkpoint can be restored again
+		if err := server.Restore(checkpoint); err != nil {
+			t.Fatalf("Failed to restore: %v", err)
+		}
+		emails := server.Emails()
+		if got := subjects(emails); !slices.Equal(got, []string{"One", "Two"}) {
+			t.Fatalf("Expected the emails of the checkpoint, got %v", got)
+		}
+		if emails[0].ID != "msg-0" || emails[1].ID != "msg-1" || len(emails[0].Tags) != 0 {
+			t.Errorf("Expected the original IDs without tags, got %s %s %v", emails[0].ID, emails[1].ID, emails[0].Tags)
+		}
+		if got := server.Find(Filter{To: "other@example.com"}); len(got) != 0 {
+			t.Errorf("Expected the recipient index to be restored, got %v", subjects(got))
+		}
+		if got := server.Search("two"); len(got) != 1 {
+			t.Errorf("Expected the search index to be restored, got %v", subjects(got))
+		}
+	}
+
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Four\r\n\r\nBody\r\n"))
+	if email := server.Find(Filter{SubjectContains: "Four"}); len(email) != 1 || email[0].ID != "msg-3" {
+		t.Errorf("Expected IDs not to be reused after a restore, got %+v", email)
+	}
+}
+
+func TestRestoreStores(t *testing.T) {
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	defer boltStore.Close()
+	compressed, err := NewCompressedStore(NewMemoryStore(), CompressGzip)
+	if err != nil {
+		t.Fatalf("Failed to create compressed store: %v", err)
+	}
+
+	// The bolt store has no Restorer, so a deleted email comes back last with a new ID
+	for name, tt := range map[string]struct {
+		store Store
+		want  []string
+	}{
+		"bolt":       {boltStore, []string{"Two", "One"}},
+		"compressed": {compressed, []string{"One", "Two"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := NewWithOptions(WithStore(tt.store))
+			body := "Subject: One\r\n\r\n" + string(make([]byte, 1000)) + "\r\n"
+			server.Send("app@example.com", []string{"user@example.com"}, []byte(body))
+			server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Two\r\n\r\nBody\r\n"))
+			checkpoint, err := server.Snapshot()
+			if err != nil {
+				t.Fatalf("Failed to snapshot: %v", err)
+			}
+
+			first := server.Emails()[0].ID
+			server.Delete(first)
+			server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Three\r\n\r\nBody\r\n"))
+			if err := server.Restore(checkpoint); err != nil {
+				t.Fatalf("Failed to restore: %v", err)
+			}
+
+			emails := server.Emails()
+			if got := subjects(emails); !slices.Equal(got, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for _, email := range emails {
+				if email.Subject == "One" && email.Body != body {
+					t.Errorf("Expected the restored body, got %q", email.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckpointEndpoints(t *testing.T) {
+	server := New(0, 0)
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Before\r\n\r\nBody\r\n"))
+	ts := httptest.NewServer(server.HTTPServer().Handler)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/v1/checkpoints", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	var info checkpointInfo
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated || info.ID == "" || info.Count != 1 {
+		t.Fatalf("Expected a checkpoint of 1 email, got %d %+v", resp.StatusCode, info)
+	}
+
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: After\r\n\r\nBody\r\n"))
+	resp, err = http.Post(ts.URL+"/api/v1/checkpoints/"+info.ID+"/restore", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to restore checkpoint: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if got := subjects(server.Emails()); !slices.Equal(got, []string{"Before"}) {
+		t.Errorf("Expected only the email from before, got %v", got)
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/checkpoints/"+info.ID, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to delete checkpoint: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Expected status %d, got %d", want, resp.StatusCode)
+		}
+	}
+	resp, err = http.Post(ts.URL+"/api/v1/checkpoints/"+info.ID+"/restore", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to restore checkpoint: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a deleted checkpoint, got %d", resp.StatusCode)
+	}
+}
+
+func TestCheckpointLimit(t *testing.T) {
+	server := New(0, 0)
+	ts := httptest.NewServer(server.HTTPServer().Handler)
+	defer ts.Close()
+
+	var ids []string
+	for range maxCheckpoints + 1 {
+		resp, err := http.Post(ts.URL+"/api/v1/checkpoints", "", nil)
+		if err != nil {
+			t.Fatalf("Failed to create checkpoint: %v", err)
+		}
+		var info checkpointInfo
+		err = json.NewDecoder(resp.Body).Decode(&info)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		ids = append(ids, info.ID)
+	}
+
+	for i, want := range []int{http.StatusNotFound, http.StatusNoContent} {
+		resp, err := http.Post(ts.URL+"/api/v1/checkpoints/"+ids[i]+"/restore", "", nil)
+		if err != nil {
+			t.Fatalf("Failed to restore checkpoint: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Expected status %d for %s, got %d", want, ids[i], resp.StatusCode)
+		}
+	}
+	if n := len(server.checkpoints.saved); n != maxCheckpoints {
+		t.Errorf("Expected %d checkpoints kept, got %d", maxCheckpoints, n)
+	}
+}
@@ -0,0 +1,414 @@
+// Package client is a typed HTTP client for a remote mailcatcher, such as
+// one running as a standalone container in docker-compose.
+//
+//	c := client.New("http://mailcatcher:8025")
+//	email, err := c.WaitFor(ctx, mailcatcher.Filter{To: "user@example.com"}.Match)
+//
+// Emails use the mailcatcher.Email type, decoded from the HTTP API.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andmetoo/mailcatcher"
+)
+
+const (
+	// defaultPollInterval is how often WaitFor retries failed requests.
+	defaultPollInterval = 100 * time.Millisecond
+
+	// maxEventBytes limits the size of an event, which holds the email.
+	maxEventBytes = 64 * 1024 * 1024
+)
+
+// Client calls the HTTP API of a mailcatcher instance.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	token        string
+	username     string
+	password     string
+	pollInterval time.Duration
+}
+
+// Option configures a Client created by New.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests, e.g. to set a
+// timeout. The default is http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithToken sends a bearer token, for servers using SetAPIToken.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithBasicAuth sends basic authentication, for servers using
+// SetAPIBasicAuth.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) { c.username, c.password = username, password }
+}
+
+// WithPollInterval sets how often WaitFor retries failed requests.
+func WithPollInterval(d time.Duration) Option {
+	return func(c *Client) { c.pollInterval = d }
+}
+
+// New returns a client for the instance whose HTTP API is at baseURL,
+// e.g. "http://localhost:8025".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		pollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// List returns the captured emails passing filter, in the order received.
+// Held emails are not included.
+func (c *Client) List(ctx context.Context, filter mailcatcher.Filter) ([]mailcatcher.Email, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{"to": filter.To, "from": filter.From, "subject_contains": filter.SubjectContains, "namespace": filter.Namespace, "tag": filter.Tag} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if filter.Unread {
+		query.Set("unread", "true")
+	}
+	if filter.Dedupe {
+		query.Set("dedupe", "true")
+	}
+	for name, t := range map[string]time.Time{"since": filter.Since, "before": filter.Before} {
+		if !t.IsZero() {
+			query.Set(name, t.Format(time.RFC3339Nano))
+		}
+	}
+
+	path := "/api/v1/emails"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var response struct {
+		Items []mailcatcher.Email `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, &response); err != nil {
+		return nil, fmt.Errorf("failed to list emails: %w", err)
+	}
+	return response.Items, nil
+}
+
+// Search returns the captured emails containing every word of query, see
+// Server.Search.
+func (c *Client) Search(ctx context.Context, query string) ([]mailcatcher.Email, error) {
+	var response struct {
+		Items []mailcatcher.Email `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/search?q="+url.QueryEscape(query), &response); err != nil {
+		return nil, fmt.Errorf("failed to search emails: %w", err)
+	}
+	return response.Items, nil
+}
+
+// Get returns the email with the given ID, including held ones. The error
+// wraps mailcatcher.ErrNotFound if there is no such email.
+func (c *Client) Get(ctx context.Context, id string) (mailcatcher.Email, error) {
+	var email mailcatcher.Email
+	if err := c.do(ctx, http.MethodGet, "/api/v1/emails/"+url.PathEscape(id), &email); err != nil {
+		return mailcatcher.Email{}, fmt.Errorf("failed to get email %s: %w", id, err)
+	}
+	return email, nil
+}
+
+// Delete deletes the email with the given ID. The error wraps
+// mailcatcher.ErrNotFound if there is no such email.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/emails/"+url.PathEscape(id), nil); err != nil {
+		return fmt.Errorf("failed to delete email %s: %w", id, err)
+	}
+	return nil
+}
+
+// Clear deletes all emails.
+func (c *Client) Clear(ctx context.Context) error {
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/emails", nil); err != nil {
+		return fmt.Errorf("failed to clear emails: %w", err)
+	}
+	return nil
+}
+
+// Export writes every stored email, including held ones, to w in the
+// given format of the export endpoint: "ndjson" (the default for ""),
+// "json" or "mbox".
+func (c *Client) Export(ctx context.Context, w io.Writer, format string) error {
+	path := "/api/v1/emails/export"
+	if format != "" {
+		path += "?format=" + url.QueryEscape(format)
+	}
+	if err := c.do(ctx, http.MethodGet, path, w); err != nil {
+		return fmt.Errorf("failed to export emails: %w", err)
+	}
+	return nil
+}
+
+// Archive writes every stored email, including held ones, to w as the zip
+// archive of the archive endpoint: an .eml file per message and an
+// index.json.
+func (c *Client) Archive(ctx context.Context, w io.Writer) error {
+	if err := c.do(ctx, http.MethodGet, "/api/v1/emails/archive", w); err != nil {
+		return fmt.Errorf("failed to archive emails: %w", err)
+	}
+	return nil
+}
+
+// Import stores a raw RFC 5322 message, or every message of an mbox file,
+// without going through SMTP, see Server.Inject. It returns the stored
+// emails.
+func (c *Client) Import(ctx context.Context, r io.Reader) ([]mailcatcher.Email, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+	resp, err := c.send(ctx, http.MethodPost, "/api/v1/emails", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import emails: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if !bytes.HasPrefix(data, []byte("From ")) {
+		var email mailcatcher.Email
+		if err := json.NewDecoder(resp.Body).Decode(&email); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return []mailcatcher.Email{email}, nil
+	}
+	var response struct {
+		Items []mailcatcher.Email `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return response.Items, nil
+}
+
+// Snapshot saves the stored emails as a checkpoint on the server and
+// returns its ID for Restore.
+func (c *Client) Snapshot(ctx context.Context) (string, error) {
+	var checkpoint struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/checkpoints", &checkpoint); err != nil {
+		return "", fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	return checkpoint.ID, nil
+}
+
+// Restore rolls the stored emails back to the checkpoint with the given ID.
+// It returns an error wrapping mailcatcher.ErrNotFound for unknown IDs.
+func (c *Client) Restore(ctx context.Context, id string) error {
+	if err := c.do(ctx, http.MethodPost, "/api/v1/checkpoints/"+url.PathEscape(id)+"/restore", nil); err != nil {
+		return fmt.Errorf("failed to restore checkpoint %s: %w", id, err)
+	}
+	return nil
+}
+
+// DeleteCheckpoint discards the checkpoint with the given ID.
+func (c *Client) DeleteCheckpoint(ctx context.Context, id string) error {
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/checkpoints/"+url.PathEscape(id), nil); err != nil {
+		return fmt.Errorf("failed to delete checkpoint %s: %w", id, err)
+	}
+	return nil
+}
+
+// Stats returns the aggregate statistics of the instance, with Buckets
+// of the given length unless bucket is 0, see Server.StatsByTime.
+func (c *Client) Stats(ctx context.Context, bucket time.Duration) (mailcatcher.Stats, error) {
+	path := "/api/v1/stats"
+	if bucket > 0 {
+		path += "?bucket=" + url.QueryEscape(bucket.String())
+	}
+	var stats mailcatcher.Stats
+	if err := c.do(ctx, http.MethodGet, path, &stats); err != nil {
+		return mailcatcher.Stats{}, fmt.Errorf("failed to get stats: %w", err)
+	}
+	return stats, nil
+}
+
+// WaitFor blocks until a captured email matches and returns it, or returns
+// an error when ctx is done. Like Server.WaitFor, emails captured before
+// the call are checked first; later ones are taken from the event stream,
+// so no polling is needed. Failed requests are retried every poll
+// interval, so WaitFor can be called while the instance is still starting.
+func (c *Client) WaitFor(ctx context.Context, match func(mailcatcher.Email) bool) (mailcatcher.Email, error) {
+	var lastErr error
+	for {
+		email, err := c.waitFor(ctx, match)
+		if err == nil {
+			return email, nil
+		}
+		if ctx.Err() == nil {
+			lastErr = err // not merely interrupted by ctx
+		}
+
+		select {
+		case <-time.After(c.pollInterval):
+		case <-ctx.Done():
+			if lastErr != nil {
+				return mailcatcher.Email{}, fmt.Errorf("failed to wait for email: %w (last error: %v)", ctx.Err(), lastErr)
+			}
+			return mailcatcher.Email{}, fmt.Errorf("failed to wait for email: %w", ctx.Err())
+		}
+	}
+}
+
+// waitFor checks the stored emails and then the event stream until an
+// email matches, or returns the error which ended the stream.
+func (c *Client) waitFor(ctx context.Context, match func(mailcatcher.Email) bool) (mailcatcher.Email, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Subscribe before listing so an arrival in between is not missed
+	subscription, err := c.Subscribe(ctx)
+	if err != nil {
+		return mailcatcher.Email{}, err
+	}
+	defer subscription.Close()
+
+	emails, err := c.List(ctx, mailcatcher.Filter{})
+	if err != nil {
+		return mailcatcher.Email{}, err
+	}
+	for _, email := range emails {
+		if match(email) {
+			return email, nil
+		}
+	}
+
+	for {
+		event, err := subscription.Next()
+		if err != nil {
+			return mailcatcher.Email{}, err
+		}
+		// Held emails match once they are approved, which updates them
+		email := event.Email
+		if (event.Type == mailcatcher.EventAdded || event.Type == mailcatcher.EventUpdated) &&
+			email != nil && !email.Held && match(*email) {
+			return *email, nil
+		}
+	}
+}
+
+// Subscription is an open stream of changes, see Subscribe.
+type Subscription struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// Subscribe opens the event stream of the instance. Once it returns,
+// every change is delivered by Next until ctx is done or Close is called.
+func (c *Client) Subscribe(ctx context.Context) (*Subscription, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/api/v1/events", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, maxEventBytes)
+	return &Subscription{body: resp.Body, scanner: scanner}, nil
+}
+
+// Next blocks until the next event arrives. It returns io.EOF when the
+// server closes the stream.
+func (s *Subscription) Next() (mailcatcher.Event, error) {
+	var data []byte
+	for s.scanner.Scan() {
+		line := s.scanner.Bytes()
+		switch {
+		case len(line) == 0 && len(data) > 0:
+			var event mailcatcher.Event
+			if err := json.Unmarshal(data, &event); err != nil {
+				return mailcatcher.Event{}, fmt.Errorf("failed to decode event: %w", err)
+			}
+			return event, nil
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))...)
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return mailcatcher.Event{}, fmt.Errorf("failed to read event: %w", err)
+	}
+	return mailcatcher.Event{}, io.EOF
+}
+
+// Close closes the stream.
+func (s *Subscription) Close() error {
+	return s.body.Close()
+}
+
+// do sends a request and decodes the JSON response into out, if not nil.
+// If out is an io.Writer, the response body is copied to it instead.
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	resp, err := c.send(ctx, method, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	if w, ok := out.(io.Writer); ok {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// send sends an authenticated request and returns the response if it is
+// successful.
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, mailcatcher.ErrNotFound
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andmetoo/mailcatcher"
+	"gitlab.com/tozd/go/errors"
+)
+
+func newTestClient(t *testing.T, opts ...mailcatcher.Option) (*mailcatcher.Server, *Client) {
+	t.Helper()
+	server, _ := mailcatcher.NewTestServer(t, opts...)
+	return server, New("http://"+server.HTTPAddr()+"/", WithPollInterval(10*time.Millisecond))
+}
+
+func TestClient(t *testing.T) {
+	server, c := newTestClient(t)
+	ctx := context.Background()
+	server.Send("sender@example.com", []string{"a@example.com"}, []byte("Subject: First\r\n\r\nBody\r\n"))
+	server.Send("sender@example.com", []string{"b@example.com"}, []byte("Subject: Second\r\n\r\nBody\r\n"))
+
+	emails, err := c.List(ctx, mailcatcher.Filter{To: "b@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to list emails: %v", err)
+	}
+	if len(emails) != 1 || emails[0].Subject != "Second" {
+		t.Fatalf("Expected only the second email, got %d", len(emails))
+	}
+
+	email, err := c.Get(ctx, emails[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get email: %v", err)
+	}
+	if email.Subject != "Second" {
+		t.Errorf("Expected subject Second, got %q", email.Subject)
+	}
+
+	if err := c.Delete(ctx, email.ID); err != nil {
+		t.Fatalf("Failed to delete email: %v", err)
+	}
+	if _, err := c.Get(ctx, email.ID); !errors.Is(err, mailcatcher.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := c.Delete(ctx, email.ID); !errors.Is(err, mailcatcher.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Export(ctx, &buf, "mbox"); err != nil {
+		t.Fatalf("Failed to export emails: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "From sender@example.com ") {
+		t.Errorf("Expected an mbox export, got %q", buf.String())
+	}
+
+	if err := c.Clear(ctx); err != nil {
+		t.Fatalf("Failed to clear emails: %v", err)
+	}
+	if count := len(server.Emails()); count != 0 {
+		t.Errorf("Expected no emails after clear, got %d", count)
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	server, c := newTestClient(t)
+	for _, to := range []string{"a@example.com", "b@example.com", "a@example.com"} {
+		server.Send("sender@example.com", []string{to}, []byte("Subject: Load\r\n\r\nBody\r\n"))
+	}
+
+	stats, err := c.Stats(context.Background(), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Messages != 3 || stats.ByRecipient["a@example.com"] != 2 || stats.BySender["sender@example.com"] != 3 {
+		t.Errorf("Expected 3 messages, 2 to a@example.com, got %+v", stats)
+	}
+	if len(stats.Buckets) == 0 || stats.Buckets[len(stats.Buckets)-1].Messages == 0 {
+		t.Errorf("Expected hourly buckets, got %+v", stats.Buckets)
+	}
+}
+
+func TestClientImport(t *testing.T) {
+	server, c := newTestClient(t)
+	ctx := context.Background()
+
+	emails, err := c.Import(ctx, strings.NewReader("From: app@example.com\r\nTo: user@example.com\r\nSubject: Fixture\r\n\r\nBody\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to import email: %v", err)
+	}
+	if len(emails) != 1 || emails[0].Subject != "Fixture" {
+		t.Errorf("Expected the imported email, got %+v", emails)
+	}
+
+	emails, err = c.Import(ctx, strings.NewReader("From app@example.com Thu Jan  1 00:00:00 2026\nSubject: One\n\nBody\n\nFrom app@example.com Thu Jan  1 00:00:00 2026\nSubject: Two\n\nBody\n"))
+	if err != nil {
+		t.Fatalf("Failed to import mbox: %v", err)
+	}
+	if len(emails) != 2 {
+		t.Errorf("Expected 2 imported emails, got %d", len(emails))
+	}
+	if n := len(server.Emails()); n != 3 {
+		t.Errorf("Expected 3 stored emails, got %d", n)
+	}
+}
+
+func TestClientCheckpoint(t *testing.T) {
+	server, c := newTestClient(t)
+	ctx := context.Background()
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Before\r\n\r\nBody\r\n"))
+
+	id, err := c.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: After\r\n\r\nBody\r\n"))
+	if err := c.Restore(ctx, id); err != nil {
+		t.Fatalf("Failed to restore checkpoint: %v", err)
+	}
+	if emails := server.Emails(); len(emails) != 1 || emails[0].Subject != "Before" {
+		t.Errorf("Expected only the email from before the checkpoint, got %d", len(emails))
+	}
+
+	if err := c.DeleteCheckpoint(ctx, id); err != nil {
+		t.Fatalf("Failed to delete checkpoint: %v", err)
+	}
+	if err := c.Restore(ctx, id); !errors.Is(err, mailcatcher.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a deleted checkpoint, got %v", err)
+	}
+}
+
+func TestClientSearch(t *testing.T) {
+	server, c := newTestClient(t)
+	server.Send("shop@example.com", []string{"user@example.com"}, []byte("Subject: Order 1234\r\n\r\nBody\r\n"))
+	server.Send("shop@example.com", []string{"user@example.com"}, []byte("Subject: Order 5678\r\n\r\nBody\r\n"))
+
+	emails, err := c.Search(context.Background(), "order #1234")
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(emails) != 1 || emails[0].Subject != "Order 1234" {
+		t.Errorf("Expected only the email about order 1234, got %d", len(emails))
+	}
+}
+
+func TestClientWaitFor(t *testing.T) {
+	server, c := newTestClient(t)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: Welcome\r\n\r\nBody\r\n"))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	email, err := c.WaitFor(ctx, mailcatcher.Filter{SubjectContains: "welcome"}.Match)
+	if err != nil {
+		t.Fatalf("Failed to wait for email: %v", err)
+	}
+	if email.Subject != "Welcome" {
+		t.Errorf("Expected subject Welcome, got %q", email.Subject)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.WaitFor(ctx, mailcatcher.Filter{To: "nobody@example.com"}.Match); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	server, _ := mailcatcher.NewTestServer(t, mailcatcher.WithAPIToken("s3cret"))
+	ctx := context.Background()
+
+	if _, err := New("http://"+server.HTTPAddr()).List(ctx, mailcatcher.Filter{}); err == nil {
+		t.Error("Expected an error without the token")
+	}
+	if _, err := New("http://"+server.HTTPAddr(), WithToken("s3cret")).List(ctx, mailcatcher.Filter{}); err != nil {
+		t.Errorf("Expected the token to be accepted, got %v", err)
+	}
+}
+
+func TestClientSubscribe(t *testing.T) {
+	server, c := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := c.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: Live\r\n\r\nBody\r\n"))
+	event, err := sub.Next()
+	if err != nil {
+		t.Fatalf("Failed to read event: %v", err)
+	}
+	if event.Type != mailcatcher.EventAdded || event.Email == nil || event.Email.Subject != "Live" {
+		t.Errorf("Expected added event for Live, got %+v", event)
+	}
+}
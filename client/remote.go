@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/andmetoo/mailcatcher"
+	"gitlab.com/tozd/go/errors"
+)
+
+var _ mailcatcher.Catcher = (*Remote)(nil)
+
+// Remote adapts a Client to mailcatcher.Catcher, for tests that run both
+// against an in-process Server and against an instance running elsewhere,
+// such as a docker-compose or testcontainers service. Like Server, request
+// errors are reported to the logger and yield no emails.
+type Remote struct {
+	client *Client
+	log    *slog.Logger
+}
+
+// Connect returns a Remote for the instance whose HTTP API is at baseURL,
+// e.g. "http://localhost:8025". No request is made until it is used, so
+// WaitFor also covers waiting for the container to come up.
+func Connect(baseURL string, opts ...Option) *Remote {
+	return &Remote{
+		client: New(baseURL, opts...),
+		log:    slog.New(slog.DiscardHandler),
+	}
+}
+
+// Client returns the client used for requests, for the rest of the HTTP API.
+func (r *Remote) Client() *Client {
+	return r.client
+}
+
+// SetLogHandler sends request failures to h at error level. By default
+// nothing is logged. It must be called before the Remote is used.
+func (r *Remote) SetLogHandler(h slog.Handler) {
+	r.log = slog.New(h)
+}
+
+// Emails returns the emails captured by the instance, excluding held ones,
+// or none if the request fails.
+func (r *Remote) Emails() []mailcatcher.Email {
+	emails, err := r.client.List(context.Background(), mailcatcher.Filter{})
+	if err != nil {
+		r.log.Error(err.Error())
+		return []mailcatcher.Email{}
+	}
+	return emails
+}
+
+// Email returns a specific email by ID, including held ones, or nil if
+// there is no such email or the request fails.
+func (r *Remote) Email(id string) *mailcatcher.Email {
+	email, err := r.client.Get(context.Background(), id)
+	if err != nil {
+		if !errors.Is(err, mailcatcher.ErrNotFound) {
+			r.log.Error(err.Error())
+		}
+		return nil
+	}
+	return &email
+}
+
+// Clear removes all captured messages.
+func (r *Remote) Clear() {
+	if err := r.client.Clear(context.Background()); err != nil {
+		r.log.Error(err.Error())
+	}
+}
+
+// WaitFor is Client.WaitFor.
+func (r *Remote) WaitFor(ctx context.Context, match func(mailcatcher.Email) bool) (mailcatcher.Email, error) {
+	return r.client.WaitFor(ctx, match)
+}
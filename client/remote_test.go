@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andmetoo/mailcatcher"
+)
+
+// newTestRemote returns a started server and a Remote connected to it.
+func newTestRemote(t *testing.T, opts ...mailcatcher.Option) (*mailcatcher.Server, *Remote) {
+	t.Helper()
+	server, _ := mailcatcher.NewTestServer(t, opts...)
+	return server, Connect("http://"+server.HTTPAddr()+"/", WithPollInterval(10*time.Millisecond))
+}
+
+func TestRemote(t *testing.T) {
+	server, remote := newTestRemote(t)
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Welcome\r\n\r\nBody\r\n"))
+
+	emails := remote.Emails()
+	if len(emails) != 1 || emails[0].Subject != "Welcome" {
+		t.Fatalf("Expected the welcome email, got %d emails", len(emails))
+	}
+	if email := remote.Email(emails[0].ID); email == nil || email.Subject != "Welcome" {
+		t.Errorf("Expected the email by ID, got %v", email)
+	}
+	if email := remote.Email("msg-99"); email != nil {
+		t.Errorf("Expected nil for an unknown ID, got %v", email)
+	}
+
+	remote.Clear()
+	if n := len(server.Emails()); n != 0 {
+		t.Errorf("Expected no emails after Clear, got %d", n)
+	}
+}
+
+func TestRemoteWaitFor(t *testing.T) {
+	server, remote := newTestRemote(t)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Reset\r\n\r\nBody\r\n"))
+	}()
+
+	// The same code runs against either
+	for _, catcher := range []mailcatcher.Catcher{remote, server} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		email, err := catcher.WaitFor(ctx, mailcatcher.Filter{SubjectContains: "reset"}.Match)
+		cancel()
+		if err != nil {
+			t.Fatalf("Failed to wait for email: %v", err)
+		}
+		if email.Subject != "Reset" {
+			t.Errorf("Expected subject Reset, got %q", email.Subject)
+		}
+	}
+}
+
+func TestRemoteWaitForApproved(t *testing.T) {
+	server, remote := newTestRemote(t)
+	server.AddHoldRule(mailcatcher.Filter{SubjectContains: "review"}.Match)
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Needs review\r\n\r\nBody\r\n"))
+	held := server.Held()[0]
+
+	// Polling at this interval would time out: the approval arrives on the stream
+	remote.client.pollInterval = time.Hour
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.Approve(held.ID)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	email, err := remote.WaitFor(ctx, func(mailcatcher.Email) bool { return true })
+	if err != nil {
+		t.Fatalf("Failed to wait for email: %v", err)
+	}
+	if email.ID != held.ID || email.Held {
+		t.Errorf("Expected the approved email, got %s held=%v", email.ID, email.Held)
+	}
+}
+
+func TestRemoteAuth(t *testing.T) {
+	server, _ := newTestRemote(t, mailcatcher.WithAPIToken("s3cret"))
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Welcome\r\n\r\nBody\r\n"))
+	var log strings.Builder
+	remote := Connect("http://" + server.HTTPAddr())
+	remote.SetLogHandler(slog.NewTextHandler(&log, nil))
+
+	if n := len(remote.Emails()); n != 0 {
+		t.Errorf("Expected no emails without the token, got %d", n)
+	}
+	if !strings.Contains(log.String(), "401") {
+		t.Errorf("Expected the rejection to be logged, got %q", log.String())
+	}
+
+	remote = Connect("http://"+server.HTTPAddr(), WithToken("s3cret"))
+	if n := len(remote.Emails()); n != 1 {
+		t.Errorf("Expected 1 email with the token, got %d", n)
+	}
+}
+
+func TestRemoteWaitForError(t *testing.T) {
+	remote := Connect("http://127.0.0.1:1", WithPollInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := remote.WaitFor(ctx, func(mailcatcher.Email) bool { return true })
+	if err == nil || !strings.Contains(err.Error(), "last error") {
+		t.Errorf("Expected the last request error, got %v", err)
+	}
+}
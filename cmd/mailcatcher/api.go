@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andmetoo/mailcatcher"
+	"github.com/andmetoo/mailcatcher/client"
+)
+
+// apiFlags registers the flags selecting the running instance to talk to.
+// It returns a function creating the client once the flags are parsed.
+func apiFlags(fs *flag.FlagSet) func() *client.Client {
+	api := fs.String("api", "http://localhost:8025", "HTTP API of the running mailcatcher (or MAILCATCHER_API)")
+	token := fs.String("api-token", "", "Bearer token for the HTTP API (or MAILCATCHER_API_TOKEN)")
+	return func() *client.Client {
+		baseURL := *api
+		if env := os.Getenv("MAILCATCHER_API"); env != "" && !isSet(fs, "api") {
+			baseURL = env
+		}
+		if *token == "" {
+			*token = os.Getenv("MAILCATCHER_API_TOKEN")
+		}
+		return client.New(baseURL, client.WithToken(*token))
+	}
+}
+
+// isSet reports whether the named flag was given on the command line.
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// runList implements "mailcatcher list [flags]".
+func runList(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	newClient := apiFlags(fs)
+	to := fs.String("to", "", "Only show emails to this recipient")
+	from := fs.String("from", "", "Only show emails from this sender")
+	subject := fs.String("subject", "", "Only show emails whose subject contains this text")
+	asJSON := fs.Bool("json", false, "Print the emails as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mailcatcher list [flags]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	emails, err := newClient().List(context.Background(), mailcatcher.Filter{To: *to, From: *from, SubjectContains: *subject})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *asJSON {
+		return printJSON(emails)
+	}
+	printTable(os.Stdout, emails)
+	return 0
+}
+
+// runShow implements "mailcatcher show [flags] <id>".
+func runShow(args []string) int {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	newClient := apiFlags(fs)
+	raw := fs.Bool("raw", false, "Print the message source as received")
+	asJSON := fs.Bool("json", false, "Print the email as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mailcatcher show [flags] <id>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	email, err := newClient().Get(context.Background(), fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch {
+	case *asJSON:
+		return printJSON(email)
+	case *raw:
+		os.Stdout.WriteString(email.Body)
+	default:
+		printEmail(os.Stdout, email)
+	}
+	return 0
+}
+
+// runTail implements "mailcatcher tail [flags]".
+func runTail(args []string) int {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	newClient := apiFlags(fs)
+	n := fs.Int("n", 10, "Number of emails to show")
+	follow := fs.Bool("f", false, "Keep running and print emails as they arrive")
+	body := fs.Bool("body", false, "Print the text body of each email")
+	notify := fs.Bool("notify", false, "Show a desktop notification for each new email (implies -f)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mailcatcher tail [flags]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *n < 0 {
+		fmt.Fprintln(fs.Output(), "-n must not be negative")
+		fs.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	c := newClient()
+
+	// Subscribe before listing so no email falls in between
+	var sub *client.Subscription
+	if *follow || *notify {
+		var err error
+		if sub, err = c.Subscribe(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer sub.Close()
+	}
+
+	emails, err := c.List(ctx, mailcatcher.Filter{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	shown := make(map[string]bool)
+	for _, email := range emails[max(len(emails)-*n, 0):] {
+		printLine(os.Stdout, email, *body)
+	}
+	for _, email := range emails {
+		shown[email.ID] = true
+	}
+	if sub == nil {
+		return 0
+	}
+
+	for {
+		event, err := sub.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0 // interrupted
+			}
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if event.Type == mailcatcher.EventAdded && event.Email != nil && !shown[event.ID] {
+			shown[event.ID] = true
+			printLine(os.Stdout, *event.Email, *body)
+			if *notify {
+				if err := desktopNotifier(*event.Email); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			}
+		}
+	}
+}
+
+// runClear implements "mailcatcher clear [flags]".
+func runClear(args []string) int {
+	fs := flag.NewFlagSet("clear", flag.ExitOnError)
+	newClient := apiFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mailcatcher clear [flags]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if err := newClient().Clear(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("Cleared all emails")
+	return 0
+}
+
+// runExport implements "mailcatcher export [flags]".
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	newClient := apiFlags(fs)
+	format := fs.String("format", "ndjson", "Export format: ndjson, json or mbox")
+	archive := fs.Bool("zip", false, "Export a zip archive of .eml files and an index.json instead")
+	output := fs.String("o", "", "Write to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mailcatcher export [flags]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	c := newClient()
+	export := func() error { return c.Export(context.Background(), w, *format) }
+	if *archive {
+		export = func() error { return c.Archive(context.Background(), w) }
+	}
+	if err := export(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runImport implements "mailcatcher import [flags] [file...]".
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	newClient := apiFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mailcatcher import [flags] [file...]")
+		fmt.Fprintln(fs.Output(), "Stores .eml or mbox files, or stdin, without going through SMTP.")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	c := newClient()
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	count := 0
+	for _, file := range files {
+		n, err := importFile(c, file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		count += n
+	}
+	fmt.Printf("Imported %d emails\n", count)
+	return 0
+}
+
+// importFile imports file, or stdin for "-", and closes it before
+// returning the number of emails stored.
+func importFile(c *client.Client, file string) (int, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+	emails, err := c.Import(context.Background(), r)
+	if err != nil {
+		return 0, err
+	}
+	return len(emails), nil
+}
+
+// printTable writes one line per email.
+func printTable(w io.Writer, emails []mailcatcher.Email) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tFROM\tTO\tSUBJECT")
+	for _, email := range emails {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", email.ID, email.Time.Local().Format(time.DateTime),
+			email.From.Address, addressList(email.To), email.Subject)
+	}
+	tw.Flush()
+}
+
+// printLine writes a one-line summary of email, followed by its text body
+// if body is set.
+func printLine(w io.Writer, email mailcatcher.Email, body bool) {
+	fmt.Fprintf(w, "%s %s from %s to %s: %s\n", email.Time.Local().Format(time.TimeOnly), email.ID,
+		email.From.Address, addressList(email.To), email.Subject)
+	if body && email.Text != "" {
+		for _, line := range strings.Split(strings.TrimRight(email.Text, "\r\n"), "\n") {
+			fmt.Fprintf(w, "    %s\n", strings.TrimRight(line, "\r"))
+		}
+	}
+}
+
+// printEmail writes the main headers and the text body of email.
+func printEmail(w io.Writer, email mailcatcher.Email) {
+	fmt.Fprintf(w, "ID:      %s\n", email.ID)
+	fmt.Fprintf(w, "Time:    %s\n", email.Time.Local().Format(time.DateTime))
+	fmt.Fprintf(w, "From:    %s\n", email.From)
+	fmt.Fprintf(w, "To:      %s\n", addressList(email.To))
+	if len(email.Cc) > 0 {
+		fmt.Fprintf(w, "Cc:      %s\n", addressList(email.Cc))
+	}
+	fmt.Fprintf(w, "Subject: %s\n", email.Subject)
+	for _, a := range email.Attachments {
+		fmt.Fprintf(w, "Attach:  %s (%s, %d bytes)\n", a.Filename, a.ContentType, a.Size)
+	}
+	fmt.Fprintln(w)
+
+	body := email.Text
+	if body == "" && email.HTML != "" {
+		body = "(HTML only, use -raw to see the source)"
+	}
+	fmt.Fprintln(w, strings.TrimRight(body, "\r\n"))
+}
+
+func addressList(addrs []mailcatcher.Address) string {
+	list := make([]string, len(addrs))
+	for i, a := range addrs {
+		list[i] = a.Address
+	}
+	return strings.Join(list, ", ")
+}
+
+func printJSON(v any) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/andmetoo/mailcatcher"
+)
+
+// runCodegen implements "mailcatcher codegen [flags] <id>".
+func runCodegen(args []string) int {
+	fs := flag.NewFlagSet("codegen", flag.ExitOnError)
+	newClient := apiFlags(fs)
+	name := fs.String("name", "fixture", "Name of the generated variable")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mailcatcher codegen [flags] <id>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	email, err := newClient().Get(context.Background(), fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	src, err := mailcatcher.GoFixture(email, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(src)
+	return 0
+}
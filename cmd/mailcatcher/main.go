@@ -2,15 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/andmetoo/mailcatcher"
+	"github.com/emersion/go-smtp"
 )
 
 var (
@@ -20,10 +25,107 @@ var (
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "codegen":
+			os.Exit(runCodegen(os.Args[2:]))
+		case "list":
+			os.Exit(runList(os.Args[2:]))
+		case "show":
+			os.Exit(runShow(os.Args[2:]))
+		case "tail":
+			os.Exit(runTail(os.Args[2:]))
+		case "clear":
+			os.Exit(runClear(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		}
+	}
+
 	smtpPort := flag.Int("smtp-port", 1025, "SMTP server port")
 	httpPort := flag.Int("http-port", 8025, "HTTP API server port")
+	pop3Port := flag.Int("pop3-port", -1, "Serve captured mail over POP3 on this port (default disabled)")
+	imapPort := flag.Int("imap-port", -1, "Serve captured mail over read-only IMAP on this port (default disabled)")
+	smtpsPort := flag.Int("smtps-port", -1, "Also accept SMTP with implicit TLS on this port, needs -tls-cert (default disabled)")
+	submissionPort := flag.Int("submission-port", -1, "Also accept submission on this port, requiring AUTH and STARTTLS if -tls-cert is set (default disabled)")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate file enabling STARTTLS")
+	tlsKey := flag.String("tls-key", "", "PEM private key file for -tls-cert")
+	bind := flag.String("bind", "", "Address to listen on, e.g. 127.0.0.1 (default all interfaces)")
 	showVersion := flag.Bool("version", false, "Show version information")
-	verbose := flag.Bool("verbose", false, "Enable verbose logging")
+	verbose := flag.Bool("verbose", false, "Enable verbose logging, same as -log-level debug")
+	logLevel := flag.String("log-level", "warn", "Server log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Server log format: text or json")
+	profileName := flag.String("profile", "", "Server behavior profile: "+strings.Join(mailcatcher.ProfileNames(), ", "))
+	extensions := flag.String("extensions", "", "Comma-separated SMTP extensions to advertise (+NAME) or hide (-NAME), e.g. -PIPELINING,+DSN")
+	storeURL := flag.String("store", "", "Message store URL: bolt:///path/to/mail.db to persist mail, or redis://localhost:6379/0 for cluster mode")
+	dataDir := flag.String("data-dir", "", "Keep captured mail in this directory across restarts (or MAILCATCHER_DATA_DIR)")
+	compress := flag.String("compress", "", "Compress stored email bodies: gzip or zstd")
+	forwardTo := flag.String("forward-to", "", "Mirror captured emails to another mailcatcher's HTTP API (e.g. http://aggregate:8025)")
+	forwardToken := flag.String("forward-token", "", "Bearer token for the HTTP API of -forward-to and -relay-to instances (or MAILCATCHER_FORWARD_TOKEN)")
+	quotaMessages := flag.Int("quota-messages", 0, "Maximum messages per recipient mailbox before 452 mailbox full (0 = unlimited)")
+	quotaBytes := flag.Int64("quota-bytes", 0, "Maximum total bytes per recipient mailbox before 452 mailbox full (0 = unlimited)")
+	maxConnections := flag.Int("max-connections", 0, "Maximum open SMTP connections before 421 too many connections (0 = unlimited)")
+	maxConnectionsPerIP := flag.Int("max-connections-per-ip", 0, "Maximum open SMTP connections per client IP (0 = unlimited)")
+	maxMessagesPerConn := flag.Int("max-messages-per-connection", 0, "Messages a connection may send before it is closed with 421 (0 = unlimited)")
+	rateLimit := flag.Int("rate-limit", 0, "Messages per client IP per -rate-window before 451 rate limited (0 = unlimited)")
+	rateWindow := flag.Duration("rate-window", time.Minute, "Sliding window of -rate-limit")
+	trustedProxies := flag.String("trusted-proxies", "", "Comma-separated IPs or CIDR networks of load balancers in front of mailcatcher (e.g. 10.0.0.0/8)")
+	proxyProtocol := flag.Bool("proxy-protocol", false, "Read the client address of SMTP connections from -trusted-proxies from a PROXY protocol v1/v2 header")
+	forwardedFor := flag.Bool("forwarded-for", false, "Read the client address of HTTP requests from -trusted-proxies from X-Forwarded-For")
+	holdTo := flag.String("hold-to", "", "Comma-separated recipient patterns to place on hold (e.g. *@legal.example.com)")
+	apiToken := flag.String("api-token", "", "Require this bearer token for the HTTP API (or MAILCATCHER_API_TOKEN)")
+	apiUser := flag.String("api-user", "", "Require HTTP basic authentication with this username for the HTTP API")
+	apiPassword := flag.String("api-password", "", "Password required with -api-user (or MAILCATCHER_API_PASSWORD)")
+	authUser := flag.String("auth-user", "", "Require clients to AUTH PLAIN with this username")
+	authPassword := flag.String("auth-password", "", "Password required with -auth-user (or MAILCATCHER_AUTH_PASSWORD)")
+	rejectAuth := flag.Bool("reject-auth", false, "Fail every AUTH attempt with 535 5.7.8")
+	relayAddr := flag.String("relay", "", "Upstream SMTP server (host:port) that captured emails can be released to")
+	relayUser := flag.String("relay-user", "", "Username for the release relay")
+	relayPassword := flag.String("relay-password", "", "Password for the release relay (or MAILCATCHER_RELAY_PASSWORD)")
+	relayAllow := flag.String("relay-allow", "", "Comma-separated patterns of other recipients the release endpoint may send to (e.g. *@ourcompany.com)")
+	relayTo := flag.String("relay-to", "", "Comma-separated recipient patterns whose mail is also delivered through -relay, or pattern=URL to post it to another mailcatcher (e.g. *@ourcompany.com)")
+	relayHeader := flag.String("relay-header", "", "Comma-separated Name:pattern header matches whose mail is also delivered through -relay (e.g. X-Deliver:yes)")
+	maxMessageBytes := flag.Int64("max-message-bytes", 0, "Reject messages larger than this with 552 5.3.4 (0 = unlimited)")
+	maxRecipients := flag.Int("max-recipients", 0, "Reject recipients past this many per message with 452 4.5.3 (0 = unlimited)")
+	readTimeout := flag.Duration("read-timeout", 0, "Close SMTP connections idle for this long with 421 4.4.2 (0 = no timeout)")
+	retainMessages := flag.Int("retain-messages", 0, "Keep at most this many messages, evicting the oldest (0 = unlimited)")
+	captureMode := flag.String("capture", "", "How much of each message to keep: full, headers, or count to only count messages")
+	redact := flag.String("redact", "", "Regular expression whose matches are replaced with [REDACTED] before messages are stored (e.g. [0-9]{16})")
+	captureBodyBytes := flag.Int("capture-body-bytes", 0, "Truncate stored messages to this many bytes (0 = unlimited)")
+	retainBytes := flag.Int64("retain-bytes", 0, "Keep at most this many bytes of messages, evicting the oldest (0 = unlimited)")
+	retainAge := flag.Duration("retain-age", 0, "Evict messages older than this, e.g. 72h (0 = forever)")
+	messageTTL := flag.Duration("message-ttl", 0, "Delete messages this long after capture, e.g. 1h; same as -retain-age (0 = forever)")
+	alertRate := flag.Int("alert-rate", 0, "Warn when more messages than this arrive per minute (0 = off)")
+	alertStoreBytes := flag.Int64("alert-store-bytes", 0, "Warn when stored messages exceed this many bytes (0 = off)")
+	alertMessageBytes := flag.Int64("alert-message-bytes", 0, "Warn about messages larger than this many bytes (0 = off)")
+	webhooks := flag.String("webhook", "", "Comma-separated URLs to POST every captured email to as JSON")
+	webhookSecret := flag.String("webhook-secret", "", "Sign webhook bodies with HMAC-SHA256 using this secret (or MAILCATCHER_WEBHOOK_SECRET)")
+	alertWebhook := flag.String("alert-webhook", "", "POST alerts as JSON to this URL")
+	validate := flag.Bool("validate", false, "Lint message headers: missing Date or Message-ID, repeated fields, 8-bit bytes")
+	dkimKeys := flag.String("dkim-keys", "", "Comma-separated DKIM key records to verify signatures against, as name=record (e.g. mail._domainkey.example.com=v=DKIM1; k=rsa; p=MIIB...)")
+	spfRecords := flag.String("spf-records", "", "Comma-separated SPF policies to check senders against, as domain=record (e.g. example.com=v=spf1 ip4:10.0.0.0/8 -all)")
+	attachmentPolicy := flag.String("attachment-policy", "", "Check attachments for executables, macros, double extensions and mismatched types: flag or reject")
+	strictData := flag.Bool("strict-data", false, "Reject messages with bare CR/LF, improper dot-stuffing or SMTP smuggling sequences")
+	exportMbox := flag.String("export-mbox", "", "Write all captured mail to this mbox file on shutdown")
+	exportMaildir := flag.String("export-maildir", "", "Write all captured mail to this Maildir on shutdown")
+	recordDir := flag.String("record-dir", "", "Save every SMTP session to this directory for later replay")
+	namespaceDomain := flag.String("namespace-domain", "", "Domain whose subdomains name namespaces, so user@checkout.<domain> belongs to namespace checkout")
+	rejectTo := flag.String("reject-to", "", "Comma-separated pattern=reply rules rejecting recipients, with a provider:kind reply or an SMTP code (e.g. *@blocked.example.com=gmail:policy-blocked)")
+	bounceTo := flag.String("bounce-to", "", "Comma-separated patterns of recipients whose mail is accepted and then bounced to the sender, optionally =reply (e.g. bounce@*,*@gone.example.com=550 5.1.1 No such user)")
+	rejectFrom := flag.String("reject-from", "", "Comma-separated pattern=reply rules rejecting senders (e.g. *@spam.example.com=550 5.7.1 Sender blocked)")
+	failDataRate := flag.Float64("fail-data-rate", 0, "Probability from 0 to 1 of refusing a message at the end of DATA")
+	failDataReply := flag.String("fail-data-reply", "", "Reply to refused DATA, a provider:kind or an SMTP code (default 451 4.3.0)")
+	dropRate := flag.Float64("drop-rate", 0, "Probability from 0 to 1 of dropping the connection mid-transaction")
+	latency := flag.Duration("latency", 0, "Delay every SMTP reply by this long, e.g. 500ms")
+	dataLatency := flag.Duration("data-latency", 0, "Further delay accepting each message by this long")
+	latencyJitter := flag.Duration("latency-jitter", 0, "Add a random delay of up to this long to each delay")
+	scenarioFile := flag.String("scenario", "", "YAML or JSON file scripting the replies of consecutive SMTP sessions, e.g. to refuse the first attempt with 451")
+	dropAt := flag.String("drop-at", mailcatcher.DropAtData, "Command at which connections are dropped: mail, rcpt or data")
 
 	flag.Parse()
 
@@ -50,6 +152,12 @@ func main() {
 		}
 	}
 
+	if !isFlagPassed("bind") {
+		if host := os.Getenv("MAILCATCHER_BIND"); host != "" {
+			*bind = host
+		}
+	}
+
 	logger := log.New(os.Stdout, "[mailcatcher] ", log.LstdFlags)
 
 	logger.Printf("Starting mailcatcher %s", version)
@@ -57,11 +165,434 @@ func main() {
 	logger.Printf("HTTP API will listen on port %d", *httpPort)
 
 	// Create server
-	server := mailcatcher.New(*smtpPort, *httpPort)
+	opts := []mailcatcher.Option{
+		mailcatcher.WithHost(*bind),
+		mailcatcher.WithSMTPPort(*smtpPort),
+		mailcatcher.WithHTTPPort(*httpPort),
+	}
+	if *pop3Port >= 0 {
+		opts = append(opts, mailcatcher.WithPOP3Port(*pop3Port))
+	}
+	if *imapPort >= 0 {
+		opts = append(opts, mailcatcher.WithIMAPPort(*imapPort))
+	}
+	if *maxMessageBytes > 0 {
+		opts = append(opts, mailcatcher.WithMaxMessageBytes(*maxMessageBytes))
+	}
+	if *tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			logger.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		opts = append(opts, mailcatcher.WithTLS(&tls.Config{Certificates: []tls.Certificate{cert}}))
+	}
+	if *smtpsPort >= 0 {
+		opts = append(opts, mailcatcher.WithListener(mailcatcher.Listener{Name: "smtps", Port: *smtpsPort, ImplicitTLS: true}))
+	}
+	if *submissionPort >= 0 {
+		opts = append(opts, mailcatcher.WithListener(mailcatcher.Listener{
+			Name: "submission", Port: *submissionPort, RequireAuth: true, RequireTLS: *tlsCert != "",
+		}))
+	}
+	server := mailcatcher.NewWithOptions(opts...)
 
-	// Set logger if verbose
+	var level slog.Level
 	if *verbose {
-		server.SetLogger(logger)
+		level = slog.LevelDebug
+	} else if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		logger.Fatalf("Invalid log level %q, expected debug, info, warn or error", *logLevel)
+	}
+	switch *logFormat {
+	case "text":
+		server.SetLogHandler(mailcatcher.NewLoggerHandler(logger, level))
+	case "json":
+		server.SetLogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	default:
+		logger.Fatalf("Invalid log format %q, expected text or json", *logFormat)
+	}
+
+	// Behavior profile
+	if *profileName != "" {
+		profile, err := mailcatcher.LookupProfile(*profileName)
+		if err != nil {
+			logger.Fatalf("Invalid profile: %v", err)
+		}
+		server.SetProfile(profile)
+		logger.Printf("Behaving like %s (%s)", profile.Name, profile.Domain)
+	}
+
+	// Session limits, overriding those of the profile
+	if *maxRecipients > 0 {
+		server.SetMaxRecipients(*maxRecipients)
+	}
+	if *readTimeout > 0 {
+		server.SetReadTimeout(*readTimeout)
+	}
+
+	// Advertised SMTP extensions
+	if *extensions != "" {
+		ext := server.Extensions()
+		for _, name := range strings.Split(*extensions, ",") {
+			name = strings.TrimSpace(name)
+			enabled := !strings.HasPrefix(name, "-")
+			if err := ext.Set(strings.TrimLeft(name, "+-"), enabled); err != nil {
+				logger.Fatalf("Invalid extensions: %v", err)
+			}
+		}
+		server.SetExtensions(ext)
+	}
+
+	// Persistent or shared store
+	if *dataDir == "" {
+		*dataDir = os.Getenv("MAILCATCHER_DATA_DIR")
+	}
+	if *dataDir != "" {
+		if *storeURL != "" {
+			logger.Fatalf("Only one of -data-dir and -store can be used")
+		}
+		store, err := mailcatcher.NewDataDirStore(*dataDir)
+		if err != nil {
+			logger.Fatalf("Failed to open data directory: %v", err)
+		}
+		defer store.Close()
+		server.SetStore(store)
+		logger.Printf("Keeping mail in %s", *dataDir)
+	}
+	if *storeURL != "" {
+		store, err := openStore(*storeURL)
+		if err != nil {
+			logger.Fatalf("Failed to open store: %v", err)
+		}
+		defer store.Close()
+		server.SetStore(store)
+		logger.Printf("Using store %s", *storeURL)
+	}
+
+	// Body compression
+	if *compress != "" {
+		store, err := mailcatcher.NewCompressedStore(server.Store(), mailcatcher.Compression(*compress))
+		if err != nil {
+			logger.Fatalf("Failed to enable compression: %v", err)
+		}
+		server.SetStore(store)
+		logger.Printf("Compressing stored bodies with %s", *compress)
+	}
+
+	// Federation
+	if *forwardToken == "" {
+		*forwardToken = os.Getenv("MAILCATCHER_FORWARD_TOKEN")
+	}
+	if *forwardTo != "" {
+		server.SetForwardURL(*forwardTo)
+		server.SetForwardToken(*forwardToken)
+		logger.Printf("Forwarding captured emails to %s", *forwardTo)
+	}
+
+	// Mailbox quotas
+	if *quotaMessages > 0 || *quotaBytes > 0 {
+		server.SetQuota(mailcatcher.Quota{Messages: *quotaMessages, Bytes: *quotaBytes})
+		logger.Printf("Mailbox quota: %d messages, %d bytes", *quotaMessages, *quotaBytes)
+	}
+
+	// Connection and message rate limits
+	if *maxConnections != 0 || *maxConnectionsPerIP != 0 || *maxMessagesPerConn != 0 || *rateLimit != 0 {
+		limit := mailcatcher.RateLimit{
+			MaxConnections:           *maxConnections,
+			MaxConnectionsPerIP:      *maxConnectionsPerIP,
+			MaxMessagesPerConnection: *maxMessagesPerConn,
+			MessagesPerIP:            *rateLimit,
+			Window:                   *rateWindow,
+		}
+		if err := server.SetRateLimit(limit); err != nil {
+			logger.Fatalf("Invalid rate limit: %v", err)
+		}
+		logger.Printf("Rate limit: %d connections (%d per IP), %d messages per connection, %d messages per IP per %v",
+			*maxConnections, *maxConnectionsPerIP, *maxMessagesPerConn, *rateLimit, *rateWindow)
+	}
+
+	// Load balancers
+	if *trustedProxies != "" || *proxyProtocol || *forwardedFor {
+		proxies := mailcatcher.TrustedProxies{ProxyProtocol: *proxyProtocol, ForwardedFor: *forwardedFor}
+		for _, network := range strings.Split(*trustedProxies, ",") {
+			if network = strings.TrimSpace(network); network != "" {
+				proxies.Networks = append(proxies.Networks, network)
+			}
+		}
+		if err := server.SetTrustedProxies(proxies); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		logger.Printf("Trusting proxies %s (PROXY protocol: %v, X-Forwarded-For: %v)", *trustedProxies, *proxyProtocol, *forwardedFor)
+	}
+
+	// Hold rules
+	for _, pattern := range strings.Split(*holdTo, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			server.AddHoldRule(mailcatcher.HoldRecipient(pattern))
+			logger.Printf("Holding mail to %s for review", pattern)
+		}
+	}
+
+	// HTTP API authentication
+	token := *apiToken
+	if token == "" {
+		token = os.Getenv("MAILCATCHER_API_TOKEN")
+	}
+	if token != "" {
+		server.SetAPIToken(token)
+		logger.Println("Requiring a bearer token for the HTTP API")
+	}
+	if *apiUser != "" {
+		password := *apiPassword
+		if password == "" {
+			password = os.Getenv("MAILCATCHER_API_PASSWORD")
+		}
+		server.SetAPIBasicAuth(*apiUser, password)
+		logger.Printf("Requiring basic authentication as %s for the HTTP API", *apiUser)
+	}
+
+	// SMTP authentication
+	if *authUser != "" {
+		password := *authPassword
+		if password == "" {
+			password = os.Getenv("MAILCATCHER_AUTH_PASSWORD")
+		}
+		server.SetAuth(*authUser, password)
+		logger.Printf("Requiring AUTH as %s", *authUser)
+	}
+	if *rejectAuth {
+		server.RejectAuth(nil)
+		logger.Println("Rejecting every AUTH attempt")
+	}
+
+	// Release relay
+	if *relayAddr != "" {
+		password := *relayPassword
+		if password == "" {
+			password = os.Getenv("MAILCATCHER_RELAY_PASSWORD")
+		}
+		relay := mailcatcher.Relay{Addr: *relayAddr, Username: *relayUser, Password: password}
+		for _, pattern := range strings.Split(*relayAllow, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				relay.AllowedRecipients = append(relay.AllowedRecipients, pattern)
+			}
+		}
+		server.SetRelay(relay)
+		if token == "" && *apiUser == "" {
+			logger.Printf("Relaying to %s; releasing through the API needs -api-token or -api-user", *relayAddr)
+		} else {
+			logger.Printf("Releasing emails to %s", *relayAddr)
+		}
+	}
+
+	// Relay rules
+	relayRule := func(rule mailcatcher.RelayRule, target string) {
+		if target != "" {
+			rule.ForwardURL, rule.ForwardToken = target, *forwardToken
+		} else if relay := server.Relay(); relay != nil {
+			rule.Relay = relay
+		} else {
+			logger.Fatalf("Invalid relay rule: -relay is required to deliver mail matching %s%s", rule.Recipient, rule.Header)
+		}
+		if err := server.AddRelayRule(rule); err != nil {
+			logger.Fatalf("%v", err)
+		}
+	}
+	for _, spec := range strings.Split(*relayTo, ",") {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			pattern, target, _ := strings.Cut(spec, "=")
+			relayRule(mailcatcher.RelayRule{Recipient: pattern}, target)
+			logger.Printf("Delivering mail to %s", pattern)
+		}
+	}
+	for _, spec := range strings.Split(*relayHeader, ",") {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			name, pattern, ok := strings.Cut(spec, ":")
+			if !ok {
+				logger.Fatalf("Invalid -relay-header %q: expected Name:pattern", spec)
+			}
+			relayRule(mailcatcher.RelayRule{Header: strings.TrimSpace(name), Value: strings.TrimSpace(pattern)}, "")
+			logger.Printf("Delivering mail with %s", spec)
+		}
+	}
+
+	// Retention limits
+	retention := mailcatcher.Retention{MaxMessages: *retainMessages, MaxBytes: *retainBytes, MaxAge: *retainAge}
+	if *messageTTL > 0 {
+		retention.MaxAge = *messageTTL
+	}
+	if retention != (mailcatcher.Retention{}) {
+		server.SetRetention(retention)
+		logger.Printf("Retaining at most %d messages, %d bytes, %s (0 = unlimited)", retention.MaxMessages, retention.MaxBytes, retention.MaxAge)
+	}
+
+	// Redaction
+	if *redact != "" {
+		re, err := regexp.Compile(*redact)
+		if err != nil {
+			logger.Fatalf("Invalid -redact: %v", err)
+		}
+		server.AddProcessor(mailcatcher.Redact(re))
+		logger.Printf("Redacting %s", *redact)
+	}
+
+	// Capture mode
+	if *captureMode != "" || *captureBodyBytes > 0 {
+		if err := server.SetCapture(mailcatcher.Capture{Mode: *captureMode, MaxBodyBytes: *captureBodyBytes}); err != nil {
+			logger.Fatalf("Invalid capture mode: %v", err)
+		}
+		logger.Printf("Capture mode %s, keeping at most %d bytes per message (0 = unlimited)", *captureMode, *captureBodyBytes)
+	}
+
+	// Webhooks
+	secret := *webhookSecret
+	if secret == "" {
+		secret = os.Getenv("MAILCATCHER_WEBHOOK_SECRET")
+	}
+	for _, url := range strings.Split(*webhooks, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			server.AddWebhook(mailcatcher.Webhook{URL: url, Secret: secret})
+			logger.Printf("Posting captured emails to %s", url)
+		}
+	}
+
+	// Alert thresholds
+	if *alertRate > 0 || *alertStoreBytes > 0 || *alertMessageBytes > 0 {
+		server.SetThresholds(mailcatcher.Thresholds{
+			MessagesPerMinute: *alertRate,
+			StoreBytes:        *alertStoreBytes,
+			MessageBytes:      *alertMessageBytes,
+			WebhookURL:        *alertWebhook,
+		})
+	}
+
+	// Message validation
+	if *validate || *dkimKeys != "" || *spfRecords != "" {
+		v := mailcatcher.Validation{Headers: *validate}
+		var err error
+		if *dkimKeys != "" {
+			if v.DKIMKeys, err = parseRecords(*dkimKeys); err != nil {
+				logger.Fatalf("Invalid DKIM keys: %v", err)
+			}
+		}
+		if *spfRecords != "" {
+			if v.SPFRecords, err = parseRecords(*spfRecords); err != nil {
+				logger.Fatalf("Invalid SPF records: %v", err)
+			}
+		}
+		server.SetValidation(v)
+		logger.Printf("Validating messages: headers %v, %d DKIM keys, %d SPF records", v.Headers, len(v.DKIMKeys), len(v.SPFRecords))
+	}
+
+	// Attachment policy
+	switch *attachmentPolicy {
+	case "":
+	case "flag", "reject":
+		policy := mailcatcher.DefaultAttachmentPolicy()
+		policy.Reject = *attachmentPolicy == "reject"
+		server.SetAttachmentPolicy(policy)
+		logger.Printf("Attachment policy: %s violations", *attachmentPolicy)
+	default:
+		logger.Fatalf("Invalid attachment policy %q, expected flag or reject", *attachmentPolicy)
+	}
+
+	// Strict DATA checks
+	if *strictData {
+		server.SetStrictData(true)
+		logger.Println("Rejecting malformed DATA content")
+	}
+
+	// Namespaces
+	if *namespaceDomain != "" {
+		server.SetNamespaceDomain(*namespaceDomain)
+	}
+
+	// Session recording
+	if *recordDir != "" {
+		server.SetRecordDir(*recordDir)
+		logger.Printf("Recording SMTP sessions to %s", *recordDir)
+	}
+
+	// Simulated rejections
+	for _, r := range []struct {
+		rules  string
+		reject func(string, *smtp.SMTPError)
+		what   string
+	}{
+		{*rejectTo, server.RejectRecipient, "mail to"},
+		{*rejectFrom, server.RejectSender, "mail from"},
+	} {
+		for _, rule := range strings.Split(r.rules, ",") {
+			if rule = strings.TrimSpace(rule); rule == "" {
+				continue
+			}
+			pattern, ref, ok := strings.Cut(rule, "=")
+			if !ok {
+				logger.Fatalf("Invalid reject rule %q, expected pattern=reply", rule)
+			}
+			reply, err := mailcatcher.ParseReply(ref)
+			if err != nil {
+				logger.Fatalf("Invalid reject rule: %v", err)
+			}
+			r.reject(pattern, reply)
+			logger.Printf("Rejecting %s %s with %d %s", r.what, pattern, reply.Code, ref)
+		}
+	}
+
+	// Simulated bounces
+	for _, rule := range strings.Split(*bounceTo, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		pattern, ref, _ := strings.Cut(rule, "=")
+		var reply *smtp.SMTPError
+		if ref != "" {
+			var err error
+			if reply, err = mailcatcher.ParseReply(ref); err != nil {
+				logger.Fatalf("Invalid bounce rule: %v", err)
+			}
+		}
+		server.BounceRecipient(pattern, reply)
+		logger.Printf("Bouncing mail to %s", pattern)
+	}
+
+	// Failure injection
+	if *failDataRate > 0 || *dropRate > 0 {
+		faults := mailcatcher.Faults{
+			DataFailureRate: *failDataRate,
+			DropRate:        *dropRate,
+			DropAt:          *dropAt,
+		}
+		if *failDataReply != "" {
+			reply, err := mailcatcher.ParseReply(*failDataReply)
+			if err != nil {
+				logger.Fatalf("Invalid -fail-data-reply: %v", err)
+			}
+			faults.DataFailure = reply
+		}
+		if err := server.SetFaults(faults); err != nil {
+			logger.Fatalf("Invalid failure injection: %v", err)
+		}
+		logger.Printf("Injecting faults: %.0f%% DATA failures, %.0f%% dropped connections at %s", *failDataRate*100, *dropRate*100, *dropAt)
+	}
+
+	// Scripted scenario
+	if *scenarioFile != "" {
+		scenario, err := mailcatcher.LoadScenario(*scenarioFile)
+		if err != nil {
+			logger.Fatalf("Invalid scenario: %v", err)
+		}
+		if err := server.SetScenario(scenario); err != nil {
+			logger.Fatalf("Invalid scenario: %v", err)
+		}
+		logger.Printf("Scripting %d SMTP sessions from %s (greylisting %v)", len(scenario.Sessions), *scenarioFile, scenario.Greylist)
+	}
+
+	// Slow server simulation
+	if *latency > 0 || *dataLatency > 0 {
+		if err := server.SetLatency(mailcatcher.Latency{Reply: *latency, Data: *dataLatency, Jitter: *latencyJitter}); err != nil {
+			logger.Fatalf("Invalid latency: %v", err)
+		}
+		logger.Printf("Delaying replies by %v and DATA by %v (jitter %v)", *latency, *dataLatency, *latencyJitter)
 	}
 
 	// Start server
@@ -69,15 +600,32 @@ func main() {
 		logger.Fatalf("Failed to start server: %v", err)
 	}
 
-	logger.Printf("SMTP server started on :%d", *smtpPort)
-	logger.Printf("HTTP API started on :%d", *httpPort)
-	logger.Printf("Web interface: http://localhost:%d/api/v1/emails", *httpPort)
+	logger.Printf("SMTP server started on %s", server.SMTPServer().Addr)
+	logger.Printf("HTTP API started on %s", server.HTTPServer().Addr)
+	for _, name := range []string{"smtps", "submission"} {
+		if addr := server.ListenerAddr(name); addr != "" {
+			logger.Printf("SMTP listener %s started on %s", name, addr)
+		}
+	}
+	if addr := server.POP3Addr(); addr != "" {
+		logger.Printf("POP3 server started on %s", addr)
+	}
+	if addr := server.IMAPAddr(); addr != "" {
+		logger.Printf("IMAP server started on %s", addr)
+	}
+	logger.Printf("Web interface: http://%s/", server.HTTPAddr())
 	logger.Println("Press Ctrl+C to stop")
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal or a listener failure
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	failed := false
+	select {
+	case <-sigChan:
+	case err := <-server.Err():
+		logger.Printf("Server failed: %v", err)
+		failed = true
+	}
 
 	logger.Println("Shutting down...")
 
@@ -90,7 +638,55 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Archive the session's mail
+	if *exportMbox != "" {
+		if err := writeMbox(server, *exportMbox); err != nil {
+			logger.Printf("Failed to export mbox: %v", err)
+		} else {
+			logger.Printf("Exported mail to %s", *exportMbox)
+		}
+	}
+	if *exportMaildir != "" {
+		if err := server.ExportMaildir(*exportMaildir); err != nil {
+			logger.Printf("Failed to export maildir: %v", err)
+		} else {
+			logger.Printf("Exported mail to %s", *exportMaildir)
+		}
+	}
+
 	logger.Println("Server stopped")
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// writeMbox exports the server's mail to an mbox file.
+func writeMbox(server *mailcatcher.Server, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := server.ExportMbox(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseRecords parses a comma-separated list of name=record pairs.
+func parseRecords(list string) (map[string]string, error) {
+	records := map[string]string{}
+	for _, pair := range strings.Split(list, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, record, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected name=record, got %q", pair)
+		}
+		records[name] = record
+	}
+	return records, nil
 }
 
 // isFlagPassed checks if a flag was explicitly passed
@@ -103,3 +699,17 @@ func isFlagPassed(name string) bool {
 	})
 	return found
 }
+
+// closingStore is a Store holding an open file or connection.
+type closingStore interface {
+	mailcatcher.Store
+	Close() error
+}
+
+// openStore opens the store named by a -store URL.
+func openStore(url string) (closingStore, error) {
+	if path, ok := strings.CutPrefix(url, "bolt://"); ok {
+		return mailcatcher.NewBoltStore(path)
+	}
+	return mailcatcher.NewRedisStore(url)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"github.com/andmetoo/mailcatcher"
+)
+
+// desktopNotifier shows a desktop notification for a new message using the
+// platform's notification tool, for "mailcatcher tail -notify".
+func desktopNotifier(email mailcatcher.Email) error {
+	title := "New mail from " + email.From.String()
+	text := email.Subject
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(text), strconv.Quote(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	default:
+		cmd = exec.Command("notify-send", "--app-name=mailcatcher", title, text)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to show desktop notification: %w: %s", err, out)
+	}
+	return nil
+}
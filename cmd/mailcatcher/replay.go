@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/andmetoo/mailcatcher"
+)
+
+// runReplay implements "mailcatcher replay [flags] recording.json...".
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:1025", "SMTP server to replay sessions against")
+	speed := fs.Float64("speed", 1, "Timing multiplier (0 = as fast as the server replies)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mailcatcher replay [flags] recording.json...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	for _, path := range fs.Args() {
+		rec, err := mailcatcher.LoadRecording(path)
+		if err == nil {
+			err = rec.Replay(context.Background(), *addr, mailcatcher.ReplayOptions{Speed: *speed})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		fmt.Printf("Replayed %s against %s\n", path, *addr)
+	}
+	return 0
+}
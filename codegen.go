@@ -0,0 +1,139 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	packagePath  = reflect.TypeOf(Email{}).PkgPath()
+)
+
+// GoFixture returns Go source declaring a variable with the given name
+// that holds email as a literal, so a captured real-world message can be
+// turned into a unit-test fixture in one step. Zero fields are omitted.
+func GoFixture(email Email, name string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "var %s = ", name)
+	writeLiteral(&b, reflect.ValueOf(email), false)
+	b.WriteString("\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format fixture: %w", err)
+	}
+	return src, nil
+}
+
+// writeLiteral writes v as a Go expression. Composite literals nested in
+// slices and maps omit their type, as gofmt -s would.
+func writeLiteral(b *bytes.Buffer, v reflect.Value, elided bool) {
+	t := v.Type()
+	switch {
+	case t == timeType:
+		tm := v.Interface().(time.Time).UTC()
+		fmt.Fprintf(b, "time.Date(%d, time.%s, %d, %d, %d, %d, %d, time.UTC)",
+			tm.Year(), tm.Month(), tm.Day(), tm.Hour(), tm.Minute(), tm.Second(), tm.Nanosecond())
+		return
+	case t == durationType:
+		fmt.Fprintf(b, "%d * time.Nanosecond", v.Int())
+		return
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		b.WriteString("[]byte(" + quoteString(string(v.Bytes())) + ")")
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		b.WriteString(quoteString(v.String()))
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		fmt.Fprintf(b, "%v", v.Interface())
+	case reflect.Pointer:
+		b.WriteString("&")
+		writeLiteral(b, v.Elem(), false)
+	case reflect.Slice, reflect.Array:
+		if !elided {
+			b.WriteString(typeName(t))
+		}
+		b.WriteString("{\n")
+		for i := range v.Len() {
+			writeLiteral(b, v.Index(i), true)
+			b.WriteString(",\n")
+		}
+		b.WriteString("}")
+	case reflect.Map:
+		if !elided {
+			b.WriteString(typeName(t))
+		}
+		b.WriteString("{\n")
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			writeLiteral(b, k, true)
+			b.WriteString(": ")
+			writeLiteral(b, v.MapIndex(k), true)
+			b.WriteString(",\n")
+		}
+		b.WriteString("}")
+	case reflect.Struct:
+		if !elided {
+			b.WriteString(typeName(t))
+		}
+		b.WriteString("{\n")
+		for i := range t.NumField() {
+			field := v.Field(i)
+			if !t.Field(i).IsExported() || field.IsZero() {
+				continue
+			}
+			b.WriteString(t.Field(i).Name + ": ")
+			writeLiteral(b, field, false)
+			b.WriteString(",\n")
+		}
+		b.WriteString("}")
+	default:
+		fmt.Fprintf(b, "nil /* unsupported %s */", t)
+	}
+}
+
+// typeName returns the name of t as written outside this package.
+func typeName(t reflect.Type) string {
+	switch {
+	case t.Name() == "":
+	case t.PkgPath() == "":
+		return t.Name() // predeclared
+	case t.PkgPath() == packagePath:
+		return "mailcatcher." + t.Name()
+	default:
+		return path.Base(t.PkgPath()) + "." + t.Name()
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), typeName(t.Elem()))
+	case reflect.Map:
+		return "map[" + typeName(t.Key()) + "]" + typeName(t.Elem())
+	case reflect.Pointer:
+		return "*" + typeName(t.Elem())
+	}
+	return t.String()
+}
+
+// quoteString prefers a raw string literal for readable multi-line bodies.
+func quoteString(s string) string {
+	if strings.Contains(s, "\n") && utf8.ValidString(s) && !strings.ContainsAny(s, "`\r\x00") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
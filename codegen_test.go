@@ -0,0 +1,49 @@
+package mailcatcher
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoFixture(t *testing.T) {
+	email := Email{
+		ID:      "msg-0",
+		From:    newAddress("Sender", "sender@example.com"),
+		Subject: `Say "hi"`,
+		Body:    "Subject: Say \"hi\"\r\n\r\nHello\r\n",
+		Time:    time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC),
+		To:      []Address{newAddress("", "user@example.com")},
+		Size:    42,
+		Parts:   []Part{{ContentType: "text/plain", Content: []byte("Hello\r\n")}},
+	}
+
+	src, err := GoFixture(email, "welcomeEmail")
+	if err != nil {
+		t.Fatalf("Failed to generate fixture: %v", err)
+	}
+	code := string(src)
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "fixture.go", "package fixtures\n"+code, 0); err != nil {
+		t.Fatalf("Expected valid Go source, got %v:\n%s", err, code)
+	}
+
+	for _, want := range []string{
+		"var welcomeEmail = mailcatcher.Email{",
+		`Subject: "Say \"hi\""`,
+		"From: mailcatcher.Address{",
+		"To: []mailcatcher.Address{",
+		"time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)",
+		"Size: 42",
+		`Content: []byte("Hello\r\n")`,
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(code), " "), want) {
+			t.Errorf("Expected fixture to contain %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "Cc:") || strings.Contains(code, "Held:") {
+		t.Errorf("Expected zero fields to be omitted, got:\n%s", code)
+	}
+}
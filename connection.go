@@ -0,0 +1,55 @@
+package mailcatcher
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// TLSInfo describes the TLS connection an email was received on.
+type TLSInfo struct {
+	Version     string `json:"version"`      // e.g. "TLS 1.3"
+	CipherSuite string `json:"cipher_suite"` // e.g. "TLS_AES_128_GCM_SHA256"
+	ServerName  string `json:"server_name,omitempty"`
+	Implicit    bool   `json:"implicit,omitempty"` // TLS from the start rather than STARTTLS
+}
+
+// tlsInfo returns the TLS state of the session connection, or nil if the
+// connection is not encrypted.
+func (s *session) tlsInfo() *TLSInfo {
+	state, ok := s.smtpConn.TLSConnectionState()
+	implicit := false
+	if !ok {
+		// With implicit TLS the TLS connection is wrapped in the transcript
+		state, ok = unwrapTLS(s.smtpConn.Conn())
+		implicit = ok
+	}
+	if !ok {
+		return nil
+	}
+	return &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+		Implicit:    implicit,
+	}
+}
+
+// unwrapTLS returns the state of the TLS connection beneath c, if any.
+func unwrapTLS(c net.Conn) (tls.ConnectionState, bool) {
+	for {
+		switch conn := c.(type) {
+		case *tls.Conn:
+			return conn.ConnectionState(), true
+		case *transcriptConn:
+			c = conn.Conn
+		case *slowConn:
+			c = conn.Conn
+		case *limitConn:
+			c = conn.Conn
+		case *timeoutConn:
+			c = conn.Conn
+		default:
+			return tls.ConnectionState{}, false
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package mailcatcher
+
+import (
+	"crypto/tls"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestConnectionMetadata(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	server, addr := NewTestServer(t,
+		WithTLS(serverTLS),
+		WithListener(Listener{Name: "smtps", ImplicitTLS: true, TLS: serverTLS}),
+	)
+
+	// Plain connection
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if err := sendOn(c, nil); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	// STARTTLS and AUTH
+	if c, err = smtp.Dial(addr); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if err := c.Hello("app.example.com"); err != nil {
+		t.Fatalf("Failed to greet: %v", err)
+	}
+	if err := c.StartTLS(clientTLS); err != nil {
+		t.Fatalf("Failed to STARTTLS: %v", err)
+	}
+	if err := sendOn(c, smtp.PlainAuth("", "app", "secret", "127.0.0.1")); err != nil {
+		t.Fatalf("Failed to send with STARTTLS: %v", err)
+	}
+
+	// Implicit TLS
+	conn, err := tls.Dial("tcp", server.ListenerAddr("smtps"), clientTLS)
+	if err != nil {
+		t.Fatalf("Failed to connect with TLS: %v", err)
+	}
+	c, err = smtp.NewClient(conn, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Failed to greet: %v", err)
+	}
+	if err := sendOn(c, nil); err != nil {
+		t.Fatalf("Failed to send with implicit TLS: %v", err)
+	}
+
+	emails := server.Emails()
+	if len(emails) != 3 {
+		t.Fatalf("Expected 3 emails, got %d", len(emails))
+	}
+	plain, starttls, implicit := emails[0], emails[1], emails[2]
+	if plain.TLS != nil || plain.Auth != nil || plain.Helo != "localhost" || !strings.HasPrefix(plain.RemoteAddr, "127.0.0.1:") {
+		t.Errorf("Expected a plain connection from 127.0.0.1, got %+v %+v %q %q", plain.TLS, plain.Auth, plain.Helo, plain.RemoteAddr)
+	}
+	if starttls.TLS == nil || starttls.TLS.Implicit || !strings.HasPrefix(starttls.TLS.Version, "TLS 1.") || starttls.TLS.CipherSuite == "" {
+		t.Errorf("Expected STARTTLS, got %+v", starttls.TLS)
+	}
+	if starttls.Helo != "app.example.com" || starttls.Auth == nil || starttls.Auth.Username != "app" {
+		t.Errorf("Expected app.example.com authenticated as app, got %q %+v", starttls.Helo, starttls.Auth)
+	}
+	if implicit.TLS == nil || !implicit.TLS.Implicit {
+		t.Errorf("Expected implicit TLS, got %+v", implicit.TLS)
+	}
+
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Direct\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if direct := server.Emails()[3]; direct.RemoteAddr != "" || direct.TLS != nil {
+		t.Errorf("Expected no connection metadata for Send, got %q %+v", direct.RemoteAddr, direct.TLS)
+	}
+}
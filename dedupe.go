@@ -0,0 +1,143 @@
+package mailcatcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// hashIgnoredHeaders are left out of Email.Hash, as a sender retrying a
+// message typically sets them anew. A DKIM signature covers the Date and
+// the MIME boundaries, so it changes with them.
+var hashIgnoredHeaders = []string{"Date", "Message-Id", "Dkim-Signature"}
+
+// contentHash returns the hex SHA-256 of the envelope and the raw
+// message without the hashIgnoredHeaders. MIME boundaries, which most
+// libraries pick at random for every attempt, are replaced by their
+// position in the message.
+func contentHash(email Email) string {
+	h := sha256.New()
+	rcpts := make([]string, len(email.Envelope.To))
+	for i, to := range email.Envelope.To {
+		rcpts[i] = strings.ToLower(to)
+	}
+	slices.Sort(rcpts)
+	h.Write([]byte(strings.ToLower(email.Envelope.From) + "\x00" + strings.Join(rcpts, ",") + "\x00"))
+
+	body := boundaryReplacer(email.Body).Replace(email.Body)
+	end := headerEnd(body)
+	skip := false
+	for line := range strings.SplitAfterSeq(body[:end], "\n") {
+		if line == "" {
+			continue
+		}
+		// Folded lines continue the previous header
+		if line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := strings.Cut(line, ":")
+			skip = slices.ContainsFunc(hashIgnoredHeaders, func(ignored string) bool {
+				return strings.EqualFold(strings.TrimSpace(name), ignored)
+			})
+		}
+		if !skip {
+			h.Write([]byte(line))
+		}
+	}
+	h.Write([]byte(body[end:]))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// boundaryReplacer replaces the multipart boundaries of a raw message by
+// their position, outermost first.
+func boundaryReplacer(raw string) *strings.Replacer {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return strings.NewReplacer()
+	}
+	var boundaries []string
+	collectBoundaries(textproto.MIMEHeader(msg.Header), msg.Body, 0, &boundaries)
+
+	// The replacer tries the old strings in order, so a boundary that
+	// starts another must come after it
+	order := make([]int, len(boundaries))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return len(boundaries[b]) - len(boundaries[a]) })
+	var oldnew []string
+	for _, i := range order {
+		oldnew = append(oldnew, boundaries[i], "\x00boundary-"+strconv.Itoa(i))
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// collectBoundaries appends the boundaries of the multipart entity read
+// from r and of the multipart entities it contains.
+func collectBoundaries(header textproto.MIMEHeader, r io.Reader, depth int, boundaries *[]string) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	boundary := params["boundary"]
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || boundary == "" || depth >= maxMIMEDepth {
+		return
+	}
+	if !slices.Contains(*boundaries, boundary) {
+		*boundaries = append(*boundaries, boundary)
+	}
+	mr := multipart.NewReader(r, boundary)
+	for {
+		part, err := mr.NextRawPart()
+		if err != nil {
+			return
+		}
+		collectBoundaries(part.Header, part, depth+1, boundaries)
+	}
+}
+
+// Duplicates returns the groups of captured emails with the same Hash,
+// such as a message delivered again by a retrying sender. Each group is
+// in the order received, and the groups in the order of their first
+// email.
+func (s *Server) Duplicates() [][]Email {
+	return duplicates(s.Emails())
+}
+
+// duplicates groups emails by Hash, leaving out those without duplicates.
+func duplicates(emails []Email) [][]Email {
+	groups := map[string][]Email{}
+	var hashes []string
+	for _, email := range emails {
+		if email.Hash == "" {
+			continue
+		}
+		if _, ok := groups[email.Hash]; !ok {
+			hashes = append(hashes, email.Hash)
+		}
+		groups[email.Hash] = append(groups[email.Hash], email)
+	}
+
+	result := [][]Email{}
+	for _, hash := range hashes {
+		if len(groups[hash]) > 1 {
+			result = append(result, groups[hash])
+		}
+	}
+	return result
+}
+
+// dedupe keeps the first of the emails with the same Hash.
+func dedupe(emails []Email) []Email {
+	seen := map[string]bool{}
+	return slices.DeleteFunc(emails, func(email Email) bool {
+		if email.Hash == "" {
+			return false
+		}
+		dup := seen[email.Hash]
+		seen[email.Hash] = true
+		return dup
+	})
+}
@@ -0,0 +1,123 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	base := newEmail("app@example.com", []string{"user@example.com"},
+		[]byte("Subject: Order\r\nDate: Mon, 02 Jan 2006 15:04:05 +0000\r\nMessage-ID:\r\n <1@example.com>\r\n\r\nShipped\r\n"))
+	retry := newEmail("App@example.com", []string{"USER@example.com"},
+		[]byte("Subject: Order\r\ndate: Tue, 03 Jan 2006 15:04:05 +0000\r\nMessage-ID: <2@example.com>\r\n\r\nShipped\r\n"))
+	if contentHash(base) != contentHash(retry) {
+		t.Error("Expected a retry to have the same hash")
+	}
+
+	for name, other := range map[string]Email{
+		"body":      newEmail("app@example.com", []string{"user@example.com"}, []byte("Subject: Order\r\n\r\nCancelled\r\n")),
+		"subject":   newEmail("app@example.com", []string{"user@example.com"}, []byte("Subject: Refund\r\n\r\nShipped\r\n")),
+		"recipient": newEmail("app@example.com", []string{"other@example.com"}, []byte("Subject: Order\r\n\r\nShipped\r\n")),
+	} {
+		if contentHash(other) == contentHash(base) {
+			t.Errorf("Expected a different %s to change the hash", name)
+		}
+	}
+}
+
+func TestContentHashMultipart(t *testing.T) {
+	// Each attempt gets new random boundaries and a new DKIM signature
+	message := func(signature string) Email {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		boundary := multipart.NewWriter(nil).Boundary()
+		fmt.Fprintf(&buf, "DKIM-Signature: v=1; a=rsa-sha256; d=example.com;\r\n b=%s\r\n", signature)
+		fmt.Fprintf(&buf, "Subject: Invoice\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+		alternative, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + boundary}})
+		inner := multipart.NewWriter(alternative)
+		inner.SetBoundary(boundary)
+		text, _ := inner.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain"}})
+		text.Write([]byte("Your invoice"))
+		html, _ := inner.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html"}})
+		html.Write([]byte("<p>Your invoice</p>"))
+		inner.Close()
+		pdf, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/pdf"}, "Content-Disposition": {"attachment; filename=invoice.pdf"}})
+		pdf.Write([]byte("%PDF-1.4"))
+		mw.Close()
+		return newEmail("app@example.com", []string{"user@example.com"}, buf.Bytes())
+	}
+
+	base, retry := message("c2lnbmF0dXJlMQ=="), message("c2lnbmF0dXJlMg==")
+	if base.Body == retry.Body {
+		t.Fatal("Expected the attempts to differ in their boundaries")
+	}
+	if len(base.Parts) != 3 {
+		t.Fatalf("Expected 3 parts, got %d", len(base.Parts))
+	}
+	if contentHash(base) != contentHash(retry) {
+		t.Error("Expected a multipart retry to have the same hash")
+	}
+
+	changed := message("c2lnbmF0dXJlMQ==")
+	changed.Body = strings.Replace(changed.Body, "%PDF-1.4", "%PDF-1.5", 1)
+	if contentHash(changed) == contentHash(base) {
+		t.Error("Expected a different attachment to change the hash")
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	server := New(0, 0)
+	for _, msg := range []string{
+		"Subject: Order\r\nMessage-ID: <1@example.com>\r\n\r\nShipped\r\n",
+		"Subject: Welcome\r\n\r\nHello\r\n",
+		"Subject: Order\r\nMessage-ID: <2@example.com>\r\n\r\nShipped\r\n",
+		"Subject: Order\r\nMessage-ID: <3@example.com>\r\n\r\nShipped\r\n",
+	} {
+		if err := server.Send("app@example.com", []string{"user@example.com"}, []byte(msg)); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	groups := server.Duplicates()
+	if len(groups) != 1 || len(groups[0]) != 3 {
+		t.Fatalf("Expected 1 group of 3 duplicates, got %v", groups)
+	}
+	if groups[0][0].ID != "msg-0" || groups[0][2].ID != "msg-3" {
+		t.Errorf("Expected the group in the order received, got %s and %s", groups[0][0].ID, groups[0][2].ID)
+	}
+
+	if emails := server.Find(Filter{Dedupe: true}); len(emails) != 2 || emails[0].ID != "msg-0" || emails[1].ID != "msg-1" {
+		t.Errorf("Expected the first of each message, got %v", emails)
+	}
+
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/api/v1/emails?dedupe=true")
+	if err != nil {
+		t.Fatalf("Failed to list emails: %v", err)
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil || list.Total != 2 {
+		t.Errorf("Expected 2 emails, got %d (%v)", list.Total, err)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/emails?dedupe=maybe")
+	if err != nil {
+		t.Fatalf("Failed to list emails: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid dedupe, got %d", resp.StatusCode)
+	}
+}
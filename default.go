@@ -6,7 +6,10 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
+
+	"gitlab.com/tozd/go/errors"
 )
 
 var (
@@ -14,11 +17,19 @@ var (
 	globalMu     sync.Mutex
 )
 
+// defaultPortAttempts is how many consecutive port pairs DefaultServer
+// tries, starting at the configured ones, when a port is taken.
+const defaultPortAttempts = 5
+
 // DefaultServer returns the global mail catcher server or starts it if not running.
 // This is useful for integration tests where you want a shared instance.
 // Ports can be configured via environment variables:
 //   - MAILCATCHER_SMTP_PORT (default: 1025)
 //   - MAILCATCHER_HTTP_PORT (default: 8025)
+//
+// If a port is taken, e.g. by a mailcatcher left running, the next few
+// ports are tried (1026 and 8026, and so on); use SMTPAddr and HTTPAddr
+// to find the ones in use.
 func DefaultServer() (*Server, error) {
 	globalMu.Lock()
 	defer globalMu.Unlock()
@@ -31,13 +42,18 @@ func DefaultServer() (*Server, error) {
 	smtpPort := getEnvInt("MAILCATCHER_SMTP_PORT", 1025)
 	httpPort := getEnvInt("MAILCATCHER_HTTP_PORT", 8025)
 
-	server := New(smtpPort, httpPort)
-	if err := server.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start mail catcher: %w", err)
+	var err error
+	for i := range defaultPortAttempts {
+		server := New(offsetPort(smtpPort, i), offsetPort(httpPort, i))
+		if err = server.Start(); err == nil {
+			globalServer = server
+			return globalServer, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			break
+		}
 	}
-
-	globalServer = server
-	return globalServer, nil
+	return nil, fmt.Errorf("failed to start mail catcher: %w", err)
 }
 
 // StopDefault stops the global mail catcher server.
@@ -59,6 +75,14 @@ func StopDefault() error {
 
 // Helper functions
 
+// offsetPort returns the port n after port, keeping 0 for any free port.
+func offsetPort(port, n int) int {
+	if port == 0 {
+		return 0
+	}
+	return port + n
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	value := os.Getenv(key)
 	if value == "" {
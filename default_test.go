@@ -0,0 +1,35 @@
+package mailcatcher
+
+import (
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestDefaultServerPortFallback(t *testing.T) {
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer taken.Close()
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	t.Setenv("MAILCATCHER_SMTP_PORT", strconv.Itoa(port))
+	t.Setenv("MAILCATCHER_HTTP_PORT", "0")
+	t.Cleanup(func() {
+		if err := StopDefault(); err != nil {
+			t.Errorf("Failed to stop default server: %v", err)
+		}
+	})
+
+	server, err := DefaultServer()
+	if err != nil {
+		t.Fatalf("Failed to start default server: %v", err)
+	}
+	if got := server.SMTPPort(); got <= port || got >= port+defaultPortAttempts {
+		t.Errorf("Expected a port after %d, got %d", port, got)
+	}
+	if again, err := DefaultServer(); err != nil || again != server {
+		t.Errorf("Expected the same server, got %v, %v", again, err)
+	}
+}
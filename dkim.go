@@ -0,0 +1,313 @@
+package mailcatcher
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDKIMSignatures limits the signatures verified per message.
+const maxDKIMSignatures = 5
+
+// verifyDKIM verifies the DKIM-Signature headers of a message (RFC 6376)
+// against keys, which are DNS TXT records by name.
+func verifyDKIM(fields []string, body []byte, keys map[string]string) []DKIMResult {
+	var results []DKIMResult
+	for i, f := range fields {
+		if !strings.EqualFold(fieldName(f), "DKIM-Signature") {
+			continue
+		}
+		if len(results) == maxDKIMSignatures {
+			break
+		}
+		results = append(results, verifySignature(fields, i, body, keys))
+	}
+	return results
+}
+
+// verifySignature verifies the DKIM-Signature header fields[sig].
+func verifySignature(fields []string, sig int, body []byte, keys map[string]string) DKIMResult {
+	_, value, _ := strings.Cut(fields[sig], ":")
+	tags, err := parseTags(value)
+	result := DKIMResult{Domain: tags["d"], Selector: tags["s"], Result: ResultPermError}
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	for _, tag := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if tags[tag] == "" {
+			result.Reason = fmt.Sprintf("missing %s= tag", tag)
+			return result
+		}
+	}
+	if tags["v"] != "1" {
+		result.Reason = "unsupported version " + tags["v"]
+		return result
+	}
+	if x := tags["x"]; x != "" {
+		expires, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			result.Reason = "invalid x= tag"
+			return result
+		}
+		if time.Now().Unix() > expires {
+			result.Result = ResultFail
+			result.Reason = "signature expired"
+			return result
+		}
+	}
+
+	keyType, hashAlgo, ok := strings.Cut(tags["a"], "-")
+	var newHash func() hash.Hash
+	var cryptoHash crypto.Hash
+	switch {
+	case ok && hashAlgo == "sha256" && (keyType == "rsa" || keyType == "ed25519"):
+		newHash, cryptoHash = sha256.New, crypto.SHA256
+	case ok && hashAlgo == "sha1" && keyType == "rsa":
+		newHash, cryptoHash = sha1.New, crypto.SHA1
+	default:
+		result.Reason = "unsupported algorithm " + tags["a"]
+		return result
+	}
+	headerCanon, bodyCanon, _ := strings.Cut(tags["c"], "/")
+	if headerCanon == "" {
+		headerCanon = "simple"
+	}
+	if bodyCanon == "" {
+		bodyCanon = "simple"
+	}
+	if headerCanon != "simple" && headerCanon != "relaxed" || bodyCanon != "simple" && bodyCanon != "relaxed" {
+		result.Reason = "unsupported canonicalization " + tags["c"]
+		return result
+	}
+
+	name := tags["s"] + "._domainkey." + tags["d"]
+	record, ok := lookupKey(keys, name)
+	if !ok {
+		result.Reason = "no key for " + name
+		return result
+	}
+	pub, err := parseDKIMKey(record, keyType)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+
+	// Body hash
+	canonBody := canonicalBody(body, bodyCanon)
+	if l := tags["l"]; l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			result.Reason = "invalid l= tag"
+			return result
+		}
+		canonBody = canonBody[:min(n, len(canonBody))]
+	}
+	h := newHash()
+	h.Write(canonBody)
+	bh := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	if bh != stripWhitespace(tags["bh"]) {
+		result.Result = ResultFail
+		result.Reason = "body hash mismatch"
+		return result
+	}
+
+	// Header hash: the signed fields, last instance first, then the
+	// signature itself with an empty b= tag
+	h = newHash()
+	used := map[int]bool{}
+	for _, signed := range strings.Split(tags["h"], ":") {
+		signed = strings.TrimSpace(signed)
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fieldName(fields[i]), signed) {
+				used[i] = true
+				h.Write([]byte(canonicalHeader(fields[i], headerCanon)))
+				break
+			}
+		}
+	}
+	self := canonicalHeader(removeSignature(fields[sig]), headerCanon)
+	h.Write([]byte(strings.TrimSuffix(self, "\r\n")))
+	digest := h.Sum(nil)
+
+	signature, err := base64.StdEncoding.DecodeString(stripWhitespace(tags["b"]))
+	if err != nil {
+		result.Reason = "invalid b= tag"
+		return result
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, cryptoHash, digest, signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, digest, signature) {
+			err = fmt.Errorf("invalid signature")
+		}
+	}
+	if err != nil {
+		result.Result = ResultFail
+		result.Reason = "signature does not verify"
+		return result
+	}
+	result.Result = ResultPass
+	return result
+}
+
+// lookupKey returns the key record by name, ignoring case.
+func lookupKey(keys map[string]string, name string) (string, bool) {
+	if record, ok := keys[name]; ok {
+		return record, true
+	}
+	for n, record := range keys {
+		if strings.EqualFold(n, name) {
+			return record, true
+		}
+	}
+	return "", false
+}
+
+// parseDKIMKey parses the public key of a DKIM key record, which must be
+// of keyType.
+func parseDKIMKey(record, keyType string) (crypto.PublicKey, error) {
+	tags, err := parseTags(record)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key record: %w", err)
+	}
+	if v := tags["v"]; v != "" && v != "DKIM1" {
+		return nil, fmt.Errorf("invalid key record version %s", v)
+	}
+	if k := tags["k"]; k != "" && k != keyType || k == "" && keyType != "rsa" {
+		return nil, fmt.Errorf("key type does not match algorithm %s", keyType)
+	}
+	p := stripWhitespace(tags["p"])
+	if p == "" {
+		return nil, fmt.Errorf("key revoked")
+	}
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key encoding: %w", err)
+	}
+
+	if keyType == "ed25519" {
+		if len(der) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key size %d", len(der))
+		}
+		return ed25519.PublicKey(der), nil
+	}
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		if rsaKey, ok := pub.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+		return nil, fmt.Errorf("key is not an RSA key")
+	}
+	pub, err := x509.ParsePKCS1PublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RSA key: %w", err)
+	}
+	return pub, nil
+}
+
+// parseTags parses a DKIM tag list, e.g. "v=1; a=rsa-sha256".
+func parseTags(list string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, spec := range strings.Split(list, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return tags, fmt.Errorf("invalid tag %q", strings.TrimSpace(spec))
+		}
+		name = strings.TrimSpace(name)
+		if _, dup := tags[name]; dup {
+			return tags, fmt.Errorf("duplicate tag %s", name)
+		}
+		tags[name] = strings.TrimSpace(strings.ReplaceAll(value, "\r\n", ""))
+	}
+	return tags, nil
+}
+
+// removeSignature empties the b= tag of a DKIM-Signature field, keeping
+// everything else as written.
+func removeSignature(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	specs := strings.Split(value, ";")
+	for i, spec := range specs {
+		tag, _, ok := strings.Cut(spec, "=")
+		if ok && strings.TrimSpace(tag) == "b" {
+			specs[i] = spec[:strings.Index(spec, "=")+1]
+			if i == len(specs)-1 {
+				specs[i] += "\r\n"
+			}
+		}
+	}
+	return name + ":" + strings.Join(specs, ";")
+}
+
+// canonicalHeader canonicalizes a header field (RFC 6376 section 3.4).
+func canonicalHeader(field, canon string) string {
+	if canon == "simple" {
+		return field
+	}
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.Join(strings.FieldsFunc(value, isWSP), " ") + "\r\n"
+}
+
+// canonicalBody canonicalizes a CRLF message body (RFC 6376 section 3.4).
+func canonicalBody(body []byte, canon string) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	if canon == "relaxed" {
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(compressWSP(line), " ")
+		}
+	}
+	// Ignore empty lines at the end of the body
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		if canon == "relaxed" {
+			return nil
+		}
+		return []byte("\r\n")
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// compressWSP reduces runs of spaces and tabs to a single space.
+func compressWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if isWSP(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+func stripWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,135 @@
+package mailcatcher
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// signDKIM returns msg with a DKIM-Signature over From, To and Subject.
+func signDKIM(t *testing.T, msg string, key crypto.Signer, canon string) string {
+	t.Helper()
+	raw := crlf([]byte(msg))
+	fields, body := splitHeader(raw)
+
+	algo := "rsa-sha256"
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		algo = "ed25519-sha256"
+	}
+	bh := sha256.Sum256(canonicalBody(body, canon))
+	sig := fmt.Sprintf("DKIM-Signature: v=1; a=%s; c=%s/%s; d=example.com; s=mail;\r\n\th=From:To:Subject; bh=%s;\r\n\tb=\r\n",
+		algo, canon, canon, base64.StdEncoding.EncodeToString(bh[:]))
+
+	h := sha256.New()
+	for _, name := range []string{"From", "To", "Subject"} {
+		for _, f := range fields {
+			if fieldName(f) == name {
+				h.Write([]byte(canonicalHeader(f, canon)))
+			}
+		}
+	}
+	h.Write([]byte(strings.TrimSuffix(canonicalHeader(sig, canon), "\r\n")))
+
+	var b []byte
+	var err error
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		b, err = key.Sign(rand.Reader, h.Sum(nil), crypto.Hash(0))
+	} else {
+		b, err = key.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	value := base64.StdEncoding.EncodeToString(b)
+	value = value[:20] + "\r\n\t" + value[20:] // signatures are usually folded
+	return strings.Replace(sig, "b=\r\n", "b="+value+"\r\n", 1) + string(raw)
+}
+
+// dkimRecord returns the DNS TXT record publishing the public key of key.
+func dkimRecord(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	if pub, ok := key.Public().(ed25519.PublicKey); ok {
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)
+}
+
+func TestVerifyDKIM(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	msg := "From: App <app@example.com>\r\nTo: user@example.com\r\nSubject:  Your   code\r\n\r\nCode: 123456  \r\n\r\n\r\n"
+
+	for _, tc := range []struct {
+		name  string
+		key   crypto.Signer
+		canon string
+	}{
+		{"ed25519 relaxed", edKey, "relaxed"},
+		{"rsa relaxed", rsaKey, "relaxed"},
+		{"rsa simple", rsaKey, "simple"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			keys := map[string]string{"mail._domainkey.example.com": dkimRecord(t, tc.key)}
+			verify := func(msg string) DKIMResult {
+				fields, body := splitHeader([]byte(msg))
+				results := verifyDKIM(fields, body, keys)
+				if len(results) != 1 {
+					t.Fatalf("Expected 1 result, got %v", results)
+				}
+				return results[0]
+			}
+
+			signed := signDKIM(t, msg, tc.key, tc.canon)
+			if r := verify(signed); r.Result != ResultPass || r.Domain != "example.com" || r.Selector != "mail" {
+				t.Errorf("Expected pass for example.com/mail, got %+v", r)
+			}
+			if r := verify(strings.Replace(signed, "123456", "654321", 1)); r.Result != ResultFail || r.Reason != "body hash mismatch" {
+				t.Errorf("Expected a body hash mismatch, got %+v", r)
+			}
+			if r := verify(strings.Replace(signed, "Your", "Our", 1)); r.Result != ResultFail || r.Reason != "signature does not verify" {
+				t.Errorf("Expected a bad signature, got %+v", r)
+			}
+			if r := verify(strings.Replace(signed, "s=mail", "s=other", 1)); r.Result != ResultPermError || !strings.Contains(r.Reason, "no key") {
+				t.Errorf("Expected a missing key, got %+v", r)
+			}
+		})
+	}
+}
+
+func TestDKIMCanonicalization(t *testing.T) {
+	// The example of RFC 6376 section 3.4.5
+	fields, body := splitHeader([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"))
+	var header string
+	for _, f := range fields {
+		header += canonicalHeader(f, "relaxed")
+	}
+	if header != "a:X\r\nb:Y Z\r\n" {
+		t.Errorf("Expected relaxed header %q, got %q", "a:X\r\nb:Y Z\r\n", header)
+	}
+	if got := string(canonicalBody(body, "relaxed")); got != " C\r\nD E\r\n" {
+		t.Errorf("Expected relaxed body %q, got %q", " C\r\nD E\r\n", got)
+	}
+	if got := string(canonicalBody(body, "simple")); got != " C \r\nD \t E\r\n" {
+		t.Errorf("Expected simple body %q, got %q", " C \r\nD \t E\r\n", got)
+	}
+	if got := string(canonicalBody(nil, "simple")); got != "\r\n" {
+		t.Errorf("Expected an empty simple body to be CRLF, got %q", got)
+	}
+}
@@ -25,6 +25,15 @@
 //	    }
 //	}
 //
+// For isolated tests, NewTestServer starts a server on free ports and
+// stops it when the test ends:
+//
+//	server, smtpAddr := mailcatcher.NewTestServer(t)
+//
+// client.Connect returns a Remote with the same Emails, Email, Clear and
+// WaitFor methods for an instance running in a container, so tests written
+// against a Catcher run either way.
+//
 // # Custom Configuration
 //
 // Create a server with custom ports:
@@ -39,13 +48,61 @@
 //
 //	server := mailcatcher.NewWithDefaults()
 //
+// NewWithOptions accepts functional options for the bind host, ports, TLS,
+// size and retention limits, authentication and more:
+//
+//	server := mailcatcher.NewWithOptions(
+//	    mailcatcher.WithHost("127.0.0.1"),
+//	    mailcatcher.WithSMTPPort(0),
+//	    mailcatcher.WithAuth("app", "secret"),
+//	)
+//
 // # HTTP API
 //
 // The server exposes a REST API on port 8025 (configurable):
 //
 //   - GET /api/v1/emails - Returns all captured emails
 //   - GET /api/v1/emails/{id} - Returns a specific email
+//   - GET /api/v1/emails/export - Streams all emails as NDJSON
+//   - GET /api/v1/emails/archive - Downloads all emails as a zip of .eml files
+//   - GET, DELETE /api/v1/namespaces/{ns}/emails - Lists or clears a namespace
+//   - POST /api/v1/emails - Stores a raw RFC 5322 message or an mbox file
+//   - PATCH /api/v1/emails/{id} - Marks an email read or unread and sets its tags
+//   - DELETE /api/v1/emails/{id} - Deletes a specific email
 //   - DELETE /api/v1/emails - Clears all emails
+//   - GET /api/v1/stats - Returns aggregate statistics
+//   - GET /api/v1/search - Finds emails by the words of their subject, headers and bodies
+//   - GET /api/v1/oversized - Lists messages rejected for their size
+//   - POST /api/v1/checkpoints - Saves the stored emails as a checkpoint
+//   - POST /api/v1/checkpoints/{id}/restore - Rolls the emails back to a checkpoint
+//   - DELETE /api/v1/checkpoints/{id} - Discards a checkpoint
+//   - GET /api/v1/behavior - Returns the injected faults, latency and rejections
+//   - POST /api/v1/behavior - Replaces them on the running server
+//   - GET /api/v1/emails/held - Returns emails on hold
+//   - POST /api/v1/emails/{id}/approve - Releases a held email
+//   - POST /api/v1/emails/{id}/reject - Discards a held email
+//   - POST /api/v1/emails/{id}/release - Sends an email on through the relay
+//   - GET /api/v1/emails/{id}/raw - Downloads the message as a .eml file
+//   - GET /api/v1/emails/{id}/html - Renders the sanitized HTML body
+//   - GET /api/v1/emails/{id}/text - Returns the plain-text body
+//   - GET /api/v1/emails/{id}/snapshot - Returns the stable content for golden files
+//   - POST /api/v1/emails/{id}/diff - Compares an email with a golden file
+//   - GET /api/v1/emails/{id}/attachments - Lists attachments of an email
+//   - GET /api/v1/emails/{id}/attachments/{index} - Downloads an attachment
+//   - GET /api/v1/events - Streams changes as Server-Sent Events
+//   - GET, POST, DELETE /api/v1/webhooks - Manages webhooks for new emails
+//   - GET /api/v1/openapi.json - Returns the OpenAPI document of this API
+//
+// A web UI for browsing captured mail is served at / on the same port.
+// SetAPIToken and SetAPIBasicAuth protect the API with a bearer token or
+// basic authentication.
+//
+// AddListener accepts SMTP on further ports, e.g. with implicit TLS or
+// required authentication, recording the port in Email.Listener.
+//
+// SetPOP3Port and SetIMAPPort additionally serve the captured mail over
+// POP3 and read-only IMAP, for applications and mail clients that poll a
+// mailbox.
 //
 // Example:
 //
@@ -57,5 +114,5 @@
 //   - Subject parsing from email headers
 //   - CORS-enabled HTTP API
 //   - Configurable ports
-//   - Optional custom logging
+//   - Optional structured logging via log/slog
 package mailcatcher
@@ -0,0 +1,97 @@
+package mailcatcher
+
+import (
+	"context"
+	"sync"
+
+	"github.com/emersion/go-smtp"
+)
+
+// errShuttingDown is returned to a new MAIL FROM once Stop has begun.
+var errShuttingDown = &smtp.SMTPError{
+	Code:         421,
+	EnhancedCode: smtp.EnhancedCode{4, 3, 2},
+	Message:      "Server shutting down, try again later",
+}
+
+// transactions counts the SMTP sessions between MAIL FROM and the end of
+// their message, so Stop can let them finish.
+type transactions struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{} // closed when active drops to 0, if waited on
+}
+
+func (t *transactions) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active++
+}
+
+func (t *transactions) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if t.active == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// wait blocks until no transaction is active or ctx is done.
+func (t *transactions) wait(ctx context.Context) error {
+	t.mu.Lock()
+	if t.active == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// beginTransaction marks the session as sending a message, or refuses it
+// if the server is stopping.
+func (s *session) beginTransaction() error {
+	if s.server.stopping.Load() {
+		return errShuttingDown
+	}
+	if !s.inTransaction {
+		s.inTransaction = true
+		s.server.transactions.begin()
+	}
+	return nil
+}
+
+// endTransaction marks the session's message as done.
+func (s *session) endTransaction() {
+	if s.inTransaction {
+		s.inTransaction = false
+		s.server.transactions.end()
+	}
+}
+
+// drain stops accepting SMTP connections and waits, bounded by ctx, for
+// the messages in flight to be received. Idle sessions are not waited
+// for; Stop closes them afterwards.
+func (s *Server) drain(ctx context.Context) error {
+	s.stopping.Store(true)
+	if s.smtpListener != nil {
+		_ = s.smtpListener.Close()
+	}
+	for _, l := range s.listeners {
+		if l.listener != nil {
+			_ = l.listener.Close()
+		}
+	}
+	return s.transactions.wait(ctx)
+}
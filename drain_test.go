@@ -0,0 +1,93 @@
+package mailcatcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"testing"
+	"time"
+)
+
+func TestStopDrainsTransactions(t *testing.T) {
+	server, addr := NewTestServer(t)
+
+	idle, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer idle.Close()
+	if err := idle.Hello("localhost"); err != nil {
+		t.Fatalf("Failed to greet: %v", err)
+	}
+
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer c.Close()
+	if err := c.Mail("app@example.com"); err != nil {
+		t.Fatalf("Failed to send MAIL: %v", err)
+	}
+	if err := c.Rcpt("user@example.com"); err != nil {
+		t.Fatalf("Failed to send RCPT: %v", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		t.Fatalf("Failed to start DATA: %v", err)
+	}
+	if _, err := w.Write([]byte("Subject: Last\r\n\r\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Stop(context.Background()) }()
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("Expected Stop to wait for the message, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("Expected new connections to be refused while draining")
+	}
+	if err := idle.Mail("app@example.com"); err == nil {
+		t.Error("Expected a new transaction to be refused while draining")
+	}
+
+	if _, err := w.Write([]byte("Body\r\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Expected the message to be accepted, got %v", err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	if emails := server.Emails(); len(emails) != 1 || emails[0].Subject != "Last" {
+		t.Errorf("Expected the drained message, got %+v", emails)
+	}
+}
+
+func TestStopDrainTimeout(t *testing.T) {
+	server, addr := NewTestServer(t)
+
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer c.Close()
+	if err := c.Mail("app@example.com"); err != nil {
+		t.Fatalf("Failed to send MAIL: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := server.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the drain to time out, got %v", err)
+	}
+	if err := c.Noop(); err == nil {
+		t.Error("Expected the stuck session to be closed")
+	}
+}
@@ -0,0 +1,137 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventKeepAlive is how often an idle event stream sends a comment so
+// proxies do not close it.
+const eventKeepAlive = 30 * time.Second
+
+// eventBuffer is the number of events queued for a slow stream client
+// before further events are dropped for it.
+const eventBuffer = 64
+
+// eventHub fans out changes to the clients of GET /api/v1/events.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+// subscribe returns a channel receiving every event until cancel is called
+// or the hub is closed, which closes the channel.
+func (h *eventHub) subscribe() (events <-chan Event, cancel func()) {
+	ch := make(chan Event, eventBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan Event]struct{})
+	}
+	h.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// broadcast sends event to every subscriber without blocking.
+// It reports whether any subscriber had to drop the event.
+func (h *eventHub) broadcast(event Event) (dropped bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			dropped = true
+		}
+	}
+	return dropped
+}
+
+// close ends all streams so the HTTP server can shut down.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		close(ch)
+	}
+	h.subscribers = nil
+	h.closed = true
+}
+
+// publish reports a local change to event stream clients. When a shared
+// store is watched, its Watch reports the change instead, together with
+// those made by other replicas.
+func (s *Server) publish(event Event) {
+	if s.stopWatch != nil {
+		return
+	}
+	s.broadcast(event)
+}
+
+func (s *Server) broadcast(event Event) {
+	if s.events.broadcast(event) {
+		s.warnf("dropped %s event for a slow stream client", event.Type)
+	}
+}
+
+// HTTP handlers
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := s.events.subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				s.errorf("Failed to encode event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,80 @@
+package mailcatcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	server := New(0, 0)
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/v1/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Live\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	server.Clear()
+
+	scanner := bufio.NewScanner(resp.Body)
+	var events []Event
+	var names []string
+	for len(events) < 2 && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			names = append(names, strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			var event Event
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("Failed to decode event: %v", err)
+			}
+			events = append(events, event)
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d (%v)", len(events), scanner.Err())
+	}
+
+	if names[0] != EventAdded || events[0].Email == nil || events[0].Email.Subject != "Live" {
+		t.Errorf("Expected added event with the email, got %s %+v", names[0], events[0])
+	}
+	if names[1] != EventCleared || events[1].Type != EventCleared {
+		t.Errorf("Expected cleared event, got %s %+v", names[1], events[1])
+	}
+}
+
+func TestEventHubClose(t *testing.T) {
+	var hub eventHub
+	events, cancel := hub.subscribe()
+	defer cancel()
+
+	hub.close()
+	if _, ok := <-events; ok {
+		t.Error("Expected closed hub to end the stream")
+	}
+	if late, _ := hub.subscribe(); late != nil {
+		if _, ok := <-late; ok {
+			t.Error("Expected subscription after close to be closed")
+		}
+	}
+}
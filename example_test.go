@@ -2,6 +2,7 @@ package mailcatcher_test
 
 import (
 	"context"
+	"net/smtp"
 	"testing"
 	"time"
 
@@ -26,21 +27,20 @@ func TestMailCatcher(t *testing.T) {
 	// Clear any existing messages
 	server.Clear()
 
-	// TODO: Send test email via SMTP
-	// smtp.SendMail("localhost:1025", nil, "from@example.com", []string{"to@example.com"}, []byte("Subject: Test\n\nBody"))
-
-	// Wait a bit for email to be received
-	time.Sleep(100 * time.Millisecond)
+	// Send a test email to the port that was actually bound
+	msg := []byte("Subject: Test\r\n\r\nBody\r\n")
+	if err := smtp.SendMail(server.SMTPAddr(), nil, "from@example.com", []string{"to@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
 
 	// Get captured emails
 	emails := server.Emails()
-
-	if len(emails) == 0 {
-		t.Skip("No emails captured (expected - need to send test email)")
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
 	}
 
 	// Verify email was captured
-	if emails[0].From != "from@example.com" {
+	if emails[0].From.Address != "from@example.com" {
 		t.Errorf("Expected from=from@example.com, got %s", emails[0].From)
 	}
 }
@@ -0,0 +1,162 @@
+package mailcatcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// exportFlushEvery is how many emails are written between flushes of the
+// HTTP response, so clients receive the export as it is produced.
+const exportFlushEvery = 100
+
+// Export writes every stored email, including held ones, to w as
+// newline-delimited JSON (one email object per line), in the order they
+// were received. Stores implementing OldestLister, such as all the stores
+// in this package, are read one email at a time, so neither the emails nor
+// the output are held in memory as a whole; other stores are listed first.
+func (s *Server) Export(w io.Writer) error {
+	ctx := context.Background()
+	emails, err := listExport(ctx, s.store)
+	if err != nil {
+		return fmt.Errorf("failed to list emails: %w", err)
+	}
+	return export(ctx, w, emails, false, nil)
+}
+
+// exportEmails is the list of emails to export: only their IDs if the
+// store is an OldestLister, so each email is loaded when it is written.
+type exportEmails struct {
+	store  Store
+	ids    []string
+	emails []Email
+}
+
+// listExport lists the emails currently in store for export.
+func listExport(ctx context.Context, store Store) (*exportEmails, error) {
+	if lister, ok := store.(OldestLister); ok {
+		n, err := store.Count(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ids, err := lister.OldestIDs(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		return &exportEmails{store: store, ids: ids}, nil
+	}
+	emails, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &exportEmails{store: store, emails: emails}, nil
+}
+
+// each calls fn with every email in turn. Emails deleted since they were
+// listed are skipped.
+func (l *exportEmails) each(ctx context.Context, fn func(e *Email) error) error {
+	for i := range l.emails {
+		if err := fn(&l.emails[i]); err != nil {
+			return err
+		}
+		l.emails[i] = Email{} // let the written email be collected
+	}
+	for _, id := range l.ids {
+		email, err := l.store.Get(ctx, id)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			continue
+		case err != nil:
+			return fmt.Errorf("failed to get %s: %w", id, err)
+		}
+		if err := fn(&email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// export writes emails as NDJSON, or as a JSON array if array is set.
+// flush, if not nil, is called periodically.
+func export(ctx context.Context, w io.Writer, emails *exportEmails, array bool, flush func()) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if array {
+		bw.WriteString("[")
+	}
+	i := 0
+	err := emails.each(ctx, func(e *Email) error {
+		if array && i > 0 {
+			bw.WriteString(",")
+		}
+		// Encode adds the newline separating NDJSON records
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to export %s: %w", e.ID, err)
+		}
+		i++
+
+		if flush != nil && i%exportFlushEvery == 0 {
+			if err := bw.Flush(); err != nil {
+				return fmt.Errorf("failed to write export: %w", err)
+			}
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if array {
+		bw.WriteString("]\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// HTTP handlers
+
+// handleExportEmails streams all emails as NDJSON, or with ?format=json as
+// a JSON array and with ?format=mbox as an mbox file.
+func (s *Server) handleExportEmails(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	var contentType string
+	switch format {
+	case "", "ndjson":
+		contentType = "application/x-ndjson"
+	case "json":
+		contentType = "application/json"
+	case "mbox":
+		contentType = "application/mbox"
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q: expected ndjson, json or mbox", format), http.StatusBadRequest)
+		return
+	}
+
+	emails, err := listExport(r.Context(), s.store)
+	if err != nil {
+		s.errorf("Failed to list emails: %v", err)
+		http.Error(w, "Failed to list emails", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	if format == "mbox" {
+		w.Header().Set("Content-Disposition", `attachment; filename="mailcatcher.mbox"`)
+		err = exportMbox(r.Context(), w, emails)
+	} else {
+		rc := http.NewResponseController(w)
+		flush := func() { _ = rc.Flush() }
+		err = export(r.Context(), w, emails, format == "json", flush)
+	}
+	if err != nil {
+		// Headers are already sent; the truncated body is all we can do
+		s.errorf("%v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package mailcatcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	server := New(0, 0)
+	for i := range 3 {
+		msg := []byte(fmt.Sprintf("Subject: Message %d\r\n\r\nBody\r\n", i))
+		if err := server.Send("sender@example.com", []string{"user@example.com"}, msg); err != nil {
+			t.Fatalf("Failed to send email: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := server.Export(&buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	var lines int
+	for scanner.Scan() {
+		var email Email
+		if err := json.Unmarshal(scanner.Bytes(), &email); err != nil {
+			t.Fatalf("Failed to decode line %d: %v", lines, err)
+		}
+		if want := fmt.Sprintf("Message %d", lines); email.Subject != want {
+			t.Errorf("Expected subject %q, got %q", want, email.Subject)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Errorf("Expected 3 lines, got %d", lines)
+	}
+}
+
+func TestExportWithoutListing(t *testing.T) {
+	store := &listCountingStore{MemoryStore: NewMemoryStore()}
+	server := NewWithOptions(WithStore(store))
+	for range 3 {
+		if err := server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: Hello\r\n\r\nBody\r\n")); err != nil {
+			t.Fatalf("Failed to send email: %v", err)
+		}
+	}
+	lists := store.lists
+
+	var buf bytes.Buffer
+	if err := server.Export(&buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 3 {
+		t.Errorf("Expected 3 lines, got %d", n)
+	}
+	// The emails are read one at a time by ID
+	if store.lists != lists {
+		t.Errorf("Expected no List call during export, got %d", store.lists-lists)
+	}
+}
+
+func TestExportEndpoint(t *testing.T) {
+	server := New(0, 0)
+	for range 2*exportFlushEvery + 1 {
+		if err := server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: Hello\r\n\r\nBody\r\n")); err != nil {
+			t.Fatalf("Failed to send email: %v", err)
+		}
+	}
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/emails/export")
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected application/x-ndjson, got %q", ct)
+	}
+	dec := json.NewDecoder(resp.Body)
+	var count int
+	for dec.More() {
+		var email Email
+		if err := dec.Decode(&email); err != nil {
+			t.Fatalf("Failed to decode email: %v", err)
+		}
+		count++
+	}
+	if count != 2*exportFlushEvery+1 {
+		t.Errorf("Expected %d emails, got %d", 2*exportFlushEvery+1, count)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/emails/export?format=json")
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	defer resp.Body.Close()
+	var emails []Email
+	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		t.Fatalf("Expected a JSON array: %v", err)
+	}
+	if len(emails) != 2*exportFlushEvery+1 {
+		t.Errorf("Expected %d emails, got %d", 2*exportFlushEvery+1, len(emails))
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/emails/export?format=xml")
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,197 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Extensions selects the ESMTP extensions the server advertises in its
+// EHLO reply.
+type Extensions struct {
+	SMTPUTF8     bool // RFC 6531 internationalized addresses
+	EightBitMIME bool // RFC 6152 BODY=8BITMIME
+	Size         bool // RFC 1870 SIZE
+	Pipelining   bool // RFC 2920 PIPELINING
+	Chunking     bool // RFC 3030 BDAT
+	BinaryMIME   bool // RFC 3030 BODY=BINARYMIME, needs Chunking
+	DSN          bool // RFC 3461 delivery status notification parameters
+	RequireTLS   bool // RFC 8689 REQUIRETLS
+}
+
+// Extension names as advertised and as recorded in Email.Extensions.
+const (
+	ExtensionSMTPUTF8     = "SMTPUTF8"
+	ExtensionEightBitMIME = "8BITMIME"
+	ExtensionSize         = "SIZE"
+	ExtensionPipelining   = "PIPELINING"
+	ExtensionChunking     = "CHUNKING"
+	ExtensionBinaryMIME   = "BINARYMIME"
+	ExtensionDSN          = "DSN"
+	ExtensionRequireTLS   = "REQUIRETLS"
+)
+
+// DefaultExtensions returns the extensions a new server advertises:
+// everything but BINARYMIME, DSN and REQUIRETLS.
+func DefaultExtensions() Extensions {
+	return Extensions{
+		SMTPUTF8:     true,
+		EightBitMIME: true,
+		Size:         true,
+		Pipelining:   true,
+		Chunking:     true,
+	}
+}
+
+// field returns the Extensions field for an extension name.
+func (e *Extensions) field(name string) *bool {
+	switch strings.ToUpper(name) {
+	case ExtensionSMTPUTF8:
+		return &e.SMTPUTF8
+	case ExtensionEightBitMIME:
+		return &e.EightBitMIME
+	case ExtensionSize:
+		return &e.Size
+	case ExtensionPipelining:
+		return &e.Pipelining
+	case ExtensionChunking:
+		return &e.Chunking
+	case ExtensionBinaryMIME:
+		return &e.BinaryMIME
+	case ExtensionDSN:
+		return &e.DSN
+	case ExtensionRequireTLS:
+		return &e.RequireTLS
+	}
+	return nil
+}
+
+// Set enables or disables the named extension, e.g. "PIPELINING".
+// Names are case-insensitive.
+func (e *Extensions) Set(name string, enabled bool) error {
+	f := e.field(name)
+	if f == nil {
+		return fmt.Errorf("unknown SMTP extension %q", name)
+	}
+	*f = enabled
+	return nil
+}
+
+// hidden returns the extensions go-smtp always advertises that e
+// disables, keyed by EHLO keyword.
+func (e Extensions) hidden() map[string]bool {
+	hidden := map[string]bool{}
+	for name, enabled := range map[string]bool{
+		ExtensionEightBitMIME: e.EightBitMIME,
+		ExtensionSize:         e.Size,
+		ExtensionPipelining:   e.Pipelining,
+		ExtensionChunking:     e.Chunking,
+	} {
+		if !enabled {
+			hidden[name] = true
+		}
+	}
+	if len(hidden) == 0 {
+		return nil
+	}
+	return hidden
+}
+
+// SetExtensions selects the ESMTP extensions advertised in the EHLO reply.
+// It must be called before Start.
+//
+// SMTPUTF8, BINARYMIME, DSN and REQUIRETLS are enabled in the SMTP server
+// itself, which refuses their parameters while they are disabled. The
+// other extensions are always supported by the server, so disabling them
+// removes them from the EHLO reply and MAIL FROM refuses BODY=8BITMIME and
+// SIZE= when those are disabled; commands sent pipelined or with BDAT are
+// still accepted. EHLO replies sent after STARTTLS are encrypted and
+// cannot be filtered, so they advertise all supported extensions.
+func (s *Server) SetExtensions(e Extensions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setExtensions(e)
+}
+
+func (s *Server) setExtensions(e Extensions) {
+	s.extensions = e
+	s.smtpServer.EnableSMTPUTF8 = e.SMTPUTF8
+	s.smtpServer.EnableBINARYMIME = e.BinaryMIME
+	s.smtpServer.EnableDSN = e.DSN
+	s.smtpServer.EnableREQUIRETLS = e.RequireTLS
+}
+
+// Extensions returns the ESMTP extensions the server advertises.
+func (s *Server) Extensions() Extensions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.extensions
+}
+
+// errParameterNotSupported rejects a MAIL FROM parameter of a disabled
+// extension.
+var errParameterNotSupported = &smtp.SMTPError{
+	Code:         555,
+	EnhancedCode: smtp.EnhancedCode{5, 5, 4},
+	Message:      "MAIL FROM parameter not supported",
+}
+
+// checkMailOptions refuses parameters of disabled extensions and returns
+// the extensions the parameters use.
+func (s *Server) checkMailOptions(opts *smtp.MailOptions) ([]string, error) {
+	if opts == nil {
+		return nil, nil
+	}
+	ext := s.Extensions()
+
+	var used []string
+	switch opts.Body {
+	case smtp.Body8BitMIME:
+		if !ext.EightBitMIME {
+			return nil, errParameterNotSupported
+		}
+		used = append(used, ExtensionEightBitMIME)
+	case smtp.BodyBinaryMIME:
+		used = append(used, ExtensionBinaryMIME)
+	}
+	if opts.Size > 0 {
+		if !ext.Size {
+			return nil, errParameterNotSupported
+		}
+		used = append(used, ExtensionSize)
+	}
+	if opts.UTF8 {
+		used = append(used, ExtensionSMTPUTF8)
+	}
+	if opts.RequireTLS {
+		used = append(used, ExtensionRequireTLS)
+	}
+	if opts.Return != "" || opts.EnvelopeID != "" {
+		used = append(used, ExtensionDSN)
+	}
+	return used, nil
+}
+
+// rcptExtensions returns the extensions used by RCPT TO parameters.
+func rcptExtensions(opts *smtp.RcptOptions) []string {
+	if opts != nil && (len(opts.Notify) > 0 || opts.OriginalRecipient != "") {
+		return []string{ExtensionDSN}
+	}
+	return nil
+}
+
+// transactionExtensions returns the extensions used by a transaction:
+// those of its parameters and, from its transcript, BDAT and pipelining.
+func transactionExtensions(params []string, transcript []Command, pipelined bool) []string {
+	used := slices.Clone(params)
+	if slices.ContainsFunc(transcript, func(cmd Command) bool { return cmd.Verb == "BDAT" }) {
+		used = append(used, ExtensionChunking)
+	}
+	if pipelined {
+		used = append(used, ExtensionPipelining)
+	}
+	slices.Sort(used)
+	return slices.Compact(used)
+}
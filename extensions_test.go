@@ -0,0 +1,110 @@
+package mailcatcher
+
+import (
+	"net/smtp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtensionsRecorded(t *testing.T) {
+	server, addr := NewTestServer(t)
+
+	msg := []byte("Subject: Hallo\r\n\r\nGrüße\r\n")
+	if err := smtp.SendMail(addr, nil, "app@example.com", []string{"jörg@bücher.example"}, msg); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	emails := server.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+	if got := emails[0].Extensions; !slices.Equal(got, []string{"8BITMIME", "SMTPUTF8"}) {
+		t.Errorf("Expected [8BITMIME SMTPUTF8], got %v", got)
+	}
+	if emails[0].Envelope.To[0] != "jörg@bücher.example" {
+		t.Errorf("Expected the internationalized recipient, got %v", emails[0].Envelope.To)
+	}
+}
+
+func TestExtensionsPipelining(t *testing.T) {
+	server, addr := NewTestServer(t)
+
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+	smtpCommand(t, conn, "EHLO client.example.com")
+
+	// Send the whole envelope before reading any reply
+	if err := conn.PrintfLine("MAIL FROM:<app@example.com> SIZE=20\r\nRCPT TO:<user@example.com>\r\nDATA"); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	for _, code := range []int{250, 250, 354} {
+		if _, _, err := conn.ReadResponse(code); err != nil {
+			t.Fatalf("Expected %d, got %v", code, err)
+		}
+	}
+	if code := smtpCommand(t, conn, "Subject: Hi\r\n\r\nBody\r\n."); code != 250 {
+		t.Fatalf("Expected 250 for the message, got %d", code)
+	}
+
+	emails := server.Emails()
+	if len(emails) != 1 || !slices.Equal(emails[0].Extensions, []string{"PIPELINING", "SIZE"}) {
+		t.Fatalf("Expected [PIPELINING SIZE], got %+v", emails)
+	}
+}
+
+func TestSetExtensions(t *testing.T) {
+	ext := DefaultExtensions()
+	for _, name := range []string{"8bitmime", "SIZE", "Pipelining"} {
+		if err := ext.Set(name, false); err != nil {
+			t.Fatalf("Failed to disable %s: %v", name, err)
+		}
+	}
+	if err := ext.Set("DSN", true); err != nil {
+		t.Fatalf("Failed to enable DSN: %v", err)
+	}
+	if err := ext.Set("XFOO", true); err == nil {
+		t.Error("Expected an error for an unknown extension")
+	}
+	_, addr := NewTestServer(t, WithExtensions(ext))
+
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer c.Close()
+	if err := c.Hello("client.example.com"); err != nil {
+		t.Fatalf("Failed to greet: %v", err)
+	}
+	for name, want := range map[string]bool{"8BITMIME": false, "SIZE": false, "PIPELINING": false, "CHUNKING": true, "SMTPUTF8": true, "DSN": true} {
+		if ok, _ := c.Extension(name); ok != want {
+			t.Errorf("Expected %s advertised to be %v, got %v", name, want, ok)
+		}
+	}
+
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+	smtpCommand(t, conn, "EHLO client.example.com")
+	if code := smtpCommand(t, conn, "MAIL FROM:<app@example.com> BODY=8BITMIME"); code != 555 {
+		t.Errorf("Expected 555 for BODY=8BITMIME, got %d", code)
+	}
+	if code := smtpCommand(t, conn, "MAIL FROM:<app@example.com> SIZE=100"); code != 555 {
+		t.Errorf("Expected 555 for SIZE=, got %d", code)
+	}
+	if code := smtpCommand(t, conn, "MAIL FROM:<app@example.com> RET=HDRS"); code != 250 {
+		t.Errorf("Expected 250 with DSN enabled, got %d", code)
+	}
+}
+
+func TestFilterEHLO(t *testing.T) {
+	reply := "250-mail.example.com Hello\r\n250-PIPELINING\r\n250-8BITMIME\r\n250 SIZE 1024\r\n"
+	got := string(filterEHLO([]byte(reply), map[string]bool{"PIPELINING": true, "SIZE": true}))
+	if want := "250-mail.example.com Hello\r\n250 8BITMIME\r\n"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if !replyComplete([]byte(reply)) || replyComplete([]byte("250-PIPELINING\r\n")) {
+		t.Error("Expected only the full reply to be complete")
+	}
+	if got := string(filterEHLO([]byte("250 mail.example.com\r\n"), map[string]bool{"SIZE": true})); !strings.HasPrefix(got, "250 mail.example.com") {
+		t.Errorf("Expected the greeting to be kept, got %q", got)
+	}
+}
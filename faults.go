@@ -0,0 +1,172 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Commands at which Faults can drop the connection.
+const (
+	DropAtMail = "mail"
+	DropAtRcpt = "rcpt"
+	DropAtData = "data"
+)
+
+// Faults injects random failures into SMTP transactions, to exercise a
+// sender's retry and bounce handling. Rejections of specific senders and
+// recipients are set with RejectSender and RejectRecipient.
+type Faults struct {
+	// DataFailureRate is the probability, from 0 to 1, of refusing a
+	// message at the end of DATA with DataFailure.
+	DataFailureRate float64 `json:"data_failure_rate,omitempty"`
+
+	// DataFailure is the reply to a failed DATA, by default 451 4.3.0.
+	DataFailure *smtp.SMTPError `json:"data_failure,omitempty"`
+
+	// DropRate is the probability, from 0 to 1, of closing the connection
+	// without replying to the command named by DropAt.
+	DropRate float64 `json:"drop_rate,omitempty"`
+
+	// DropAt is DropAtMail, DropAtRcpt or DropAtData (the default).
+	DropAt string `json:"drop_at,omitempty"`
+}
+
+var errDataFailure = &smtp.SMTPError{
+	Code:         451,
+	EnhancedCode: smtp.EnhancedCode{4, 3, 0},
+	Message:      "Requested action aborted: local error in processing",
+}
+
+// errDropped is returned to go-smtp after the connection has been closed;
+// the client never sees it.
+var errDropped = &smtp.SMTPError{
+	Code:         421,
+	EnhancedCode: smtp.EnhancedCode{4, 4, 2},
+	Message:      "Connection dropped",
+}
+
+// SetFaults sets the random failures injected into SMTP transactions.
+func (s *Server) SetFaults(f Faults) error {
+	if err := f.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+	return nil
+}
+
+// Faults returns the random failures injected into SMTP transactions.
+func (s *Server) Faults() Faults {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.faults
+}
+
+func (f Faults) validate() error {
+	switch f.DropAt {
+	case "", DropAtMail, DropAtRcpt, DropAtData:
+	default:
+		return fmt.Errorf("invalid drop command %q: expected %s, %s or %s", f.DropAt, DropAtMail, DropAtRcpt, DropAtData)
+	}
+	for name, rate := range map[string]float64{"data failure": f.DataFailureRate, "drop": f.DropRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid %s rate %v: expected a probability from 0 to 1", name, rate)
+		}
+	}
+	return nil
+}
+
+// shouldDrop reports whether to drop the connection at command.
+func (s *Server) shouldDrop(command string) bool {
+	s.mu.RLock()
+	f := s.faults
+	s.mu.RUnlock()
+
+	at := f.DropAt
+	if at == "" {
+		at = DropAtData
+	}
+	return at == command && chance(f.DropRate)
+}
+
+// dataFailure returns the reply refusing a message, or nil to accept it.
+func (s *Server) dataFailure() error {
+	s.mu.RLock()
+	f := s.faults
+	s.mu.RUnlock()
+
+	if !chance(f.DataFailureRate) {
+		return nil
+	}
+	if f.DataFailure != nil {
+		return f.DataFailure
+	}
+	return errDataFailure
+}
+
+// chance returns true with probability p.
+func chance(p float64) bool {
+	return p > 0 && rand.Float64() < p
+}
+
+// ParseReply parses an SMTP reply, either a "provider:kind" reference
+// accepted by ParseProviderReply or a literal reply such as
+// "421 4.7.0 Try again later". The enhanced code and text are optional.
+func ParseReply(s string) (*smtp.SMTPError, error) {
+	s = strings.TrimSpace(s)
+	codeText, rest, _ := strings.Cut(s, " ")
+	code, err := strconv.Atoi(codeText)
+	if err != nil {
+		return ParseProviderReply(s)
+	}
+	if code < 400 || code > 599 {
+		return nil, fmt.Errorf("invalid reply code %d: expected 4xx or 5xx", code)
+	}
+
+	r := &smtp.SMTPError{Code: code}
+	enhancedText, message, _ := strings.Cut(rest, " ")
+	if enhanced, ok := parseEnhancedCode(enhancedText); ok {
+		if enhanced[0] != code/100 {
+			return nil, fmt.Errorf("invalid reply %q: enhanced code class does not match %d", s, code)
+		}
+		r.EnhancedCode = enhanced
+	} else {
+		message = rest
+	}
+	r.Message = strings.TrimSpace(message)
+	if r.Message == "" {
+		r.Message = "Rejected"
+	}
+	return r, nil
+}
+
+// formatReply formats reply as accepted by ParseReply.
+func formatReply(reply *smtp.SMTPError) string {
+	if reply.EnhancedCode == smtp.EnhancedCodeNotSet || reply.EnhancedCode == smtp.NoEnhancedCode {
+		return fmt.Sprintf("%d %s", reply.Code, reply.Message)
+	}
+	return fmt.Sprintf("%d %d.%d.%d %s", reply.Code, reply.EnhancedCode[0], reply.EnhancedCode[1], reply.EnhancedCode[2], reply.Message)
+}
+
+// parseEnhancedCode parses an RFC 3463 status code such as "5.1.1".
+func parseEnhancedCode(s string) (smtp.EnhancedCode, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return smtp.EnhancedCode{}, false
+	}
+	var code smtp.EnhancedCode
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return smtp.EnhancedCode{}, false
+		}
+		code[i] = n
+	}
+	return code, true
+}
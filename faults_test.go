@@ -0,0 +1,125 @@
+package mailcatcher
+
+import (
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"testing"
+
+	gosmtp "github.com/emersion/go-smtp"
+)
+
+func TestRejectSender(t *testing.T) {
+	server, addr := NewTestServer(t)
+	reply, err := ParseReply("550 5.7.1 Sender blocked")
+	if err != nil {
+		t.Fatalf("Failed to parse reply: %v", err)
+	}
+	server.RejectSender("*@Spam.example.com", reply)
+
+	msg := []byte("Subject: Hello\r\n\r\nBody\r\n")
+	err = smtp.SendMail(addr, nil, "bot@spam.example.com", []string{"user@example.com"}, msg)
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != 550 || tpErr.Msg != "5.7.1 Sender blocked" {
+		t.Fatalf("Expected 550 5.7.1 Sender blocked, got %v", err)
+	}
+
+	if err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Expected other senders to be accepted, got %v", err)
+	}
+
+	err = server.Send("bot@spam.example.com", []string{"user@example.com"}, msg)
+	var smtpErr *gosmtp.SMTPError
+	if !errors.As(err, &smtpErr) || smtpErr.Code != reply.Code || smtpErr.EnhancedCode != reply.EnhancedCode {
+		t.Errorf("Expected Send to be rejected with %v, got %v", reply, err)
+	}
+}
+
+func TestDataFailure(t *testing.T) {
+	server, addr := NewTestServer(t)
+	msg := []byte("Subject: Hello\r\n\r\nBody\r\n")
+
+	if err := server.SetFaults(Faults{DataFailureRate: 1}); err != nil {
+		t.Fatalf("Failed to set faults: %v", err)
+	}
+	err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, msg)
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != 451 {
+		t.Fatalf("Expected 451 failure, got %v", err)
+	}
+
+	reply, _ := ProviderReply(ProviderGmail, ReplyGreylisted)
+	server.SetFaults(Faults{DataFailureRate: 1, DataFailure: reply})
+	err = smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, msg)
+	if !errors.As(err, &tpErr) || tpErr.Code != 450 {
+		t.Fatalf("Expected 450 failure, got %v", err)
+	}
+
+	server.SetFaults(Faults{})
+	if err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Expected email to be accepted without faults, got %v", err)
+	}
+	if emails := server.Emails(); len(emails) != 1 {
+		t.Errorf("Expected 1 email, got %d", len(emails))
+	}
+}
+
+func TestDropConnection(t *testing.T) {
+	for _, at := range []string{DropAtMail, DropAtRcpt, DropAtData} {
+		t.Run(at, func(t *testing.T) {
+			server, addr := NewTestServer(t)
+			if err := server.SetFaults(Faults{DropRate: 1, DropAt: at}); err != nil {
+				t.Fatalf("Failed to set faults: %v", err)
+			}
+
+			msg := []byte("Subject: Hello\r\n\r\nBody\r\n")
+			err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, msg)
+			var tpErr *textproto.Error
+			if err == nil || errors.As(err, &tpErr) {
+				t.Fatalf("Expected connection error, got %v", err)
+			}
+			if emails := server.Emails(); len(emails) != 0 {
+				t.Errorf("Expected no emails, got %d", len(emails))
+			}
+		})
+	}
+}
+
+func TestSetFaultsInvalid(t *testing.T) {
+	server := New(0, 0)
+	for _, f := range []Faults{{DropAt: "helo"}, {DropRate: 2}, {DataFailureRate: -0.5}} {
+		if err := server.SetFaults(f); err == nil {
+			t.Errorf("Expected error for %+v", f)
+		}
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		in       string
+		code     int
+		enhanced gosmtp.EnhancedCode
+		message  string
+	}{
+		{"421 4.7.0 Try again later", 421, gosmtp.EnhancedCode{4, 7, 0}, "Try again later"},
+		{"554 Go away", 554, gosmtp.EnhancedCode{}, "Go away"},
+		{"452", 452, gosmtp.EnhancedCode{}, "Rejected"},
+		{"gmail:mailbox-full", 452, gosmtp.EnhancedCode{4, 2, 2}, ""},
+	}
+	for _, tt := range tests {
+		r, err := ParseReply(tt.in)
+		if err != nil {
+			t.Errorf("ParseReply(%q): unexpected error %v", tt.in, err)
+			continue
+		}
+		if r.Code != tt.code || r.EnhancedCode != tt.enhanced || (tt.message != "" && r.Message != tt.message) {
+			t.Errorf("ParseReply(%q): expected %d %v %q, got %d %v %q", tt.in, tt.code, tt.enhanced, tt.message, r.Code, r.EnhancedCode, r.Message)
+		}
+	}
+
+	for _, in := range []string{"250 OK", "550 4.1.1 Mismatch", "nope"} {
+		if _, err := ParseReply(in); err == nil {
+			t.Errorf("ParseReply(%q): expected error", in)
+		}
+	}
+}
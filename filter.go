@@ -0,0 +1,193 @@
+package mailcatcher
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter selects emails. Empty fields match everything.
+type Filter struct {
+	// To matches a To, Cc or envelope recipient, see Email.HasRecipient.
+	To string `json:"to,omitempty"`
+
+	// From matches the sender, see Address.Matches.
+	From string `json:"from,omitempty"`
+
+	// SubjectContains matches a substring of the subject, ignoring case.
+	SubjectContains string `json:"subject_contains,omitempty"`
+
+	// Namespace matches emails routed to the namespace of that name, see
+	// Server.Namespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Unread, if set, matches only unread emails.
+	Unread bool `json:"unread,omitempty"`
+
+	// Tag matches emails with that tag.
+	Tag string `json:"tag,omitempty"`
+
+	// Dedupe keeps only the first of the emails with the same Hash, see
+	// Server.Duplicates. It is ignored by Match, which sees one email.
+	Dedupe bool `json:"dedupe,omitempty"`
+
+	// Since and Before bound the capture time: Since is inclusive, Before
+	// exclusive.
+	Since  time.Time `json:"since,omitzero"`
+	Before time.Time `json:"before,omitzero"`
+
+	namespaceDomain string // see Server.SetNamespaceDomain, set by Find
+}
+
+// Match reports whether email passes the filter. It can be passed to
+// WaitFor to wait for a matching email.
+func (f Filter) Match(email Email) bool {
+	switch {
+	case f.To != "" && !email.HasRecipient(f.To):
+		return false
+	case f.From != "" && !email.From.Matches(f.From):
+		return false
+	case f.SubjectContains != "" && !strings.Contains(strings.ToLower(email.Subject), strings.ToLower(f.SubjectContains)):
+		return false
+	case f.Namespace != "" && !inNamespace(email, strings.ToLower(f.Namespace), f.namespaceDomain):
+		return false
+	case f.Unread && !email.Unread:
+		return false
+	case f.Tag != "" && !slices.Contains(email.Tags, f.Tag):
+		return false
+	case !f.Since.IsZero() && email.Time.Before(f.Since):
+		return false
+	case !f.Before.IsZero() && !email.Time.Before(f.Before):
+		return false
+	}
+	return true
+}
+
+// Find returns the captured emails matching f, excluding held ones, in the
+// order they were received.
+func (s *Server) Find(f Filter) []Email {
+	if f.To == "" {
+		return s.match(s.Emails(), f)
+	}
+
+	candidates, err := s.listByRecipient(f.To)
+	if err != nil {
+		s.errorf("Failed to list emails: %v", err)
+		return []Email{}
+	}
+	return s.match(candidates, f)
+}
+
+// match returns the emails passing f, excluding held ones.
+func (s *Server) match(candidates []Email, f Filter) []Email {
+	f.namespaceDomain = s.namespaceDomainName()
+	emails := []Email{}
+	for _, email := range candidates {
+		if !email.Held && f.Match(email) {
+			emails = append(emails, email)
+		}
+	}
+	if f.Dedupe {
+		emails = dedupe(emails)
+	}
+	return emails
+}
+
+// listByRecipient returns stored emails, including held ones, that may be
+// addressed to addr, using the store's index if it has one. Callers still
+// check each email.
+func (s *Server) listByRecipient(addr string) ([]Email, error) {
+	ctx := context.Background()
+	if lister, ok := s.store.(RecipientLister); ok {
+		return lister.ListByRecipient(ctx, addr)
+	}
+	return s.store.List(ctx)
+}
+
+// parseFilter reads a Filter from the query parameters of the list
+// endpoint. Times are RFC 3339.
+func parseFilter(query url.Values) (Filter, error) {
+	f := Filter{
+		To:              query.Get("to"),
+		From:            query.Get("from"),
+		SubjectContains: query.Get("subject_contains"),
+		Namespace:       query.Get("namespace"),
+		Tag:             query.Get("tag"),
+	}
+	if value := query.Get("unread"); value != "" {
+		unread, err := strconv.ParseBool(value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid unread %q: expected true or false", value)
+		}
+		f.Unread = unread
+	}
+	if value := query.Get("dedupe"); value != "" {
+		dedupe, err := strconv.ParseBool(value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid dedupe %q: expected true or false", value)
+		}
+		f.Dedupe = dedupe
+	}
+	for name, t := range map[string]*time.Time{"since": &f.Since, "before": &f.Before} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid %s time %q: expected RFC 3339", name, value)
+		}
+		*t = parsed
+	}
+	return f, nil
+}
+
+// page selects a slice of the list endpoint's results.
+type page struct {
+	offset int
+	limit  int // 0 means no limit
+	desc   bool
+}
+
+// parsePage reads ?offset=, ?limit= and ?sort=asc|desc.
+func parsePage(query url.Values) (page, error) {
+	var p page
+	for name, n := range map[string]*int{"offset": &p.offset, "limit": &p.limit} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return page{}, fmt.Errorf("invalid %s %q: expected a non-negative integer", name, value)
+		}
+		*n = parsed
+	}
+
+	switch sort := query.Get("sort"); sort {
+	case "", "asc":
+	case "desc":
+		p.desc = true
+	default:
+		return page{}, fmt.Errorf("invalid sort %q: expected asc or desc", sort)
+	}
+	return p, nil
+}
+
+// apply returns the page of emails, which are in the order received.
+func (p page) apply(emails []Email) []Email {
+	if p.desc {
+		emails = slices.Clone(emails)
+		slices.Reverse(emails)
+	}
+	start := min(p.offset, len(emails))
+	end := len(emails)
+	if p.limit > 0 {
+		end = min(start+p.limit, end)
+	}
+	return emails[start:end]
+}
@@ -0,0 +1,154 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFind(t *testing.T) {
+	server := New(0, 0)
+	for _, m := range []struct{ from, to, subject string }{
+		{"app@example.com", "alice@example.com", "Welcome"},
+		{"app@example.com", "bob@example.com", "Reset your password"},
+		{"billing@example.com", "alice@example.com", "Invoice"},
+		{"app@example.com", "alice@example.com", "Password reset"},
+	} {
+		msg := []byte("From: " + m.from + "\r\nTo: " + m.to + "\r\nSubject: " + m.subject + "\r\n\r\nBody\r\n")
+		if err := server.Send(m.from, []string{m.to}, msg); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	found := server.Find(Filter{To: "ALICE@example.com", SubjectContains: "password"})
+	if len(found) != 1 || found[0].Subject != "Password reset" {
+		t.Errorf("Expected the password reset for alice, got %+v", found)
+	}
+	if found := server.Find(Filter{From: "billing@example.com"}); len(found) != 1 || found[0].Subject != "Invoice" {
+		t.Errorf("Expected the invoice, got %+v", found)
+	}
+	if found := server.Find(Filter{Since: time.Now().Add(time.Hour)}); len(found) != 0 {
+		t.Errorf("Expected no emails from the future, got %d", len(found))
+	}
+	if found := server.Find(Filter{Before: time.Now().Add(time.Hour)}); len(found) != 4 {
+		t.Errorf("Expected all 4 emails, got %d", len(found))
+	}
+
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	query := url.Values{"to": {"alice@example.com"}, "from": {"app@example.com"}, "since": {time.Now().Add(-time.Hour).Format(time.RFC3339)}}
+	resp, err := http.Get(ts.URL + "/api/v1/emails?" + query.Encode())
+	if err != nil {
+		t.Fatalf("Failed to GET emails: %v", err)
+	}
+	var list struct {
+		Count int     `json:"count"`
+		Items []Email `json:"items"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if list.Count != 2 || list.Items[0].Subject != "Welcome" || list.Items[1].Subject != "Password reset" {
+		t.Errorf("Expected Welcome and Password reset, got %+v", list.Items)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/emails?since=yesterday")
+	if err != nil {
+		t.Fatalf("Failed to GET emails: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid time, got %d", resp.StatusCode)
+	}
+}
+
+func TestFindBlindCopy(t *testing.T) {
+	server := New(0, 0)
+	msg := []byte("From: app@example.com\r\nTo: alice@example.com\r\nSubject: Report\r\n\r\nBody\r\n")
+	if err := server.Send("app@example.com", []string{"alice@example.com", "audit@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	// Like the recipient index, the filter matches envelope recipients
+	filter := Filter{To: "AUDIT@example.com"}
+	if found := server.Find(filter); len(found) != 1 {
+		t.Fatalf("Expected the blind copy to be found, got %d emails", len(found))
+	}
+	if email := server.Emails()[0]; !filter.Match(email) || !email.HasRecipient("audit@example.com") {
+		t.Error("Expected the filter to match the blind copy recipient")
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	server := New(0, 0)
+	for i := range 5 {
+		msg := []byte(fmt.Sprintf("Subject: %d\r\n\r\nBody\r\n", i))
+		if err := server.Send("app@example.com", []string{"user@example.com"}, msg); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		query string
+		want  string
+		total int
+	}{
+		{"limit=2", "0,1", 5},
+		{"limit=2&offset=2", "2,3", 5},
+		{"offset=4&limit=10", "4", 5},
+		{"offset=9", "", 5},
+		{"sort=desc&limit=2", "4,3", 5},
+		{"sort=desc&offset=3", "1,0", 5},
+		{"sort=asc", "0,1,2,3,4", 5},
+		{"subject_contains=3&limit=1", "3", 1},
+	} {
+		query := tc.query
+		resp, err := http.Get(ts.URL + "/api/v1/emails?" + query)
+		if err != nil {
+			t.Fatalf("Failed to GET emails: %v", err)
+		}
+		var list struct {
+			Total int     `json:"total"`
+			Count int     `json:"count"`
+			Items []Email `json:"items"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode response for %s: %v", query, err)
+		}
+
+		var subjects []string
+		for _, e := range list.Items {
+			subjects = append(subjects, e.Subject)
+		}
+		if got := strings.Join(subjects, ","); got != tc.want || list.Count != len(list.Items) {
+			t.Errorf("Expected %q for %s, got %q (count %d)", tc.want, query, got, list.Count)
+		}
+		if list.Total != tc.total {
+			t.Errorf("Expected total %d for %s, got %d", tc.total, query, list.Total)
+		}
+	}
+
+	for _, query := range []string{"limit=-1", "offset=x", "sort=random"} {
+		resp, err := http.Get(ts.URL + "/api/v1/emails?" + query)
+		if err != nil {
+			t.Fatalf("Failed to GET emails: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", query, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"gitlab.com/tozd/go/errors"
+)
+
+const (
+	// maxForwardHops stops forwarding loops between misconfigured instances.
+	maxForwardHops = 5
+
+	// maxInjectBytes caps the size of a message accepted by the inject endpoint.
+	maxInjectBytes = 64 * 1024 * 1024
+
+	hopsHeader = "X-Mailcatcher-Hops"
+)
+
+var forwardClient = &http.Client{Timeout: 10 * time.Second}
+
+// SetForwardURL mirrors every captured email to another mailcatcher
+// instance, given by the base URL of its HTTP API (e.g. "http://aggregate:8025").
+// Emails are posted to the remote inject endpoint with their original
+// envelope. Forwarding is asynchronous; failures are reported to the logger.
+// An empty URL disables forwarding.
+func (s *Server) SetForwardURL(baseURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forwardURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetForwardToken sends token as a bearer token with the emails mirrored
+// by SetForwardURL, for an instance protected with SetAPIToken. Basic
+// authentication can be given in the URL instead.
+func (s *Server) SetForwardToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forwardToken = token
+}
+
+// forward posts email to the inject endpoint of the instance at baseURL,
+// authenticating with token if set.
+func (s *Server) forward(baseURL, token string, email Email) {
+	query := url.Values{}
+	query.Set("from", email.Envelope.From)
+	for _, to := range email.Envelope.To {
+		query.Add("to", to)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/api/v1/emails?"+query.Encode(), strings.NewReader(email.Body))
+	if err != nil {
+		s.errorf("Failed to forward %s: %v", email.ID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "message/rfc822")
+	req.Header.Set(hopsHeader, strconv.Itoa(email.hops+1))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := forwardClient.Do(req)
+	if err != nil {
+		s.errorf("Failed to forward %s: %v", email.ID, err)
+		return
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusCreated {
+		s.errorf("Failed to forward %s: %s returned %s", email.ID, baseURL, resp.Status)
+	}
+}
+
+// HTTP handlers
+
+// handleInjectEmail stores a raw RFC 5322 message posted in the request
+// body, or every message of an mbox file. The envelope of a message is
+// given by the "from" and repeated "to" query parameters, or taken from
+// its headers.
+func (s *Server) handleInjectEmail(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInjectBytes))
+	if err != nil {
+		http.Error(w, "Failed to read message", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		http.Error(w, "Message body is required", http.StatusBadRequest)
+		return
+	}
+
+	// A message starts with a header, never with an mbox "From " line
+	if bytes.HasPrefix(body, []byte("From ")) {
+		s.handleInjectMbox(w, body)
+		return
+	}
+
+	query := r.URL.Query()
+	hops := 0
+	if value := r.Header.Get(hopsHeader); value != "" {
+		if hops, err = strconv.Atoi(value); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s header", hopsHeader), http.StatusBadRequest)
+			return
+		}
+	}
+
+	email, err := s.inject(query.Get("from"), query["to"], body, hops)
+	if err != nil {
+		s.injectError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(email); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleInjectMbox(w http.ResponseWriter, body []byte) {
+	emails, err := s.InjectMbox(bytes.NewReader(body))
+	if err != nil && len(emails) == 0 {
+		s.injectError(w, err)
+		return
+	}
+	if err != nil {
+		// Report the messages stored before the failure
+		s.errorf("%v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{"count": len(emails), "items": emails}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// injectError replies with the reason a message could not be injected.
+func (s *Server) injectError(w http.ResponseWriter, err error) {
+	var smtpErr *smtp.SMTPError
+	switch {
+	case errors.As(err, &smtpErr):
+		// Refused by the attachment policy
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, errInvalidMbox):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		s.errorf("%v", err)
+		http.Error(w, "Failed to store message", http.StatusInternalServerError)
+	}
+}
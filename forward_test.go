@@ -0,0 +1,122 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInjectEmail(t *testing.T) {
+	server := New(10036, 10091)
+	err := server.Start()
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	msg := "From: App <app@example.com>\r\nSubject: Injected\r\n\r\nBody\r\n"
+	resp, err := http.Post("http://localhost:10091/api/v1/emails?from=app@example.com&to=user@example.com",
+		"message/rfc822", strings.NewReader(msg))
+	if err != nil {
+		t.Fatalf("Failed to inject email: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	var email Email
+	if err := json.NewDecoder(resp.Body).Decode(&email); err != nil {
+		t.Fatalf("Failed to decode email: %v", err)
+	}
+
+	if email.ID == "" || email.Subject != "Injected" {
+		t.Errorf("Expected injected email with subject 'Injected', got %+v", email)
+	}
+	if len(email.To) != 1 || email.To[0].Address != "user@example.com" {
+		t.Errorf("Expected envelope recipient user@example.com, got %v", email.To)
+	}
+	if len(server.Emails()) != 1 {
+		t.Errorf("Expected 1 stored email, got %d", len(server.Emails()))
+	}
+}
+
+func TestForwardURL(t *testing.T) {
+	aggregate := New(10037, 10092)
+	if err := aggregate.Start(); err != nil {
+		t.Fatalf("Failed to start aggregate server: %v", err)
+	}
+	server := New(10038, 10093)
+	server.SetForwardURL("http://localhost:10092/")
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+		aggregate.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	msg := []byte("Subject: Federated\r\n\r\nBody\r\n")
+	err := smtp.SendMail("localhost:10038", nil, "sender@example.com",
+		[]string{"bcc@example.com"}, msg)
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if len(server.Emails()) != 1 {
+		t.Errorf("Expected local copy, got %d emails", len(server.Emails()))
+	}
+
+	emails := aggregate.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 forwarded email, got %d", len(emails))
+	}
+	if emails[0].Subject != "Federated" {
+		t.Errorf("Expected subject='Federated', got '%s'", emails[0].Subject)
+	}
+	if len(emails[0].To) != 1 || emails[0].To[0].Address != "bcc@example.com" {
+		t.Errorf("Expected envelope recipient to survive forwarding, got %v", emails[0].To)
+	}
+}
+
+func TestForwardToken(t *testing.T) {
+	aggregate := NewWithOptions(WithAPIToken("s3cret"))
+	ts := httptest.NewServer(aggregate.HTTPServer().Handler)
+	defer ts.Close()
+
+	server := New(0, 0)
+	server.SetForwardURL(ts.URL)
+	server.SetForwardToken("s3cret")
+	if err := server.AddRelayRule(RelayRule{Recipient: "*@ourcompany.com", ForwardURL: ts.URL, ForwardToken: "s3cret"}); err != nil {
+		t.Fatalf("Failed to add relay rule: %v", err)
+	}
+	server.Send("app@example.com", []string{"dev@ourcompany.com"}, []byte("Subject: Federated\r\n\r\nBody\r\n"))
+
+	// Mirrored and delivered by the rule, both with the token
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for len(aggregate.Emails()) < 2 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(aggregate.Emails()); n != 2 {
+		t.Errorf("Expected 2 forwarded emails, got %d", n)
+	}
+}
@@ -3,11 +3,22 @@ module github.com/andmetoo/mailcatcher
 go 1.24
 
 require (
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/emersion/go-sasl v0.0.0-20241020182733-b788ff22d5a6
 	github.com/emersion/go-smtp v0.24.0
+	github.com/klauspost/compress v1.17.11
+	github.com/redis/go-redis/v9 v9.22.0
 	gitlab.com/tozd/go/errors v0.10.0
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/net v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/emersion/go-sasl v0.0.0-20241020182733-b788ff22d5a6 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
 )
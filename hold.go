@@ -0,0 +1,175 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+var errNotHeld = errors.Base("email is not on hold")
+
+// HoldRule decides whether a captured email is placed on hold.
+// Held emails are excluded from Emails() and the list endpoint until they
+// are approved, and are discarded when rejected.
+type HoldRule func(Email) bool
+
+// HoldRecipient returns a HoldRule matching emails with a To or Cc address
+// matching the given path.Match pattern, e.g. "*@legal.example.com".
+// Matching is case-insensitive.
+func HoldRecipient(pattern string) HoldRule {
+	pattern = strings.ToLower(pattern)
+	return func(e Email) bool {
+		for _, list := range [][]Address{e.To, e.Cc} {
+			for _, a := range list {
+				if ok, _ := path.Match(pattern, strings.ToLower(a.Address)); ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// HoldSubject returns a HoldRule matching emails whose subject contains
+// substr, ignoring case.
+func HoldSubject(substr string) HoldRule {
+	substr = strings.ToLower(substr)
+	return func(e Email) bool {
+		return strings.Contains(strings.ToLower(e.Subject), substr)
+	}
+}
+
+// AddHoldRule registers a rule that places matching emails on hold.
+// An email is held if any registered rule matches.
+func (s *Server) AddHoldRule(rule HoldRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.holdRules = append(s.holdRules, rule)
+}
+
+// Held returns all emails currently on hold.
+func (s *Server) Held() []Email {
+	all, err := s.store.List(context.Background())
+	if err != nil {
+		s.errorf("Failed to list emails: %v", err)
+		return nil
+	}
+
+	var emails []Email
+	for _, email := range all {
+		if email.Held {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// Approve releases a held email into the normal listings.
+// Like Reject, approving an email that is not on hold is an error.
+func (s *Server) Approve(id string) error {
+	var email Email
+	err := s.tryUpdateEmail(id, func(e *Email) error {
+		if !e.Held {
+			return fmt.Errorf("%w: %s", errNotHeld, id)
+		}
+		e.Held = false
+		email = *e
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.notify(email)
+	s.signalArrival()
+	return nil
+}
+
+// Reject discards a held email.
+// Rejecting an email that is not on hold is an error, so a typo cannot
+// delete mail that already passed review.
+func (s *Server) Reject(id string) error {
+	ctx := context.Background()
+
+	email, err := s.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !email.Held {
+		return fmt.Errorf("%w: %s", errNotHeld, id)
+	}
+	return s.Delete(id)
+}
+
+// shouldHold reports whether any hold rule matches the email.
+func (s *Server) shouldHold(email Email) bool {
+	s.mu.RLock()
+	rules := s.holdRules
+	s.mu.RUnlock()
+
+	for _, rule := range rules {
+		if rule(email) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetHeld(w http.ResponseWriter, r *http.Request) {
+	emails := s.Held()
+	if emails == nil {
+		emails = []Email{}
+	}
+
+	response := map[string]any{
+		"total": len(emails),
+		"count": len(emails),
+		"items": emails,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleApproveEmail(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.Approve(id); err != nil {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, "Email not found", http.StatusNotFound)
+		case errors.Is(err, errNotHeld):
+			http.Error(w, "Email is not on hold", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to approve email", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Email(id)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleRejectEmail(w http.ResponseWriter, r *http.Request) {
+	if err := s.Reject(r.PathValue("id")); err != nil {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, "Email not found", http.StatusNotFound)
+		case errors.Is(err, errNotHeld):
+			http.Error(w, "Email is not on hold", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to reject email", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+package mailcatcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/smtp"
+	"testing"
+	"time"
+)
+
+func TestHoldRules(t *testing.T) {
+	server := New(10035, 10090)
+	server.AddHoldRule(HoldRecipient("*@legal.example.com"))
+
+	err := server.Start()
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	for _, to := range []string{"user@example.com", "counsel@legal.example.com", "clerk@legal.example.com"} {
+		msg := []byte("To: " + to + "\r\nSubject: Contract\r\n\r\nBody\r\n")
+		if err := smtp.SendMail("localhost:10035", nil, "sender@example.com", []string{to}, msg); err != nil {
+			t.Fatalf("Failed to send email: %v", err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if emails := server.Emails(); len(emails) != 1 {
+		t.Fatalf("Expected 1 released email, got %d", len(emails))
+	}
+
+	held := server.Held()
+	if len(held) != 2 {
+		t.Fatalf("Expected 2 held emails, got %d", len(held))
+	}
+
+	// Approve the first held email over HTTP
+	resp, err := http.Post("http://localhost:10090/api/v1/emails/"+held[0].ID+"/approve", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to approve email: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// Reject the second one
+	resp, err = http.Post("http://localhost:10090/api/v1/emails/"+held[1].ID+"/reject", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to reject email: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+
+	if emails := server.Emails(); len(emails) != 2 {
+		t.Errorf("Expected 2 released emails after review, got %d", len(emails))
+	}
+	if held := server.Held(); len(held) != 0 {
+		t.Errorf("Expected no held emails after review, got %d", len(held))
+	}
+	if server.Email(held[1].ID) != nil {
+		t.Error("Expected rejected email to be discarded")
+	}
+
+	// Rejecting or approving released mail again is refused
+	if err := server.Reject(held[0].ID); err == nil {
+		t.Error("Expected error rejecting an email that is not on hold")
+	}
+	if err := server.Approve(held[0].ID); !errors.Is(err, errNotHeld) {
+		t.Errorf("Expected error approving an email that is not on hold, got %v", err)
+	}
+	resp, err = http.Post("http://localhost:10090/api/v1/emails/"+held[0].ID+"/approve", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to approve email: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status 409 approving again, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,112 @@
+package mailcatcher
+
+import (
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"gitlab.com/tozd/go/errors"
+)
+
+// SessionInfo describes an SMTP session. A session begins with the
+// client's HELO or EHLO and ends when the connection closes, or when
+// STARTTLS restarts it.
+type SessionInfo struct {
+	RemoteAddr string    `json:"remote_addr"`
+	Hostname   string    `json:"hostname"` // as announced in HELO/EHLO
+	Start      time.Time `json:"start"`
+
+	// Messages is the number of messages accepted, and Duration the length
+	// of the session. Both are only set when the session ends.
+	Messages int           `json:"messages"`
+	Duration time.Duration `json:"duration"`
+}
+
+// hooks are callbacks registered with the On methods.
+type hooks struct {
+	accept       []func(Email) error
+	message      []func(Email)
+	sessionStart []func(SessionInfo)
+	sessionEnd   []func(SessionInfo)
+}
+
+// OnAccept registers a function deciding whether to accept each message,
+// after the built-in checks and before it is stored. Returning an error
+// rejects the message: an *smtp.SMTPError is sent as the reply, any other
+// error as 550 5.7.1 with the error text.
+func (s *Server) OnAccept(fn func(Email) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks.accept = append(s.hooks.accept, fn)
+}
+
+// OnMessage registers a function called with every stored message,
+// including held ones. Unlike a Notifier it runs synchronously, before
+// the client gets its reply, so it should return quickly.
+func (s *Server) OnMessage(fn func(Email)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks.message = append(s.hooks.message, fn)
+}
+
+// OnSessionStart registers a function called when an SMTP session begins.
+func (s *Server) OnSessionStart(fn func(SessionInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks.sessionStart = append(s.hooks.sessionStart, fn)
+}
+
+// OnSessionEnd registers a function called when an SMTP session ends.
+func (s *Server) OnSessionEnd(fn func(SessionInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks.sessionEnd = append(s.hooks.sessionEnd, fn)
+}
+
+// checkAccept runs the OnAccept hooks.
+func (s *Server) checkAccept(email Email) error {
+	s.mu.RLock()
+	accept := s.hooks.accept
+	s.mu.RUnlock()
+
+	for _, fn := range accept {
+		err := fn(email)
+		if err == nil {
+			continue
+		}
+		var smtpErr *smtp.SMTPError
+		if errors.As(err, &smtpErr) {
+			return smtpErr
+		}
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      err.Error(),
+		}
+	}
+	return nil
+}
+
+// runMessageHooks runs the OnMessage hooks.
+func (s *Server) runMessageHooks(email Email) {
+	s.mu.RLock()
+	message := s.hooks.message
+	s.mu.RUnlock()
+
+	for _, fn := range message {
+		fn(email)
+	}
+}
+
+// runSessionHooks runs the OnSessionStart or OnSessionEnd hooks.
+func (s *Server) runSessionHooks(end bool, info SessionInfo) {
+	s.mu.RLock()
+	fns := s.hooks.sessionStart
+	if end {
+		fns = s.hooks.sessionEnd
+	}
+	s.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(info)
+	}
+}
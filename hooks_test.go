@@ -0,0 +1,100 @@
+package mailcatcher
+
+import (
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOnAccept(t *testing.T) {
+	server, addr := NewTestServer(t)
+	server.OnAccept(func(e Email) error {
+		if strings.Contains(e.Subject, "spam") {
+			return errors.New("No spam please")
+		}
+		return nil
+	})
+	reply, _ := ParseReply("451 4.7.1 Try again")
+	server.OnAccept(func(e Email) error {
+		if e.Subject == "Later" {
+			return reply
+		}
+		return nil
+	})
+
+	err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, []byte("Subject: Buy spam\r\n\r\nBody\r\n"))
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != 550 || tpErr.Msg != "5.7.1 No spam please" {
+		t.Errorf("Expected 550 5.7.1 No spam please, got %v", err)
+	}
+
+	err = server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: Later\r\n\r\nBody\r\n"))
+	if err != reply {
+		t.Errorf("Expected hook reply, got %v", err)
+	}
+
+	if err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, []byte("Subject: Hello\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	if emails := server.Emails(); len(emails) != 1 || emails[0].Subject != "Hello" {
+		t.Errorf("Expected only the accepted email, got %d", len(emails))
+	}
+}
+
+func TestOnMessage(t *testing.T) {
+	server := New(0, 0)
+	var subjects []string
+	server.OnMessage(func(e Email) {
+		if e.ID == "" {
+			t.Error("Expected stored email with ID")
+		}
+		subjects = append(subjects, e.Subject)
+	})
+
+	for _, subject := range []string{"One", "Two"} {
+		if err := server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: "+subject+"\r\n\r\nBody\r\n")); err != nil {
+			t.Fatalf("Failed to send email: %v", err)
+		}
+	}
+
+	// Hooks run before Send returns
+	if len(subjects) != 2 || subjects[0] != "One" || subjects[1] != "Two" {
+		t.Errorf("Expected hooks for One and Two, got %v", subjects)
+	}
+}
+
+func TestOnSession(t *testing.T) {
+	server, addr := NewTestServer(t)
+
+	var mu sync.Mutex
+	var started, ended []SessionInfo
+	ends := make(chan struct{}, 1)
+	server.OnSessionStart(func(info SessionInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		started = append(started, info)
+	})
+	server.OnSessionEnd(func(info SessionInfo) {
+		mu.Lock()
+		ended = append(ended, info)
+		mu.Unlock()
+		ends <- struct{}{}
+	})
+
+	if err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, []byte("Subject: Hello\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	<-ends
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(started) != 1 || started[0].Hostname != "localhost" || !strings.HasPrefix(started[0].RemoteAddr, "127.0.0.1:") {
+		t.Errorf("Expected 1 session start from localhost, got %+v", started)
+	}
+	if len(ended) != 1 || ended[0].Messages != 1 || ended[0].Duration <= 0 {
+		t.Errorf("Expected 1 session end with 1 message, got %+v", ended)
+	}
+}
@@ -0,0 +1,592 @@
+package mailcatcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// imapTimeout is the inactivity autologout timer, the minimum RFC 3501
+	// allows.
+	imapTimeout = 30 * time.Minute
+
+	// imapMaxCommand limits the size of a command including its literals.
+	imapMaxCommand = 1 << 20
+
+	// imapUIDValidity never changes, as email IDs are never reused.
+	imapUIDValidity = 1
+
+	imapCapabilities = "IMAP4rev1 LITERAL+ UNSELECT AUTH=PLAIN"
+)
+
+// imapLiteral matches a line ending in a literal, e.g. "{12}" or "{12+}".
+var imapLiteral = regexp.MustCompile(`\{(\d+)(\+?)\}$`)
+
+// SetIMAPPort enables a read-only IMAP server (RFC 3501) on port, so
+// desktop clients and services polling a mailbox can read the captured
+// mail. Zero picks a free port. It must be called before Start.
+//
+// The server has a single mailbox, INBOX, which is opened read-only.
+// Logging in works as for SetPOP3Port: an email address sees the mail
+// delivered to it, any other user name sees all mail.
+func (s *Server) SetIMAPPort(port int) {
+	s.imap = &mailboxListener{
+		name:  "IMAP",
+		port:  port,
+		addr:  net.JoinHostPort(s.host, strconv.Itoa(port)),
+		serve: s.serveIMAP,
+	}
+}
+
+// IMAPAddr returns the address of the IMAP listener, like SMTPAddr, or ""
+// if IMAP is not enabled.
+func (s *Server) IMAPAddr() string {
+	if s.imap == nil {
+		return ""
+	}
+	return dialAddr(s.imap.addr)
+}
+
+// imapSession is the state of one IMAP connection.
+type imapSession struct {
+	server *Server
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+
+	user     string // set once logged in
+	selected bool
+	messages []*imapMessage
+}
+
+// imapMessage is a message of the selected mailbox.
+type imapMessage struct {
+	email Email
+	uid   uint32
+	body  []byte // with CRLF line endings
+	part  *imapPart
+}
+
+// imapAtom is an unquoted command argument, as opposed to a string.
+type imapAtom string
+
+func (s *Server) serveIMAP(conn net.Conn) {
+	c := &imapSession{server: s, conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	c.untagged("OK [CAPABILITY %s] mailcatcher IMAP ready", imapCapabilities)
+	c.w.Flush()
+
+	for {
+		conn.SetDeadline(time.Now().Add(imapTimeout))
+		line, err := c.readCommand()
+		if err != nil {
+			return
+		}
+		args, err := parseIMAPArgs(line)
+		if err != nil || len(args) < 2 {
+			c.untagged("BAD Invalid command")
+			c.w.Flush()
+			continue
+		}
+		tag, _ := args[0].(imapAtom)
+		cmd, _ := args[1].(imapAtom)
+		if tag == "" || cmd == "" {
+			c.untagged("BAD Invalid command")
+			c.w.Flush()
+			continue
+		}
+
+		done := c.handle(string(tag), strings.ToUpper(string(cmd)), args[2:])
+		if c.w.Flush() != nil || done {
+			return
+		}
+	}
+}
+
+// readCommand reads a command line, including the literals it contains.
+func (c *imapSession) readCommand() ([]byte, error) {
+	var command []byte
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		command = append(command, strings.TrimRight(line, "\r\n")...)
+		if len(command) > imapMaxCommand {
+			return nil, fmt.Errorf("command too long")
+		}
+
+		m := imapLiteral.FindSubmatch(command)
+		if m == nil {
+			return command, nil
+		}
+		n, err := strconv.Atoi(string(m[1]))
+		if err != nil || len(command)+n > imapMaxCommand {
+			return nil, fmt.Errorf("literal too long")
+		}
+		if len(m[2]) == 0 { // synchronizing literal
+			c.w.WriteString("+ Ready for literal data\r\n")
+			c.w.Flush()
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return nil, err
+		}
+		command = append(append(command, "\r\n"...), literal...)
+	}
+}
+
+// handle runs a single command and reports whether the connection ends.
+func (c *imapSession) handle(tag, cmd string, args []any) bool {
+	switch cmd {
+	case "CAPABILITY":
+		c.untagged("CAPABILITY %s", imapCapabilities)
+		c.tagged(tag, "OK CAPABILITY completed")
+		return false
+	case "NOOP", "CHECK":
+		if c.selected {
+			c.refresh()
+		}
+		c.tagged(tag, "OK %s completed", cmd)
+		return false
+	case "LOGOUT":
+		c.untagged("BYE mailcatcher logging out")
+		c.tagged(tag, "OK LOGOUT completed")
+		return true
+	}
+
+	if c.user == "" {
+		switch cmd {
+		case "LOGIN":
+			if len(args) != 2 {
+				c.tagged(tag, "BAD Usage: LOGIN user password")
+				return false
+			}
+			c.login(tag, imapText(args[0]), imapText(args[1]))
+		case "AUTHENTICATE":
+			c.authenticate(tag, args)
+		default:
+			c.tagged(tag, "BAD Log in first")
+		}
+		return false
+	}
+
+	uid := false
+	if cmd == "UID" && len(args) > 0 {
+		uid = true
+		sub, _ := args[0].(imapAtom)
+		cmd, args = strings.ToUpper(string(sub)), args[1:]
+	}
+
+	switch cmd {
+	case "LIST", "LSUB":
+		c.list(tag, cmd, args)
+	case "SELECT", "EXAMINE":
+		c.selectMailbox(tag, cmd, args)
+	case "STATUS":
+		c.status(tag, args)
+	case "CLOSE", "UNSELECT":
+		if !c.selected {
+			c.tagged(tag, "BAD No mailbox selected")
+			return false
+		}
+		c.selected, c.messages = false, nil
+		c.tagged(tag, "OK %s completed", cmd)
+	case "FETCH":
+		if c.requireSelected(tag) {
+			c.fetch(tag, uid, args)
+		}
+	case "SEARCH":
+		if c.requireSelected(tag) {
+			c.search(tag, uid, args)
+		}
+	case "STORE", "COPY", "MOVE", "EXPUNGE", "APPEND", "CREATE", "DELETE", "RENAME", "SUBSCRIBE", "UNSUBSCRIBE":
+		c.tagged(tag, "NO [CANNOT] Mailbox is read-only")
+	default:
+		c.tagged(tag, "BAD Unknown command")
+	}
+	return false
+}
+
+func (c *imapSession) login(tag, username, password string) {
+	if !c.server.checkMailboxLogin(username, password) {
+		c.server.infof("Rejected IMAP login for %q from %s", username, c.conn.RemoteAddr())
+		c.tagged(tag, "NO [AUTHENTICATIONFAILED] Invalid credentials")
+		return
+	}
+	c.user = username
+	c.tagged(tag, "OK [CAPABILITY %s] Logged in", imapCapabilities)
+}
+
+// authenticate handles AUTHENTICATE PLAIN, with or without an initial
+// response.
+func (c *imapSession) authenticate(tag string, args []any) {
+	if len(args) == 0 || !strings.EqualFold(imapText(args[0]), "PLAIN") {
+		c.tagged(tag, "NO [CANNOT] Unsupported mechanism")
+		return
+	}
+
+	response := ""
+	if len(args) > 1 {
+		response = imapText(args[1])
+	} else {
+		c.w.WriteString("+ \r\n")
+		c.w.Flush()
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		response = strings.TrimRight(line, "\r\n")
+	}
+	if response == "*" {
+		c.tagged(tag, "BAD Authentication cancelled")
+		return
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	parts := strings.Split(string(decoded), "\x00")
+	if err != nil || len(parts) != 3 {
+		c.tagged(tag, "BAD Invalid response")
+		return
+	}
+	c.login(tag, parts[1], parts[2])
+}
+
+func (c *imapSession) requireSelected(tag string) bool {
+	if !c.selected {
+		c.tagged(tag, "BAD No mailbox selected")
+	}
+	return c.selected
+}
+
+func (c *imapSession) list(tag, cmd string, args []any) {
+	if len(args) != 2 {
+		c.tagged(tag, "BAD Usage: %s reference mailbox", cmd)
+		return
+	}
+	pattern := imapText(args[0]) + imapText(args[1])
+	switch {
+	case imapText(args[1]) == "":
+		c.untagged(`%s (\Noselect) "/" ""`, cmd)
+	case imapPatternMatch(pattern, "INBOX"):
+		c.untagged(`%s (\HasNoChildren) "/" INBOX`, cmd)
+	}
+	c.tagged(tag, "OK %s completed", cmd)
+}
+
+// imapPatternMatch reports whether the LIST pattern, with the wildcards
+// '*' and '%', matches name. INBOX is case-insensitive.
+func imapPatternMatch(pattern, name string) bool {
+	re := regexp.QuoteMeta(strings.ToUpper(pattern))
+	re = strings.NewReplacer(`\*`, ".*", "%", "[^/]*").Replace(re)
+	return regexp.MustCompile("^" + re + "$").MatchString(name)
+}
+
+func (c *imapSession) selectMailbox(tag, cmd string, args []any) {
+	if len(args) != 1 || !strings.EqualFold(imapText(args[0]), "INBOX") {
+		c.selected, c.messages = false, nil
+		c.tagged(tag, "NO [NONEXISTENT] No such mailbox")
+		return
+	}
+
+	messages, err := c.load()
+	if err != nil {
+		c.tagged(tag, "NO [UNAVAILABLE] Mailbox unavailable")
+		return
+	}
+	c.selected, c.messages = true, messages
+
+	c.untagged(`FLAGS (\Seen \Answered \Flagged \Deleted \Draft)`)
+	c.untagged("%d EXISTS", len(messages))
+	c.untagged("0 RECENT")
+	c.untagged("OK [UIDVALIDITY %d] UIDs valid", imapUIDValidity)
+	c.untagged("OK [UIDNEXT %d] Predicted next UID", uidNext(messages))
+	c.untagged("OK [PERMANENTFLAGS ()] No permanent flags")
+	c.tagged(tag, "OK [READ-ONLY] %s completed", cmd)
+}
+
+func (c *imapSession) status(tag string, args []any) {
+	items, ok := imapListArg(args, 1)
+	if len(args) != 2 || !ok || !strings.EqualFold(imapText(args[0]), "INBOX") {
+		c.tagged(tag, "NO [NONEXISTENT] No such mailbox")
+		return
+	}
+	messages, err := c.load()
+	if err != nil {
+		c.tagged(tag, "NO [UNAVAILABLE] Mailbox unavailable")
+		return
+	}
+
+	var values []string
+	for _, item := range items {
+		name := strings.ToUpper(imapText(item))
+		switch name {
+		case "MESSAGES", "UNSEEN":
+			values = append(values, fmt.Sprintf("%s %d", name, len(messages)))
+		case "RECENT":
+			values = append(values, "RECENT 0")
+		case "UIDNEXT":
+			values = append(values, fmt.Sprintf("UIDNEXT %d", uidNext(messages)))
+		case "UIDVALIDITY":
+			values = append(values, fmt.Sprintf("UIDVALIDITY %d", imapUIDValidity))
+		default:
+			c.tagged(tag, "BAD Unknown status item %s", name)
+			return
+		}
+	}
+	c.untagged("STATUS INBOX (%s)", strings.Join(values, " "))
+	c.tagged(tag, "OK STATUS completed")
+}
+
+// load returns the messages of the user's mailbox. UIDs follow the numbers
+// of the email IDs, so they stay valid across sessions.
+func (c *imapSession) load() ([]*imapMessage, error) {
+	emails, err := c.server.mailbox(c.user)
+	if err != nil {
+		c.server.errorf("Failed to open IMAP mailbox %q: %v", c.user, err)
+		return nil, err
+	}
+
+	messages := make([]*imapMessage, 0, len(emails))
+	var last uint32
+	for _, email := range emails {
+		uid := last + 1
+		if seq, ok := idSeq(email.ID); ok && seq >= uint64(last) && seq < 1<<32-1 {
+			uid = uint32(seq) + 1 // UIDs start at 1, IDs at msg-0
+		}
+		last = uid
+		messages = append(messages, &imapMessage{email: email, uid: uid, body: crlf(email.Raw())})
+	}
+	return messages, nil
+}
+
+// refresh announces messages that arrived since the mailbox was selected.
+// Deleted messages stay visible until the mailbox is selected again.
+func (c *imapSession) refresh() {
+	messages, err := c.load()
+	if err != nil {
+		return
+	}
+	last, count := uidNext(c.messages)-1, len(c.messages)
+	for _, m := range messages {
+		if m.uid > last {
+			c.messages = append(c.messages, m)
+		}
+	}
+	if len(c.messages) != count {
+		c.untagged("%d EXISTS", len(c.messages))
+	}
+}
+
+func uidNext(messages []*imapMessage) uint32 {
+	if len(messages) == 0 {
+		return 1
+	}
+	return messages[len(messages)-1].uid + 1
+}
+
+func (c *imapSession) untagged(format string, args ...any) {
+	fmt.Fprintf(c.w, "* "+format+"\r\n", args...)
+}
+
+func (c *imapSession) tagged(tag, format string, args ...any) {
+	fmt.Fprintf(c.w, tag+" "+format+"\r\n", args...)
+}
+
+// parseIMAPArgs splits a command into atoms, strings and parenthesized
+// lists ([]any). Square brackets in atoms, as in "BODY[HEADER.FIELDS
+// (SUBJECT)]", may hold spaces and parentheses.
+func parseIMAPArgs(line []byte) ([]any, error) {
+	args, rest, err := parseIMAPList(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected %q", rest)
+	}
+	return args, nil
+}
+
+func parseIMAPList(b []byte) ([]any, []byte, error) {
+	var args []any
+	for {
+		b = bytes.TrimLeft(b, " ")
+		if len(b) == 0 || b[0] == ')' {
+			return args, b, nil
+		}
+
+		switch b[0] {
+		case '(':
+			list, rest, err := parseIMAPList(b[1:])
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(rest) == 0 {
+				return nil, nil, fmt.Errorf("unterminated list")
+			}
+			args, b = append(args, list), rest[1:]
+		case '"':
+			var s strings.Builder
+			i := 1
+			for ; i < len(b) && b[i] != '"'; i++ {
+				if b[i] == '\\' && i+1 < len(b) {
+					i++
+				}
+				s.WriteByte(b[i])
+			}
+			if i == len(b) {
+				return nil, nil, fmt.Errorf("unterminated string")
+			}
+			args, b = append(args, s.String()), b[i+1:]
+		case '{':
+			end := bytes.Index(b, []byte("}\r\n"))
+			if end < 0 {
+				return nil, nil, fmt.Errorf("invalid literal")
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(string(b[1:end]), "+"))
+			if err != nil || n < 0 || end+3+n > len(b) {
+				return nil, nil, fmt.Errorf("invalid literal")
+			}
+			b = b[end+3:]
+			args, b = append(args, string(b[:n])), b[n:]
+		default:
+			i, depth := 0, 0
+			for ; i < len(b); i++ {
+				if depth == 0 && (b[i] == ' ' || b[i] == '(' || b[i] == ')') {
+					break
+				}
+				switch b[i] {
+				case '[':
+					depth++
+				case ']':
+					depth--
+				}
+			}
+			args, b = append(args, imapAtom(b[:i])), b[i:]
+		}
+	}
+}
+
+// imapText returns the text of an atom or string argument.
+func imapText(arg any) string {
+	switch v := arg.(type) {
+	case imapAtom:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// imapListArg returns args[i] as a list, accepting a single atom in its
+// place.
+func imapListArg(args []any, i int) ([]any, bool) {
+	if i >= len(args) {
+		return nil, false
+	}
+	switch v := args[i].(type) {
+	case []any:
+		return v, true
+	case imapAtom:
+		return []any{v}, true
+	}
+	return nil, false
+}
+
+// imapQuote formats s as an IMAP string: quoted, or a literal if it holds
+// characters quoted strings cannot.
+func imapQuote(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '\r' || c == '\n' || c == 0 || c >= 0x80 {
+			return fmt.Sprintf("{%d}\r\n%s", len(s), s)
+		}
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// imapNString is imapQuote with NIL for the empty string.
+func imapNString(s string) string {
+	if s == "" {
+		return "NIL"
+	}
+	return imapQuote(s)
+}
+
+// imapSeqSet is a parsed sequence set such as "1:3,7,9:*".
+type imapSeqSet [][2]uint32
+
+// parseIMAPSeqSet parses set, with '*' standing for max.
+func parseIMAPSeqSet(set string, max uint32) (imapSeqSet, error) {
+	var ranges imapSeqSet
+	for _, r := range strings.Split(set, ",") {
+		lo, hi, isRange := strings.Cut(r, ":")
+		if !isRange {
+			hi = lo
+		}
+		a, err := parseIMAPSeqNumber(lo, max)
+		if err != nil {
+			return nil, err
+		}
+		b, err := parseIMAPSeqNumber(hi, max)
+		if err != nil {
+			return nil, err
+		}
+		if a > b {
+			a, b = b, a
+		}
+		ranges = append(ranges, [2]uint32{a, b})
+	}
+	return ranges, nil
+}
+
+func parseIMAPSeqNumber(s string, max uint32) (uint32, error) {
+	if s == "*" {
+		return max, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid sequence number %q", s)
+	}
+	return uint32(n), nil
+}
+
+func (set imapSeqSet) contains(n uint32) bool {
+	for _, r := range set {
+		if n >= r[0] && n <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// matching returns the sequence numbers (from 1) of the selected messages
+// in set, which holds UIDs if uid is set.
+func (c *imapSession) matching(set string, uid bool) ([]int, error) {
+	max := uint32(len(c.messages))
+	if uid {
+		max = uidNext(c.messages) - 1
+	}
+	ranges, err := parseIMAPSeqSet(set, max)
+	if err != nil {
+		return nil, err
+	}
+
+	var seqs []int
+	for i, m := range c.messages {
+		n := uint32(i + 1)
+		if uid {
+			n = m.uid
+		}
+		if ranges.contains(n) {
+			seqs = append(seqs, i+1)
+		}
+	}
+	return seqs, nil
+}
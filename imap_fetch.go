@@ -0,0 +1,400 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"mime"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// imapSection matches the section of a BODY[section] fetch item, e.g.
+// "1.2.TEXT" or "HEADER.FIELDS (SUBJECT FROM)".
+var imapSection = regexp.MustCompile(`^(?:\d+(?:\.\d+)*)?(?:(?:^|\.)(?:HEADER|TEXT|MIME|HEADER\.FIELDS(?:\.NOT)? \([^()]*\)))?$`)
+
+// fetchItem is a parsed FETCH data item.
+type fetchItem struct {
+	name    string // e.g. "ENVELOPE" or "BODY.PEEK"
+	section string // set for BODY[section]
+	body    bool   // BODY[...] rather than BODY
+	partial bool
+	origin  int
+	count   int
+}
+
+func parseFetchItem(s string) (fetchItem, error) {
+	name, section, hasSection := strings.Cut(s, "[")
+	if !hasSection {
+		switch name {
+		case "UID", "FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "RFC822", "RFC822.HEADER", "RFC822.TEXT", "BODY", "BODYSTRUCTURE":
+			return fetchItem{name: name}, nil
+		}
+		return fetchItem{}, fmt.Errorf("unknown fetch item %s", s)
+	}
+
+	end := strings.LastIndexByte(section, ']')
+	if (name != "BODY" && name != "BODY.PEEK") || end < 0 || !imapSection.MatchString(section[:end]) {
+		return fetchItem{}, fmt.Errorf("invalid fetch item %s", s)
+	}
+	item := fetchItem{name: name, section: section[:end], body: true}
+
+	if partial := section[end+1:]; partial != "" {
+		origin, count, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(partial, "<"), ">"), ".")
+		var err1, err2 error
+		item.origin, err1 = strconv.Atoi(origin)
+		item.count, err2 = strconv.Atoi(count)
+		if !ok || err1 != nil || err2 != nil || item.origin < 0 || item.count < 0 {
+			return fetchItem{}, fmt.Errorf("invalid partial %s", partial)
+		}
+		item.partial = true
+	}
+	return item, nil
+}
+
+func (c *imapSession) fetch(tag string, uid bool, args []any) {
+	items, ok := imapListArg(args, 1)
+	if len(args) != 2 || !ok {
+		c.tagged(tag, "BAD Usage: FETCH sequence items")
+		return
+	}
+	seqs, err := c.matching(imapText(args[0]), uid)
+	if err != nil {
+		c.tagged(tag, "BAD %v", err)
+		return
+	}
+
+	var names []string
+	for _, item := range items {
+		names = append(names, strings.ToUpper(imapText(item)))
+	}
+	if len(names) == 1 {
+		switch names[0] {
+		case "ALL":
+			names = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE"}
+		case "FAST":
+			names = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE"}
+		case "FULL":
+			names = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODY"}
+		}
+	}
+	if uid && !slices.Contains(names, "UID") {
+		names = append([]string{"UID"}, names...)
+	}
+
+	var fetchItems []fetchItem
+	for _, name := range names {
+		item, err := parseFetchItem(name)
+		if err != nil {
+			c.tagged(tag, "BAD %v", err)
+			return
+		}
+		fetchItems = append(fetchItems, item)
+	}
+
+	for _, seq := range seqs {
+		m := c.messages[seq-1]
+		values := make([]string, len(fetchItems))
+		for i, item := range fetchItems {
+			values[i] = m.fetch(item)
+		}
+		c.untagged("%d FETCH (%s)", seq, strings.Join(values, " "))
+	}
+	c.tagged(tag, "OK FETCH completed")
+}
+
+// fetch returns the response to a FETCH data item.
+func (m *imapMessage) fetch(item fetchItem) string {
+	part := m.mime()
+	switch {
+	case item.body:
+		content := part.section(item.section)
+		name := "BODY[" + item.section + "]"
+		if item.partial {
+			start := min(item.origin, len(content))
+			content = content[start:min(start+item.count, len(content))]
+			name += "<" + strconv.Itoa(item.origin) + ">"
+		}
+		return name + " " + imapLiteralString(content)
+	case item.name == "UID":
+		return "UID " + strconv.FormatUint(uint64(m.uid), 10)
+	case item.name == "FLAGS":
+		return "FLAGS ()"
+	case item.name == "INTERNALDATE":
+		return `INTERNALDATE "` + m.email.Time.Format("02-Jan-2006 15:04:05 -0700") + `"`
+	case item.name == "RFC822.SIZE":
+		return "RFC822.SIZE " + strconv.Itoa(len(m.body))
+	case item.name == "ENVELOPE":
+		return "ENVELOPE " + imapEnvelope(part.header)
+	case item.name == "RFC822":
+		return "RFC822 " + imapLiteralString(m.body)
+	case item.name == "RFC822.HEADER":
+		return "RFC822.HEADER " + imapLiteralString(part.header)
+	case item.name == "RFC822.TEXT":
+		return "RFC822.TEXT " + imapLiteralString(part.body)
+	default: // BODY and BODYSTRUCTURE
+		return item.name + " " + part.structure()
+	}
+}
+
+// mime returns the MIME structure of the message, parsing it on first use.
+func (m *imapMessage) mime() *imapPart {
+	if m.part == nil {
+		m.part = parseIMAPPart(m.body, "text/plain")
+	}
+	return m.part
+}
+
+func imapLiteralString(b []byte) string {
+	return fmt.Sprintf("{%d}\r\n%s", len(b), b)
+}
+
+// imapPart is a MIME entity of a message.
+type imapPart struct {
+	raw    []byte
+	header []byte // including the blank line that ends it
+	body   []byte
+
+	mediaType   string
+	subtype     string
+	params      map[string]string
+	id          string
+	description string
+	encoding    string
+
+	parts   []*imapPart // of a multipart entity
+	message *imapPart   // encapsulated by a message/rfc822 entity
+}
+
+// parseIMAPPart parses the entity raw, with CRLF line endings. Entities
+// without a valid Content-Type get defaultType.
+func parseIMAPPart(raw []byte, defaultType string) *imapPart {
+	p := &imapPart{raw: raw}
+	if bytes.HasPrefix(raw, []byte("\r\n")) {
+		p.header, p.body = raw[:2], raw[2:]
+	} else if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		p.header, p.body = raw[:i+4], raw[i+4:]
+	} else {
+		p.header = raw
+	}
+	h := parseIMAPHeader(p.header)
+
+	p.mediaType, p.subtype, _ = strings.Cut(defaultType, "/")
+	if mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type")); err == nil {
+		if typ, sub, ok := strings.Cut(mediaType, "/"); ok {
+			p.mediaType, p.subtype, p.params = typ, sub, params
+		}
+	}
+	if len(p.params) == 0 && p.mediaType == "text" {
+		p.params = map[string]string{"charset": "us-ascii"}
+	}
+	p.id = h.Get("Content-Id")
+	p.description = h.Get("Content-Description")
+	p.encoding = h.Get("Content-Transfer-Encoding")
+	if p.encoding == "" {
+		p.encoding = "7bit"
+	}
+
+	switch {
+	case p.mediaType == "multipart":
+		childType := "text/plain"
+		if p.subtype == "digest" {
+			childType = "message/rfc822"
+		}
+		for _, raw := range splitIMAPMultipart(p.body, p.params["boundary"]) {
+			p.parts = append(p.parts, parseIMAPPart(raw, childType))
+		}
+		if len(p.parts) == 0 { // not a valid multipart, show it as text
+			p.mediaType, p.subtype, p.params = "text", "plain", map[string]string{"charset": "us-ascii"}
+		}
+	case p.mediaType == "message" && p.subtype == "rfc822":
+		p.message = parseIMAPPart(p.body, "text/plain")
+	}
+	return p
+}
+
+func parseIMAPHeader(header []byte) mail.Header {
+	if !bytes.HasSuffix(header, []byte("\r\n\r\n")) {
+		header = append(bytes.Clone(header), "\r\n\r\n"...)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(header))
+	if err != nil {
+		return mail.Header{}
+	}
+	return msg.Header
+}
+
+// splitIMAPMultipart returns the body parts of a multipart entity.
+func splitIMAPMultipart(body []byte, boundary string) [][]byte {
+	if boundary == "" {
+		return nil
+	}
+	// The CRLF before a delimiter belongs to it, not to the part
+	segments := bytes.Split(append([]byte("\r\n"), body...), []byte("\r\n--"+boundary))
+
+	var parts [][]byte
+	for _, segment := range segments[1:] {
+		if bytes.HasPrefix(segment, []byte("--")) {
+			break // close delimiter
+		}
+		if _, part, found := bytes.Cut(segment, []byte("\r\n")); found {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// child returns body part n (from 1) of p, or nil if there is none.
+func (p *imapPart) child(n int) *imapPart {
+	switch {
+	case p.message != nil:
+		return p.message.child(n)
+	case len(p.parts) > 0:
+		if n <= len(p.parts) {
+			return p.parts[n-1]
+		}
+	case n == 1:
+		return p
+	}
+	return nil
+}
+
+// section returns the content of a BODY[section], which matches
+// imapSection. Sections of missing parts are empty.
+func (p *imapPart) section(section string) []byte {
+	spec, fields, _ := strings.Cut(section, " ")
+	path := strings.Split(spec, ".")
+
+	part, msg := p, p
+	i := 0
+	for ; i < len(path) && path[i] != "" && path[i][0] >= '0' && path[i][0] <= '9'; i++ {
+		n, _ := strconv.Atoi(path[i])
+		if part = part.child(n); part == nil {
+			return nil
+		}
+		msg = part.message
+	}
+	top, spec := i == 0, strings.Join(path[i:], ".")
+
+	switch spec {
+	case "":
+		if top {
+			return p.raw
+		}
+		return part.body
+	case "MIME":
+		if top {
+			return nil
+		}
+		return part.header
+	}
+
+	if msg == nil { // HEADER and TEXT only apply to messages
+		return nil
+	}
+	switch spec {
+	case "HEADER":
+		return msg.header
+	case "TEXT":
+		return msg.body
+	default: // HEADER.FIELDS and HEADER.FIELDS.NOT
+		names := strings.Fields(strings.Trim(fields, "()"))
+		return headerFields(msg.header, names, strings.HasSuffix(spec, ".NOT"))
+	}
+}
+
+// headerFields returns the header lines of the named fields, or of all
+// other fields if not is set, followed by a blank line.
+func headerFields(header []byte, names []string, not bool) []byte {
+	var result []byte
+	include := false
+	for _, line := range bytes.SplitAfter(header, []byte("\r\n")) {
+		if len(line) == 0 || bytes.Equal(line, []byte("\r\n")) {
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' { // not a continuation line
+			name, _, _ := bytes.Cut(line, []byte(":"))
+			include = slices.ContainsFunc(names, func(n string) bool {
+				return strings.EqualFold(n, string(bytes.TrimSpace(name)))
+			}) != not
+		}
+		if include {
+			result = append(result, line...)
+		}
+	}
+	return append(result, "\r\n"...)
+}
+
+// structure returns the BODYSTRUCTURE of p, without extension data.
+func (p *imapPart) structure() string {
+	var b strings.Builder
+	b.WriteByte('(')
+	if len(p.parts) > 0 {
+		for _, part := range p.parts {
+			b.WriteString(part.structure())
+		}
+		fmt.Fprintf(&b, " %s)", imapQuote(strings.ToUpper(p.subtype)))
+		return b.String()
+	}
+
+	params := "NIL"
+	if len(p.params) > 0 {
+		var values []string
+		for _, key := range slices.Sorted(maps.Keys(p.params)) {
+			values = append(values, imapQuote(strings.ToUpper(key))+" "+imapQuote(p.params[key]))
+		}
+		params = "(" + strings.Join(values, " ") + ")"
+	}
+	fmt.Fprintf(&b, "%s %s %s %s %s %s %d",
+		imapQuote(strings.ToUpper(p.mediaType)), imapQuote(strings.ToUpper(p.subtype)), params,
+		imapNString(p.id), imapNString(p.description), imapQuote(strings.ToUpper(p.encoding)), len(p.body))
+
+	switch {
+	case p.message != nil:
+		fmt.Fprintf(&b, " %s %s %d", imapEnvelope(p.message.header), p.message.structure(), bytes.Count(p.body, []byte("\n")))
+	case p.mediaType == "text":
+		fmt.Fprintf(&b, " %d", bytes.Count(p.body, []byte("\n")))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// imapEnvelope returns the ENVELOPE of a message with the given header.
+func imapEnvelope(header []byte) string {
+	h := parseIMAPHeader(header)
+	from := imapAddresses(h, "From")
+	sender, replyTo := imapAddresses(h, "Sender"), imapAddresses(h, "Reply-To")
+	if sender == "NIL" {
+		sender = from
+	}
+	if replyTo == "NIL" {
+		replyTo = from
+	}
+	return fmt.Sprintf("(%s %s %s %s %s %s %s %s %s %s)",
+		imapNString(h.Get("Date")), imapNString(h.Get("Subject")), from, sender, replyTo,
+		imapAddresses(h, "To"), imapAddresses(h, "Cc"), imapAddresses(h, "Bcc"),
+		imapNString(h.Get("In-Reply-To")), imapNString(h.Get("Message-Id")))
+}
+
+// imapAddresses returns the address list of the named header field.
+func imapAddresses(h mail.Header, name string) string {
+	list, err := h.AddressList(name)
+	if err != nil || len(list) == 0 {
+		return "NIL"
+	}
+
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, a := range list {
+		mailbox, host := a.Address, ""
+		if i := strings.LastIndexByte(a.Address, '@'); i >= 0 {
+			mailbox, host = a.Address[:i], a.Address[i+1:]
+		}
+		fmt.Fprintf(&b, "(%s NIL %s %s)", imapNString(a.Name), imapNString(mailbox), imapNString(host))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
@@ -0,0 +1,216 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapMatcher reports whether the message numbered seq matches a SEARCH
+// key.
+type imapMatcher func(seq int, m *imapMessage) bool
+
+func (c *imapSession) search(tag string, uid bool, args []any) {
+	if len(args) >= 2 && strings.EqualFold(imapText(args[0]), "CHARSET") {
+		if charset := strings.ToUpper(imapText(args[1])); charset != "UTF-8" && charset != "US-ASCII" {
+			c.tagged(tag, "NO [BADCHARSET (UTF-8 US-ASCII)] Unsupported charset")
+			return
+		}
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		c.tagged(tag, "BAD Usage: SEARCH criteria")
+		return
+	}
+	match, err := c.parseSearch(args)
+	if err != nil {
+		c.tagged(tag, "BAD %v", err)
+		return
+	}
+
+	var result strings.Builder
+	for i, m := range c.messages {
+		if match(i+1, m) {
+			n := uint64(i + 1)
+			if uid {
+				n = uint64(m.uid)
+			}
+			result.WriteString(" " + strconv.FormatUint(n, 10))
+		}
+	}
+	c.untagged("SEARCH%s", result.String())
+	c.tagged(tag, "OK SEARCH completed")
+}
+
+// parseSearch returns a matcher for all keys in args.
+func (c *imapSession) parseSearch(args []any) (imapMatcher, error) {
+	var matchers []imapMatcher
+	for len(args) > 0 {
+		match, rest, err := c.parseSearchKey(args)
+		if err != nil {
+			return nil, err
+		}
+		matchers, args = append(matchers, match), rest
+	}
+	return func(seq int, m *imapMessage) bool {
+		for _, match := range matchers {
+			if !match(seq, m) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// parseSearchKey returns a matcher for the first key in args and the
+// remaining arguments. Nothing is flagged in the read-only mailbox, so
+// flag keys match either all or no messages.
+func (c *imapSession) parseSearchKey(args []any) (imapMatcher, []any, error) {
+	if list, ok := args[0].([]any); ok {
+		match, err := c.parseSearch(list)
+		return match, args[1:], err
+	}
+
+	key := strings.ToUpper(imapText(args[0]))
+	args = args[1:]
+	var err error
+	next := func() string {
+		if len(args) == 0 {
+			err = fmt.Errorf("missing argument to %s", key)
+			return ""
+		}
+		arg := imapText(args[0])
+		args = args[1:]
+		return arg
+	}
+	constant := func(result bool) imapMatcher {
+		return func(int, *imapMessage) bool { return result }
+	}
+
+	var match imapMatcher
+	switch key {
+	case "ALL", "OLD", "UNANSWERED", "UNDELETED", "UNDRAFT", "UNFLAGGED", "UNSEEN":
+		match = constant(true)
+	case "ANSWERED", "DELETED", "DRAFT", "FLAGGED", "NEW", "RECENT", "SEEN":
+		match = constant(false)
+	case "KEYWORD", "UNKEYWORD":
+		next()
+		match = constant(key == "UNKEYWORD")
+	case "FROM", "TO", "CC", "BCC", "SUBJECT":
+		value := next()
+		match = func(_ int, m *imapMessage) bool { return headerContains(&m.email, key, value) }
+	case "HEADER":
+		name, value := next(), next()
+		match = func(_ int, m *imapMessage) bool { return headerContains(&m.email, name, value) }
+	case "BODY":
+		value := next()
+		match = func(_ int, m *imapMessage) bool { return bodyContains(m, value) }
+	case "TEXT":
+		value := next()
+		match = func(_ int, m *imapMessage) bool {
+			return containsFold(string(m.mime().header), value) || bodyContains(m, value)
+		}
+	case "LARGER", "SMALLER":
+		var size int
+		if size, err = strconv.Atoi(next()); err != nil {
+			return nil, nil, fmt.Errorf("invalid size for %s", key)
+		}
+		match = func(_ int, m *imapMessage) bool {
+			if key == "LARGER" {
+				return len(m.body) > size
+			}
+			return len(m.body) < size
+		}
+	case "BEFORE", "ON", "SINCE", "SENTBEFORE", "SENTON", "SENTSINCE":
+		date, perr := time.Parse("2-Jan-2006", next())
+		if perr != nil {
+			return nil, nil, fmt.Errorf("invalid date for %s", key)
+		}
+		match = func(_ int, m *imapMessage) bool {
+			t := m.email.Time
+			if strings.HasPrefix(key, "SENT") && !m.email.Date.IsZero() {
+				t = m.email.Date
+			}
+			y, mo, d := t.Date()
+			day := time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+			switch strings.TrimPrefix(key, "SENT") {
+			case "BEFORE":
+				return day.Before(date)
+			case "ON":
+				return day.Equal(date)
+			default:
+				return !day.Before(date)
+			}
+		}
+	case "UID":
+		set, perr := parseIMAPSeqSet(next(), uidNext(c.messages)-1)
+		if perr != nil {
+			return nil, nil, perr
+		}
+		match = func(_ int, m *imapMessage) bool { return set.contains(m.uid) }
+	case "NOT":
+		if len(args) == 0 {
+			return nil, nil, fmt.Errorf("missing argument to NOT")
+		}
+		inner, rest, ierr := c.parseSearchKey(args)
+		if ierr != nil {
+			return nil, nil, ierr
+		}
+		args = rest
+		match = func(seq int, m *imapMessage) bool { return !inner(seq, m) }
+	case "OR":
+		if len(args) < 2 {
+			return nil, nil, fmt.Errorf("missing argument to OR")
+		}
+		left, rest, lerr := c.parseSearchKey(args)
+		if lerr != nil || len(rest) == 0 {
+			return nil, nil, fmt.Errorf("invalid OR")
+		}
+		right, rest, rerr := c.parseSearchKey(rest)
+		if rerr != nil {
+			return nil, nil, rerr
+		}
+		args = rest
+		match = func(seq int, m *imapMessage) bool { return left(seq, m) || right(seq, m) }
+	default:
+		set, perr := parseIMAPSeqSet(key, uint32(len(c.messages)))
+		if perr != nil {
+			return nil, nil, fmt.Errorf("unknown search key %s", key)
+		}
+		match = func(seq int, _ *imapMessage) bool { return set.contains(uint32(seq)) }
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return match, args, nil
+}
+
+// headerContains reports whether a named header field contains value,
+// raw or decoded, ignoring case. An empty value matches any message with
+// the field.
+func headerContains(e *Email, name, value string) bool {
+	values, ok := e.Headers[textproto.CanonicalMIMEHeaderKey(name)]
+	if value == "" {
+		return ok
+	}
+	for _, v := range values {
+		if containsFold(v, value) || containsFold(decodeWord(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyContains reports whether the text of a message contains value,
+// raw or decoded, ignoring case.
+func bodyContains(m *imapMessage, value string) bool {
+	return containsFold(string(m.mime().body), value) ||
+		containsFold(m.email.Text, value) || containsFold(m.email.HTML, value)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
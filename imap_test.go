@@ -0,0 +1,173 @@
+package mailcatcher
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+type imapClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	tags int
+}
+
+func dialIMAP(t *testing.T, server *Server) *imapClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.IMAPAddr())
+	if err != nil {
+		t.Fatalf("Failed to connect to IMAP: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &imapClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	if greeting, _ := c.r.ReadString('\n'); !strings.HasPrefix(greeting, "* OK") {
+		t.Fatalf("Expected greeting, got %q", greeting)
+	}
+	return c
+}
+
+// command sends cmd and returns the response up to the tagged status line,
+// which is returned separately.
+func (c *imapClient) command(cmd string) (response, status string) {
+	c.t.Helper()
+	c.tags++
+	tag := fmt.Sprintf("a%d", c.tags)
+	fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd)
+
+	var b strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("Failed to read reply to %q: %v", cmd, err)
+		}
+		if strings.HasPrefix(line, tag+" ") {
+			return b.String(), strings.TrimSpace(strings.TrimPrefix(line, tag+" "))
+		}
+		b.WriteString(line)
+	}
+}
+
+// ok runs cmd and fails the test unless it succeeds.
+func (c *imapClient) ok(cmd string) string {
+	c.t.Helper()
+	response, status := c.command(cmd)
+	if !strings.HasPrefix(status, "OK") {
+		c.t.Fatalf("Expected OK for %q, got %q", cmd, status)
+	}
+	return response
+}
+
+func TestIMAP(t *testing.T) {
+	server, _ := NewTestServer(t, WithIMAPPort(0))
+	server.Send("sender@example.com", []string{"user@example.com"}, []byte("From: Sender <sender@example.com>\r\nTo: user@example.com\r\nSubject: Welcome\r\n\r\nYour code is 1234\r\n"))
+	server.Send("sender@example.com", []string{"other@example.com"}, []byte("Subject: Other\r\n\r\nBody\r\n"))
+
+	c := dialIMAP(t, server)
+	c.ok(`LOGIN "user@example.com" anything`)
+
+	if response := c.ok(`LIST "" "*"`); !strings.Contains(response, "INBOX") {
+		t.Errorf("Expected INBOX in LIST, got %q", response)
+	}
+	if response := c.ok("SELECT INBOX"); !strings.Contains(response, "* 1 EXISTS") {
+		t.Errorf("Expected 1 message, got %q", response)
+	}
+
+	seq, _ := idSeq(server.Emails()[0].ID)
+	uid := fmt.Sprint(seq + 1)
+	response := c.ok("FETCH 1 (UID ENVELOPE BODY.PEEK[HEADER.FIELDS (SUBJECT)])")
+	if !strings.Contains(response, "UID "+uid) {
+		t.Errorf("Expected UID %s, got %q", uid, response)
+	}
+	if !strings.Contains(response, `"Welcome" (("Sender" NIL "sender" "example.com"))`) {
+		t.Errorf("Expected envelope with subject and sender, got %q", response)
+	}
+	if !strings.Contains(response, "BODY[HEADER.FIELDS (SUBJECT)] {20}\r\nSubject: Welcome\r\n\r\n") {
+		t.Errorf("Expected only the Subject header, got %q", response)
+	}
+
+	response = c.ok("UID FETCH " + uid + " BODY[TEXT]")
+	if !strings.Contains(response, "{19}\r\nYour code is 1234\r\n") {
+		t.Errorf("Expected body text, got %q", response)
+	}
+
+	if response := c.ok(`SEARCH SUBJECT "welcome"`); !strings.Contains(response, "* SEARCH 1\r\n") {
+		t.Errorf("Expected SEARCH to find message 1, got %q", response)
+	}
+	if response := c.ok("UID SEARCH NOT BODY 1234"); !strings.Contains(response, "* SEARCH\r\n") {
+		t.Errorf("Expected no results, got %q", response)
+	}
+
+	if _, status := c.command(`STORE 1 +FLAGS (\Deleted)`); !strings.HasPrefix(status, "NO") {
+		t.Errorf("Expected STORE to fail on the read-only mailbox, got %q", status)
+	}
+
+	server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: Later\r\n\r\nBody\r\n"))
+	if response := c.ok("NOOP"); !strings.Contains(response, "* 2 EXISTS") {
+		t.Errorf("Expected new mail on NOOP, got %q", response)
+	}
+	c.ok("LOGOUT")
+}
+
+func TestIMAPBodyStructure(t *testing.T) {
+	server, _ := NewTestServer(t, WithIMAPPort(0))
+	msg := "Subject: Parts\r\nContent-Type: multipart/alternative; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nPlain\r\n" +
+		"--b\r\nContent-Type: text/html; charset=utf-8\r\n\r\n<p>HTML</p>\r\n" +
+		"--b--\r\n"
+	server.Send("sender@example.com", []string{"user@example.com"}, []byte(msg))
+
+	c := dialIMAP(t, server)
+	c.ok("LOGIN test test")
+	c.ok("EXAMINE INBOX")
+
+	response := c.ok("FETCH 1 BODYSTRUCTURE")
+	want := `BODYSTRUCTURE (("TEXT" "PLAIN" ("CHARSET" "us-ascii") NIL NIL "7BIT" 5 0)("TEXT" "HTML" ("CHARSET" "utf-8") NIL NIL "7BIT" 11 0) "ALTERNATIVE")`
+	if !strings.Contains(response, want) {
+		t.Errorf("Expected %s, got %q", want, response)
+	}
+
+	response = c.ok("FETCH 1 BODY.PEEK[2]")
+	if !strings.Contains(response, "BODY[2] {11}\r\n<p>HTML</p>") {
+		t.Errorf("Expected the HTML part, got %q", response)
+	}
+	response = c.ok("FETCH 1 BODY.PEEK[2.MIME]")
+	if !strings.Contains(response, "Content-Type: text/html; charset=utf-8\r\n\r\n") {
+		t.Errorf("Expected the HTML part header, got %q", response)
+	}
+}
+
+func TestIMAPAuth(t *testing.T) {
+	server, _ := NewTestServer(t, WithIMAPPort(0), WithAuth("app", "secret"))
+
+	c := dialIMAP(t, server)
+	if _, status := c.command("SELECT INBOX"); !strings.HasPrefix(status, "BAD") {
+		t.Errorf("Expected BAD before login, got %q", status)
+	}
+	if _, status := c.command("LOGIN app wrong"); !strings.HasPrefix(status, "NO") {
+		t.Errorf("Expected NO for a wrong password, got %q", status)
+	}
+	c.ok("AUTHENTICATE PLAIN AGFwcABzZWNyZXQ=") // "\x00app\x00secret"
+}
+
+func TestParseIMAPArgs(t *testing.T) {
+	args, err := parseIMAPArgs([]byte("a1 FETCH 1:* (FLAGS BODY.PEEK[HEADER.FIELDS (FROM TO)]<0.10>) \"quoted \\\"x\\\"\" {3}\r\nabc"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(args) != 6 {
+		t.Fatalf("Expected 6 arguments, got %d: %q", len(args), args)
+	}
+	list, ok := args[3].([]any)
+	if !ok || len(list) != 2 || list[1] != imapAtom("BODY.PEEK[HEADER.FIELDS (FROM TO)]<0.10>") {
+		t.Errorf("Expected fetch item list, got %q", args[3])
+	}
+	if args[4] != `quoted "x"` {
+		t.Errorf("Expected quoted string, got %q", args[4])
+	}
+	if args[5] != "abc" {
+		t.Errorf("Expected literal, got %q", args[5])
+	}
+}
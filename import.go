@@ -0,0 +1,113 @@
+package mailcatcher
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// errInvalidMbox is returned for input that is not an mbox file.
+var errInvalidMbox = errors.Base("invalid mbox")
+
+// Inject stores a raw RFC 5322 message without going through SMTP, e.g.
+// to seed the store with fixtures for tests of a mail viewer. Unlike Send,
+// no SMTP rules such as rejections or quotas apply. The envelope is taken
+// from the From, To, Cc and Bcc headers.
+func (s *Server) Inject(raw []byte) (Email, error) {
+	return s.inject("", nil, raw, 0)
+}
+
+// InjectMbox stores every message of an mbox file, in the mboxrd format of
+// ExportMbox, like Inject. The sender of each "From " line is its envelope
+// sender. It returns the stored emails.
+func (s *Server) InjectMbox(r io.Reader) ([]Email, error) {
+	messages, err := readMbox(r)
+	if err != nil {
+		return nil, err
+	}
+	emails := make([]Email, 0, len(messages))
+	for _, m := range messages {
+		email, err := s.inject(m.from, nil, m.raw, 0)
+		if err != nil {
+			return emails, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// inject stores raw with the given envelope, forwarded hops times. Missing
+// envelope addresses are taken from the headers.
+func (s *Server) inject(from string, to []string, raw []byte, hops int) (Email, error) {
+	email := newEmail(from, to, raw)
+	email.hops = hops
+	if from == "" {
+		email.Envelope.From = email.From.Address
+	}
+	if len(to) == 0 {
+		for _, addr := range slices.Concat(email.To, email.Cc, email.Bcc) {
+			email.Envelope.To = append(email.Envelope.To, addr.Address)
+		}
+	}
+	if err := s.checkAttachments(&email); err != nil {
+		return Email{}, err
+	}
+	return s.addMessage(email)
+}
+
+// mboxMessage is a message read from an mbox file.
+type mboxMessage struct {
+	from string // sender of the "From " line
+	raw  []byte // with CRLF line endings
+}
+
+// readMbox splits an mbox file into its messages, unquoting ">From "
+// lines as written by ExportMbox.
+func readMbox(r io.Reader) ([]mboxMessage, error) {
+	var (
+		messages []mboxMessage
+		current  *mboxMessage
+	)
+	finish := func() {
+		if current != nil {
+			// The blank line before the next "From " line is a separator
+			current.raw = bytes.TrimSuffix(current.raw, []byte("\r\n"))
+			messages = append(messages, *current)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, defaultMaxLineLength)
+	for scanner.Scan() {
+		line := bytes.TrimSuffix(scanner.Bytes(), []byte("\r"))
+		if sender, ok := bytes.CutPrefix(line, []byte("From ")); ok {
+			finish()
+			from, _, _ := bytes.Cut(sender, []byte(" "))
+			current = &mboxMessage{from: string(from)}
+			if current.from == "MAILER-DAEMON" {
+				current.from = ""
+			}
+			continue
+		}
+		if current == nil {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("%w: expected a \"From \" line, got %q", errInvalidMbox, line)
+		}
+		if mboxFromLine.Match(line) {
+			line = line[1:]
+		}
+		current.raw = append(current.raw, line...)
+		current.raw = append(current.raw, '\r', '\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mbox: %w", err)
+	}
+	finish()
+	return messages, nil
+}
@@ -0,0 +1,91 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInject(t *testing.T) {
+	server := New(0, 0)
+	email, err := server.Inject([]byte("From: App <app@example.com>\r\nTo: user@example.com\r\nCc: boss@example.com\r\nSubject: Fixture\r\n\r\nBody\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to inject email: %v", err)
+	}
+
+	if email.Envelope.From != "app@example.com" {
+		t.Errorf("Expected envelope sender app@example.com, got %q", email.Envelope.From)
+	}
+	if !slices.Equal(email.Envelope.To, []string{"user@example.com", "boss@example.com"}) {
+		t.Errorf("Expected the recipients of the headers, got %v", email.Envelope.To)
+	}
+	if stored := server.Emails(); len(stored) != 1 || stored[0].Subject != "Fixture" {
+		t.Errorf("Expected the stored fixture, got %+v", stored)
+	}
+}
+
+func TestInjectMbox(t *testing.T) {
+	source := New(0, 0)
+	source.Send("bounce@example.com", []string{"user@example.com"}, []byte("Subject: One\r\n\r\nFrom the start\r\n>From quoted\r\n"))
+	source.Send("", []string{"user@example.com"}, []byte("Subject: Two\r\n\r\nBody\r\n"))
+	var buf bytes.Buffer
+	if err := source.ExportMbox(&buf); err != nil {
+		t.Fatalf("Failed to export mbox: %v", err)
+	}
+
+	server := New(0, 0)
+	emails, err := server.InjectMbox(&buf)
+	if err != nil {
+		t.Fatalf("Failed to inject mbox: %v", err)
+	}
+	if len(emails) != 2 {
+		t.Fatalf("Expected 2 emails, got %d", len(emails))
+	}
+	original := source.Emails()
+	for i, email := range emails {
+		if email.Body != original[i].Body {
+			t.Errorf("Expected body %q, got %q", original[i].Body, email.Body)
+		}
+		if email.Envelope.From != original[i].Envelope.From {
+			t.Errorf("Expected envelope sender %q, got %q", original[i].Envelope.From, email.Envelope.From)
+		}
+	}
+
+	if _, err := server.InjectMbox(strings.NewReader("Subject: Not an mbox\r\n")); err == nil {
+		t.Error("Expected an error for input without a From line")
+	}
+}
+
+func TestInjectMboxEndpoint(t *testing.T) {
+	server := New(0, 0)
+	ts := httptest.NewServer(server.HTTPServer().Handler)
+	defer ts.Close()
+
+	mbox := "From app@example.com Thu Jan  1 00:00:00 2026\nTo: user@example.com\nSubject: One\n\nBody\n\nFrom app@example.com Thu Jan  1 00:00:00 2026\nTo: user@example.com\nSubject: Two\n\nBody\n\n"
+	resp, err := http.Post(ts.URL+"/api/v1/emails", "application/mbox", strings.NewReader(mbox))
+	if err != nil {
+		t.Fatalf("Failed to upload mbox: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Count int     `json:"count"`
+		Items []Email `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.Count != 2 || len(result.Items) != 2 || result.Items[1].Subject != "Two" {
+		t.Errorf("Expected 2 stored emails, got %+v", result)
+	}
+	if got := server.Emails()[0].Body; got != "To: user@example.com\r\nSubject: One\r\n\r\nBody\r\n" {
+		t.Errorf("Expected the message with CRLF line endings, got %q", got)
+	}
+}
@@ -0,0 +1,105 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Latency slows the SMTP server down, to test client timeouts and
+// context cancellation against a slow mail server.
+type Latency struct {
+	// Reply delays every reply, including the greeting. Pipelined
+	// commands are delayed once per batch.
+	Reply time.Duration `json:"reply,omitempty"`
+
+	// Data delays accepting a message once its content has been
+	// received, on top of Reply.
+	Data time.Duration `json:"data,omitempty"`
+
+	// Jitter adds a random delay of up to Jitter to each delay.
+	Jitter time.Duration `json:"jitter,omitempty"`
+}
+
+// SetLatency sets the delays of SMTP replies.
+func (s *Server) SetLatency(l Latency) error {
+	if err := l.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = l
+	return nil
+}
+
+// Latency returns the delays of SMTP replies.
+func (s *Server) Latency() Latency {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.latency
+}
+
+func (l Latency) validate() error {
+	if l.Reply < 0 || l.Data < 0 || l.Jitter < 0 {
+		return fmt.Errorf("invalid latency %+v: delays must not be negative", l)
+	}
+	return nil
+}
+
+// delay sleeps for d plus the configured jitter, if d is set.
+func (s *Server) delay(d func(Latency) time.Duration) {
+	s.mu.RLock()
+	l := s.latency
+	s.mu.RUnlock()
+
+	wait := d(l)
+	if wait <= 0 {
+		return
+	}
+	if l.Jitter > 0 {
+		wait += rand.N(l.Jitter)
+	}
+	time.Sleep(wait)
+}
+
+// slowListener wraps accepted connections in a slowConn.
+type slowListener struct {
+	net.Listener
+	server *Server
+}
+
+func (l *slowListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	conn := &slowConn{Conn: c, server: l.server}
+	conn.replyDue.Store(true) // the greeting
+	return conn, nil
+}
+
+// slowConn delays the first write after the client has sent something,
+// which is the start of the server's reply.
+type slowConn struct {
+	net.Conn
+	server   *Server
+	replyDue atomic.Bool
+}
+
+func (c *slowConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.replyDue.Store(true)
+	}
+	return n, err
+}
+
+func (c *slowConn) Write(b []byte) (int, error) {
+	if c.replyDue.Swap(false) {
+		c.server.delay(func(l Latency) time.Duration { return l.Reply })
+	}
+	return c.Conn.Write(b)
+}
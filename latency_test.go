@@ -0,0 +1,78 @@
+package mailcatcher
+
+import (
+	"net"
+	"net/smtp"
+	"testing"
+	"time"
+)
+
+func TestLatency(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetLatency(Latency{Reply: 50 * time.Millisecond, Data: 200 * time.Millisecond}); err != nil {
+		t.Fatalf("Failed to set latency: %v", err)
+	}
+
+	start := time.Now()
+	client, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected delayed greeting, got it after %v", elapsed)
+	}
+
+	start = time.Now()
+	if err := client.Noop(); err != nil {
+		t.Fatalf("NOOP failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("Expected NOOP reply after about 50ms, got %v", elapsed)
+	}
+
+	if err := client.Mail("sender@example.com"); err != nil {
+		t.Fatalf("MAIL failed: %v", err)
+	}
+	if err := client.Rcpt("user@example.com"); err != nil {
+		t.Fatalf("RCPT failed: %v", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+	w.Write([]byte("Subject: Slow\r\n\r\nBody\r\n"))
+	start = time.Now()
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("Expected DATA accepted after at least 250ms, got %v", elapsed)
+	}
+}
+
+func TestLatencyTimeout(t *testing.T) {
+	server, addr := NewTestServer(t)
+	server.SetLatency(Latency{Reply: time.Second})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// A client with a short deadline gives up before the greeting
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Fatal("Expected read to time out")
+	} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+}
+
+func TestSetLatencyInvalid(t *testing.T) {
+	server := New(0, 0)
+	if err := server.SetLatency(Latency{Jitter: -time.Second}); err == nil {
+		t.Error("Expected error for negative jitter")
+	}
+}
@@ -0,0 +1,85 @@
+package mailcatcher
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Replies refusing mail at the server limits, so tests can compare the
+// errors their mail client returns by code. Behavior profiles may phrase
+// the replies of their provider instead.
+var (
+	// ErrTooManyRecipients refuses a RCPT TO over SetMaxRecipients with
+	// 452 4.5.3. The message states the limit.
+	ErrTooManyRecipients = &smtp.SMTPError{
+		Code:         452,
+		EnhancedCode: smtp.EnhancedCode{4, 5, 3},
+		Message:      "Too many recipients",
+	}
+
+	// ErrTooManyMessages answers the MAIL FROM of a connection over the
+	// MaxMessagesPerConnection of SetRateLimit with 421 4.7.0 and closes
+	// the connection.
+	ErrTooManyMessages = &smtp.SMTPError{
+		Code:         421,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 0},
+		Message:      "Too many messages on this connection, closing",
+	}
+
+	// ErrMessageTooLarge refuses DATA over SetMaxMessageBytes with
+	// 552 5.3.4.
+	ErrMessageTooLarge = smtp.ErrDataTooLarge
+
+	// ErrReadTimeout closes a connection idle for longer than
+	// SetReadTimeout with 421 4.4.2.
+	ErrReadTimeout = &smtp.SMTPError{
+		Code:         421,
+		EnhancedCode: smtp.EnhancedCode{4, 4, 2},
+		Message:      "Idle timeout, bye bye", // as sent by go-smtp
+	}
+)
+
+// limitState holds the counts of refusals at the limits reported by
+// Stats.
+type limitState struct {
+	recipients atomic.Int64
+	messages   atomic.Int64
+	oversized  atomic.Int64
+	timeouts   atomic.Int64
+}
+
+// SetReadTimeout closes connections with ErrReadTimeout when a client
+// sends nothing for d, such as one that forgets to QUIT or stalls during
+// DATA. Zero means no timeout. It must be called before Start.
+func (s *Server) SetReadTimeout(d time.Duration) {
+	s.smtpServer.ReadTimeout = d
+}
+
+// SetMaxRecipients refuses recipients past the first n of a message with
+// ErrTooManyRecipients, or the TooManyRecipients reply of SetRejections.
+// Zero means no limit.
+func (s *Server) SetMaxRecipients(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxRecipients = n
+}
+
+// timeoutConn counts the read timeouts of its connection.
+type timeoutConn struct {
+	net.Conn
+	server *Server
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		c.server.infof("Closing connection from %s: read timeout", c.RemoteAddr())
+		c.server.limits.timeouts.Add(1)
+	}
+	return n, err
+}
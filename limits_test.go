@@ -0,0 +1,88 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMaxRecipients(t *testing.T) {
+	server, addr := NewTestServer(t, WithMaxRecipients(2))
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+
+	smtpCommand(t, conn, "EHLO client.example.com")
+	smtpCommand(t, conn, "MAIL FROM:<app@example.com>")
+	for i, want := range []int{250, 250, ErrTooManyRecipients.Code} {
+		if code := smtpCommand(t, conn, "RCPT TO:<user-%d@example.com>", i); code != want {
+			t.Errorf("Expected %d for recipient %d, got %d", want, i, code)
+		}
+	}
+
+	if n := server.Stats().RejectedRecipients; n != 1 {
+		t.Errorf("Expected 1 rejected recipient, got %d", n)
+	}
+}
+
+func TestMaxMessagesPerConnectionStats(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetRateLimit(RateLimit{MaxMessagesPerConnection: 1}); err != nil {
+		t.Fatalf("Failed to set rate limit: %v", err)
+	}
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+
+	smtpCommand(t, conn, "EHLO client.example.com")
+	for _, cmd := range []string{"MAIL FROM:<app@example.com>", "RCPT TO:<user@example.com>", "DATA", "Subject: One\r\n\r\nBody\r\n."} {
+		smtpCommand(t, conn, "%s", cmd)
+	}
+	if code := smtpCommand(t, conn, "MAIL FROM:<app@example.com>"); code != ErrTooManyMessages.Code {
+		t.Errorf("Expected %d, got %d", ErrTooManyMessages.Code, code)
+	}
+
+	if n := server.Stats().RejectedMessages; n != 1 {
+		t.Errorf("Expected 1 rejected connection, got %d", n)
+	}
+}
+
+func TestMaxMessageBytesStats(t *testing.T) {
+	server, addr := NewTestServer(t, WithMaxMessageBytes(64))
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+
+	smtpCommand(t, conn, "EHLO client.example.com")
+	smtpCommand(t, conn, "MAIL FROM:<app@example.com>")
+	smtpCommand(t, conn, "RCPT TO:<user@example.com>")
+	smtpCommand(t, conn, "DATA")
+	if code := smtpCommand(t, conn, "Subject: Large\r\n\r\n%0100d\r\n.", 0); code != ErrMessageTooLarge.Code {
+		t.Errorf("Expected %d, got %d", ErrMessageTooLarge.Code, code)
+	}
+
+	if n := server.Stats().RejectedOversized; n != 1 {
+		t.Errorf("Expected 1 rejected message, got %d", n)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	server, addr := NewTestServer(t, WithReadTimeout(100*time.Millisecond))
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+
+	// The client stalls after EHLO
+	smtpCommand(t, conn, "EHLO client.example.com")
+	code, message, err := conn.ReadResponse(0)
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	want := ErrReadTimeout
+	if code != want.Code || message != fmt.Sprintf("%d.%d.%d %s", want.EnhancedCode[0], want.EnhancedCode[1], want.EnhancedCode[2], want.Message) {
+		t.Errorf("Expected %q, got %d %s", formatReply(want), code, message)
+	}
+	if _, err := conn.ReadLine(); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+
+	if n := server.Stats().ReadTimeouts; n != 1 {
+		t.Errorf("Expected 1 read timeout, got %d", n)
+	}
+}
@@ -0,0 +1,109 @@
+package mailcatcher
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// urlPattern matches URLs in plain text. Trailing punctuation is
+	// trimmed separately.
+	urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+	// codePatterns are tried in order by ExtractCode: a code next to a
+	// keyword, then a lone six-digit number.
+	codePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b(?:code|otp|pin|passcode|one-time password|verification)\b\D{0,30}?\b(\d{4,8})\b`),
+		regexp.MustCompile(`\b(\d{4,8})\b[^\n\d]{0,30}?(?i:\bis your\b|\bcode\b)`),
+		regexp.MustCompile(`\b(\d{6})\b`),
+	}
+)
+
+// Links returns the URLs in the email, in order and without duplicates:
+// the links of the HTML body, then the URLs in the text body. Confirmation
+// and password reset links can be taken from it without matching the raw
+// message.
+func (e *Email) Links() []string {
+	var links []string
+	add := func(link string) {
+		if link != "" && !slices.Contains(links, link) {
+			links = append(links, link)
+		}
+	}
+
+	tokens := html.NewTokenizer(strings.NewReader(e.HTML))
+	for tt := tokens.Next(); tt != html.ErrorToken; tt = tokens.Next() {
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		token := tokens.Token()
+		if token.Data != "a" && token.Data != "area" {
+			continue
+		}
+		for _, attr := range token.Attr {
+			if attr.Key == "href" && urlPattern.MatchString(attr.Val) {
+				add(strings.TrimSpace(attr.Val))
+			}
+		}
+	}
+
+	for _, link := range urlPattern.FindAllString(e.Text, -1) {
+		add(strings.TrimRight(link, ".,;:!?)]}'"))
+	}
+	return links
+}
+
+// ExtractCode returns a one-time code from the subject and body of the
+// email. With a nil re it looks for four to eight digits next to words
+// such as "code" or "PIN", falling back to a lone six-digit number.
+// Otherwise it returns the first match of re, or of its first
+// subexpression if it has one.
+func (e *Email) ExtractCode(re *regexp.Regexp) (string, bool) {
+	text := e.Subject + "\n" + e.Text
+	if e.Text == "" {
+		text += htmlText(e.HTML)
+	}
+
+	patterns := codePatterns
+	if re != nil {
+		patterns = []*regexp.Regexp{re}
+	}
+	for _, p := range patterns {
+		match := p.FindStringSubmatch(text)
+		switch {
+		case match == nil:
+			continue
+		case len(match) > 1:
+			return match[1], true
+		default:
+			return match[0], true
+		}
+	}
+	return "", false
+}
+
+// htmlText returns the text content of an HTML document, without scripts
+// and styles.
+func htmlText(s string) string {
+	var b strings.Builder
+	skip := false
+	tokens := html.NewTokenizer(strings.NewReader(s))
+	for tt := tokens.Next(); tt != html.ErrorToken; tt = tokens.Next() {
+		switch tt {
+		case html.StartTagToken:
+			name, _ := tokens.TagName()
+			skip = string(name) == "script" || string(name) == "style"
+		case html.EndTagToken:
+			skip = false
+			b.WriteByte(' ')
+		case html.TextToken:
+			if !skip {
+				b.Write(tokens.Text())
+			}
+		}
+	}
+	return b.String()
+}
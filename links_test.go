@@ -0,0 +1,49 @@
+package mailcatcher
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestLinks(t *testing.T) {
+	email := Email{
+		HTML: `<p><a href="https://app.example.com/confirm?token=abc&amp;u=1">Confirm</a>
+<a href="mailto:help@example.com">Help</a> <a href="https://app.example.com/confirm?token=abc&u=1">Again</a></p>`,
+		Text: "Confirm at https://app.example.com/confirm?token=abc&u=1.\nOr visit (https://example.com/help).",
+	}
+
+	want := []string{"https://app.example.com/confirm?token=abc&u=1", "https://example.com/help"}
+	if links := email.Links(); !slices.Equal(links, want) {
+		t.Errorf("Expected %q, got %q", want, links)
+	}
+}
+
+func TestExtractCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		email Email
+		re    *regexp.Regexp
+		want  string
+	}{
+		{"keyword", Email{Text: "Hello,\nYour verification code is: 482913\nThanks"}, nil, "482913"},
+		{"code before keyword", Email{Text: "Use 4821 as your verification code."}, nil, "4821"},
+		{"subject", Email{Subject: "739201 is your login code", Text: "Welcome back"}, nil, "739201"},
+		{"html only", Email{HTML: "<p>Your PIN:</p><p><b>5512</b></p>"}, nil, "5512"},
+		{"lone six digits", Email{Text: "Enter 118822 to continue"}, nil, "118822"},
+		{"custom pattern", Email{Text: "Token: AB-12-CD"}, regexp.MustCompile(`Token: ([A-Z0-9-]+)`), "AB-12-CD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, ok := tt.email.ExtractCode(tt.re)
+			if !ok || code != tt.want {
+				t.Errorf("Expected code %q, got %q (found %v)", tt.want, code, ok)
+			}
+		})
+	}
+
+	email := Email{Text: "Order 12 shipped"}
+	if code, ok := email.ExtractCode(nil); ok {
+		t.Errorf("Expected no code, got %q", code)
+	}
+}
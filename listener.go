@@ -0,0 +1,184 @@
+package mailcatcher
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/emersion/go-smtp"
+	"gitlab.com/tozd/go/errors"
+)
+
+// DefaultListener is the Email.Listener of mail received on the main SMTP
+// port.
+const DefaultListener = "smtp"
+
+var errTLSRequired = &smtp.SMTPError{
+	Code:         530,
+	EnhancedCode: smtp.EnhancedCode{5, 7, 0},
+	Message:      "Must issue a STARTTLS command first",
+}
+
+// Listener configures an additional SMTP port, such as implicit TLS on 465
+// next to submission on 587, so tests can check which port and security
+// mode an application picks. Mail is captured into the same store and
+// tagged with the listener name.
+type Listener struct {
+	// Name is recorded in Email.Listener, e.g. "submission". It must be
+	// unique.
+	Name string
+	// Port is the port to listen on. Zero picks a free port.
+	Port int
+
+	// TLS enables STARTTLS, or is used for the handshake with
+	// ImplicitTLS. The TLS configuration of the main SMTP server is used
+	// if nil.
+	TLS *tls.Config
+	// ImplicitTLS makes clients start with a TLS handshake (SMTPS).
+	ImplicitTLS bool
+	// RequireTLS rejects MAIL FROM on connections that have not switched
+	// to TLS with STARTTLS.
+	RequireTLS bool
+	// RequireAuth rejects MAIL FROM until the client authenticates. Any
+	// credentials are accepted unless SetAuth is used.
+	RequireAuth bool
+}
+
+// smtpListener is an additional SMTP port added by AddListener.
+type smtpListener struct {
+	config   Listener
+	addr     string // the bound address once started
+	server   *smtp.Server
+	listener net.Listener
+}
+
+// AddListener adds an SMTP port with its own security settings. The other
+// settings, such as the domain and message size limit, follow the main
+// SMTP server. It must be called before Start.
+func (s *Server) AddListener(l Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, &smtpListener{config: l, addr: net.JoinHostPort(s.host, strconv.Itoa(l.Port))})
+}
+
+// ListenerAddr returns the address of the named listener, like SMTPAddr,
+// or "" if there is no such listener. DefaultListener is the main SMTP
+// server.
+func (s *Server) ListenerAddr(name string) string {
+	if name == DefaultListener {
+		return s.SMTPAddr()
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, l := range s.listeners {
+		if l.config.Name == name {
+			return dialAddr(l.addr)
+		}
+	}
+	return ""
+}
+
+// start listens on the configured address, with an SMTP server configured
+// like main.
+func (l *smtpListener) start(ctx context.Context, lc *net.ListenConfig, s *Server) error {
+	main := s.smtpServer
+	server := smtp.NewServer(&backend{server: s, listener: &l.config})
+	server.Domain = main.Domain
+	server.AllowInsecureAuth = main.AllowInsecureAuth
+	server.EnableSMTPUTF8 = main.EnableSMTPUTF8
+	server.EnableREQUIRETLS = main.EnableREQUIRETLS
+	server.EnableBINARYMIME = main.EnableBINARYMIME
+	server.EnableDSN = main.EnableDSN
+	server.MaxLineLength = main.MaxLineLength
+	server.MaxMessageBytes = main.MaxMessageBytes
+	server.MaxRecipients = main.MaxRecipients
+	server.ReadTimeout = main.ReadTimeout
+	server.WriteTimeout = main.WriteTimeout
+	server.ErrorLog = main.ErrorLog
+	server.LMTP = main.LMTP
+	server.TLSConfig = l.config.TLS
+	if server.TLSConfig == nil {
+		server.TLSConfig = main.TLSConfig
+	}
+	if l.config.ImplicitTLS && server.TLSConfig == nil {
+		return fmt.Errorf("failed to start SMTP listener %s: implicit TLS needs a TLS configuration", l.config.Name)
+	}
+
+	listener, err := lc.Listen(ctx, "tcp", l.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start SMTP listener %s: %w", l.config.Name, err)
+	}
+	l.addr = listener.Addr().String()
+	server.Addr = l.addr
+	l.server = server
+	l.listener = listener
+
+	// The PROXY header precedes the TLS handshake
+	listener = newProxyListener(listener, s)
+	if l.config.ImplicitTLS {
+		// The transcript wraps the TLS connection so it sees the commands
+		// in the clear; STARTTLS is no longer offered
+		listener = tls.NewListener(listener, server.TLSConfig)
+		server.TLSConfig = nil
+		server.AllowInsecureAuth = true
+	}
+	wrapped := &transcriptListener{Listener: &slowListener{Listener: &limitListener{Listener: listener, server: s}, server: s}, hidden: s.Extensions().hidden()}
+	if s.recordDir != "" {
+		wrapped.record = s.saveRecording
+	}
+
+	go func() {
+		if err := server.Serve(wrapped); err != nil && !errors.Is(err, smtp.ErrServerClosed) && !s.stopping.Load() {
+			s.fail(fmt.Errorf("SMTP listener %s failed: %w", l.config.Name, err))
+		}
+	}()
+	return nil
+}
+
+// close stops the listener, if started. The listener is closed directly
+// as well: smtp.Server.Close misses it if Serve has not run yet.
+func (l *smtpListener) close() error {
+	if l.server == nil {
+		return nil
+	}
+	if err := l.server.Close(); err != nil && !errors.Is(err, smtp.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	_ = l.listener.Close()
+	return nil
+}
+
+// listenerName returns the Email.Listener of mail received in the session.
+func (s *session) listenerName() string {
+	if s.listener == nil {
+		return DefaultListener
+	}
+	return s.listener.Name
+}
+
+// checkListener applies the TLS and authentication requirements of the
+// listener before MAIL FROM is accepted.
+func (s *session) checkListener() error {
+	l := s.listener
+	if l == nil {
+		return nil
+	}
+	if l.RequireTLS && !l.ImplicitTLS {
+		if _, ok := s.smtpConn.TLSConnectionState(); !ok {
+			return errTLSRequired
+		}
+	}
+	if l.RequireAuth && s.auth == nil {
+		return errAuthRequired
+	}
+	return nil
+}
+
+// closeListeners closes the started additional listeners.
+func (s *Server) closeListeners() {
+	for _, l := range s.listeners {
+		_ = l.close()
+	}
+}
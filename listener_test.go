@@ -0,0 +1,147 @@
+package mailcatcher
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+// testTLS returns server and client configurations sharing a self-signed
+// certificate for 127.0.0.1.
+func testTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+}
+
+// sendOn sends a message over an established client connection.
+func sendOn(c *smtp.Client, auth smtp.Auth) error {
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail("app@example.com"); err != nil {
+		return err
+	}
+	if err := c.Rcpt("user@example.com"); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("Subject: Hello\r\n\r\nBody\r\n")); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func TestListeners(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	server, addr := NewTestServer(t,
+		WithListener(Listener{Name: "smtps", ImplicitTLS: true, TLS: serverTLS}),
+		WithListener(Listener{Name: "submission", TLS: serverTLS, RequireTLS: true, RequireAuth: true}),
+	)
+	auth := smtp.PlainAuth("", "app", "secret", "127.0.0.1")
+
+	if err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, []byte("Subject: Hello\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send on the main listener: %v", err)
+	}
+
+	conn, err := tls.Dial("tcp", server.ListenerAddr("smtps"), clientTLS)
+	if err != nil {
+		t.Fatalf("Failed to connect with TLS: %v", err)
+	}
+	c, err := smtp.NewClient(conn, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Failed to greet: %v", err)
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		t.Error("Expected no STARTTLS on implicit TLS")
+	}
+	if err := sendOn(c, nil); err != nil {
+		t.Fatalf("Failed to send with implicit TLS: %v", err)
+	}
+
+	// Submission needs STARTTLS, then AUTH
+	var tpErr *textproto.Error
+	c, err = smtp.Dial(server.ListenerAddr("submission"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if err := sendOn(c, nil); !errors.As(err, &tpErr) || tpErr.Code != 530 {
+		t.Errorf("Expected 530 without STARTTLS, got %v", err)
+	}
+	c, _ = smtp.Dial(server.ListenerAddr("submission"))
+	if err := c.StartTLS(clientTLS); err != nil {
+		t.Fatalf("Failed to STARTTLS: %v", err)
+	}
+	if err := sendOn(c, nil); !errors.As(err, &tpErr) || tpErr.Code != 530 {
+		t.Errorf("Expected 530 without AUTH, got %v", err)
+	}
+	c, _ = smtp.Dial(server.ListenerAddr("submission"))
+	if err := c.StartTLS(clientTLS); err != nil {
+		t.Fatalf("Failed to STARTTLS: %v", err)
+	}
+	if err := sendOn(c, auth); err != nil {
+		t.Fatalf("Failed to send on submission: %v", err)
+	}
+
+	emails := server.Emails()
+	if len(emails) != 3 {
+		t.Fatalf("Expected 3 emails, got %d", len(emails))
+	}
+	for i, want := range []string{DefaultListener, "smtps", "submission"} {
+		if emails[i].Listener != want {
+			t.Errorf("Expected email %d on %s, got %q", i, want, emails[i].Listener)
+		}
+	}
+	if len(emails[1].Transcript) == 0 || emails[1].Transcript[0].Verb != "EHLO" {
+		t.Errorf("Expected a clear-text transcript with implicit TLS, got %+v", emails[1].Transcript)
+	}
+	if server.ListenerAddr("unknown") != "" {
+		t.Error("Expected no address for an unknown listener")
+	}
+}
+
+func TestListenerNeedsTLSConfig(t *testing.T) {
+	server := NewWithOptions(WithHost("127.0.0.1"), WithSMTPPort(0), WithHTTPPort(0),
+		WithListener(Listener{Name: "smtps", ImplicitTLS: true}))
+	if err := server.Start(); err == nil {
+		t.Fatal("Expected implicit TLS without a configuration to fail")
+	}
+}
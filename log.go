@@ -0,0 +1,163 @@
+package mailcatcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SetLogHandler sends the server's logs to h: failures at error level,
+// dropped events and alerts at warn, captured messages and rejections at
+// info, and SMTP sessions, HTTP requests and store events at debug. It
+// replaces a Logger set with SetLogger. By default nothing is logged.
+func (s *Server) SetLogHandler(h slog.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log = slog.New(h)
+}
+
+// NewLoggerHandler returns a slog.Handler writing records at level and
+// above to logger, one Printf call per record: the message followed by the
+// attributes as key=value pairs. Warnings are prefixed with "Warning: ".
+func NewLoggerHandler(logger Logger, level slog.Leveler) slog.Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &loggerHandler{logger: logger, level: level}
+}
+
+// loggerHandler adapts a Printf Logger to slog.
+type loggerHandler struct {
+	logger Logger
+	level  slog.Leveler
+	attrs  string // preformatted attributes from WithAttrs
+	group  string // key prefix from WithGroup
+}
+
+// Enabled implements slog.Handler.
+func (h *loggerHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle implements slog.Handler.
+func (h *loggerHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if r.Level == slog.LevelWarn {
+		b.WriteString("Warning: ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.group, a)
+		return true
+	})
+	h.logger.Printf("%s", b.String())
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *loggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		writeAttr(&b, h.group, a)
+	}
+	clone := *h
+	clone.attrs += b.String()
+	return &clone
+}
+
+// WithGroup implements slog.Handler.
+func (h *loggerHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.group += name + "."
+	return &clone
+}
+
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, prefix+a.Key+".", ga)
+		}
+		return
+	}
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\"=") {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, value)
+}
+
+// logger returns the structured logger, which discards everything if none
+// is set.
+func (s *Server) logger() *slog.Logger {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.log == nil {
+		return discardLogger
+	}
+	return s.log
+}
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// errorf logs a failure.
+func (s *Server) errorf(format string, v ...any) {
+	s.logger().Error(fmt.Sprintf(format, v...))
+}
+
+// warnf logs a condition that needs attention.
+func (s *Server) warnf(format string, v ...any) {
+	s.logger().Warn(fmt.Sprintf(format, v...))
+}
+
+// infof logs a notable event.
+func (s *Server) infof(format string, v ...any) {
+	s.logger().Info(fmt.Sprintf(format, v...))
+}
+
+// logRequests logs every HTTP request at debug level.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := s.logger()
+		if !log.Enabled(r.Context(), slog.LevelDebug) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		log.Debug("HTTP request", "method", r.Method, "path", r.URL.Path, "status", rec.status,
+			"duration", time.Since(start), "remote", r.RemoteAddr)
+	})
+}
+
+// statusRecorder captures the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps the event stream working through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap supports http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,117 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// bufferLogger collects Printf output.
+type bufferLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *bufferLogger) Printf(format string, v ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *bufferLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.lines, "\n")
+}
+
+func TestLoggerHandler(t *testing.T) {
+	logger := &bufferLogger{}
+	log := slog.New(NewLoggerHandler(logger, slog.LevelInfo))
+
+	log.Debug("Hidden")
+	log.Info("Captured message", "id", "msg-0", "subject", "Hello world")
+	log.Warn("dropped event")
+	log.With("remote", "127.0.0.1:1234").WithGroup("smtp").Error("Failed", "code", 451)
+
+	expected := []string{
+		`Captured message id=msg-0 subject="Hello world"`,
+		`Warning: dropped event`,
+		`Failed remote=127.0.0.1:1234 smtp.code=451`,
+	}
+	if got := logger.String(); got != strings.Join(expected, "\n") {
+		t.Errorf("Expected %q, got %q", strings.Join(expected, "\n"), got)
+	}
+}
+
+func TestSetLoggerKeepsInfoLevel(t *testing.T) {
+	logger := &bufferLogger{}
+	server := New(0, 0)
+	server.SetLogger(logger)
+
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Hi\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if got := logger.String(); !strings.Contains(got, "Captured message id=msg-0 from=app@example.com") {
+		t.Errorf("Expected the captured message to be logged, got %q", got)
+	}
+	if got := logger.String(); strings.Contains(got, "Store event") {
+		t.Errorf("Expected no debug logs at info level, got %q", got)
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf syncBuffer
+	server, addr := NewTestServer(t, WithLogHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	if err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, []byte("Subject: Hi\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	resp, err := http.Get("http://" + server.HTTPAddr() + "/api/v1/emails")
+	if err != nil {
+		t.Fatalf("Failed to list emails: %v", err)
+	}
+	resp.Body.Close()
+
+	records := map[string]map[string]any{}
+	for line := range strings.Lines(buf.String()) {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to decode log record %q: %v", line, err)
+		}
+		records[record["msg"].(string)] = record
+	}
+
+	if r := records["SMTP session started"]; r == nil || r["level"] != "DEBUG" || r["listener"] != DefaultListener {
+		t.Errorf("Expected a debug record of the session start, got %v", r)
+	}
+	if r := records["Captured message"]; r == nil || r["level"] != "INFO" || r["id"] != "msg-0" {
+		t.Errorf("Expected an info record of the message, got %v", r)
+	}
+	if r := records["HTTP request"]; r == nil || r["path"] != "/api/v1/emails" || r["status"] != float64(http.StatusOK) {
+		t.Errorf("Expected a debug record of the request, got %v", r)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
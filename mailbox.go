@@ -0,0 +1,138 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// mailboxListener runs a retrieval protocol (POP3, IMAP) on its own port,
+// serving the captured mail to clients that poll a mailbox.
+type mailboxListener struct {
+	name  string
+	port  int
+	addr  string // set from the host and port by NewWithOptions
+	serve func(net.Conn)
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// start listens on the configured address and serves connections until
+// close is called. If accepting fails before that, fail is called.
+func (l *mailboxListener) start(ctx context.Context, lc *net.ListenConfig, fail func(error)) error {
+	listener, err := lc.Listen(ctx, "tcp", l.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start %s server: %w", l.name, err)
+	}
+	l.addr = listener.Addr().String()
+
+	l.mu.Lock()
+	l.listener = listener
+	l.conns = make(map[net.Conn]struct{})
+	l.mu.Unlock()
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				l.mu.Lock()
+				closed := l.listener == nil
+				l.mu.Unlock()
+				if !closed {
+					fail(fmt.Errorf("%s server failed: %w", l.name, err))
+				}
+				return
+			}
+			l.mu.Lock()
+			l.conns[conn] = struct{}{}
+			l.mu.Unlock()
+
+			l.wg.Add(1)
+			go func() {
+				defer l.wg.Done()
+				defer func() {
+					l.mu.Lock()
+					delete(l.conns, conn)
+					l.mu.Unlock()
+					conn.Close()
+				}()
+				l.serve(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// close stops the listener and closes open connections.
+func (l *mailboxListener) close() error {
+	l.mu.Lock()
+	listener := l.listener
+	l.listener = nil
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	if listener == nil {
+		return nil
+	}
+	err := listener.Close()
+	l.wg.Wait()
+	return err
+}
+
+// mailboxListeners returns the enabled retrieval listeners.
+func (s *Server) mailboxListeners() []*mailboxListener {
+	var listeners []*mailboxListener
+	for _, l := range []*mailboxListener{s.pop3, s.imap} {
+		if l != nil {
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners
+}
+
+// crlf returns body with every line ending converted to CRLF, as
+// retrieval protocols count and transfer messages that way.
+func crlf(body []byte) []byte {
+	body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(body, []byte("\n"), []byte("\r\n"))
+}
+
+// mailbox returns the released emails a retrieval client logged in as
+// user sees: if user is an email address, the mail delivered to it,
+// otherwise all mail.
+func (s *Server) mailbox(user string) ([]Email, error) {
+	if !strings.Contains(user, "@") {
+		return s.Emails(), nil
+	}
+
+	candidates, err := s.listByRecipient(user)
+	if err != nil {
+		return nil, err
+	}
+	emails := []Email{}
+	for _, email := range candidates {
+		if !email.Held && (email.deliveredTo(user) || email.HasRecipient(user)) {
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
+}
+
+// checkMailboxLogin reports whether a retrieval client may log in. Any
+// credentials are accepted unless SetAuth is configured.
+func (s *Server) checkMailboxLogin(username, password string) bool {
+	s.mu.RLock()
+	auth := s.auth
+	s.mu.RUnlock()
+	return auth == nil || auth.match(username, password)
+}
@@ -0,0 +1,103 @@
+package mailcatcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// mboxFromLine matches lines that mboxrd quotes with one more '>'.
+var mboxFromLine = regexp.MustCompile(`^>*From `)
+
+// ExportMbox writes every stored email, including held ones, to w in
+// mboxrd format, which mail clients and tools such as mutt can open.
+// Line endings are converted to LF.
+func (s *Server) ExportMbox(w io.Writer) error {
+	ctx := context.Background()
+	emails, err := listExport(ctx, s.store)
+	if err != nil {
+		return fmt.Errorf("failed to list emails: %w", err)
+	}
+	return exportMbox(ctx, w, emails)
+}
+
+func exportMbox(ctx context.Context, w io.Writer, emails *exportEmails) error {
+	bw := bufio.NewWriter(w)
+	err := emails.each(ctx, func(e *Email) error {
+		fmt.Fprintf(bw, "From %s %s\n", mboxSender(e), e.Time.UTC().Format(time.ANSIC))
+
+		scanner := bufio.NewScanner(bytes.NewReader(e.Raw()))
+		scanner.Buffer(nil, defaultMaxLineLength)
+		for scanner.Scan() {
+			line := bytes.TrimSuffix(scanner.Bytes(), []byte("\r"))
+			if mboxFromLine.Match(line) {
+				bw.WriteByte('>')
+			}
+			bw.Write(line)
+			bw.WriteByte('\n')
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to export %s: %w", e.ID, err)
+		}
+		bw.WriteByte('\n')
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write mbox: %w", err)
+	}
+	return nil
+}
+
+// mboxSender returns the address for the "From " separator line.
+func mboxSender(e *Email) string {
+	switch {
+	case e.Envelope.From != "":
+		return e.Envelope.From
+	case e.From.Address != "":
+		return e.From.Address
+	default:
+		return "MAILER-DAEMON"
+	}
+}
+
+// ExportMaildir writes every stored email, including held ones, into the
+// Maildir at dir, creating it if needed. Messages are delivered to new/
+// with LF line endings, named after their capture time and ID, so
+// exporting again overwrites rather than duplicates them.
+func (s *Server) ExportMaildir(dir string) error {
+	emails, err := s.store.List(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to list emails: %w", err)
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return fmt.Errorf("failed to create maildir: %w", err)
+		}
+	}
+
+	for i := range emails {
+		e := &emails[i]
+		name := fmt.Sprintf("%d.%s.mailcatcher", e.Time.Unix(), e.ID)
+		tmp := filepath.Join(dir, "tmp", name)
+
+		body := bytes.ReplaceAll(e.Raw(), []byte("\r\n"), []byte("\n"))
+		if err := os.WriteFile(tmp, body, 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", e.ID, err)
+		}
+		// Maildir readers never see a partially written message in new/
+		if err := os.Rename(tmp, filepath.Join(dir, "new", name)); err != nil {
+			return fmt.Errorf("failed to deliver %s: %w", e.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportMbox(t *testing.T) {
+	server := New(0, 0)
+	server.Send("bounce@example.com", []string{"user@example.com"}, []byte("From: App <app@example.com>\r\nSubject: One\r\n\r\nFrom the start\r\n>From quoted\r\n"))
+	server.Send("bounce@example.com", []string{"user@example.com"}, []byte("Subject: Two\r\n\r\nBody\r\n"))
+
+	var buf bytes.Buffer
+	if err := server.ExportMbox(&buf); err != nil {
+		t.Fatalf("Failed to export mbox: %v", err)
+	}
+	mbox := buf.String()
+
+	if strings.Contains(mbox, "\r") {
+		t.Error("Expected LF line endings")
+	}
+	var separators int
+	for _, line := range strings.Split(mbox, "\n") {
+		if strings.HasPrefix(line, "From ") {
+			separators++
+			if !strings.HasPrefix(line, "From bounce@example.com ") {
+				t.Errorf("Expected envelope sender in separator, got %q", line)
+			}
+		}
+	}
+	if separators != 2 {
+		t.Errorf("Expected 2 separator lines, got %d in %q", separators, mbox)
+	}
+	if !strings.Contains(mbox, "\n>From the start\n") || !strings.Contains(mbox, "\n>>From quoted\n") {
+		t.Errorf("Expected From lines in bodies to be quoted, got %q", mbox)
+	}
+}
+
+func TestExportMaildir(t *testing.T) {
+	server := New(0, 0)
+	server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: One\r\n\r\nBody\r\n"))
+	server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: Two\r\n\r\nBody\r\n"))
+
+	dir := filepath.Join(t.TempDir(), "Maildir")
+	for range 2 { // exporting again does not duplicate messages
+		if err := server.ExportMaildir(dir); err != nil {
+			t.Fatalf("Failed to export maildir: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatalf("Failed to read maildir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 messages in new/, got %d", len(entries))
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, "new", entries[0].Name()))
+	if string(content) != "Subject: One\n\nBody\n" {
+		t.Errorf("Expected message with LF line endings, got %q", content)
+	}
+	if tmp, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Errorf("Expected empty tmp/, got %d files", len(tmp))
+	}
+}
+
+func TestExportMboxEndpoint(t *testing.T) {
+	server := New(0, 0)
+	server.Send("sender@example.com", []string{"user@example.com"}, []byte("Subject: One\r\n\r\nBody\r\n"))
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/emails/export?format=mbox")
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/mbox" {
+		t.Errorf("Expected application/mbox, got %q", ct)
+	}
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	if !strings.HasPrefix(buf.String(), "From sender@example.com ") {
+		t.Errorf("Expected mbox separator line, got %q", buf.String())
+	}
+}
@@ -0,0 +1,162 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxMIMEDepth bounds the nesting of multipart bodies.
+const maxMIMEDepth = 10
+
+// Part is a leaf MIME part of an email. Content is decoded from the
+// transfer encoding; text parts are also converted to UTF-8 from Charset.
+type Part struct {
+	ContentType string              `json:"content_type"` // media type, lowercase
+	Charset     string              `json:"charset,omitempty"`
+	Encoding    string              `json:"encoding,omitempty"`    // Content-Transfer-Encoding
+	Disposition string              `json:"disposition,omitempty"` // "inline", "attachment" or empty
+	Filename    string              `json:"filename,omitempty"`
+	ContentID   string              `json:"content_id,omitempty"` // without angle brackets
+	Headers     map[string][]string `json:"headers,omitempty"`
+	Content     []byte              `json:"content"`
+}
+
+// IsAttachment reports whether the part is a file rather than a body.
+func (p Part) IsAttachment() bool {
+	return p.Disposition == "attachment" || p.Filename != ""
+}
+
+// parseParts returns the leaf parts of a raw message. A message that is
+// not multipart is a single part. Malformed parts are skipped.
+func parseParts(body []byte) []Part {
+	var parts []Part
+	walkParts(body, func(p Part) { parts = append(parts, p) })
+	return parts
+}
+
+// walkParts calls fn for every leaf part of a raw message.
+func walkParts(body []byte, fn func(Part)) {
+	msg, err := mail.ReadMessage(bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	walkPart(textproto.MIMEHeader(msg.Header), msg.Body, 0, fn)
+}
+
+func walkPart(header textproto.MIMEHeader, r io.Reader, depth int, fn func(Part)) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxMIMEDepth || params["boundary"] == "" {
+			return
+		}
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				return
+			}
+			walkPart(part.Header, part, depth+1, fn)
+		}
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding")))
+	content, err := io.ReadAll(decodeTransfer(encoding, r))
+	if err != nil {
+		return
+	}
+
+	p := Part{
+		ContentType: mediaType,
+		Charset:     strings.ToLower(params["charset"]),
+		Encoding:    encoding,
+		ContentID:   strings.Trim(header.Get("Content-Id"), "<> "),
+		Headers:     header,
+		Content:     content,
+	}
+	if disposition, dparams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		p.Disposition = disposition
+		p.Filename = dparams["filename"]
+	}
+	if p.Filename == "" {
+		p.Filename = params["name"]
+	}
+	p.Filename = decodeWord(p.Filename)
+
+	if strings.HasPrefix(mediaType, "text/") && !p.IsAttachment() {
+		p.Content = toUTF8(p.Charset, p.Content)
+	}
+	fn(p)
+}
+
+// toUTF8 converts text in the given charset to UTF-8. Unknown charsets
+// are left unchanged.
+func toUTF8(label string, text []byte) []byte {
+	switch label {
+	case "", "utf-8", "us-ascii":
+		return text
+	}
+	r, err := charset.NewReaderLabel(label, bytes.NewReader(text))
+	if err != nil {
+		return text
+	}
+	converted, err := io.ReadAll(r)
+	if err != nil {
+		return text
+	}
+	return converted
+}
+
+// decodeTransfer undoes a Content-Transfer-Encoding.
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch encoding {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// base64Cleaner drops the line breaks and whitespace of base64 bodies.
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func (c *base64Cleaner) Read(b []byte) (int, error) {
+	for {
+		n, err := c.r.Read(b)
+		kept := 0
+		for _, ch := range b[:n] {
+			if ch != '\r' && ch != '\n' && ch != ' ' && ch != '\t' {
+				b[kept] = ch
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// decodeWord decodes RFC 2047 encoded words in s, returning s unchanged if
+// it cannot be decoded.
+func decodeWord(s string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
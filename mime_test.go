@@ -0,0 +1,73 @@
+package mailcatcher
+
+import (
+	"testing"
+)
+
+func TestWalkParts(t *testing.T) {
+	body := []byte("Subject: Parts\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"Caf=C3=A9\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html\r\n\r\n" +
+		"<p>Café</p>\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf; name=\"=?utf-8?q?Rechnung_M=C3=A4rz.pdf?=\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"JVBE\r\nRi0x\r\n" +
+		"--outer--\r\n")
+
+	parts := parseParts(body)
+
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 parts, got %d", len(parts))
+	}
+	if parts[0].ContentType != "text/plain" || string(parts[0].Content) != "Café" {
+		t.Errorf("Expected decoded quoted-printable text, got %s %q", parts[0].ContentType, parts[0].Content)
+	}
+	if parts[1].ContentType != "text/html" || parts[1].IsAttachment() {
+		t.Errorf("Expected inline HTML part, got %+v", parts[1])
+	}
+	if !parts[2].IsAttachment() || parts[2].Filename != "Rechnung März.pdf" || string(parts[2].Content) != "%PDF-1" {
+		t.Errorf("Expected decoded PDF attachment, got %q %q", parts[2].Filename, parts[2].Content)
+	}
+}
+
+func TestEmailBodies(t *testing.T) {
+	body := []byte("Subject: Bodies\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=alt\r\n\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"Gr=FC=DFe\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+		"<p>Gr\xc3\xbc\xc3\x9fe</p>\r\n" +
+		"--alt--\r\n")
+
+	email := newEmail("sender@example.com", []string{"user@example.com"}, body)
+	if email.Text != "Grüße" {
+		t.Errorf("Expected text body converted from ISO-8859-1, got %q", email.Text)
+	}
+	if email.HTML != "<p>Grüße</p>" {
+		t.Errorf("Expected HTML body, got %q", email.HTML)
+	}
+	if len(email.Parts) != 2 || email.Parts[0].Charset != "iso-8859-1" || email.Parts[0].Encoding != "quoted-printable" {
+		t.Errorf("Expected 2 parts with charset and encoding, got %+v", email.Parts)
+	}
+	if got := email.Headers["Mime-Version"]; len(got) != 1 || got[0] != "1.0" {
+		t.Errorf("Expected MIME-Version header, got %v", email.Headers)
+	}
+
+	plain := newEmail("sender@example.com", []string{"user@example.com"}, []byte("Subject: Plain\r\n\r\nJust text\r\n"))
+	if plain.Text != "Just text\r\n" || plain.HTML != "" {
+		t.Errorf("Expected a non-MIME message to be its text body, got %q / %q", plain.Text, plain.HTML)
+	}
+}
@@ -0,0 +1,159 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Namespace is an isolated view of the mail sent to one test, so tests
+// sharing a server, such as DefaultServer, do not see or clear each
+// other's mail. An email belongs to namespace "checkout" if a recipient
+// is plus-addressed with the name, like user+checkout@example.com, or,
+// with SetNamespaceDomain("test.example.com"), its domain is the name
+// under that domain, like user@checkout.test.example.com. Names are
+// case-insensitive.
+type Namespace struct {
+	server *Server
+	name   string
+}
+
+// SetNamespaceDomain makes mail to the subdomains of domain belong to the
+// namespace named by the subdomain's first label, so
+// user@checkout.test.example.com belongs to "checkout" for domain
+// "test.example.com". Only plus addresses are matched by default.
+func (s *Server) SetNamespaceDomain(domain string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.namespaceDomain = strings.Trim(strings.ToLower(domain), ".")
+}
+
+// namespaceDomainName returns the domain set with SetNamespaceDomain.
+func (s *Server) namespaceDomainName() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.namespaceDomain
+}
+
+// Namespace returns the namespace with the given name. Namespaces need
+// no setup; any name can be used.
+func (s *Server) Namespace(name string) *Namespace {
+	return &Namespace{server: s, name: strings.ToLower(name)}
+}
+
+// Name returns the name of the namespace.
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// Address returns addr plus-addressed into the namespace, e.g.
+// "user+checkout@example.com" for "user@example.com".
+func (n *Namespace) Address(addr string) string {
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok {
+		return addr + "+" + n.name
+	}
+	return local + "+" + n.name + "@" + domain
+}
+
+// Contains reports whether email belongs to the namespace.
+func (n *Namespace) Contains(email Email) bool {
+	return inNamespace(email, n.name, n.server.namespaceDomainName())
+}
+
+// Emails returns the captured emails of the namespace, excluding held
+// ones.
+func (n *Namespace) Emails() []Email {
+	return n.server.Find(Filter{Namespace: n.name})
+}
+
+// Find returns the captured emails of the namespace matching f.
+func (n *Namespace) Find(f Filter) []Email {
+	f.Namespace = n.name
+	return n.server.Find(f)
+}
+
+// WaitFor is Server.WaitFor for the emails of the namespace.
+func (n *Namespace) WaitFor(ctx context.Context, match func(Email) bool) (Email, error) {
+	return n.server.WaitFor(ctx, func(e Email) bool { return n.Contains(e) && match(e) })
+}
+
+// Clear deletes the emails of the namespace, including held ones, and
+// leaves all other mail in place.
+func (n *Namespace) Clear() {
+	emails, err := n.server.store.List(context.Background())
+	if err != nil {
+		n.server.errorf("Failed to list emails: %v", err)
+		return
+	}
+	for _, email := range emails {
+		if n.Contains(email) {
+			if err := n.server.Delete(email.ID); err != nil {
+				n.server.errorf("Failed to delete %s: %v", email.ID, err)
+			}
+		}
+	}
+}
+
+// inNamespace reports whether a recipient of email routes it to name: it
+// is plus-addressed with name, or its domain is name under domain.
+func inNamespace(email Email, name, domain string) bool {
+	if name == "" {
+		return true
+	}
+	addrs := append([]string(nil), email.Envelope.To...)
+	for _, list := range [][]Address{email.To, email.Cc, email.Bcc} {
+		for _, a := range list {
+			addrs = append(addrs, a.Address)
+		}
+	}
+
+	for _, addr := range addrs {
+		at := strings.LastIndex(addr, "@")
+		if at < 0 {
+			continue
+		}
+		local := strings.ToLower(addr[:at])
+		if _, tag, ok := strings.Cut(local, "+"); ok && tag == name {
+			return true
+		}
+		if domain != "" && strings.ToLower(addr[at+1:]) == name+"."+domain {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetNamespaceEmails(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	emails := s.Namespace(r.PathValue("ns")).Find(filter)
+	items := page.apply(emails)
+
+	response := map[string]any{
+		"total": len(emails),
+		"count": len(items),
+		"items": items,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleDeleteNamespaceEmails(w http.ResponseWriter, r *http.Request) {
+	s.Namespace(r.PathValue("ns")).Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,112 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	server := NewWithOptions(WithNamespaceDomain("test.example.com"))
+	checkout := server.Namespace("Checkout")
+	signup := server.Namespace("signup")
+	send := func(to, subject string) {
+		t.Helper()
+		if err := server.Send("app@example.com", []string{to}, []byte("To: "+to+"\r\nSubject: "+subject+"\r\n\r\nBody\r\n")); err != nil {
+			t.Fatalf("Failed to send email: %v", err)
+		}
+	}
+
+	if got := checkout.Address("user@example.com"); got != "user+checkout@example.com" {
+		t.Errorf("Expected plus address, got %s", got)
+	}
+	send(checkout.Address("user@example.com"), "Receipt")
+	send("user@checkout.test.example.com", "Shipping")
+	send("user@signup.test.example.com", "Welcome")
+	send("user@example.com", "Other")
+
+	if emails := checkout.Emails(); len(emails) != 2 || emails[0].Subject != "Receipt" || emails[1].Subject != "Shipping" {
+		t.Errorf("Expected Receipt and Shipping in checkout, got %d emails", len(emails))
+	}
+	if emails := signup.Find(Filter{SubjectContains: "welcome"}); len(emails) != 1 {
+		t.Errorf("Expected Welcome in signup, got %d emails", len(emails))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if email, err := signup.WaitFor(ctx, func(Email) bool { return true }); err != nil || email.Subject != "Welcome" {
+		t.Errorf("Expected to wait for Welcome, got %q (%v)", email.Subject, err)
+	}
+
+	checkout.Clear()
+	if n := len(checkout.Emails()); n != 0 {
+		t.Errorf("Expected checkout to be empty, got %d emails", n)
+	}
+	if n := len(server.Emails()); n != 2 {
+		t.Errorf("Expected the other 2 emails to remain, got %d", n)
+	}
+}
+
+func TestNamespaceSharedPrefix(t *testing.T) {
+	server := NewWithOptions(WithNamespaceDomain("example.com"))
+	for _, to := range []string{"user@example.com", "user+examples@example.com", "user@example.com.evil.test", "user@checkout.example.com", "user@a.checkout.example.com"} {
+		if err := server.Send("app@example.com", []string{to}, []byte("To: "+to+"\r\nSubject: "+to+"\r\n\r\nBody\r\n")); err != nil {
+			t.Fatalf("Failed to send email: %v", err)
+		}
+	}
+
+	// Neither namespace may claim another's mail by sharing a prefix with it
+	for name, want := range map[string][]string{
+		"example":  nil,
+		"check":    nil,
+		"checkout": {"user@checkout.example.com"},
+		"examples": {"user+examples@example.com"},
+	} {
+		ns := server.Namespace(name)
+		if got := subjects(ns.Emails()); !slices.Equal(got, want) {
+			t.Errorf("Expected %v in namespace %s, got %v", want, name, got)
+		}
+	}
+	server.Namespace("example").Clear()
+	server.Namespace("check").Clear()
+	if n := len(server.Emails()); n != 5 {
+		t.Errorf("Expected clearing the prefixes to leave all 5 emails, got %d", n)
+	}
+}
+
+func TestNamespaceAPI(t *testing.T) {
+	server, _ := NewTestServer(t)
+	server.Send("app@example.com", []string{"a+orders@example.com"}, []byte("Subject: Order\r\n\r\nBody\r\n"))
+	server.Send("app@example.com", []string{"b@example.com"}, []byte("Subject: Other\r\n\r\nBody\r\n"))
+	base := "http://" + server.HTTPAddr() + "/api/v1/namespaces/orders/emails"
+
+	resp, err := http.Get(base)
+	if err != nil {
+		t.Fatalf("Failed to list namespace: %v", err)
+	}
+	var response struct {
+		Total int     `json:"total"`
+		Items []Email `json:"items"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	resp.Body.Close()
+	if err != nil || response.Total != 1 || response.Items[0].Subject != "Order" {
+		t.Fatalf("Expected the order email, got %+v (%v)", response, err)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, base, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to clear namespace: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	if emails := server.Emails(); len(emails) != 1 || emails[0].Subject != "Other" {
+		t.Errorf("Expected only the other email to remain, got %d", len(emails))
+	}
+}
@@ -0,0 +1,38 @@
+package mailcatcher
+
+// Notifier is alerted the moment a message lands, e.g. to push a browser
+// or desktop notification. Held messages are announced once approved.
+type Notifier interface {
+	Notify(email Email) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface.
+type NotifierFunc func(email Email) error
+
+// Notify implements Notifier.
+func (f NotifierFunc) Notify(email Email) error {
+	return f(email)
+}
+
+// AddNotifier registers a notifier for new messages.
+// Notifiers run asynchronously; failures are reported to the logger.
+func (s *Server) AddNotifier(n Notifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifiers = append(s.notifiers, n)
+}
+
+// notify alerts every notifier about email.
+func (s *Server) notify(email Email) {
+	s.mu.RLock()
+	notifiers := s.notifiers
+	s.mu.RUnlock()
+
+	for _, n := range notifiers {
+		go func() {
+			if err := n.Notify(email); err != nil {
+				s.errorf("Failed to notify about %s: %v", email.ID, err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,57 @@
+package mailcatcher
+
+import (
+	"context"
+	"net/smtp"
+	"testing"
+	"time"
+)
+
+func TestAddNotifier(t *testing.T) {
+	notified := make(chan Email, 2)
+
+	server := New(10048, 10103)
+	server.AddNotifier(NotifierFunc(func(email Email) error {
+		notified <- email
+		return nil
+	}))
+	server.AddHoldRule(HoldRecipient("*@legal.example.com"))
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	msg := []byte("Subject: Contract\r\n\r\nBody\r\n")
+	if err := smtp.SendMail("localhost:10048", nil, "sender@example.com", []string{"counsel@legal.example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	select {
+	case email := <-notified:
+		t.Fatalf("Expected no notification for held email, got %s", email.ID)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	held := server.Held()
+	if len(held) != 1 {
+		t.Fatalf("Expected 1 held email, got %d", len(held))
+	}
+	if err := server.Approve(held[0].ID); err != nil {
+		t.Fatalf("Failed to approve email: %v", err)
+	}
+
+	select {
+	case email := <-notified:
+		if email.Subject != "Contract" {
+			t.Errorf("Expected notification for approved email, got %q", email.Subject)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a notification once the email was approved")
+	}
+}
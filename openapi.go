@@ -0,0 +1,64 @@
+package mailcatcher
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+)
+
+// openAPISpec describes the HTTP API, for generating clients in other
+// languages. Every route of Server.routes must be in it.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// routes returns the HTTP API endpoints by pattern.
+func (s *Server) routes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"GET /api/v1/emails":                          s.handleGetEmails,
+		"POST /api/v1/emails":                         s.handleInjectEmail,
+		"GET /api/v1/emails/held":                     s.handleGetHeld,
+		"GET /api/v1/emails/export":                   s.handleExportEmails,
+		"GET /api/v1/emails/archive":                  s.handleArchiveEmails,
+		"GET /api/v1/emails/{id}":                     s.handleGetEmail,
+		"GET /api/v1/emails/{id}/raw":                 s.handleGetRawEmail,
+		"GET /api/v1/emails/{id}/html":                s.handleGetHTML,
+		"GET /api/v1/emails/{id}/text":                s.handleGetText,
+		"GET /api/v1/emails/{id}/snapshot":            s.handleGetSnapshot,
+		"POST /api/v1/emails/{id}/diff":               s.handleDiffEmail,
+		"GET /api/v1/emails/{id}/attachments":         s.handleGetAttachments,
+		"GET /api/v1/emails/{id}/attachments/{index}": s.handleGetAttachment,
+		"POST /api/v1/emails/{id}/approve":            s.handleApproveEmail,
+		"POST /api/v1/emails/{id}/reject":             s.handleRejectEmail,
+		"POST /api/v1/emails/{id}/release":            s.handleReleaseEmail,
+		"DELETE /api/v1/emails":                       s.handleDeleteEmails,
+		"PATCH /api/v1/emails/{id}":                   s.handlePatchEmail,
+		"DELETE /api/v1/emails/{id}":                  s.handleDeleteEmail,
+		"GET /api/v1/namespaces/{ns}/emails":          s.handleGetNamespaceEmails,
+		"DELETE /api/v1/namespaces/{ns}/emails":       s.handleDeleteNamespaceEmails,
+		"GET /api/v1/stats":                           s.handleGetStats,
+		"GET /api/v1/search":                          s.handleSearch,
+		"GET /api/v1/oversized":                       s.handleGetOversized,
+		"POST /api/v1/checkpoints":                    s.handleCreateCheckpoint,
+		"POST /api/v1/checkpoints/{id}/restore":       s.handleRestoreCheckpoint,
+		"DELETE /api/v1/checkpoints/{id}":             s.handleDeleteCheckpoint,
+		"GET /api/v1/behavior":                        s.handleGetBehavior,
+		"POST /api/v1/behavior":                       s.handleSetBehavior,
+		"GET /api/v1/events":                          s.handleEvents,
+		"GET /api/v1/webhooks":                        s.handleGetWebhooks,
+		"POST /api/v1/webhooks":                       s.handleAddWebhook,
+		"DELETE /api/v1/webhooks":                     s.handleRemoveWebhook,
+		"GET /api/v1/push/key":                        s.handleGetPushKey,
+		"POST /api/v1/push/subscriptions":             s.handleSubscribePush,
+		"DELETE /api/v1/push/subscriptions":           s.handleUnsubscribePush,
+		"GET /api/v1/openapi.json":                    s.handleGetOpenAPI,
+	}
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(openAPISpec)))
+	_, _ = w.Write(openAPISpec)
+}
@@ -0,0 +1,159 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type openAPIDoc struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func parseOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("Failed to parse openapi.json: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := parseOpenAPI(t)
+	server := New(0, 0)
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method != "parameters" {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+	routes := server.routes()
+	for pattern := range routes {
+		if !documented[pattern] {
+			t.Errorf("Expected %s to be in openapi.json", pattern)
+		}
+	}
+	for pattern := range documented {
+		if _, ok := routes[pattern]; !ok {
+			t.Errorf("Expected %s in openapi.json to be served", pattern)
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc := parseOpenAPI(t)
+	for name, typ := range map[string]any{
+		"Address":            Address{},
+		"Group":              Group{},
+		"Envelope":           Envelope{},
+		"Part":               Part{},
+		"Attachment":         Attachment{},
+		"Command":            Command{},
+		"DataFinding":        DataFinding{},
+		"PolicyViolation":    PolicyViolation{},
+		"ValidationReport":   ValidationReport{},
+		"DKIMResult":         DKIMResult{},
+		"SPFResult":          SPFResult{},
+		"HeaderIssue":        HeaderIssue{},
+		"TLSInfo":            TLSInfo{},
+		"AuthInfo":           AuthInfo{},
+		"Email":              Email{},
+		"Stats":              Stats{},
+		"StatsBucket":        StatsBucket{},
+		"Oversized":          Oversized{},
+		"Snapshot":           Snapshot{},
+		"SnapshotAttachment": SnapshotAttachment{},
+		"Webhook":            Webhook{},
+		"PushSubscription":   PushSubscription{},
+		"Event":              Event{},
+		"Behavior":           Behavior{},
+		"Faults":             Faults{},
+		"Latency":            Latency{},
+		"Rejection":          Rejection{},
+		"Checkpoint":         checkpointInfo{},
+	} {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("Expected schema %s in openapi.json", name)
+			continue
+		}
+		var fields []string
+		rt := reflect.TypeOf(typ)
+		for i := range rt.NumField() {
+			f := rt.Field(i)
+			tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || tag == "-" {
+				continue
+			}
+			fields = append(fields, tag)
+		}
+		var props []string
+		for prop := range schema.Properties {
+			props = append(props, prop)
+		}
+		slices.Sort(fields)
+		slices.Sort(props)
+		if !slices.Equal(fields, props) {
+			t.Errorf("Expected schema %s to have properties %v, got %v", name, fields, props)
+		}
+		for _, req := range schema.Required {
+			if !slices.Contains(props, req) {
+				t.Errorf("Expected required property %s of %s to be defined", req, name)
+			}
+		}
+	}
+}
+
+func TestOpenAPIReferences(t *testing.T) {
+	var doc struct {
+		Components map[string]map[string]json.RawMessage `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("Failed to parse openapi.json: %v", err)
+	}
+	refs := regexp.MustCompile(`"\$ref": "#/components/(\w+)/(\w+)"`).FindAllStringSubmatch(string(openAPISpec), -1)
+	if len(refs) == 0 {
+		t.Fatal("Expected references in openapi.json")
+	}
+	for _, ref := range refs {
+		if _, ok := doc.Components[ref[1]][ref[2]]; !ok {
+			t.Errorf("Expected %s %s to be defined", ref[1], ref[2])
+		}
+	}
+}
+
+func TestOpenAPIEndpoint(t *testing.T) {
+	server := New(0, 0)
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/openapi.json")
+	if err != nil {
+		t.Fatalf("Failed to get spec: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected 200 with JSON, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil || doc.OpenAPI != "3.1.0" {
+		t.Errorf("Expected an OpenAPI 3.1.0 document, got %q (%v)", doc.OpenAPI, err)
+	}
+}
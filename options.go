@@ -0,0 +1,133 @@
+package mailcatcher
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"time"
+)
+
+// Default ports used by NewWithDefaults and NewWithOptions.
+const (
+	defaultSMTPPort = 1025
+	defaultHTTPPort = 8025
+)
+
+// Option configures a Server created by NewWithOptions.
+type Option func(*Server)
+
+// WithHost binds both listeners to host, e.g. "127.0.0.1", instead of all
+// interfaces.
+func WithHost(host string) Option {
+	return func(s *Server) { s.host = host }
+}
+
+// WithSMTPPort sets the SMTP port. Zero picks a free port.
+func WithSMTPPort(port int) Option {
+	return func(s *Server) { s.smtpPort = port }
+}
+
+// WithHTTPPort sets the HTTP API port. Zero picks a free port.
+func WithHTTPPort(port int) Option {
+	return func(s *Server) { s.httpPort = port }
+}
+
+// WithPOP3Port enables the POP3 server on port, see SetPOP3Port.
+func WithPOP3Port(port int) Option {
+	return func(s *Server) { s.SetPOP3Port(port) }
+}
+
+// WithIMAPPort enables the IMAP server on port, see SetIMAPPort.
+func WithIMAPPort(port int) Option {
+	return func(s *Server) { s.SetIMAPPort(port) }
+}
+
+// WithListener adds an SMTP port, see AddListener.
+func WithListener(l Listener) Option {
+	return func(s *Server) { s.AddListener(l) }
+}
+
+// WithWebhook registers a webhook for new messages, see AddWebhook.
+func WithWebhook(w Webhook) Option {
+	return func(s *Server) { s.AddWebhook(w) }
+}
+
+// WithTLS enables STARTTLS on the SMTP server with the given configuration.
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) { s.smtpServer.TLSConfig = config }
+}
+
+// WithMaxMessageBytes rejects messages larger than n bytes, see
+// SetMaxMessageBytes.
+func WithMaxMessageBytes(n int64) Option {
+	return func(s *Server) { s.SetMaxMessageBytes(n) }
+}
+
+// WithReadTimeout closes connections idle for d, see SetReadTimeout.
+func WithReadTimeout(d time.Duration) Option {
+	return func(s *Server) { s.SetReadTimeout(d) }
+}
+
+// WithMaxRecipients refuses recipients past the first n of a message, see
+// SetMaxRecipients.
+func WithMaxRecipients(n int) Option {
+	return func(s *Server) { s.SetMaxRecipients(n) }
+}
+
+// WithRetention limits the captured mail, see SetRetention.
+func WithRetention(r Retention) Option {
+	return func(s *Server) { s.SetRetention(r) }
+}
+
+// WithMessageTTL deletes messages captured longer ago than ttl, see
+// SetMessageTTL.
+func WithMessageTTL(ttl time.Duration) Option {
+	return func(s *Server) { s.SetMessageTTL(ttl) }
+}
+
+// WithLogger sets the logger, see SetLogger.
+func WithLogger(logger Logger) Option {
+	return func(s *Server) { s.SetLogger(logger) }
+}
+
+// WithLogHandler sets the structured log handler, see SetLogHandler.
+func WithLogHandler(h slog.Handler) Option {
+	return func(s *Server) { s.SetLogHandler(h) }
+}
+
+// WithAuth requires clients to authenticate, see SetAuth.
+func WithAuth(username, password string) Option {
+	return func(s *Server) { s.SetAuth(username, password) }
+}
+
+// WithAPIToken requires a bearer token for the HTTP API, see SetAPIToken.
+func WithAPIToken(token string) Option {
+	return func(s *Server) { s.SetAPIToken(token) }
+}
+
+// WithAPIBasicAuth requires basic authentication for the HTTP API, see
+// SetAPIBasicAuth.
+func WithAPIBasicAuth(username, password string) Option {
+	return func(s *Server) { s.SetAPIBasicAuth(username, password) }
+}
+
+// WithNamespaceDomain sets the domain whose subdomains name namespaces,
+// see SetNamespaceDomain.
+func WithNamespaceDomain(domain string) Option {
+	return func(s *Server) { s.SetNamespaceDomain(domain) }
+}
+
+// WithDomain sets the domain the SMTP server announces in its greeting.
+func WithDomain(domain string) Option {
+	return func(s *Server) { s.smtpServer.Domain = domain }
+}
+
+// WithExtensions selects the advertised ESMTP extensions, see
+// SetExtensions.
+func WithExtensions(e Extensions) Option {
+	return func(s *Server) { s.SetExtensions(e) }
+}
+
+// WithStore sets the message store, see SetStore.
+func WithStore(store Store) Option {
+	return func(s *Server) { s.SetStore(store) }
+}
@@ -0,0 +1,90 @@
+package mailcatcher
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	server := NewWithOptions(
+		WithHost("127.0.0.1"),
+		WithSMTPPort(0),
+		WithHTTPPort(0),
+		WithDomain("mx.example.com"),
+		WithMaxMessageBytes(1024),
+		WithRetention(Retention{MaxMessages: 2}),
+		WithAuth("app", "secret"),
+	)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	addr := server.SMTPServer().Addr
+	if host, _, _ := net.SplitHostPort(addr); host != "127.0.0.1" {
+		t.Errorf("Expected SMTP bound to 127.0.0.1, got %s", addr)
+	}
+	if host, _, _ := net.SplitHostPort(server.HTTPServer().Addr); host != "127.0.0.1" {
+		t.Errorf("Expected HTTP bound to 127.0.0.1, got %s", server.HTTPServer().Addr)
+	}
+
+	auth := smtp.PlainAuth("", "app", "secret", "127.0.0.1")
+	for _, subject := range []string{"One", "Two", "Three"} {
+		msg := []byte("Subject: " + subject + "\r\n\r\nBody\r\n")
+		if err := smtp.SendMail(addr, auth, "app@example.com", []string{"user@example.com"}, msg); err != nil {
+			t.Fatalf("Failed to send email: %v", err)
+		}
+	}
+
+	emails := server.Emails()
+	if len(emails) != 2 || emails[0].Subject != "Two" || emails[1].Subject != "Three" {
+		t.Errorf("Expected the 2 newest emails to be kept, got %d", len(emails))
+	}
+
+	msg := []byte("Subject: Unauthenticated\r\n\r\nBody\r\n")
+	err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, msg)
+	if err == nil || !strings.HasPrefix(err.Error(), "530") {
+		t.Errorf("Expected 530 without authentication, got %v", err)
+	}
+
+	wrong := smtp.PlainAuth("", "app", "wrong", "127.0.0.1")
+	err = smtp.SendMail(addr, wrong, "app@example.com", []string{"user@example.com"}, msg)
+	if err == nil || !strings.HasPrefix(err.Error(), "535") {
+		t.Errorf("Expected 535 for wrong credentials, got %v", err)
+	}
+
+	big := []byte("Subject: Big\r\n\r\n" + strings.Repeat("x", 2048) + "\r\n")
+	err = smtp.SendMail(addr, auth, "app@example.com", []string{"user@example.com"}, big)
+	if err == nil || !strings.HasPrefix(err.Error(), "552") {
+		t.Errorf("Expected 552 for oversized message, got %v", err)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	greeting := make([]byte, 128)
+	n, _ := conn.Read(greeting)
+	if !strings.Contains(string(greeting[:n]), "mx.example.com") {
+		t.Errorf("Expected greeting from mx.example.com, got %q", greeting[:n])
+	}
+}
+
+func TestNewWithOptionsDefaults(t *testing.T) {
+	server := NewWithOptions()
+	if addr := server.SMTPServer().Addr; addr != ":1025" {
+		t.Errorf("Expected SMTP address :1025, got %s", addr)
+	}
+	if addr := server.HTTPServer().Addr; addr != ":8025" {
+		t.Errorf("Expected HTTP address :8025, got %s", addr)
+	}
+}
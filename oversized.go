@@ -0,0 +1,87 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+// maxOversized is the number of oversized rejections kept; older ones
+// are dropped.
+const maxOversized = 1000
+
+// Oversized records a message rejected with 552 for exceeding the
+// MaxMessageBytes limit. The message content is not kept.
+type Oversized struct {
+	Time  time.Time `json:"time"`
+	From  string    `json:"from"`
+	To    []string  `json:"to"`
+	Limit int64     `json:"limit"`
+
+	// Size is the size of messages passed to Send. Over SMTP the server
+	// stops reading at the limit, so the size is unknown and zero.
+	Size int64 `json:"size,omitempty"`
+
+	// Listener and RemoteAddr identify the SMTP connection; both are
+	// empty for Send.
+	Listener   string `json:"listener,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+// SetMaxMessageBytes rejects messages larger than n bytes during DATA with
+// ErrMessageTooLarge, or the MessageTooLarge reply of SetRejections, and advertises
+// the limit with the SIZE extension. Rejections are recorded, see
+// OversizedMessages. Reading stops at the limit, so hostile clients cannot
+// exhaust memory. Zero means no limit. It must be called before Start.
+func (s *Server) SetMaxMessageBytes(n int64) {
+	s.smtpServer.MaxMessageBytes = n
+}
+
+// OversizedMessages returns the most recent rejections of messages over
+// the size limit, oldest first. Messages declaring a size over the limit
+// with MAIL FROM SIZE= are refused before they are sent and are not
+// included.
+func (s *Server) OversizedMessages() []Oversized {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Oversized(nil), s.oversized...)
+}
+
+// recordOversized records a rejected message and returns the reply.
+func (s *Server) recordOversized(o Oversized) *smtp.SMTPError {
+	o.Time = time.Now()
+	o.Limit = s.smtpServer.MaxMessageBytes
+	s.limits.oversized.Add(1)
+	s.infof("Rejected message from %s over %d bytes", o.From, o.Limit)
+
+	s.mu.Lock()
+	s.oversized = append(s.oversized, o)
+	if len(s.oversized) > maxOversized {
+		s.oversized = s.oversized[len(s.oversized)-maxOversized:]
+	}
+	s.mu.Unlock()
+
+	return s.rejection(func(r Rejections) *smtp.SMTPError { return r.MessageTooLarge }, ErrMessageTooLarge)
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetOversized(w http.ResponseWriter, r *http.Request) {
+	items := s.OversizedMessages()
+	if items == nil {
+		items = []Oversized{}
+	}
+
+	response := map[string]any{
+		"total": len(items),
+		"count": len(items),
+		"items": items,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,65 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	gosmtp "github.com/emersion/go-smtp"
+)
+
+func TestOversizedRejection(t *testing.T) {
+	server, addr := NewTestServer(t, WithMaxMessageBytes(100))
+	big := []byte("Subject: Big\r\n\r\n" + strings.Repeat("x", 200) + "\r\n")
+
+	err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, big)
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != 552 {
+		t.Fatalf("Expected 552 for an oversized message, got %v", err)
+	}
+	if err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, []byte("Subject: Small\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send a small message: %v", err)
+	}
+
+	var smtpErr *gosmtp.SMTPError
+	if err := server.Send("app@example.com", []string{"other@example.com"}, big); !errors.As(err, &smtpErr) || smtpErr.Code != 552 {
+		t.Errorf("Expected 552 from Send, got %v", err)
+	}
+
+	oversized := server.OversizedMessages()
+	if len(oversized) != 2 {
+		t.Fatalf("Expected 2 oversized rejections, got %d", len(oversized))
+	}
+	if o := oversized[0]; o.From != "app@example.com" || len(o.To) != 1 || o.To[0] != "user@example.com" ||
+		o.Limit != 100 || o.Listener != DefaultListener || o.RemoteAddr == "" {
+		t.Errorf("Unexpected SMTP rejection %+v", o)
+	}
+	if o := oversized[1]; o.Size != int64(len(big)) || o.To[0] != "other@example.com" {
+		t.Errorf("Unexpected Send rejection %+v", o)
+	}
+	if emails := server.Emails(); len(emails) != 1 || emails[0].Subject != "Small" {
+		t.Errorf("Expected only the small message, got %d emails", len(emails))
+	}
+
+	resp, err := http.Get("http://" + server.HTTPAddr() + "/api/v1/oversized")
+	if err != nil {
+		t.Fatalf("Failed to get oversized rejections: %v", err)
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Count int         `json:"count"`
+		Items []Oversized `json:"items"`
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("Failed to decode response %s: %v", body, err)
+	}
+	if response.Count != 2 || len(response.Items) != 2 {
+		t.Errorf("Expected 2 items, got %s", body)
+	}
+}
@@ -0,0 +1,258 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pop3Timeout is the inactivity autologout timer, the minimum RFC 1939
+// allows.
+const pop3Timeout = 10 * time.Minute
+
+// SetPOP3Port enables a POP3 server (RFC 1939) on port, so applications
+// that poll a mailbox can fetch the captured mail. Zero picks a free port.
+// It must be called before Start.
+//
+// Logging in as an email address opens the mail delivered to it; any other
+// user name sees all mail. Passwords are only checked when SetAuth is
+// configured. Messages deleted with DELE are removed from the server on QUIT.
+func (s *Server) SetPOP3Port(port int) {
+	s.pop3 = &mailboxListener{
+		name:  "POP3",
+		port:  port,
+		addr:  net.JoinHostPort(s.host, strconv.Itoa(port)),
+		serve: s.servePOP3,
+	}
+}
+
+// POP3Addr returns the address of the POP3 listener, like SMTPAddr, or ""
+// if POP3 is not enabled.
+func (s *Server) POP3Addr() string {
+	if s.pop3 == nil {
+		return ""
+	}
+	return dialAddr(s.pop3.addr)
+}
+
+// pop3Session is the state of one POP3 connection.
+type pop3Session struct {
+	server *Server
+	conn   net.Conn
+	text   *textproto.Conn
+
+	user     string
+	messages []pop3Message // nil until logged in
+}
+
+type pop3Message struct {
+	email   Email
+	body    []byte // with CRLF line endings
+	deleted bool
+}
+
+func (s *Server) servePOP3(conn net.Conn) {
+	p := &pop3Session{server: s, conn: conn, text: textproto.NewConn(conn)}
+	p.ok("mailcatcher POP3 ready")
+
+	for {
+		conn.SetDeadline(time.Now().Add(pop3Timeout))
+		line, err := p.text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		if !p.handle(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+// handle runs a single command and reports whether the session continues.
+func (p *pop3Session) handle(cmd, arg string) bool {
+	switch cmd {
+	case "CAPA":
+		p.ok("Capability list follows")
+		p.lines("USER", "UIDL", "TOP", "IMPLEMENTATION mailcatcher")
+		return true
+	case "QUIT":
+		p.quit()
+		return false
+	}
+
+	if p.messages == nil {
+		switch cmd {
+		case "USER":
+			p.user = arg
+			p.ok("Send PASS")
+		case "PASS":
+			p.login(arg)
+		default:
+			p.err("Not logged in")
+		}
+		return true
+	}
+
+	switch cmd {
+	case "STAT":
+		var count, size int
+		for _, m := range p.messages {
+			if !m.deleted {
+				count++
+				size += len(m.body)
+			}
+		}
+		p.ok(fmt.Sprintf("%d %d", count, size))
+	case "LIST":
+		p.list(arg, func(n int, m *pop3Message) string { return fmt.Sprintf("%d %d", n, len(m.body)) })
+	case "UIDL":
+		p.list(arg, func(n int, m *pop3Message) string { return fmt.Sprintf("%d %s", n, m.email.ID) })
+	case "RETR":
+		if m := p.message(arg); m != nil {
+			p.ok(fmt.Sprintf("%d octets", len(m.body)))
+			p.dot(m.body)
+		}
+	case "TOP":
+		n, lines, _ := strings.Cut(arg, " ")
+		count, err := strconv.Atoi(lines)
+		if err != nil || count < 0 {
+			p.err("Usage: TOP msg lines")
+			return true
+		}
+		if m := p.message(n); m != nil {
+			p.ok("Top of message follows")
+			p.dot(top(m.body, count))
+		}
+	case "DELE":
+		if m := p.message(arg); m != nil {
+			m.deleted = true
+			p.ok("Message deleted")
+		}
+	case "RSET":
+		for i := range p.messages {
+			p.messages[i].deleted = false
+		}
+		p.ok(fmt.Sprintf("%d messages", len(p.messages)))
+	case "NOOP":
+		p.ok("")
+	default:
+		p.err("Unknown command")
+	}
+	return true
+}
+
+// login opens the mailbox of the user given by USER.
+func (p *pop3Session) login(password string) {
+	if p.user == "" {
+		p.err("Send USER first")
+		return
+	}
+	if !p.server.checkMailboxLogin(p.user, password) {
+		p.server.infof("Rejected POP3 login for %q from %s", p.user, p.conn.RemoteAddr())
+		p.user = ""
+		p.err("[AUTH] Invalid credentials")
+		return
+	}
+
+	emails, err := p.server.mailbox(p.user)
+	if err != nil {
+		p.server.errorf("Failed to open POP3 mailbox %q: %v", p.user, err)
+		p.err("[SYS/TEMP] Mailbox unavailable")
+		return
+	}
+	p.messages = make([]pop3Message, len(emails))
+	for i, email := range emails {
+		p.messages[i] = pop3Message{email: email, body: crlf(email.Raw())}
+	}
+	p.ok(fmt.Sprintf("%d messages", len(p.messages)))
+}
+
+// quit ends the session, removing the messages marked for deletion.
+func (p *pop3Session) quit() {
+	for _, m := range p.messages {
+		if m.deleted {
+			if err := p.server.Delete(m.email.ID); err != nil {
+				p.server.errorf("Failed to delete %s: %v", m.email.ID, err)
+			}
+		}
+	}
+	p.ok("Bye")
+}
+
+// list answers LIST and UIDL, for a single message if arg is given.
+func (p *pop3Session) list(arg string, format func(int, *pop3Message) string) {
+	if arg != "" {
+		if m := p.message(arg); m != nil {
+			n, _ := strconv.Atoi(arg)
+			p.ok(format(n, m))
+		}
+		return
+	}
+
+	var lines []string
+	for i := range p.messages {
+		if !p.messages[i].deleted {
+			lines = append(lines, format(i+1, &p.messages[i]))
+		}
+	}
+	p.ok("Listing follows")
+	p.lines(lines...)
+}
+
+// message returns the undeleted message numbered arg, or replies with an
+// error and returns nil.
+func (p *pop3Session) message(arg string) *pop3Message {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(p.messages) || p.messages[n-1].deleted {
+		p.err("No such message")
+		return nil
+	}
+	return &p.messages[n-1]
+}
+
+// top returns the header of body and the first n lines of its text.
+func top(body []byte, n int) []byte {
+	header, text, found := bytes.Cut(body, []byte("\r\n\r\n"))
+	if !found {
+		return body
+	}
+	result := append(bytes.Clone(header), "\r\n\r\n"...)
+	for ; n > 0 && len(text) > 0; n-- {
+		line, rest, _ := bytes.Cut(text, []byte("\r\n"))
+		result = append(append(result, line...), "\r\n"...)
+		text = rest
+	}
+	return result
+}
+
+func (p *pop3Session) ok(msg string) {
+	if msg == "" {
+		p.text.PrintfLine("+OK")
+		return
+	}
+	p.text.PrintfLine("+OK %s", msg)
+}
+
+func (p *pop3Session) err(msg string) {
+	p.text.PrintfLine("-ERR %s", msg)
+}
+
+// lines writes a multi-line response body.
+func (p *pop3Session) lines(lines ...string) {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line + "\r\n")
+	}
+	p.dot(buf.Bytes())
+}
+
+// dot writes data byte-stuffed and terminated by a line holding ".".
+func (p *pop3Session) dot(data []byte) {
+	w := p.text.DotWriter()
+	w.Write(data)
+	w.Close()
+}
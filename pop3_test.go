@@ -0,0 +1,128 @@
+package mailcatcher
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// dialPOP3 connects to the server's POP3 listener and reads the greeting.
+func dialPOP3(t *testing.T, server *Server) *textproto.Conn {
+	t.Helper()
+	conn, err := textproto.Dial("tcp", server.POP3Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to POP3: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	pop3Expect(t, conn, "")
+	return conn
+}
+
+// pop3Expect reads a reply, failing unless it is +OK, and returns its text.
+func pop3Expect(t *testing.T, conn *textproto.Conn, cmd string) string {
+	t.Helper()
+	if cmd != "" {
+		conn.PrintfLine("%s", cmd)
+	}
+	line, err := conn.ReadLine()
+	if err != nil {
+		t.Fatalf("Failed to read reply to %q: %v", cmd, err)
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		t.Fatalf("Expected +OK for %q, got %q", cmd, line)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "+OK"))
+}
+
+func pop3Lines(t *testing.T, conn *textproto.Conn, cmd string) []string {
+	t.Helper()
+	pop3Expect(t, conn, cmd)
+	lines, err := conn.ReadDotLines()
+	if err != nil {
+		t.Fatalf("Failed to read %s listing: %v", cmd, err)
+	}
+	return lines
+}
+
+func TestPOP3(t *testing.T) {
+	server, _ := NewTestServer(t, WithPOP3Port(0))
+	server.Send("sender@example.com", []string{"bounces@example.com"}, []byte("Subject: Bounce\r\n\r\n.leading dot\r\nLine 2\r\n"))
+	server.Send("sender@example.com", []string{"other@example.com"}, []byte("Subject: Other\r\n\r\nBody\r\n"))
+
+	conn := dialPOP3(t, server)
+	pop3Expect(t, conn, "USER bounces@example.com")
+	if got := pop3Expect(t, conn, "PASS anything"); got != "1 messages" {
+		t.Errorf("Expected 1 message for the mailbox, got %q", got)
+	}
+
+	lines := pop3Lines(t, conn, "UIDL")
+	if len(lines) != 1 || lines[0] != "1 "+server.Emails()[0].ID {
+		t.Errorf("Expected the email ID as UIDL, got %q", lines)
+	}
+
+	lines = pop3Lines(t, conn, "RETR 1")
+	if want := []string{"Subject: Bounce", "", ".leading dot", "Line 2"}; strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected message %q, got %q", want, lines)
+	}
+
+	lines = pop3Lines(t, conn, "TOP 1 1")
+	if len(lines) != 3 || lines[2] != ".leading dot" {
+		t.Errorf("Expected header and one line, got %q", lines)
+	}
+
+	pop3Expect(t, conn, "DELE 1")
+	if got := pop3Expect(t, conn, "STAT"); got != "0 0" {
+		t.Errorf("Expected empty mailbox after DELE, got %q", got)
+	}
+	pop3Expect(t, conn, "QUIT")
+
+	emails := server.Emails()
+	if len(emails) != 1 || emails[0].Subject != "Other" {
+		t.Errorf("Expected only the other email to remain, got %d emails", len(emails))
+	}
+}
+
+func TestPOP3AllMail(t *testing.T) {
+	server, _ := NewTestServer(t, WithPOP3Port(0))
+	server.Send("sender@example.com", []string{"a@example.com"}, []byte("Subject: A\r\n\r\nBody\r\n"))
+	server.Send("sender@example.com", []string{"b@example.com"}, []byte("Subject: B\r\n\r\nBody\r\n"))
+
+	conn := dialPOP3(t, server)
+	pop3Expect(t, conn, "USER test")
+	pop3Expect(t, conn, "PASS test")
+	if lines := pop3Lines(t, conn, "LIST"); len(lines) != 2 {
+		t.Errorf("Expected 2 messages, got %q", lines)
+	}
+
+	pop3Expect(t, conn, "DELE 2")
+	pop3Expect(t, conn, "RSET")
+	pop3Expect(t, conn, "QUIT")
+	if count := len(server.Emails()); count != 2 {
+		t.Errorf("Expected RSET to undo DELE, got %d emails", count)
+	}
+}
+
+func TestPOP3Auth(t *testing.T) {
+	server, _ := NewTestServer(t, WithPOP3Port(0), WithAuth("app", "secret"))
+
+	conn := dialPOP3(t, server)
+	pop3Expect(t, conn, "USER app")
+	conn.PrintfLine("PASS wrong")
+	if line, _ := conn.ReadLine(); !strings.HasPrefix(line, "-ERR") {
+		t.Errorf("Expected -ERR for a wrong password, got %q", line)
+	}
+	conn.PrintfLine("STAT")
+	if line, _ := conn.ReadLine(); !strings.HasPrefix(line, "-ERR") {
+		t.Errorf("Expected -ERR before login, got %q", line)
+	}
+
+	pop3Expect(t, conn, "USER app")
+	pop3Expect(t, conn, "PASS secret")
+}
+
+func TestPOP3Disabled(t *testing.T) {
+	server := New(0, 0)
+	if addr := server.POP3Addr(); addr != "" {
+		t.Errorf("Expected no POP3 address by default, got %q", addr)
+	}
+}
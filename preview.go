@@ -0,0 +1,193 @@
+package mailcatcher
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// previewCSP lets a preview load remote images and styles, as mail
+// clients do, but never run scripts.
+const previewCSP = "default-src 'none'; img-src * data:; style-src * 'unsafe-inline'; font-src * data:; media-src * data:"
+
+// droppedElements are removed with their content from previews, as mail
+// clients do.
+var droppedElements = map[string]bool{
+	"script": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "noscript": true,
+}
+
+// urlAttributes hold URLs that may not use a script scheme.
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true,
+	"background": true, "poster": true, "xlink:href": true,
+}
+
+// cssCIDPattern matches cid: URLs in CSS, e.g. url("cid:logo").
+var cssCIDPattern = regexp.MustCompile(`(?i)url\(\s*(['"]?)cid:([^'")\s]+)['"]?\s*\)`)
+
+// PreviewHTML returns the HTML body as a mail client would display it:
+// scripts, frames, plugins and event handlers are removed, script URLs
+// are blanked, and cid: references to inline parts (RFC 2392) are
+// replaced with data: URLs, so the result renders on its own in a
+// browser.
+func (e *Email) PreviewHTML() string {
+	inline := map[string]Part{}
+	for _, p := range e.Parts {
+		if p.ContentID != "" {
+			inline[strings.ToLower(p.ContentID)] = p
+		}
+	}
+	resolve := func(ref string) (string, bool) {
+		id, err := url.PathUnescape(ref)
+		if err != nil {
+			id = ref
+		}
+		p, ok := inline[strings.ToLower(id)]
+		if !ok {
+			return "", false
+		}
+		contentType := p.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(p.Content), true
+	}
+	resolveCSS := func(css string) string {
+		return cssCIDPattern.ReplaceAllStringFunc(css, func(m string) string {
+			sub := cssCIDPattern.FindStringSubmatch(m)
+			if data, ok := resolve(sub[2]); ok {
+				return `url("` + data + `")`
+			}
+			return m
+		})
+	}
+
+	var b strings.Builder
+	skip := 0 // depth inside a dropped element
+	inStyle := false
+	tokens := html.NewTokenizer(strings.NewReader(e.HTML))
+	for tt := tokens.Next(); tt != html.ErrorToken; tt = tokens.Next() {
+		raw := string(tokens.Raw())
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokens.Token()
+			if droppedElements[token.Data] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			// base changes the links, meta http-equiv may redirect
+			if skip > 0 || token.Data == "base" || token.Data == "meta" && hasAttr(token, "http-equiv") {
+				continue
+			}
+			inStyle = token.Data == "style" && tt == html.StartTagToken
+			b.WriteString(sanitizeTag(token, resolve, resolveCSS).String())
+		case html.EndTagToken:
+			name, _ := tokens.TagName()
+			if droppedElements[string(name)] {
+				skip = max(skip-1, 0)
+				continue
+			}
+			if skip == 0 {
+				inStyle = false
+				b.WriteString(raw)
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			if inStyle {
+				raw = resolveCSS(raw)
+			}
+			b.WriteString(raw)
+		default:
+			if skip == 0 {
+				b.WriteString(raw)
+			}
+		}
+	}
+	return b.String()
+}
+
+// sanitizeTag removes event handlers and script URLs from a start tag and
+// resolves its cid: references.
+func sanitizeTag(token html.Token, resolve func(string) (string, bool), resolveCSS func(string) string) html.Token {
+	attrs := token.Attr[:0]
+	for _, attr := range token.Attr {
+		key := strings.ToLower(attr.Key)
+		if strings.HasPrefix(key, "on") {
+			continue
+		}
+		if urlAttributes[key] {
+			val := strings.ToLower(strings.TrimSpace(attr.Val))
+			switch {
+			case strings.HasPrefix(val, "javascript:"), strings.HasPrefix(val, "vbscript:"):
+				attr.Val = ""
+			case strings.HasPrefix(val, "cid:"):
+				if data, ok := resolve(strings.TrimSpace(attr.Val)[len("cid:"):]); ok {
+					attr.Val = data
+				}
+			}
+		}
+		if key == "style" {
+			attr.Val = resolveCSS(attr.Val)
+		}
+		attrs = append(attrs, attr)
+	}
+	token.Attr = attrs
+	return token
+}
+
+func hasAttr(token html.Token, key string) bool {
+	for _, attr := range token.Attr {
+		if strings.EqualFold(attr.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetHTML(w http.ResponseWriter, r *http.Request) {
+	email := s.Email(r.PathValue("id"))
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+	if email.HTML == "" {
+		http.Error(w, "Email has no HTML body", http.StatusNotFound)
+		return
+	}
+
+	preview := email.PreviewHTML()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(preview)))
+	w.Header().Set("Content-Security-Policy", previewCSP)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, _ = w.Write([]byte(preview))
+}
+
+func (s *Server) handleGetText(w http.ResponseWriter, r *http.Request) {
+	email := s.Email(r.PathValue("id"))
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+	if email.Text == "" {
+		http.Error(w, "Email has no text body", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(email.Text)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, _ = w.Write([]byte(email.Text))
+}
@@ -0,0 +1,83 @@
+package mailcatcher
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const previewMessage = "From: shop@example.com\r\nTo: user@example.com\r\nSubject: Sale\r\n" +
+	"MIME-Version: 1.0\r\nContent-Type: multipart/related; boundary=b\r\n\r\n" +
+	"--b\r\nContent-Type: multipart/alternative; boundary=a\r\n\r\n" +
+	"--a\r\nContent-Type: text/plain\r\n\r\n50% off today\r\n" +
+	"--a\r\nContent-Type: text/html\r\n\r\n" +
+	`<html><head><base href="https://evil.example/"><meta http-equiv="refresh" content="0;url=https://evil.example/">` +
+	`<style>.hero { background: url(cid:bg) }</style><script>alert(1)</script></head>` +
+	`<body onload="track()"><img src="cid:logo@example.com" alt="Logo"><p style="background-image: url('cid:bg')">50% off</p>` +
+	`<a href="javascript:alert(2)">Buy</a><a href="https://shop.example/">Shop</a><iframe src="https://ads.example/"><p>ad</p></iframe></body></html>` + "\r\n" +
+	"--a--\r\n" +
+	"--b\r\nContent-Type: image/png\r\nContent-ID: <logo@example.com>\r\nContent-Transfer-Encoding: base64\r\n\r\niVBORw0KGgo=\r\n" +
+	"--b\r\nContent-Type: image/gif\r\nContent-ID: <bg>\r\nContent-Transfer-Encoding: base64\r\n\r\nR0lGODlh\r\n" +
+	"--b--\r\n"
+
+func TestPreviewHTML(t *testing.T) {
+	email := newEmail("shop@example.com", []string{"user@example.com"}, []byte(previewMessage))
+	preview := email.PreviewHTML()
+
+	for _, want := range []string{
+		`<img src="data:image/png;base64,iVBORw0KGgo=" alt="Logo">`,
+		`.hero { background: url("data:image/gif;base64,R0lGODlh") }`,
+		`style="background-image: url(&#34;data:image/gif;base64,R0lGODlh&#34;)"`,
+		`<a href="">Buy</a>`,
+		`<a href="https://shop.example/">Shop</a>`,
+		`<body>`,
+	} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("Expected %q in the preview, got %s", want, preview)
+		}
+	}
+	for _, unwanted := range []string{"<script", "alert(1)", "onload", "<iframe", "ads.example", "<p>ad</p>", "<base", "refresh"} {
+		if strings.Contains(preview, unwanted) {
+			t.Errorf("Expected no %q in the preview, got %s", unwanted, preview)
+		}
+	}
+}
+
+func TestPreviewEndpoints(t *testing.T) {
+	server, _ := NewTestServer(t)
+	if err := server.Send("shop@example.com", []string{"user@example.com"}, []byte(previewMessage)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Plain\r\n\r\nHello\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	base := "http://" + server.HTTPAddr() + "/api/v1/emails/"
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("msg-0/html")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("Expected an HTML preview, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(resp.Header.Get("Content-Security-Policy"), "default-src 'none'") || strings.Contains(body, "<script") {
+		t.Errorf("Expected a script-free preview, got %s", body)
+	}
+	if resp, body := get("msg-0/text"); resp.StatusCode != http.StatusOK || !strings.Contains(body, "50% off today") {
+		t.Errorf("Expected the text body, got %d %q", resp.StatusCode, body)
+	}
+	if resp, _ := get("msg-1/html"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an email without HTML, got %d", resp.StatusCode)
+	}
+	if resp, _ := get("msg-9/text"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing email, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,271 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// Redacted replaces the text matched by a Redact processor.
+const Redacted = "[REDACTED]"
+
+// ErrDiscard is returned by a MessageProcessor to discard a message: the
+// client gets a success reply, but the message is not stored.
+var ErrDiscard = errors.Base("message discarded")
+
+// MessageProcessor transforms each message before it is stored, e.g. to
+// redact personal data, annotate it with computed fields or discard noise
+// like monitoring pings. Processors run in the order they were added, on
+// mail from SMTP, Send and the HTTP API, after the accept checks.
+//
+// Process may change any field of the email. After changing Body, call
+// Reparse so that the headers, bodies and parts match it. Returning
+// ErrDiscard discards the message; any other error refuses it with a
+// temporary failure, so a failing redaction never stores the original.
+type MessageProcessor interface {
+	Process(email *Email) error
+}
+
+// ProcessorFunc adapts a function to a MessageProcessor.
+type ProcessorFunc func(email *Email) error
+
+// Process calls f(email).
+func (f ProcessorFunc) Process(email *Email) error {
+	return f(email)
+}
+
+// AddProcessor adds a MessageProcessor run on every message before it is
+// stored.
+func (s *Server) AddProcessor(p MessageProcessor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processors = append(s.processors, p)
+}
+
+// Redact returns a MessageProcessor replacing every match of the patterns
+// in the message with Redacted. Header values and MIME parts, attachments
+// included, are matched decoded, so encoded words and base64 or
+// quoted-printable content are redacted too; changed parts are encoded
+// again.
+func Redact(patterns ...*regexp.Regexp) MessageProcessor {
+	return ProcessorFunc(func(email *Email) error {
+		body := string(redactEntity([]byte(email.Body), patterns, 0))
+		if body != email.Body {
+			email.Body = body
+			email.Reparse()
+		}
+		return nil
+	})
+}
+
+// redactBytes replaces the matches of patterns in b with Redacted.
+func redactBytes(b []byte, patterns []*regexp.Regexp) []byte {
+	for _, re := range patterns {
+		b = re.ReplaceAllLiteral(b, []byte(Redacted))
+	}
+	return b
+}
+
+// redactEntity redacts a message or MIME part: its header fields, and its
+// content decoded from the transfer encoding, or each part of a multipart
+// body. The line endings of entity are kept.
+func redactEntity(entity []byte, patterns []*regexp.Regexp, depth int) []byte {
+	nl := "\n"
+	if bytes.Contains(entity, []byte("\r\n")) {
+		nl = "\r\n"
+	}
+	head, body := splitEntity(entity)
+	head, header := redactHeader(head, patterns, nl)
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	switch {
+	case depth >= maxMIMEDepth:
+		body = redactBytes(body, patterns)
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		body = redactMultipart(body, params["boundary"], patterns, depth)
+	case mediaType == "message/rfc822":
+		body = redactEntity(body, patterns, depth+1)
+	default:
+		body = redactContent(body, strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))), patterns, nl)
+	}
+	return append(head, body...)
+}
+
+// splitEntity splits a MIME entity after the blank line ending its header.
+func splitEntity(entity []byte) (head, body []byte) {
+	for _, nl := range []string{"\r\n", "\n"} {
+		if bytes.HasPrefix(entity, []byte(nl)) {
+			return entity[:len(nl)], entity[len(nl):]
+		}
+	}
+	crlf := bytes.Index(entity, []byte("\r\n\r\n"))
+	lf := bytes.Index(entity, []byte("\n\n"))
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf < lf):
+		return entity[:crlf+4], entity[crlf+4:]
+	case lf >= 0:
+		return entity[:lf+2], entity[lf+2:]
+	}
+	return entity, nil
+}
+
+// redactHeader redacts the decoded value of each header field in head,
+// rewriting only the fields that change, and returns the header parsed.
+func redactHeader(head []byte, patterns []*regexp.Regexp, nl string) ([]byte, textproto.MIMEHeader) {
+	header := make(textproto.MIMEHeader)
+	var out []byte
+	for _, field := range splitFields(head) {
+		unfolded := strings.NewReplacer("\r", "", "\n", "").Replace(field)
+		name, value, ok := strings.Cut(unfolded, ":")
+		if !ok {
+			out = append(out, field...)
+			continue
+		}
+		value = strings.TrimSpace(value)
+		header.Add(name, value)
+
+		decoded := decodeWord(value)
+		redacted := string(redactBytes([]byte(decoded), patterns))
+		if redacted == decoded {
+			out = append(out, field...)
+			continue
+		}
+		out = append(out, name+": "+encodeWords(redacted)+nl...)
+	}
+	return out, header
+}
+
+// splitFields splits head into its fields, each with its continuation
+// lines and line endings. The blank line ending head is a field of its own.
+func splitFields(head []byte) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(string(head), "\n") {
+		switch {
+		case line == "":
+		case len(fields) > 0 && (line[0] == ' ' || line[0] == '\t'):
+			fields[len(fields)-1] += line
+		default:
+			fields = append(fields, line)
+		}
+	}
+	return fields
+}
+
+// encodeWords encodes the words of a header value that are not ASCII as
+// RFC 2047 encoded words.
+func encodeWords(value string) string {
+	words := strings.Split(value, " ")
+	for i, word := range words {
+		words[i] = mime.QEncoding.Encode("utf-8", word)
+	}
+	return strings.Join(words, " ")
+}
+
+// redactMultipart redacts each part of a multipart body. The preamble
+// and epilogue are redacted as they are.
+func redactMultipart(body []byte, boundary string, patterns []*regexp.Regexp, depth int) []byte {
+	delimiter := "--" + boundary
+	var out []byte
+	start := 0      // of the text not yet copied
+	inPart := false // the text since start is a part
+	for offset := 0; offset < len(body); {
+		end := bytes.IndexByte(body[offset:], '\n')
+		if end < 0 {
+			end = len(body)
+		} else {
+			end += offset + 1
+		}
+		line := strings.TrimRight(string(body[offset:end]), " \t\r\n")
+		if line != delimiter && line != delimiter+"--" {
+			offset = end
+			continue
+		}
+
+		// The line break before a delimiter belongs to it
+		text := body[start:offset]
+		lineBreak := len(text) - len(bytes.TrimSuffix(bytes.TrimSuffix(text, []byte("\n")), []byte("\r")))
+		text = text[:len(text)-lineBreak]
+		if inPart {
+			out = append(out, redactEntity(text, patterns, depth+1)...)
+		} else {
+			out = append(out, redactBytes(text, patterns)...)
+		}
+		out = append(out, body[offset-lineBreak:end]...)
+		start, offset, inPart = end, end, line == delimiter
+	}
+	return append(out, redactBytes(body[start:], patterns)...)
+}
+
+// redactContent redacts the content of a leaf part, decoded from its
+// transfer encoding and encoded again if it changes.
+func redactContent(content []byte, encoding string, patterns []*regexp.Regexp, nl string) []byte {
+	decoded, err := io.ReadAll(decodeTransfer(encoding, bytes.NewReader(content)))
+	if err != nil {
+		return redactBytes(content, patterns)
+	}
+	redacted := redactBytes(decoded, patterns)
+	if bytes.Equal(redacted, decoded) {
+		return content
+	}
+
+	switch encoding {
+	case "base64":
+		encoded := base64.StdEncoding.EncodeToString(redacted)
+		var out []byte
+		for len(encoded) > 76 {
+			out = append(out, encoded[:76]+nl...)
+			encoded = encoded[76:]
+		}
+		return append(out, encoded+nl...)
+	case "quoted-printable":
+		var out bytes.Buffer
+		w := quotedprintable.NewWriter(&out)
+		_, _ = w.Write(redacted)
+		_ = w.Close()
+		return []byte(strings.ReplaceAll(out.String(), "\r\n", nl))
+	}
+	return redacted
+}
+
+// Reparse parses Body again, updating the fields read from the message
+// headers and content. The envelope, Size and the delivery details are
+// kept.
+func (e *Email) Reparse() {
+	parsed := newEmail(e.Envelope.From, e.Envelope.To, []byte(e.Body))
+	e.From, e.To, e.Cc, e.Bcc = parsed.From, parsed.To, parsed.Cc, parsed.Bcc
+	e.ToGroups, e.CcGroups = parsed.ToGroups, parsed.CcGroups
+	e.Subject, e.ReplyTo, e.MessageID, e.Date = parsed.Subject, parsed.ReplyTo, parsed.MessageID, parsed.Date
+	e.Headers = parsed.Headers
+	e.Text, e.HTML = parsed.Text, parsed.HTML
+	e.Parts, e.Attachments = parsed.Parts, parsed.Attachments
+}
+
+// process runs the processors on email. It reports false if a processor
+// discarded it.
+func (s *Server) process(email *Email) (bool, error) {
+	s.mu.RLock()
+	processors := s.processors
+	s.mu.RUnlock()
+
+	for _, p := range processors {
+		err := p.Process(email)
+		if errors.Is(err, ErrDiscard) {
+			s.logger().Info("Discarded message", "from", email.From.Address, "to", email.Envelope.To, "size", email.Size)
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("failed to process message: %w", err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,131 @@
+package mailcatcher
+
+import (
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestProcessorRedact(t *testing.T) {
+	server := New(0, 0)
+	server.AddProcessor(Redact(regexp.MustCompile(`[0-9]{4}(-[0-9]{4}){3}`), regexp.MustCompile(`jane@customer\.com`)))
+
+	msg := "From: app@example.com\r\nTo: jane@customer.com\r\nSubject: Receipt\r\n\r\nCard 4111-1111-1111-1111 charged.\r\n"
+	if err := server.Send("app@example.com", []string{"jane@customer.com"}, []byte(msg)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	email := server.Emails()[0]
+	if strings.Contains(email.Body, "4111") || strings.Contains(email.Body, "jane@customer.com") {
+		t.Errorf("Expected the body to be redacted, got %q", email.Body)
+	}
+	if email.Text != "Card [REDACTED] charged.\r\n" {
+		t.Errorf("Expected the text to be reparsed, got %q", email.Text)
+	}
+	if len(email.To) != 1 || email.To[0].Address != Redacted {
+		t.Errorf("Expected the To header to be redacted, got %+v", email.To)
+	}
+}
+
+func TestProcessorRedactEncoded(t *testing.T) {
+	card := "4111111111111111"
+	encoded := base64.StdEncoding.EncodeToString([]byte("Card: " + card))
+	attachment := base64.StdEncoding.EncodeToString([]byte("name,card\njane," + card + "\n"))
+	for name, msg := range map[string]string{
+		"base64":           "Subject: Receipt\r\nContent-Transfer-Encoding: base64\r\n\r\n" + encoded + "\r\n",
+		"quoted-printable": "Subject: Receipt\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nCard: 41111111=\r\n11111111\r\n",
+		"encoded word":     "Subject: =?utf-8?b?" + base64.StdEncoding.EncodeToString([]byte("Card "+card+" – ok")) + "?=\r\n\r\nCard on file\r\n",
+		"multipart": "Subject: Receipt\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b1\r\n\r\n" +
+			"--b1\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n" + encoded + "\r\n" +
+			"--b1\r\nContent-Type: text/csv\r\nContent-Disposition: attachment; filename=cards.csv\r\nContent-Transfer-Encoding: base64\r\n\r\n" + attachment + "\r\n" +
+			"--b1--\r\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := New(0, 0)
+			server.AddProcessor(Redact(regexp.MustCompile(`[0-9]{16}`)))
+			if err := server.Send("app@example.com", []string{"jane@customer.com"}, []byte(msg)); err != nil {
+				t.Fatalf("Failed to send: %v", err)
+			}
+
+			email := server.Emails()[0]
+			if strings.Contains(email.Body, encoded) || strings.Contains(email.Body, attachment) {
+				t.Errorf("Expected the encoded content to be replaced, got %q", email.Body)
+			}
+			found := []string{email.Text, decodeWord(email.Subject)}
+			for _, part := range email.Parts {
+				found = append(found, string(part.Content))
+			}
+			for _, a := range email.Attachments {
+				found = append(found, string(a.Content))
+			}
+			for _, text := range found {
+				if strings.Contains(text, card) {
+					t.Errorf("Expected the card number to be redacted, got %q", text)
+				}
+			}
+			if name == "encoded word" && decodeWord(email.Subject) != "Card "+Redacted+" – ok" {
+				t.Errorf("Expected the subject to be redacted and encoded again, got %q", email.Subject)
+			}
+			if name != "encoded word" && !strings.Contains(email.Text, "Card: "+Redacted) {
+				t.Errorf("Expected the redacted text, got %q", email.Text)
+			}
+			if name == "multipart" && (len(email.Attachments) != 1 || string(email.Attachments[0].Content) != "name,card\njane,"+Redacted+"\n") {
+				t.Errorf("Expected the redacted attachment, got %+v", email.Attachments)
+			}
+		})
+	}
+}
+
+func TestProcessorAnnotateAndDiscard(t *testing.T) {
+	server, addr := NewTestServer(t)
+	server.AddProcessor(ProcessorFunc(func(email *Email) error {
+		if email.Subject == "Healthcheck" {
+			return ErrDiscard
+		}
+		email.Annotations = map[string]string{"tenant": email.Header("X-Tenant")}
+		return nil
+	}))
+
+	if codes := sendMessage(t, addr, "Subject: Healthcheck\r\n\r\nping\r\n."); codes != 250 {
+		t.Errorf("Expected a discarded message to be accepted, got %d", codes)
+	}
+	if codes := sendMessage(t, addr, "Subject: Welcome\r\nX-Tenant: acme\r\n\r\nHello\r\n."); codes != 250 {
+		t.Errorf("Expected the message to be accepted, got %d", codes)
+	}
+
+	emails := server.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+	if emails[0].Annotations["tenant"] != "acme" {
+		t.Errorf("Expected the tenant annotation, got %v", emails[0].Annotations)
+	}
+}
+
+func TestProcessorError(t *testing.T) {
+	server, addr := NewTestServer(t)
+	server.AddProcessor(ProcessorFunc(func(*Email) error { return errors.New("scrubber unavailable") }))
+
+	if code := sendMessage(t, addr, "Subject: Secret\r\n\r\nHello\r\n."); code != 451 {
+		t.Errorf("Expected 451, got %d", code)
+	}
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Secret\r\n\r\nHello\r\n")); err == nil {
+		t.Error("Expected Send to fail")
+	}
+	if n := len(server.Emails()); n != 0 {
+		t.Errorf("Expected no stored emails, got %d", n)
+	}
+}
+
+// sendMessage sends data on a new connection and returns the reply to it.
+func sendMessage(t *testing.T, addr, data string) int {
+	t.Helper()
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+	for _, cmd := range []string{"EHLO client.example.com", "MAIL FROM:<app@example.com>", "RCPT TO:<user@example.com>", "DATA"} {
+		smtpCommand(t, conn, "%s", cmd)
+	}
+	return smtpCommand(t, conn, "%s", data)
+}
@@ -0,0 +1,173 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Rejections holds the replies the server gives when it refuses mail.
+// A nil field keeps the default reply.
+type Rejections struct {
+	MailboxFull       *smtp.SMTPError `json:"mailbox_full,omitempty"`
+	MessageTooLarge   *smtp.SMTPError `json:"message_too_large,omitempty"`
+	TooManyRecipients *smtp.SMTPError `json:"too_many_recipients,omitempty"`
+}
+
+// Profile bundles the capabilities, limits and rejection phrasing of a
+// kind of mail server, so the catcher can behave like the provider an
+// application ships against. Zero limits mean no limit.
+type Profile struct {
+	Name string `json:"name"`
+
+	// Domain is the hostname announced in the greeting and EHLO reply.
+	Domain string `json:"domain"`
+
+	EnableSMTPUTF8   bool `json:"enable_smtputf8"`
+	EnableDSN        bool `json:"enable_dsn"`
+	EnableBINARYMIME bool `json:"enable_binarymime"`
+	EnableREQUIRETLS bool `json:"enable_requiretls"`
+
+	MaxMessageBytes int64         `json:"max_message_bytes"`
+	MaxRecipients   int           `json:"max_recipients"`
+	MaxLineLength   int           `json:"max_line_length"`
+	ReadTimeout     time.Duration `json:"read_timeout"`
+	WriteTimeout    time.Duration `json:"write_timeout"`
+
+	Rejections Rejections `json:"rejections"`
+}
+
+// Built-in profile names.
+const (
+	ProfileStrictMSA     = "strict-msa"
+	ProfilePermissiveMTA = "permissive-mta"
+	ProfileGmail         = "gmail-like"
+	ProfileOffice365     = "office365-like"
+)
+
+// defaultMaxLineLength allows the very long lines of generated HTML email.
+const defaultMaxLineLength = 16 * 1024 * 1024
+
+var profiles = map[string]Profile{
+	// A submission server enforcing RFC limits to the letter
+	ProfileStrictMSA: {
+		Name:            ProfileStrictMSA,
+		Domain:          "submission.localhost",
+		MaxMessageBytes: 10 * 1024 * 1024,
+		MaxRecipients:   100,
+		MaxLineLength:   1000, // 998 characters plus CRLF (RFC 5322)
+		ReadTimeout:     5 * time.Minute,
+		WriteTimeout:    5 * time.Minute,
+	},
+	// Accept anything, advertising every supported extension
+	ProfilePermissiveMTA: {
+		Name:             ProfilePermissiveMTA,
+		Domain:           "localhost",
+		EnableSMTPUTF8:   true,
+		EnableDSN:        true,
+		EnableBINARYMIME: true,
+		MaxLineLength:    defaultMaxLineLength,
+	},
+	ProfileGmail: {
+		Name:            ProfileGmail,
+		Domain:          "mx.google.com",
+		EnableSMTPUTF8:  true,
+		MaxMessageBytes: 35882577,
+		MaxRecipients:   100,
+		MaxLineLength:   defaultMaxLineLength,
+		ReadTimeout:     5 * time.Minute,
+		Rejections: Rejections{
+			MailboxFull:       mustProviderReply(ProviderGmail, ReplyMailboxFull),
+			MessageTooLarge:   mustProviderReply(ProviderGmail, ReplyMessageTooLarge),
+			TooManyRecipients: mustProviderReply(ProviderGmail, ReplyTooManyRecipients),
+		},
+	},
+	ProfileOffice365: {
+		Name:            ProfileOffice365,
+		Domain:          "mail.protection.outlook.com",
+		EnableSMTPUTF8:  true,
+		EnableDSN:       true,
+		MaxMessageBytes: 37748736,
+		MaxRecipients:   500,
+		MaxLineLength:   defaultMaxLineLength,
+		ReadTimeout:     10 * time.Minute,
+		Rejections: Rejections{
+			MailboxFull:       mustProviderReply(ProviderOffice365, ReplyMailboxFull),
+			MessageTooLarge:   mustProviderReply(ProviderOffice365, ReplyMessageTooLarge),
+			TooManyRecipients: mustProviderReply(ProviderOffice365, ReplyTooManyRecipients),
+		},
+	},
+}
+
+// LookupProfile returns the built-in profile with the given name.
+func LookupProfile(name string) (Profile, error) {
+	p, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q (available: %v)", name, ProfileNames())
+	}
+	return p, nil
+}
+
+// ProfileNames returns the names of the built-in profiles.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetProfile makes the server behave according to p.
+// It must be called before Start.
+func (s *Server) SetProfile(p Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.smtpServer.Domain = p.Domain
+	ext := s.extensions
+	ext.SMTPUTF8 = p.EnableSMTPUTF8
+	ext.DSN = p.EnableDSN
+	ext.BinaryMIME = p.EnableBINARYMIME
+	ext.RequireTLS = p.EnableREQUIRETLS
+	s.setExtensions(ext)
+	s.smtpServer.MaxMessageBytes = p.MaxMessageBytes
+	s.smtpServer.MaxLineLength = p.MaxLineLength
+	s.smtpServer.ReadTimeout = p.ReadTimeout
+	s.smtpServer.WriteTimeout = p.WriteTimeout
+
+	// Recipients are limited by the session rather than go-smtp so the
+	// rejection can use the profile's phrasing
+	s.maxRecipients = p.MaxRecipients
+	s.rejections = p.Rejections
+}
+
+// rejection returns the configured reply, falling back to def.
+func (s *Server) rejection(configured func(Rejections) *smtp.SMTPError, def *smtp.SMTPError) *smtp.SMTPError {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := configured(s.rejections); err != nil {
+		return err
+	}
+	return def
+}
+
+// checkRecipients refuses another recipient once the limit is reached.
+func (s *Server) checkRecipients(count int) error {
+	s.mu.RLock()
+	limit := s.maxRecipients
+	s.mu.RUnlock()
+
+	if limit <= 0 || count < limit {
+		return nil
+	}
+	s.limits.recipients.Add(1)
+	return s.rejection(func(r Rejections) *smtp.SMTPError { return r.TooManyRecipients }, &smtp.SMTPError{
+		Code:         ErrTooManyRecipients.Code,
+		EnhancedCode: ErrTooManyRecipients.EnhancedCode,
+		Message:      fmt.Sprintf("%s (maximum %d)", ErrTooManyRecipients.Message, limit),
+	})
+}
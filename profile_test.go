@@ -0,0 +1,83 @@
+package mailcatcher
+
+import (
+	"context"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfile(t *testing.T) {
+	profile, err := LookupProfile(ProfileGmail)
+	if err != nil {
+		t.Fatalf("Failed to look up profile: %v", err)
+	}
+	profile.MaxRecipients = 2
+	profile.MaxMessageBytes = 200
+
+	server := New(10044, 10099)
+	server.SetProfile(profile)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := textproto.Dial("tcp", "localhost:10044")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	_, greeting, err := conn.ReadResponse(220)
+	if err != nil || !strings.HasPrefix(greeting, "mx.google.com") {
+		t.Errorf("Expected greeting from mx.google.com, got %q (%v)", greeting, err)
+	}
+
+	smtpCommand(t, conn, "EHLO client.example.com")
+	smtpCommand(t, conn, "MAIL FROM:<sender@example.com>")
+	smtpCommand(t, conn, "RCPT TO:<a@example.com>")
+	smtpCommand(t, conn, "RCPT TO:<b@example.com>")
+
+	id, _ := conn.Cmd("RCPT TO:<c@example.com>")
+	conn.StartResponse(id)
+	code, msg, _ := conn.ReadResponse(0)
+	conn.EndResponse(id)
+	if code != 452 || !strings.Contains(msg, "too many recipients") {
+		t.Errorf("Expected Gmail-style 452 too many recipients, got %d %s", code, msg)
+	}
+
+	if code := smtpCommand(t, conn, "DATA"); code != 354 {
+		t.Fatalf("Expected 354 for DATA, got %d", code)
+	}
+	w := conn.DotWriter()
+	w.Write([]byte("Subject: Big\r\n\r\n" + strings.Repeat("x", 500) + "\r\n"))
+	w.Close()
+	code, msg, _ = conn.ReadResponse(0)
+	if code != 552 || !strings.Contains(msg, "Google's message size limits") {
+		t.Errorf("Expected Gmail-style 552 size error, got %d %s", code, msg)
+	}
+
+	if len(server.Emails()) != 0 {
+		t.Errorf("Expected oversized message to be refused, got %d emails", len(server.Emails()))
+	}
+}
+
+func TestLookupProfile(t *testing.T) {
+	for _, name := range ProfileNames() {
+		p, err := LookupProfile(name)
+		if err != nil || p.Name != name {
+			t.Errorf("Expected profile %s, got %+v (%v)", name, p, err)
+		}
+	}
+
+	if _, err := LookupProfile("sendmail-1983"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+}
@@ -0,0 +1,286 @@
+package mailcatcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout bounds reading the PROXY protocol header.
+const proxyHeaderTimeout = 10 * time.Second
+
+// proxyV2Signature starts a PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// TrustedProxies are the load balancers in front of the server. Mail and
+// requests passing through them are attributed to the real client, so
+// Email.RemoteAddr, SPF checks and the per-IP rate limits use the source
+// address rather than the proxy's.
+type TrustedProxies struct {
+	// Networks are the IPs or CIDR networks of the proxies, e.g.
+	// 10.0.0.0/8. Connections from elsewhere are taken as they are.
+	Networks []string `json:"networks"`
+
+	// ProxyProtocol requires SMTP connections from the proxies to begin
+	// with a HAProxy PROXY protocol v1 or v2 header. Connections without
+	// one are closed.
+	ProxyProtocol bool `json:"proxy_protocol,omitempty"`
+
+	// ForwardedFor takes the client of HTTP requests from the proxies
+	// from their X-Forwarded-For header.
+	ForwardedFor bool `json:"forwarded_for,omitempty"`
+}
+
+// proxyState is the parsed TrustedProxies.
+type proxyState struct {
+	config   TrustedProxies
+	networks []*net.IPNet
+}
+
+// SetTrustedProxies sets the load balancers whose client addresses are
+// used instead of their own. A zero TrustedProxies removes them.
+func (s *Server) SetTrustedProxies(p TrustedProxies) error {
+	if (p.ProxyProtocol || p.ForwardedFor) && len(p.Networks) == 0 {
+		return fmt.Errorf("invalid trusted proxies: no networks")
+	}
+	networks := make([]*net.IPNet, 0, len(p.Networks))
+	for _, network := range p.Networks {
+		network = strings.TrimSpace(network)
+		if ip := net.ParseIP(network); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: expected an IP or CIDR network", network)
+		}
+		networks = append(networks, ipNet)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proxies = proxyState{config: p, networks: networks}
+	return nil
+}
+
+// TrustedProxies returns the load balancers set by SetTrustedProxies.
+func (s *Server) TrustedProxies() TrustedProxies {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.proxies.config
+}
+
+// trusted reports whether ip is one of the proxies.
+func (p proxyState) trusted(ip net.IP) bool {
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyListener reads the PROXY protocol header of connections from
+// trusted proxies. Headers are read concurrently, so a slow proxy does not
+// hold up other connections.
+type proxyListener struct {
+	net.Listener
+	server *Server
+	once   sync.Once
+	conns  chan net.Conn
+	done   chan struct{} // closed when Accept of the listener fails
+	err    error
+}
+
+func newProxyListener(l net.Listener, s *Server) *proxyListener {
+	return &proxyListener{Listener: l, server: s, conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { go l.acceptLoop() })
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *proxyListener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			close(l.done)
+			return
+		}
+		go l.handshake(c)
+	}
+}
+
+// handshake passes c on to Accept, with the client address of its PROXY
+// protocol header if it comes from a trusted proxy.
+func (l *proxyListener) handshake(c net.Conn) {
+	l.server.mu.RLock()
+	proxies := l.server.proxies
+	l.server.mu.RUnlock()
+
+	if proxies.config.ProxyProtocol && proxies.trusted(remoteIP(c.RemoteAddr().String())) {
+		proxied, err := readProxyHeader(c)
+		if err != nil {
+			l.server.infof("Closing connection from %s: %v", c.RemoteAddr(), err)
+			_ = c.Close()
+			return
+		}
+		c = proxied
+	}
+
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		_ = c.Close()
+	}
+}
+
+// proxyConn is a connection whose client address was read from a PROXY
+// protocol header.
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// readProxyHeader reads the PROXY protocol v1 or v2 header starting c. A
+// header without a client address, such as a health check, keeps the
+// address of the proxy.
+func readProxyHeader(c net.Conn) (net.Conn, error) {
+	_ = c.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer func() { _ = c.SetReadDeadline(time.Time{}) }()
+
+	r := bufio.NewReader(c)
+	start, err := r.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY header: %w", err)
+	}
+	var remote net.Addr
+	if start[0] == proxyV2Signature[0] {
+		remote, err = readProxyV2(r)
+	} else {
+		remote, err = readProxyV1(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if remote == nil {
+		remote = c.RemoteAddr()
+	}
+	return &proxyConn{Conn: c, r: r, remote: remote}, nil
+}
+
+// readProxyV1 reads a header like "PROXY TCP4 192.0.2.1 198.51.100.1
+// 56324 25\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 { // the longest v1 header
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PROXY header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok || !strings.HasPrefix(text, "PROXY ") {
+		return nil, fmt.Errorf("invalid PROXY header %q", line)
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY header %q", text)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("invalid PROXY header %q", text)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 reads a binary header.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY header: %w", err)
+	}
+	if !bytes.Equal(header[:12], proxyV2Signature) || header[12]>>4 != 2 {
+		return nil, fmt.Errorf("invalid PROXY v2 header")
+	}
+	addrs := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, addrs); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY header: %w", err)
+	}
+
+	if header[12]&0xf == 0 {
+		return nil, nil // LOCAL, sent by the proxy itself
+	}
+	switch family := header[13] >> 4; {
+	case family == 1 && len(addrs) >= 12:
+		return &net.TCPAddr{IP: net.IP(addrs[:4]), Port: int(binary.BigEndian.Uint16(addrs[8:]))}, nil
+	case family == 2 && len(addrs) >= 36:
+		return &net.TCPAddr{IP: net.IP(addrs[:16]), Port: int(binary.BigEndian.Uint16(addrs[32:]))}, nil
+	}
+	return nil, nil // UNSPEC or a Unix socket
+}
+
+// forwardedFor replaces the client address of HTTP requests from trusted
+// proxies with the one in X-Forwarded-For: the last address not itself of
+// a proxy.
+func (s *Server) forwardedFor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		proxies := s.proxies
+		s.mu.RUnlock()
+
+		if !proxies.config.ForwardedFor || !proxies.trusted(remoteIP(r.RemoteAddr)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		addrs := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(addrs[i]))
+			if ip == nil {
+				break
+			}
+			r.RemoteAddr = ip.String()
+			if !proxies.trusted(ip) {
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
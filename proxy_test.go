@@ -0,0 +1,144 @@
+package mailcatcher
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+// sendProxied sends a message on a new connection that begins with header
+// and returns the stored email.
+func sendProxied(t *testing.T, server *Server, addr string, header []byte) Email {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if _, err := c.Write(header); err != nil {
+		t.Fatalf("Failed to write PROXY header: %v", err)
+	}
+	conn := textproto.NewConn(c)
+	defer conn.Close()
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		t.Fatalf("Failed to read greeting: %v", err)
+	}
+	for _, cmd := range []string{"EHLO client.example.com", "MAIL FROM:<app@example.com>", "RCPT TO:<user@example.com>", "DATA", "Subject: Proxied\r\n\r\nBody\r\n."} {
+		smtpCommand(t, conn, "%s", cmd)
+	}
+
+	emails := server.Emails()
+	if len(emails) == 0 {
+		t.Fatal("Expected the email to be captured")
+	}
+	return emails[len(emails)-1]
+}
+
+func TestProxyProtocolV1(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetTrustedProxies(TrustedProxies{Networks: []string{"127.0.0.1"}, ProxyProtocol: true}); err != nil {
+		t.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+
+	email := sendProxied(t, server, addr, []byte("PROXY TCP4 203.0.113.7 127.0.0.1 5555 25\r\n"))
+	if email.RemoteAddr != "203.0.113.7:5555" {
+		t.Errorf("Expected the client address 203.0.113.7:5555, got %s", email.RemoteAddr)
+	}
+
+	// Health checks keep the address of the proxy
+	email = sendProxied(t, server, addr, []byte("PROXY UNKNOWN\r\n"))
+	if ip := remoteIP(email.RemoteAddr); !ip.IsLoopback() {
+		t.Errorf("Expected the proxy address, got %s", email.RemoteAddr)
+	}
+}
+
+func TestProxyProtocolV2(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetTrustedProxies(TrustedProxies{Networks: []string{"127.0.0.0/8"}, ProxyProtocol: true}); err != nil {
+		t.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x21, 0x21) // v2 PROXY, TCP over IPv6
+	header = binary.BigEndian.AppendUint16(header, 36)
+	header = append(header, net.ParseIP("2001:db8::7")...)
+	header = append(header, net.ParseIP("::1")...)
+	header = binary.BigEndian.AppendUint16(header, 5555)
+	header = binary.BigEndian.AppendUint16(header, 25)
+
+	email := sendProxied(t, server, addr, header)
+	if email.RemoteAddr != "[2001:db8::7]:5555" {
+		t.Errorf("Expected the client address [2001:db8::7]:5555, got %s", email.RemoteAddr)
+	}
+}
+
+func TestProxyProtocolRequired(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetTrustedProxies(TrustedProxies{Networks: []string{"127.0.0.1"}, ProxyProtocol: true}); err != nil {
+		t.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("EHLO client.example.com\r\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := c.Read(make([]byte, 64)); err == nil {
+		t.Errorf("Expected the connection to be closed, got %d bytes", n)
+	}
+
+	// Connections from elsewhere need no header
+	if err := server.SetTrustedProxies(TrustedProxies{Networks: []string{"192.0.2.0/24"}, ProxyProtocol: true}); err != nil {
+		t.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+	if code := smtpCommand(t, conn, "EHLO client.example.com"); code != 250 {
+		t.Errorf("Expected 250, got %d", code)
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	server := New(0, 0)
+	if err := server.SetTrustedProxies(TrustedProxies{Networks: []string{"10.0.0.0/8"}, ForwardedFor: true}); err != nil {
+		t.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+	var remote string
+	handler := server.forwardedFor(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { remote = r.RemoteAddr }))
+
+	for _, tt := range []struct {
+		from, forwarded, want string
+	}{
+		{"10.0.0.1:4000", "198.51.100.9, 10.0.0.2", "198.51.100.9"},
+		{"10.0.0.1:4000", "203.0.113.1, 198.51.100.9", "198.51.100.9"}, // only the last hop is trusted
+		{"192.0.2.1:4000", "198.51.100.9", "192.0.2.1:4000"},           // not from a proxy
+		{"10.0.0.1:4000", "", "10.0.0.1:4000"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/emails", nil)
+		r.RemoteAddr = tt.from
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if remote != tt.want {
+			t.Errorf("Expected %s for %s via %q, got %s", tt.want, tt.from, tt.forwarded, remote)
+		}
+	}
+}
+
+func TestSetTrustedProxiesInvalid(t *testing.T) {
+	server := New(0, 0)
+	if err := server.SetTrustedProxies(TrustedProxies{ProxyProtocol: true}); err == nil {
+		t.Error("Expected an error without networks")
+	}
+	if err := server.SetTrustedProxies(TrustedProxies{Networks: []string{"10.0.0.0/33"}, ForwardedFor: true}); err == nil {
+		t.Error("Expected an error for an invalid network")
+	}
+}
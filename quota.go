@@ -0,0 +1,106 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Quota limits how much mail a single recipient mailbox may hold.
+// Recipients over quota are refused with 452 4.2.2 "mailbox full", the
+// temporary failure real servers use, so senders are expected to retry.
+type Quota struct {
+	// Messages is the maximum number of messages, or 0 for no limit.
+	Messages int
+	// Bytes is the maximum total size of messages, or 0 for no limit.
+	Bytes int64
+}
+
+// SetQuota sets the default quota applied to every recipient.
+func (s *Server) SetQuota(q Quota) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quota = q
+}
+
+// SetMailboxQuota overrides the default quota for one recipient address.
+func (s *Server) SetMailboxQuota(addr string, q Quota) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mailboxQuotas == nil {
+		s.mailboxQuotas = make(map[string]Quota)
+	}
+	s.mailboxQuotas[strings.ToLower(addr)] = q
+}
+
+// quotaFor returns the quota applying to a recipient.
+func (s *Server) quotaFor(rcpt string) Quota {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if q, ok := s.mailboxQuotas[strings.ToLower(rcpt)]; ok {
+		return q
+	}
+	return s.quota
+}
+
+// mailboxUsage returns the number and total size of stored messages
+// delivered to rcpt, including held ones.
+func (s *Server) mailboxUsage(rcpt string) (messages int, bytes int64, err error) {
+	emails, err := s.listByRecipient(rcpt)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i := range emails {
+		if emails[i].deliveredTo(rcpt) {
+			messages++
+			bytes += int64(len(emails[i].Body))
+		}
+	}
+	return messages, bytes, nil
+}
+
+// checkQuota returns a 452 error if delivering size more bytes to rcpt
+// would exceed its quota. A size of 0 checks whether the mailbox is full.
+func (s *Server) checkQuota(rcpt string, size int64) error {
+	q := s.quotaFor(rcpt)
+	if q.Messages <= 0 && q.Bytes <= 0 {
+		return nil
+	}
+
+	messages, bytes, err := s.mailboxUsage(rcpt)
+	if err != nil {
+		return fmt.Errorf("failed to check quota: %w", err)
+	}
+
+	full := q.Messages > 0 && messages >= q.Messages
+	if q.Bytes > 0 && (bytes >= q.Bytes || bytes+size > q.Bytes) {
+		full = true
+	}
+	if !full {
+		return nil
+	}
+
+	return s.rejection(func(r Rejections) *smtp.SMTPError { return r.MailboxFull }, &smtp.SMTPError{
+		Code:         452,
+		EnhancedCode: smtp.EnhancedCode{4, 2, 2},
+		Message:      fmt.Sprintf("Mailbox full: %s", rcpt),
+	})
+}
+
+// deliveredTo reports whether the email was delivered to addr, by
+// envelope when known and by headers otherwise.
+func (e *Email) deliveredTo(addr string) bool {
+	if e.Envelope.To == nil {
+		return e.HasRecipient(addr)
+	}
+	for _, to := range e.Envelope.To {
+		if parseAddress(to).Matches(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package mailcatcher
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuota(t *testing.T) {
+	server := New(10041, 10096)
+	server.SetQuota(Quota{Messages: 1})
+	server.SetMailboxQuota("big@example.com", Quota{Bytes: 100})
+
+	err := server.Start()
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	send := func(to string, body string) error {
+		msg := []byte("Subject: Quota\r\n\r\n" + body + "\r\n")
+		return smtp.SendMail("localhost:10041", nil, "sender@example.com", []string{to}, msg)
+	}
+
+	if err := send("user@example.com", "first"); err != nil {
+		t.Fatalf("Failed to send first email: %v", err)
+	}
+
+	err = send("user@example.com", "second")
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code != 452 {
+		t.Fatalf("Expected 452 mailbox full, got %v", err)
+	}
+	if !strings.Contains(tpErr.Msg, "Mailbox full") {
+		t.Errorf("Expected 'Mailbox full' message, got '%s'", tpErr.Msg)
+	}
+
+	// Other recipients are unaffected
+	if err := send("other@example.com", "first"); err != nil {
+		t.Errorf("Expected other mailbox to accept mail, got %v", err)
+	}
+
+	// Byte quota is enforced against the actual message size
+	if err := send("big@example.com", "small"); err != nil {
+		t.Errorf("Expected small message within byte quota, got %v", err)
+	}
+	err = send("big@example.com", strings.Repeat("x", 200))
+	if !errors.As(err, &tpErr) || tpErr.Code != 452 {
+		t.Errorf("Expected 452 for message over byte quota, got %v", err)
+	}
+
+	// Clearing frees the mailbox
+	server.Clear()
+	if err := send("user@example.com", "again"); err != nil {
+		t.Errorf("Expected mail accepted after clear, got %v", err)
+	}
+}
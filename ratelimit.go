@@ -0,0 +1,253 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+// defaultRateWindow is the RateLimit window used when only
+// MessagesPerIP is set.
+const defaultRateWindow = time.Minute
+
+// rejectTimeout bounds writing the reply to a connection over the limit.
+const rejectTimeout = 10 * time.Second
+
+// RateLimit limits connections and message rates like production mail
+// servers do, so the backoff and retry logic of a sender can be tested.
+// Connections over a limit are greeted with 421 4.7.0 and closed, a
+// client over a message rate is refused with 451 4.7.1 at MAIL FROM.
+type RateLimit struct {
+	// MaxConnections is the maximum number of open SMTP connections, on
+	// all listeners together, or 0 for no limit.
+	MaxConnections int `json:"max_connections,omitempty"`
+	// MaxConnectionsPerIP is the maximum number of open SMTP connections
+	// from one client IP, or 0 for no limit.
+	MaxConnectionsPerIP int `json:"max_connections_per_ip,omitempty"`
+	// MaxMessagesPerConnection is the number of messages a connection may
+	// send. The next MAIL FROM is answered with 421 4.7.0 and the
+	// connection closed. 0 means no limit.
+	MaxMessagesPerConnection int `json:"max_messages_per_connection,omitempty"`
+	// MessagesPerIP is the number of messages one client IP may send per
+	// Window, or 0 for no limit.
+	MessagesPerIP int `json:"messages_per_ip,omitempty"`
+	// Window is the sliding window of MessagesPerIP, one minute if 0.
+	Window time.Duration `json:"window,omitempty"`
+}
+
+var (
+	errTooManyConnections = &smtp.SMTPError{
+		Code:         421,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 0},
+		Message:      "Too many connections, try again later",
+	}
+	errRateLimited = &smtp.SMTPError{
+		Code:         451,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+		Message:      "Rate limit exceeded, try again later",
+	}
+)
+
+// SetRateLimit sets the connection and message rate limits.
+func (s *Server) SetRateLimit(r RateLimit) error {
+	if r.MaxConnections < 0 || r.MaxConnectionsPerIP < 0 || r.MaxMessagesPerConnection < 0 || r.MessagesPerIP < 0 || r.Window < 0 {
+		return fmt.Errorf("invalid rate limit %+v: limits must not be negative", r)
+	}
+	if r.Window == 0 {
+		r.Window = defaultRateWindow
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimit = r
+	return nil
+}
+
+// RateLimit returns the connection and message rate limits.
+func (s *Server) RateLimit() RateLimit {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rateLimit
+}
+
+// limiter counts the open connections and recent messages per client IP.
+type limiter struct {
+	mu          sync.Mutex
+	connections int
+	perIP       map[string]int
+	sent        map[string][]time.Time // reservation times within the window
+}
+
+// acquire counts a new connection from ip, or reports false if it would
+// exceed r.
+func (l *limiter) acquire(ip string, r RateLimit) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r.MaxConnections > 0 && l.connections >= r.MaxConnections {
+		return false
+	}
+	if r.MaxConnectionsPerIP > 0 && l.perIP[ip] >= r.MaxConnectionsPerIP {
+		return false
+	}
+	if l.perIP == nil {
+		l.perIP = make(map[string]int)
+	}
+	l.connections++
+	l.perIP[ip]++
+	return true
+}
+
+// release uncounts a connection from ip.
+func (l *limiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.connections--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// reserve counts a message from ip if another is allowed under r, and
+// returns the time it is counted at, or zero without a message rate. The
+// check and the count are one step, so concurrent connections from ip
+// cannot exceed MessagesPerIP together.
+func (l *limiter) reserve(ip string, r RateLimit, now time.Time) (time.Time, bool) {
+	if r.MessagesPerIP <= 0 {
+		return time.Time{}, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire(ip, now.Add(-r.Window))
+	if len(l.sent[ip]) >= r.MessagesPerIP {
+		return time.Time{}, false
+	}
+	if l.sent == nil {
+		l.sent = make(map[string][]time.Time)
+	}
+	l.sent[ip] = append(l.sent[ip], now)
+	return now, true
+}
+
+// cancel uncounts a message from ip reserved at the given time.
+func (l *limiter) cancel(ip string, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	times := l.sent[ip]
+	if i := slices.Index(times, at); i >= 0 {
+		l.sent[ip] = slices.Delete(times, i, i+1)
+	}
+	if len(l.sent[ip]) == 0 {
+		delete(l.sent, ip)
+	}
+}
+
+// expire forgets the messages from ip accepted before since.
+func (l *limiter) expire(ip string, since time.Time) {
+	times := l.sent[ip]
+	i := 0
+	for i < len(times) && !times[i].After(since) {
+		i++
+	}
+	if i == len(times) {
+		delete(l.sent, ip)
+		return
+	}
+	l.sent[ip] = times[i:]
+}
+
+// limitListener refuses connections over the connection limits, and
+// assigns accepted connections their session of the Scenario.
+type limitListener struct {
+	net.Listener
+	server *Server
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := remoteIP(c.RemoteAddr().String()).String()
+		if !l.server.limiter.acquire(ip, l.server.RateLimit()) {
+			l.server.infof("Refusing connection from %s: too many connections", c.RemoteAddr())
+			go reject(c, errTooManyConnections) // a TLS handshake must not block Accept
+			continue
+		}
+		conn := &limitConn{Conn: &timeoutConn{Conn: c, server: l.server}, release: func() { l.server.limiter.release(ip) }}
+		conn.replies = l.server.scenario.nextSession()
+		if conn.replies == nil || conn.replies.connect == nil {
+			return conn, nil
+		}
+		if conn.replies.connect.drop {
+			_ = conn.Close()
+			continue
+		}
+		go reject(conn, conn.replies.connect.reply)
+	}
+}
+
+// reject greets a connection with err and closes it.
+func reject(c net.Conn, err *smtp.SMTPError) {
+	_ = c.SetWriteDeadline(time.Now().Add(rejectTimeout))
+	_, _ = fmt.Fprintf(c, "%s\r\n", formatReply(err))
+	_ = c.Close()
+}
+
+// limitConn uncounts its connection when closed.
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+	replies *sessionReplies // nil if the session is not scripted
+}
+
+func (c *limitConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// checkRateLimit refuses a new transaction over the message limits, and
+// otherwise reserves its message under MessagesPerIP. Over
+// MaxMessagesPerConnection, the connection is closed after the reply.
+func (s *session) checkRateLimit() error {
+	r := s.server.RateLimit()
+	if r.MaxMessagesPerConnection > 0 && s.info.Messages >= r.MaxMessagesPerConnection {
+		s.server.infof("Closing connection from %s: too many messages", s.conn.RemoteAddr())
+		s.server.limits.messages.Add(1)
+		reject(s.smtpConn.Conn(), ErrTooManyMessages)
+		return errDropped
+	}
+	slot, ok := s.server.limiter.reserve(s.clientIP(), r, time.Now())
+	if !ok {
+		return errRateLimited
+	}
+	s.rateSlot = slot
+	return nil
+}
+
+// recordMessage keeps the message reserved by checkRateLimit counted, as
+// it was accepted.
+func (s *session) recordMessage() {
+	s.rateSlot = time.Time{}
+}
+
+// releaseRateSlot uncounts the message reserved by checkRateLimit if it
+// was not accepted.
+func (s *session) releaseRateSlot() {
+	if !s.rateSlot.IsZero() {
+		s.server.limiter.cancel(s.clientIP(), s.rateSlot)
+		s.rateSlot = time.Time{}
+	}
+}
+
+func (s *session) clientIP() string {
+	return remoteIP(s.conn.RemoteAddr().String()).String()
+}
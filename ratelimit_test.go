@@ -0,0 +1,167 @@
+package mailcatcher
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitConnections(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetRateLimit(RateLimit{MaxConnectionsPerIP: 1}); err != nil {
+		t.Fatalf("Failed to set rate limit: %v", err)
+	}
+
+	first := dialSMTP(t, addr)
+	defer first.Close()
+
+	second, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer second.Close()
+	code, msg, _ := second.ReadResponse(0)
+	if code != 421 || !strings.Contains(msg, "4.7.0 Too many connections") {
+		t.Errorf("Expected 421 4.7.0 too many connections, got %d %s", code, msg)
+	}
+	if _, err := second.ReadLine(); err == nil {
+		t.Error("Expected the refused connection to be closed")
+	}
+
+	// The slot is freed when the first connection closes
+	if code := smtpCommand(t, first, "QUIT"); code != 221 {
+		t.Fatalf("Expected 221 for QUIT, got %d", code)
+	}
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := textproto.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		code, _, _ := conn.ReadResponse(0)
+		conn.Close()
+		if code == 220 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a connection to be accepted after the first closed, got %d", code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRateLimitMessagesPerConnection(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetRateLimit(RateLimit{MaxMessagesPerConnection: 1}); err != nil {
+		t.Fatalf("Failed to set rate limit: %v", err)
+	}
+
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+	smtpCommand(t, conn, "EHLO client.example.com")
+	send := func() int {
+		if code := smtpCommand(t, conn, "MAIL FROM:<sender@example.com>"); code != 250 {
+			return code
+		}
+		smtpCommand(t, conn, "RCPT TO:<user@example.com>")
+		smtpCommand(t, conn, "DATA")
+		return smtpCommand(t, conn, "Subject: Limit\r\n\r\nBody\r\n.")
+	}
+
+	if code := send(); code != 250 {
+		t.Fatalf("Expected the first message to be accepted, got %d", code)
+	}
+	if code := send(); code != 421 {
+		t.Errorf("Expected 421 for the second message, got %d", code)
+	}
+	if _, err := conn.ReadLine(); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+	if n := len(server.Emails()); n != 1 {
+		t.Errorf("Expected 1 email, got %d", n)
+	}
+}
+
+func TestRateLimitMessagesPerIP(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetRateLimit(RateLimit{MessagesPerIP: 2, Window: 200 * time.Millisecond}); err != nil {
+		t.Fatalf("Failed to set rate limit: %v", err)
+	}
+
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+	smtpCommand(t, conn, "EHLO client.example.com")
+	send := func() int {
+		if code := smtpCommand(t, conn, "MAIL FROM:<sender@example.com>"); code != 250 {
+			return code
+		}
+		smtpCommand(t, conn, "RCPT TO:<user@example.com>")
+		smtpCommand(t, conn, "DATA")
+		return smtpCommand(t, conn, "Subject: Rate\r\n\r\nBody\r\n.")
+	}
+
+	for i := range 2 {
+		if code := send(); code != 250 {
+			t.Fatalf("Expected message %d to be accepted, got %d", i+1, code)
+		}
+	}
+	if code := send(); code != 451 {
+		t.Errorf("Expected 451 over the rate limit, got %d", code)
+	}
+
+	// The connection stays open and the window slides
+	time.Sleep(250 * time.Millisecond)
+	if code := send(); code != 250 {
+		t.Errorf("Expected a message to be accepted once the window passed, got %d", code)
+	}
+}
+
+func TestRateLimitConcurrentTransactions(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetRateLimit(RateLimit{MessagesPerIP: 2, Window: time.Minute}); err != nil {
+		t.Fatalf("Failed to set rate limit: %v", err)
+	}
+
+	// Each open transaction holds a message of the limit
+	var conns []*textproto.Conn
+	for range 3 {
+		conn := dialSMTP(t, addr)
+		defer conn.Close()
+		smtpCommand(t, conn, "EHLO client.example.com")
+		conns = append(conns, conn)
+	}
+	for i, want := range []int{250, 250, 451} {
+		if code := smtpCommand(t, conns[i], "MAIL FROM:<sender@example.com>"); code != want {
+			t.Fatalf("Expected %d for MAIL FROM on connection %d, got %d", want, i+1, code)
+		}
+	}
+
+	// A transaction given up frees its message
+	smtpCommand(t, conns[1], "RSET")
+	if code := smtpCommand(t, conns[2], "MAIL FROM:<sender@example.com>"); code != 250 {
+		t.Fatalf("Expected MAIL FROM to be accepted after RSET, got %d", code)
+	}
+	smtpCommand(t, conns[2], "RCPT TO:<user@example.com>")
+	smtpCommand(t, conns[2], "DATA")
+	if code := smtpCommand(t, conns[2], "Subject: Rate\r\n\r\nBody\r\n."); code != 250 {
+		t.Fatalf("Expected the message to be accepted, got %d", code)
+	}
+	if code := smtpCommand(t, conns[1], "MAIL FROM:<sender@example.com>"); code != 451 {
+		t.Errorf("Expected 451 with two messages counted, got %d", code)
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	server := NewWithOptions()
+	if err := server.SetRateLimit(RateLimit{MaxConnections: -1}); err == nil {
+		t.Error("Expected an error for a negative limit")
+	}
+	if err := server.SetRateLimit(RateLimit{MessagesPerIP: 10}); err != nil {
+		t.Fatalf("Failed to set rate limit: %v", err)
+	}
+	if w := server.RateLimit().Window; w != time.Minute {
+		t.Errorf("Expected a default window of 1m, got %v", w)
+	}
+}
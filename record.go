@@ -0,0 +1,158 @@
+package mailcatcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Recording is a complete SMTP session as seen on the wire, saved so that
+// flaky client behavior captured in CI can be reproduced by replaying it.
+// Recording stops once the session switches to TLS via STARTTLS. AUTH
+// credentials are replaced with Redacted, so a replayed AUTH fails unless
+// the server accepts any credentials.
+type Recording struct {
+	Start  time.Time `json:"start"`
+	Remote string    `json:"remote"`
+	Steps  []Step    `json:"steps"`
+}
+
+// Step is one chunk of bytes sent by the client or the server.
+type Step struct {
+	Offset time.Duration `json:"offset"` // since the connection was accepted
+	Client bool          `json:"client"`
+	Data   []byte        `json:"data"`
+}
+
+// recordSeq keeps file names unique when sessions start in the same second.
+var recordSeq atomic.Int64
+
+// SetRecordDir enables recording of every SMTP session to a JSON file in
+// dir, written when the connection closes. An empty dir disables recording.
+// It must be called before Start.
+func (s *Server) SetRecordDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordDir = dir
+}
+
+// saveRecording writes a finished session to the record directory.
+func (s *Server) saveRecording(rec *Recording) {
+	s.mu.RLock()
+	dir := s.recordDir
+	s.mu.RUnlock()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		s.errorf("Failed to create record directory: %v", err)
+		return
+	}
+	name := fmt.Sprintf("session-%s-%d.json", rec.Start.UTC().Format("20060102T150405"), recordSeq.Add(1))
+	path := filepath.Join(dir, name)
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err == nil {
+		// Renamed once written, so a reader never sees a partial file
+		err = os.WriteFile(path+".tmp", data, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		s.errorf("Failed to save session recording: %v", err)
+	}
+}
+
+// LoadRecording reads a session recording written by the server.
+func LoadRecording(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	var rec Recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse recording %s: %w", path, err)
+	}
+	return &rec, nil
+}
+
+// ReplayOptions controls how a Recording is replayed.
+type ReplayOptions struct {
+	// Speed scales the recorded timing: 1 replays in real time, 2 twice as
+	// fast. Zero sends each chunk as soon as the server has answered the
+	// previous one.
+	Speed float64
+}
+
+// Replay re-submits the client side of the recording to the SMTP server at
+// addr, which may be a catcher or any other server. Before sending each
+// client chunk it waits for as many replies as the original server gave,
+// so pipelining and DATA boundaries are preserved.
+func (r *Recording) Replay(ctx context.Context, addr string, opts ReplayOptions) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	replies := bufio.NewReader(conn)
+	start := time.Now()
+	for _, step := range r.Steps {
+		if !step.Client {
+			for range countReplies(step.Data) {
+				if err := readReply(replies); err != nil {
+					return fmt.Errorf("failed to read reply: %w", err)
+				}
+			}
+			continue
+		}
+
+		if opts.Speed > 0 {
+			wait := time.Until(start.Add(time.Duration(float64(step.Offset) / opts.Speed)))
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if _, err := conn.Write(step.Data); err != nil {
+			return fmt.Errorf("failed to send: %w", err)
+		}
+	}
+	return nil
+}
+
+// countReplies returns the number of complete replies in server output.
+func countReplies(data []byte) int {
+	n := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 3 || len(line) > 3 && line[3] == ' ' {
+			n++
+		}
+	}
+	return n
+}
+
+// readReply reads one possibly multi-line reply.
+func readReply(r *bufio.Reader) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) <= 3 || line[3] != '-' {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package mailcatcher
+
+import (
+	"context"
+	"net/smtp"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	server := New(10046, 10101)
+	server.SetRecordDir(dir)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	msg := []byte("Subject: Recorded\r\n\r\nReplay me\r\n")
+	if err := smtp.SendMail("localhost:10046", nil, "sender@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	// The recording is written when the server closes the connection
+	var files []string
+	for range 20 {
+		if files, _ = filepath.Glob(filepath.Join(dir, "*.json")); len(files) > 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 recording, got %d", len(files))
+	}
+
+	rec, err := LoadRecording(files[0])
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+	if len(rec.Steps) == 0 || rec.Steps[0].Client {
+		t.Fatalf("Expected recording to start with the server greeting, got %+v", rec.Steps)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rec.Replay(ctx, "localhost:10046", ReplayOptions{Speed: 10}); err != nil {
+		t.Fatalf("Failed to replay recording: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	emails := server.Emails()
+	if len(emails) != 2 {
+		t.Fatalf("Expected 2 emails after replay, got %d", len(emails))
+	}
+	if emails[1].Subject != "Recorded" || emails[1].Body != emails[0].Body {
+		t.Errorf("Expected replayed email to match the original, got %+v", emails[1])
+	}
+}
@@ -0,0 +1,131 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"net/textproto"
+	"path"
+	"strings"
+)
+
+// RelayRule delivers matching captured emails for real, through an SMTP
+// relay or to another mailcatcher, while the copy is still captured. In
+// staging, this lets mail to internal addresses arrive while everything
+// else is swallowed.
+//
+// An email matches if it has a matching envelope recipient and a matching
+// header; empty fields match everything. Only the matching recipients are
+// delivered to, unless the Relay gives its own.
+type RelayRule struct {
+	// Recipient is a path.Match pattern for envelope recipients, e.g.
+	// "*@ourcompany.com". Matching is case-insensitive.
+	Recipient string `json:"recipient,omitempty"`
+
+	// Header names a header field, and Value is a path.Match pattern for
+	// its value, e.g. "X-Environment" and "staging*". Matching is
+	// case-insensitive.
+	Header string `json:"header,omitempty"`
+	Value  string `json:"value,omitempty"`
+
+	// Relay is the SMTP server matching emails are sent through.
+	Relay *Relay `json:"relay,omitempty"`
+
+	// ForwardURL is the base URL of the HTTP API of another mailcatcher,
+	// e.g. "http://aggregate:8025", used instead of Relay. ForwardToken
+	// is sent as a bearer token, for an instance using SetAPIToken.
+	ForwardURL   string `json:"forward_url,omitempty"`
+	ForwardToken string `json:"-"`
+}
+
+// AddRelayRule registers a rule delivering matching emails. Each rule
+// applies independently, so an email matching two rules is delivered
+// twice. Held emails are not delivered; use Release once approved.
+func (s *Server) AddRelayRule(rule RelayRule) error {
+	if (rule.Relay == nil) == (rule.ForwardURL == "") {
+		return fmt.Errorf("invalid relay rule: exactly one of Relay and ForwardURL must be set")
+	}
+	if rule.Relay != nil && rule.Relay.Addr == "" {
+		return fmt.Errorf("invalid relay rule: relay address is required")
+	}
+	if rule.Value != "" && rule.Header == "" {
+		return fmt.Errorf("invalid relay rule: a header value needs a header name")
+	}
+	for _, pattern := range []string{rule.Recipient, rule.Value} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid relay rule pattern %q: %w", pattern, err)
+		}
+	}
+
+	rule.Recipient = strings.ToLower(rule.Recipient)
+	rule.Value = strings.ToLower(rule.Value)
+	rule.ForwardURL = strings.TrimRight(rule.ForwardURL, "/")
+	if rule.Relay != nil {
+		relay := *rule.Relay
+		rule.Relay = &relay
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.relayRules = append(s.relayRules, rule)
+	return nil
+}
+
+// RelayRules returns the registered relay rules.
+func (s *Server) RelayRules() []RelayRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]RelayRule(nil), s.relayRules...)
+}
+
+// recipients returns the envelope recipients of email the rule delivers
+// to, or nil if it does not match.
+func (r RelayRule) recipients(email Email) []string {
+	if r.Header != "" {
+		matched := false
+		for _, value := range email.Headers[textproto.CanonicalMIMEHeaderKey(r.Header)] {
+			if ok, _ := path.Match(r.Value, strings.ToLower(strings.TrimSpace(value))); ok || r.Value == "" {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil
+		}
+	}
+
+	var to []string
+	for _, rcpt := range email.Envelope.To {
+		if ok, _ := path.Match(r.Recipient, strings.ToLower(rcpt)); ok || r.Recipient == "" {
+			to = append(to, rcpt)
+		}
+	}
+	return to
+}
+
+// relayByRules delivers email according to the relay rules. Delivery is
+// asynchronous; failures are reported to the logger.
+func (s *Server) relayByRules(email Email) {
+	if email.Held {
+		return
+	}
+	for _, rule := range s.RelayRules() {
+		to := rule.recipients(email)
+		if len(to) == 0 {
+			continue
+		}
+		matched := email
+		matched.Envelope.To = to
+
+		if rule.ForwardURL != "" {
+			if email.hops < maxForwardHops {
+				go s.forward(rule.ForwardURL, rule.ForwardToken, matched)
+			}
+			continue
+		}
+		relay := *rule.Relay
+		go func() {
+			if err := s.relayEmail(matched, relay); err != nil {
+				s.errorf("%v", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,100 @@
+package mailcatcher
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRelayRules(t *testing.T) {
+	upstream, upstreamAddr := NewTestServer(t)
+	aggregate := New(0, 0)
+	ts := httptest.NewServer(aggregate.Mux())
+	defer ts.Close()
+
+	server := New(0, 0)
+	if err := server.AddRelayRule(RelayRule{Recipient: "*@ourcompany.com", Relay: &Relay{Addr: upstreamAddr}}); err != nil {
+		t.Fatalf("Failed to add relay rule: %v", err)
+	}
+	if err := server.AddRelayRule(RelayRule{Header: "X-Environment", Value: "staging*", ForwardURL: ts.URL + "/"}); err != nil {
+		t.Fatalf("Failed to add relay rule: %v", err)
+	}
+
+	send := func(to []string, header string) {
+		t.Helper()
+		msg := []byte("From: app@example.com\r\nSubject: Relay\r\n" + header + "\r\nBody\r\n")
+		if err := server.Send("app@example.com", to, msg); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+	send([]string{"dev@OurCompany.com", "customer@example.com"}, "")
+	send([]string{"customer@example.com"}, "X-Environment: Staging-2\r\n")
+	send([]string{"other@example.com"}, "X-Environment: production\r\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	relayed, err := upstream.WaitForEmail(ctx)
+	if err != nil {
+		t.Fatalf("Expected an email at the relay: %v", err)
+	}
+	if !slices.Equal(relayed.Envelope.To, []string{"dev@OurCompany.com"}) {
+		t.Errorf("Expected only the matching recipient to be relayed to, got %v", relayed.Envelope.To)
+	}
+	forwarded, err := aggregate.WaitForEmail(ctx)
+	if err != nil {
+		t.Fatalf("Expected an email at the forward URL: %v", err)
+	}
+	if forwarded.Headers["X-Environment"][0] != "Staging-2" {
+		t.Errorf("Expected the staging email to be forwarded, got %v", forwarded.Headers)
+	}
+
+	// Every email is still captured, and the others go nowhere
+	if n := len(server.Emails()); n != 3 {
+		t.Errorf("Expected 3 captured emails, got %d", n)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := len(upstream.Emails()); n != 1 {
+		t.Errorf("Expected 1 relayed email, got %d", n)
+	}
+	if n := len(aggregate.Emails()); n != 1 {
+		t.Errorf("Expected 1 forwarded email, got %d", n)
+	}
+}
+
+func TestRelayRulesHeld(t *testing.T) {
+	upstream, upstreamAddr := NewTestServer(t)
+	server := New(0, 0)
+	server.AddHoldRule(HoldSubject("review"))
+	if err := server.AddRelayRule(RelayRule{Relay: &Relay{Addr: upstreamAddr}}); err != nil {
+		t.Fatalf("Failed to add relay rule: %v", err)
+	}
+
+	msg := []byte("From: app@example.com\r\nSubject: Please review\r\n\r\nBody\r\n")
+	if err := server.Send("app@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := len(upstream.Emails()); n != 0 {
+		t.Errorf("Expected held emails not to be relayed, got %d", n)
+	}
+}
+
+func TestAddRelayRuleInvalid(t *testing.T) {
+	server := New(0, 0)
+	for _, rule := range []RelayRule{
+		{Recipient: "*@example.com"},
+		{Recipient: "*@example.com", Relay: &Relay{Addr: "localhost:25"}, ForwardURL: "http://localhost:8025"},
+		{Relay: &Relay{}},
+		{Value: "staging", ForwardURL: "http://localhost:8025"},
+		{Recipient: "[", ForwardURL: "http://localhost:8025"},
+	} {
+		if err := server.AddRelayRule(rule); err == nil {
+			t.Errorf("Expected an error for %+v", rule)
+		}
+	}
+	if n := len(server.RelayRules()); n != 0 {
+		t.Errorf("Expected no rules, got %d", n)
+	}
+}
@@ -0,0 +1,190 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	netsmtp "net/smtp"
+	"path"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+var errNoRelay = errors.Base("no relay configured")
+
+// Relay is an upstream SMTP server that captured emails can be released
+// to, so selected messages in staging actually go out.
+type Relay struct {
+	// Addr is the host and port of the server, e.g. "smtp.example.com:587".
+	// STARTTLS is used when the server offers it.
+	Addr string `json:"addr"`
+
+	// Username and Password authenticate with AUTH PLAIN if set. The
+	// connection must use TLS unless the relay is on localhost.
+	Username string `json:"username,omitempty"`
+	Password string `json:"-"`
+
+	// From overrides the envelope sender.
+	From string `json:"from,omitempty"`
+
+	// To overrides the recipients. By default the message goes to its
+	// original envelope recipients.
+	To []string `json:"to,omitempty"`
+
+	// AllowedRecipients are path.Match patterns, e.g. "*@ourcompany.com",
+	// for the recipients the release endpoint may send to other than the
+	// original ones. Matching is case-insensitive.
+	AllowedRecipients []string `json:"allowed_recipients,omitempty"`
+}
+
+// SetRelay configures the relay used by POST /api/v1/emails/{id}/release.
+// The endpoint is refused unless the API requires credentials, see
+// SetAPIToken, since it sends mail out with the relay's.
+func (s *Server) SetRelay(relay Relay) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.relay = &relay
+}
+
+// Relay returns the relay configured with SetRelay, or nil.
+func (s *Server) Relay() *Relay {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.relay == nil {
+		return nil
+	}
+	relay := *s.relay
+	return &relay
+}
+
+// Release sends a captured email, unchanged, through relay.
+func (s *Server) Release(id string, relay Relay) error {
+	email := s.Email(id)
+	if email == nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return s.relayEmail(*email, relay)
+}
+
+// relayEmail sends email, unchanged, through relay.
+func (s *Server) relayEmail(email Email, relay Relay) error {
+	from := relay.From
+	if from == "" {
+		from = email.Envelope.From
+	}
+	if from == "" {
+		from = email.From.Address
+	}
+
+	to := relay.To
+	if len(to) == 0 {
+		to = originalRecipients(email)
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("failed to release %s: no recipients", email.ID)
+	}
+
+	var auth netsmtp.Auth
+	if relay.Username != "" {
+		host, _, err := net.SplitHostPort(relay.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid relay address %q: %w", relay.Addr, err)
+		}
+		auth = netsmtp.PlainAuth("", relay.Username, relay.Password, host)
+	}
+
+	if err := netsmtp.SendMail(relay.Addr, auth, from, to, email.Raw()); err != nil {
+		return fmt.Errorf("failed to release %s to %s: %w", email.ID, relay.Addr, err)
+	}
+	s.infof("Released %s to %s for %v", email.ID, relay.Addr, to)
+	return nil
+}
+
+// originalRecipients returns the envelope recipients of email, or its To
+// and Cc addresses for emails stored through the HTTP API without one.
+func originalRecipients(email Email) []string {
+	if len(email.Envelope.To) > 0 {
+		return email.Envelope.To
+	}
+	var to []string
+	for _, list := range [][]Address{email.To, email.Cc} {
+		for _, a := range list {
+			to = append(to, a.Address)
+		}
+	}
+	return to
+}
+
+// allowsRecipient reports whether the release endpoint may send email to
+// addr: an original recipient, or one matching AllowedRecipients.
+func (r Relay) allowsRecipient(email Email, addr string) bool {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	for _, to := range originalRecipients(email) {
+		if strings.ToLower(to) == addr {
+			return true
+		}
+	}
+	for _, pattern := range r.AllowedRecipients {
+		if ok, _ := path.Match(strings.ToLower(pattern), addr); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTP handlers
+
+// handleReleaseEmail releases an email through the configured relay. An
+// optional JSON body {"to": [...]} narrows the recipients, or widens them
+// to addresses matching Relay.AllowedRecipients.
+func (s *Server) handleReleaseEmail(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	configured := s.relay
+	s.mu.RUnlock()
+	if configured == nil {
+		http.Error(w, "Release is not available: "+errNoRelay.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if !s.requireAPIAuth(w, "Release") {
+		return
+	}
+	relay := *configured
+
+	email := s.Email(r.PathValue("id"))
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	if r.ContentLength != 0 {
+		if !requireJSON(w, r) {
+			return
+		}
+		var body struct {
+			To []string `json:"to"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		for _, to := range body.To {
+			if !relay.allowsRecipient(*email, to) {
+				http.Error(w, "Recipient not allowed: "+to, http.StatusForbidden)
+				return
+			}
+		}
+		if len(body.To) > 0 {
+			relay.To = body.To
+		}
+	}
+
+	if err := s.relayEmail(*email, relay); err != nil {
+		s.errorf("%v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
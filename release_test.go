@@ -0,0 +1,89 @@
+package mailcatcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRelease(t *testing.T) {
+	upstream, upstreamAddr := NewTestServer(t, WithAuth("relay", "secret"))
+
+	server := New(0, 0)
+	msg := []byte("From: app@example.com\r\nTo: user@example.com\r\nSubject: Go live\r\n\r\nBody\r\n")
+	if err := server.Send("bounce@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	id := server.Emails()[0].ID
+
+	relay := Relay{Addr: upstreamAddr, Username: "relay", Password: "secret"}
+	if err := server.Release(id, relay); err != nil {
+		t.Fatalf("Failed to release email: %v", err)
+	}
+
+	released := upstream.Emails()
+	if len(released) != 1 || string(released[0].Raw()) != string(msg) {
+		t.Fatalf("Expected the message to be relayed unchanged, got %+v", released)
+	}
+	if released[0].Envelope.From != "bounce@example.com" {
+		t.Errorf("Expected the original envelope sender, got %s", released[0].Envelope.From)
+	}
+
+	if err := server.Release("msg-999", relay); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := server.Release(id, Relay{Addr: upstreamAddr, Username: "relay", Password: "wrong"}); err == nil {
+		t.Error("Expected error with wrong relay credentials")
+	}
+
+	ts := httptest.NewServer(server.HTTPServer().Handler)
+	defer ts.Close()
+	release := func(contentType, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/emails/"+id+"/release", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer t0ken")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to release email: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Without a configured relay the endpoint is unavailable
+	if status := release("", ""); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", status)
+	}
+
+	// Nor, with a relay, while the API is open to any web page
+	relay.AllowedRecipients = []string{"*@qa.example.com"}
+	server.SetRelay(relay)
+	if status := release("", ""); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 without API authentication, got %d", status)
+	}
+
+	server.SetAPIToken("t0ken")
+	for _, tt := range []struct {
+		contentType, body string
+		want              int
+	}{
+		{"text/plain", `{"to": ["tester@qa.example.com"]}`, http.StatusUnsupportedMediaType},
+		{"application/json", `{"to": ["anyone@elsewhere.example.com"]}`, http.StatusForbidden},
+		{"application/json", `{"to": ["USER@example.com"]}`, http.StatusNoContent},
+		{"application/json", `{"to": ["tester@qa.example.com"]}`, http.StatusNoContent},
+	} {
+		if status := release(tt.contentType, tt.body); status != tt.want {
+			t.Errorf("Expected status %d for %s %s, got %d", tt.want, tt.contentType, tt.body, status)
+		}
+	}
+
+	released = upstream.Emails()
+	if len(released) != 3 || len(released[2].Envelope.To) != 1 || released[2].Envelope.To[0] != "tester@qa.example.com" {
+		t.Errorf("Expected the last release to go to tester@qa.example.com, got %+v", released)
+	}
+}
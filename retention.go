@@ -0,0 +1,279 @@
+package mailcatcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// Retention bounds the captured mail so a long-running catcher does not
+// grow without limit. The oldest messages are evicted first. Zero fields
+// disable a limit.
+type Retention struct {
+	// MaxMessages is the number of messages kept.
+	MaxMessages int `json:"max_messages"`
+
+	// MaxBytes is the total size of the messages kept. The newest message
+	// is always kept, even if it is larger on its own.
+	MaxBytes int64 `json:"max_bytes"`
+
+	// MaxAge evicts messages captured longer ago, see SetMessageTTL.
+	// Expired messages are removed by a periodic sweep while running.
+	MaxAge time.Duration `json:"max_age"`
+}
+
+// retentionState holds the eviction counters reported by Stats and the
+// running total of stored bytes checked against MaxBytes.
+type retentionState struct {
+	evicted      atomic.Int64
+	evictedBytes atomic.Int64
+
+	// mu is held while adding and evicting emails, so bytes stays in step
+	// with the store.
+	mu      sync.Mutex
+	bytes   int64
+	counted bool // whether bytes is known, else it is counted when needed
+}
+
+// SetRetention sets the retention limits.
+func (s *Server) SetRetention(r Retention) {
+	s.mu.Lock()
+	s.retention = r
+	s.mu.Unlock()
+	s.wakeRetention()
+}
+
+// Retention returns the retention limits.
+func (s *Server) Retention() Retention {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retention
+}
+
+// SetMessageTTL sets the time to live of captured messages: a background
+// sweep deletes mail captured longer ago, e.g. password reset emails on an
+// always-on staging catcher. It is Retention.MaxAge, keeping the other
+// limits; 0 keeps messages forever.
+func (s *Server) SetMessageTTL(ttl time.Duration) {
+	s.mu.Lock()
+	s.retention.MaxAge = ttl
+	s.mu.Unlock()
+	s.wakeRetention()
+}
+
+// MessageTTL returns the time to live of captured messages, see
+// SetMessageTTL.
+func (s *Server) MessageTTL() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retention.MaxAge
+}
+
+// wakeRetention makes the sweep pick up changed limits.
+func (s *Server) wakeRetention() {
+	select {
+	case s.retentionChanged <- struct{}{}:
+	default:
+	}
+}
+
+// startRetention periodically evicts expired mail until ctx is canceled.
+func (s *Server) startRetention(ctx context.Context) {
+	go func() {
+		timer := time.NewTimer(s.sweepInterval())
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.retentionChanged:
+				// Limits changed, so sweep now and at the new interval
+			case <-timer.C:
+			}
+			s.expireMessages()
+			timer.Reset(s.sweepInterval())
+		}
+	}()
+}
+
+// sweepInterval is the time between sweeps for expired mail, a fraction
+// of MaxAge so messages do not outlive it by much.
+func (s *Server) sweepInterval() time.Duration {
+	if maxAge := s.MessageTTL(); maxAge > 0 {
+		return min(max(maxAge/2, time.Second), time.Minute)
+	}
+	return time.Minute
+}
+
+// enforceRetention evicts the oldest messages beyond MaxMessages and
+// MaxBytes. It runs on every arrival, so the emails are only counted and
+// the running byte total checked until a limit is exceeded. Expiry by
+// MaxAge is left to the sweep.
+func (s *Server) enforceRetention() {
+	r := s.Retention()
+	if r.MaxMessages == 0 && r.MaxBytes == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	n, err := s.store.Count(ctx)
+	if err != nil {
+		s.errorf("Failed to count emails: %v", err)
+		return
+	}
+	var total int64
+	if r.MaxBytes > 0 {
+		if total, err = s.storedBytes(ctx); err != nil {
+			s.errorf("Failed to count stored bytes: %v", err)
+			return
+		}
+	}
+	over := func() bool {
+		return (r.MaxMessages > 0 && n > r.MaxMessages) ||
+			(r.MaxBytes > 0 && total > r.MaxBytes && n > 1)
+	}
+	for over() {
+		// Fetch as many as the count limit is exceeded by, else one by one
+		batch := 1
+		if r.MaxMessages > 0 {
+			batch = max(n-r.MaxMessages, 1)
+		}
+		ids, err := oldestIDs(ctx, s.store, batch)
+		if err != nil {
+			s.errorf("Failed to list the oldest emails: %v", err)
+			return
+		}
+		if len(ids) == 0 {
+			return
+		}
+		for _, id := range ids {
+			if !over() {
+				return
+			}
+			// Only the evicted emails are loaded, for their size
+			email, err := s.store.Get(ctx, id)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				// Deleted meanwhile
+			case err != nil:
+				s.errorf("Failed to get email %s: %v", id, err)
+				return
+			case !s.evict(ctx, email):
+				return
+			}
+			n--
+			total -= email.Size
+		}
+	}
+}
+
+// oldestIDs returns the IDs of up to n of the oldest emails, listing them
+// all if the store is not an OldestLister.
+func oldestIDs(ctx context.Context, store Store, n int) ([]string, error) {
+	if lister, ok := store.(OldestLister); ok {
+		return lister.OldestIDs(ctx, n)
+	}
+	all, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, min(n, len(all)))
+	for _, email := range all[:cap(ids)] {
+		ids = append(ids, email.ID)
+	}
+	return ids, nil
+}
+
+// expireMessages evicts the messages captured longer than MaxAge ago.
+func (s *Server) expireMessages() {
+	maxAge := s.MessageTTL()
+	if maxAge == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	all, err := s.store.List(ctx)
+	if err != nil {
+		s.errorf("Failed to list emails: %v", err)
+		return
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, email := range all {
+		if !email.Time.Before(cutoff) {
+			break // the rest is newer
+		}
+		s.evict(ctx, email)
+	}
+}
+
+// evict deletes email and reports whether it did.
+func (s *Server) evict(ctx context.Context, email Email) bool {
+	e := &s.evictions
+	e.mu.Lock()
+	err := s.store.Delete(ctx, email.ID)
+	if err == nil {
+		e.bytes -= email.Size
+	}
+	e.mu.Unlock()
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			s.errorf("Failed to evict email %s: %v", email.ID, err)
+		}
+		return false
+	}
+
+	e.evicted.Add(1)
+	e.evictedBytes.Add(email.Size)
+	s.publish(Event{Type: EventDeleted, ID: email.ID})
+	return true
+}
+
+// addEmail stores email, adding its size to the running byte total.
+func (s *Server) addEmail(ctx context.Context, email Email) (Email, error) {
+	e := &s.evictions
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stored, err := s.store.Add(ctx, email)
+	if err != nil {
+		return Email{}, err
+	}
+	e.bytes += stored.Size
+	return stored, nil
+}
+
+// storedBytes returns the total size of the stored emails. They are only
+// listed if the running total is not known, which is the case after other
+// deletions and always with a shared store, which other replicas change.
+func (s *Server) storedBytes(ctx context.Context) (int64, error) {
+	e := &s.evictions
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counted {
+		return e.bytes, nil
+	}
+
+	all, err := s.store.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list emails: %w", err)
+	}
+	var total int64
+	for _, email := range all {
+		total += email.Size
+	}
+	e.bytes, e.counted = total, s.stopWatch == nil
+	return total, nil
+}
+
+// forgetStoredBytes makes storedBytes count the stored emails again, after
+// they were changed other than by addEmail and evict.
+func (s *Server) forgetStoredBytes() {
+	e := &s.evictions
+	e.mu.Lock()
+	e.counted = false
+	e.mu.Unlock()
+}
@@ -0,0 +1,144 @@
+package mailcatcher
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	send := func(t *testing.T, server *Server, subject string, size int) {
+		t.Helper()
+		msg := []byte("Subject: " + subject + "\r\n\r\n" + strings.Repeat("x", size) + "\r\n")
+		if err := server.Send("app@example.com", []string{"user@example.com"}, msg); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+	subjects := func(server *Server) string {
+		var list []string
+		for _, e := range server.Emails() {
+			list = append(list, e.Subject)
+		}
+		return strings.Join(list, ",")
+	}
+
+	t.Run("messages", func(t *testing.T) {
+		server := New(0, 0)
+		server.SetRetention(Retention{MaxMessages: 2})
+		for _, subject := range []string{"a", "b", "c"} {
+			send(t, server, subject, 10)
+		}
+		if got := subjects(server); got != "b,c" {
+			t.Errorf("Expected b,c to be kept, got %s", got)
+		}
+		if stats := server.Stats(); stats.Evicted != 1 || stats.EvictedBytes == 0 {
+			t.Errorf("Expected 1 eviction in stats, got %d (%d bytes)", stats.Evicted, stats.EvictedBytes)
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		server := New(0, 0)
+		server.SetRetention(Retention{MaxBytes: 250})
+		send(t, server, "a", 100)
+		send(t, server, "b", 100)
+		send(t, server, "c", 100)
+		if got := subjects(server); got != "b,c" {
+			t.Errorf("Expected b,c to be kept, got %s", got)
+		}
+
+		// The newest message stays even when it alone exceeds the limit
+		send(t, server, "big", 500)
+		if got := subjects(server); got != "big" {
+			t.Errorf("Expected only the big message to be kept, got %s", got)
+		}
+
+		// The running total follows deletions by other means
+		server.Delete(server.Emails()[0].ID)
+		send(t, server, "d", 100)
+		send(t, server, "e", 100)
+		if got := subjects(server); got != "d,e" {
+			t.Errorf("Expected d,e to be kept, got %s", got)
+		}
+	})
+
+	t.Run("age", func(t *testing.T) {
+		server := New(0, 0)
+		server.SetRetention(Retention{MaxAge: 50 * time.Millisecond})
+		send(t, server, "old", 10)
+		time.Sleep(80 * time.Millisecond)
+		send(t, server, "new", 10)
+
+		// Expiry is left to the sweep, so arrivals only count the emails
+		if got := subjects(server); got != "old,new" {
+			t.Errorf("Expected the expired message to wait for the sweep, got %s", got)
+		}
+		server.expireMessages()
+		if got := subjects(server); got != "new" {
+			t.Errorf("Expected the expired message to be evicted, got %s", got)
+		}
+	})
+}
+
+// listCountingStore counts the calls to List.
+type listCountingStore struct {
+	*MemoryStore
+	lists int
+}
+
+func (c *listCountingStore) List(ctx context.Context) ([]Email, error) {
+	c.lists++
+	return c.MemoryStore.List(ctx)
+}
+
+func TestRetentionWithoutListing(t *testing.T) {
+	store := &listCountingStore{MemoryStore: NewMemoryStore()}
+	server := NewWithOptions(WithStore(store), WithRetention(Retention{MaxMessages: 3, MaxBytes: 1 << 20, MaxAge: time.Hour}))
+	for range 10 {
+		server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Hi\r\n\r\nBody\r\n"))
+	}
+
+	// Counting, the running byte total and the oldest IDs are enough
+	if store.lists != 1 {
+		t.Errorf("Expected the emails to be listed once for the byte total, got %d lists", store.lists)
+	}
+	if n, _ := store.Count(context.Background()); n != 3 {
+		t.Errorf("Expected 3 emails to be kept, got %d", n)
+	}
+}
+
+func TestRetentionSweep(t *testing.T) {
+	server, _ := NewTestServer(t, WithRetention(Retention{MaxAge: 100 * time.Millisecond}))
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Old\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	// The sweep runs every second at most, without new mail arriving
+	deadline := time.Now().Add(3 * time.Second)
+	for len(server.Emails()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if n := len(server.Emails()); n != 0 {
+		t.Errorf("Expected expired mail to be swept, got %d emails", n)
+	}
+}
+
+func TestMessageTTL(t *testing.T) {
+	server, _ := NewTestServer(t, WithRetention(Retention{MaxMessages: 10}))
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Reset\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	// A TTL set while running is swept without new mail arriving
+	server.SetMessageTTL(100 * time.Millisecond)
+	if r := server.Retention(); r.MaxMessages != 10 || r.MaxAge != 100*time.Millisecond {
+		t.Errorf("Expected the TTL to keep the other limits, got %+v", r)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for len(server.Emails()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if n := len(server.Emails()); n != 0 {
+		t.Errorf("Expected expired mail to be swept, got %d emails", n)
+	}
+}
@@ -0,0 +1,227 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"gopkg.in/yaml.v3"
+)
+
+// ReplyDrop in a SessionScript closes the connection without a reply.
+const ReplyDrop = "drop"
+
+// Scenario scripts the replies of consecutive SMTP sessions, so retry and
+// backoff logic can be tested deterministically: the first attempt may be
+// refused with 451 and the second accepted, or a recipient greylisted
+// until the sender retries late enough.
+type Scenario struct {
+	// Sessions scripts the sessions in the order they connect: the first
+	// connection follows Sessions[0], the second Sessions[1] and so on.
+	// Later sessions behave normally, unless Repeat is set.
+	Sessions []SessionScript `json:"sessions,omitempty" yaml:"sessions,omitempty"`
+
+	// Repeat starts the script over after the last session.
+	Repeat bool `json:"repeat,omitempty" yaml:"repeat,omitempty"`
+
+	// Greylist refuses each new combination of client IP, sender and
+	// recipient with 451 4.7.1 until it is retried at least Greylist
+	// later, like the greylisting of many receiving servers. 0 disables
+	// greylisting.
+	Greylist time.Duration `json:"greylist,omitempty" yaml:"greylist,omitempty"`
+}
+
+// SessionScript holds the replies of one SMTP session, each a reply
+// accepted by ParseReply or ReplyDrop. An empty reply keeps the normal
+// behavior. Connect refuses the connection instead of the greeting; Rcpt
+// applies to every recipient. Data may also be a 2xx reply, which
+// accepts the message with that text, e.g. "250 2.0.0 Queued as 4F2A".
+type SessionScript struct {
+	Connect string `json:"connect,omitempty" yaml:"connect,omitempty"`
+	Mail    string `json:"mail,omitempty" yaml:"mail,omitempty"`
+	Rcpt    string `json:"rcpt,omitempty" yaml:"rcpt,omitempty"`
+	Data    string `json:"data,omitempty" yaml:"data,omitempty"`
+}
+
+// sessionReplies is a parsed SessionScript. A nil reply keeps the normal
+// behavior.
+type sessionReplies struct {
+	connect, mail, rcpt, data *scriptedReply
+}
+
+// scriptedReply is a reply of a SessionScript.
+type scriptedReply struct {
+	drop  bool
+	reply *smtp.SMTPError
+}
+
+// scenarioState is the parsed scenario and its progress.
+type scenarioState struct {
+	mu       sync.Mutex
+	sessions []sessionReplies
+	repeat   bool
+	greylist time.Duration
+	next     int                  // index of the next session
+	seen     map[string]time.Time // first attempt by greylisting triplet
+}
+
+// SetScenario replaces the scripted scenario and starts it from its first
+// session. A zero Scenario removes it.
+func (s *Server) SetScenario(sc Scenario) error {
+	if sc.Greylist < 0 {
+		return fmt.Errorf("invalid scenario: negative greylist delay %v", sc.Greylist)
+	}
+	sessions := make([]sessionReplies, len(sc.Sessions))
+	for i, script := range sc.Sessions {
+		var err error
+		for _, step := range []struct {
+			name  string
+			reply string
+			dest  **scriptedReply
+		}{
+			{"connect", script.Connect, &sessions[i].connect},
+			{"mail", script.Mail, &sessions[i].mail},
+			{"rcpt", script.Rcpt, &sessions[i].rcpt},
+			{"data", script.Data, &sessions[i].data},
+		} {
+			if *step.dest, err = parseScriptedReply(step.reply, step.name == "data"); err != nil {
+				return fmt.Errorf("invalid scenario session %d %s reply: %w", i+1, step.name, err)
+			}
+		}
+	}
+
+	s.scenario.mu.Lock()
+	defer s.scenario.mu.Unlock()
+	s.scenario.sessions = sessions
+	s.scenario.repeat = sc.Repeat
+	s.scenario.greylist = sc.Greylist
+	s.scenario.next = 0
+	s.scenario.seen = nil
+	return nil
+}
+
+// LoadScenario reads a Scenario from a YAML or JSON file, e.g.
+//
+//	greylist: 5m
+//	sessions:
+//	  - mail: 451 4.3.0 Try again later
+//	  - rcpt: gmail:mailbox-full
+//	  - {}
+func LoadScenario(path string) (Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	var sc Scenario
+	if err := yaml.Unmarshal(data, &sc); err != nil {
+		return Scenario{}, fmt.Errorf("failed to parse scenario %s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// parseScriptedReply parses a SessionScript reply. Success replies are
+// only allowed if accept is set.
+func parseScriptedReply(s string, accept bool) (*scriptedReply, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return nil, nil
+	case strings.EqualFold(s, ReplyDrop):
+		return &scriptedReply{drop: true}, nil
+	case accept && strings.HasPrefix(s, "2"):
+		codeText, rest, _ := strings.Cut(s, " ")
+		reply := &smtp.SMTPError{Message: "OK"}
+		if _, err := fmt.Sscanf(codeText, "%d", &reply.Code); err != nil || reply.Code < 200 || reply.Code > 299 || len(codeText) != 3 {
+			return nil, fmt.Errorf("invalid reply %q", s)
+		}
+		enhancedText, message, _ := strings.Cut(rest, " ")
+		if enhanced, ok := parseEnhancedCode(enhancedText); ok && enhanced[0] == 2 {
+			reply.EnhancedCode = enhanced
+		} else {
+			message = rest
+		}
+		if message = strings.TrimSpace(message); message != "" {
+			reply.Message = message
+		}
+		return &scriptedReply{reply: reply}, nil
+	}
+	reply, err := ParseReply(s)
+	if err != nil {
+		return nil, err
+	}
+	return &scriptedReply{reply: reply}, nil
+}
+
+// nextSession returns the replies of the next scripted session, or nil.
+func (sc *scenarioState) nextSession() *sessionReplies {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.next >= len(sc.sessions) {
+		if !sc.repeat || len(sc.sessions) == 0 {
+			return nil
+		}
+		sc.next = 0
+	}
+	replies := sc.sessions[sc.next]
+	sc.next++
+	return &replies
+}
+
+// greylisted reports whether the triplet must be refused for greylisting
+// at now.
+func (sc *scenarioState) greylisted(ip, from, rcpt string, now time.Time) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.greylist <= 0 {
+		return false
+	}
+	key := ip + "\x00" + strings.ToLower(from) + "\x00" + strings.ToLower(rcpt)
+	first, ok := sc.seen[key]
+	if !ok {
+		if sc.seen == nil {
+			sc.seen = make(map[string]time.Time)
+		}
+		sc.seen[key] = now
+		return true
+	}
+	return now.Sub(first) < sc.greylist
+}
+
+var errGreylisted = &smtp.SMTPError{
+	Code:         451,
+	EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+	Message:      "Greylisted, please try again later",
+}
+
+// connReplies returns the scripted replies of the session on c, or nil.
+func connReplies(c net.Conn) *sessionReplies {
+	for {
+		switch conn := c.(type) {
+		case *limitConn:
+			return conn.replies
+		case *transcriptConn:
+			c = conn.Conn
+		case *slowConn:
+			c = conn.Conn
+		default:
+			return nil
+		}
+	}
+}
+
+// scripted answers a command as scripted, if it is.
+func (s *session) scripted(reply *scriptedReply) error {
+	if reply == nil {
+		return nil
+	}
+	if reply.drop {
+		return s.drop()
+	}
+	return reply.reply
+}
@@ -0,0 +1,153 @@
+package mailcatcher
+
+import (
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sendScripted sends a message on a new connection and returns the reply
+// codes up to the first failure.
+func sendScripted(t *testing.T, addr, rcpt string) []int {
+	t.Helper()
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+
+	var codes []int
+	for _, cmd := range []string{"EHLO client.example.com", "MAIL FROM:<app@example.com>", "RCPT TO:<" + rcpt + ">", "DATA", "Subject: Retry\r\n\r\nBody\r\n."} {
+		code := smtpCommand(t, conn, "%s", cmd)
+		codes = append(codes, code)
+		if code >= 400 {
+			break
+		}
+	}
+	return codes
+}
+
+func TestScenarioSessions(t *testing.T) {
+	server, addr := NewTestServer(t)
+	err := server.SetScenario(Scenario{Sessions: []SessionScript{
+		{Mail: "451 4.3.0 Try again later"},
+		{Rcpt: "generic:mailbox-full"},
+		{Data: "250 2.0.0 Queued as 4F2A"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to set scenario: %v", err)
+	}
+
+	if codes := sendScripted(t, addr, "user@example.com"); codes[len(codes)-1] != 451 || len(codes) != 2 {
+		t.Errorf("Expected 451 at MAIL FROM, got %v", codes)
+	}
+	if codes := sendScripted(t, addr, "user@example.com"); codes[len(codes)-1] != 452 || len(codes) != 3 {
+		t.Errorf("Expected 452 at RCPT TO, got %v", codes)
+	}
+
+	conn := dialSMTP(t, addr)
+	defer conn.Close()
+	for _, cmd := range []string{"EHLO client.example.com", "MAIL FROM:<app@example.com>", "RCPT TO:<user@example.com>", "DATA"} {
+		smtpCommand(t, conn, "%s", cmd)
+	}
+	id, err := conn.Cmd("Subject: Retry\r\n\r\nBody\r\n.")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	conn.StartResponse(id)
+	code, msg, _ := conn.ReadResponse(250)
+	conn.EndResponse(id)
+	if code != 250 || msg != "2.0.0 Queued as 4F2A" {
+		t.Errorf("Expected the scripted reply, got %d %s", code, msg)
+	}
+	if n := len(server.Emails()); n != 1 {
+		t.Errorf("Expected 1 email, got %d", n)
+	}
+
+	// The script is over
+	if codes := sendScripted(t, addr, "user@example.com"); codes[len(codes)-1] != 250 {
+		t.Errorf("Expected later sessions to behave normally, got %v", codes)
+	}
+}
+
+func TestScenarioConnect(t *testing.T) {
+	server, addr := NewTestServer(t)
+	err := server.SetScenario(Scenario{Repeat: true, Sessions: []SessionScript{
+		{Connect: "421 4.3.2 Service not available"},
+		{},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to set scenario: %v", err)
+	}
+
+	for range 2 {
+		conn, err := textproto.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		code, msg, _ := conn.ReadResponse(0)
+		conn.Close()
+		if code != 421 || msg != "4.3.2 Service not available" {
+			t.Errorf("Expected the scripted greeting, got %d %s", code, msg)
+		}
+		if codes := sendScripted(t, addr, "user@example.com"); codes[len(codes)-1] != 250 {
+			t.Errorf("Expected the second session to succeed, got %v", codes)
+		}
+	}
+}
+
+func TestScenarioGreylist(t *testing.T) {
+	server, addr := NewTestServer(t)
+	if err := server.SetScenario(Scenario{Greylist: 200 * time.Millisecond}); err != nil {
+		t.Fatalf("Failed to set scenario: %v", err)
+	}
+
+	if codes := sendScripted(t, addr, "user@example.com"); codes[len(codes)-1] != 451 {
+		t.Errorf("Expected the first attempt to be greylisted, got %v", codes)
+	}
+	if codes := sendScripted(t, addr, "user@example.com"); codes[len(codes)-1] != 451 {
+		t.Errorf("Expected an early retry to be greylisted, got %v", codes)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if codes := sendScripted(t, addr, "user@example.com"); codes[len(codes)-1] != 250 {
+		t.Errorf("Expected a late retry to be accepted, got %v", codes)
+	}
+	if codes := sendScripted(t, addr, "other@example.com"); codes[len(codes)-1] != 451 {
+		t.Errorf("Expected a new recipient to be greylisted, got %v", codes)
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	yaml := "greylist: 5m\nrepeat: true\nsessions:\n  - mail: 451 4.3.0 Try again later\n  - data: drop\n  - {}\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("Failed to write scenario: %v", err)
+	}
+
+	sc, err := LoadScenario(path)
+	if err != nil {
+		t.Fatalf("Failed to load scenario: %v", err)
+	}
+	if sc.Greylist != 5*time.Minute || !sc.Repeat || len(sc.Sessions) != 3 || sc.Sessions[1].Data != ReplyDrop {
+		t.Errorf("Expected the scenario of the file, got %+v", sc)
+	}
+	if err := New(0, 0).SetScenario(sc); err != nil {
+		t.Errorf("Expected the scenario to be valid, got %v", err)
+	}
+}
+
+func TestSetScenarioInvalid(t *testing.T) {
+	server := New(0, 0)
+	for _, sc := range []Scenario{
+		{Sessions: []SessionScript{{Mail: "250 OK"}}},
+		{Sessions: []SessionScript{{Rcpt: "nope:nothing"}}},
+		{Sessions: []SessionScript{{Data: "299x"}}},
+		{Greylist: -time.Second},
+	} {
+		if err := server.SetScenario(sc); err == nil {
+			t.Errorf("Expected an error for %+v", sc)
+		} else if !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("Expected an invalid scenario error, got %v", err)
+		}
+	}
+}
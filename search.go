@@ -0,0 +1,129 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Searcher is implemented by stores with a full-text index, so Search does
+// not scan every email.
+type Searcher interface {
+	// Search returns the emails that may contain every word of query, in
+	// the order they were added. Callers still check each email.
+	Search(ctx context.Context, query string) ([]Email, error)
+}
+
+// Search returns the captured emails containing every word of query in
+// their subject, headers or decoded text and HTML bodies, excluding held
+// ones, in the order they were received. Words are runs of letters and
+// digits compared ignoring case, so "Order #1234" finds a message
+// mentioning "order 1234" but not "order 12345".
+func (s *Server) Search(query string) []Email {
+	words := searchWords(query)
+	if len(words) == 0 {
+		return []Email{}
+	}
+
+	ctx := context.Background()
+	var (
+		candidates []Email
+		err        error
+	)
+	if searcher, ok := s.store.(Searcher); ok {
+		candidates, err = searcher.Search(ctx, query)
+	} else {
+		candidates, err = s.store.List(ctx)
+	}
+	if err != nil {
+		s.errorf("Failed to search emails: %v", err)
+		return []Email{}
+	}
+
+	emails := []Email{}
+	for _, email := range candidates {
+		if !email.Held && containsWords(emailWords(&email), words) {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// searchWords returns the sorted, distinct lowercased words of s.
+func searchWords(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+// emailWords returns the words Search finds e by. Bodies compressed by a
+// CompressedStore are not indexed by the store it wraps.
+func emailWords(e *Email) []string {
+	var b strings.Builder
+	b.WriteString(e.Subject)
+	for _, values := range e.Headers {
+		for _, v := range values {
+			b.WriteByte(' ')
+			b.WriteString(v)
+		}
+	}
+	if e.Compression == "" {
+		b.WriteByte(' ')
+		b.WriteString(e.Text)
+		if e.HTML != "" {
+			b.WriteByte(' ')
+			b.WriteString(htmlText(e.HTML))
+		}
+	}
+	return searchWords(b.String())
+}
+
+// containsWords reports whether the sorted words have all of want.
+func containsWords(words, want []string) bool {
+	for _, w := range want {
+		if _, ok := slices.BinarySearch(words, w); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// HTTP handlers
+
+// handleSearch lists the emails found by Search for ?q=, with the query
+// parameters of the list endpoint.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		http.Error(w, "missing q: expected words to search for", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	emails := s.match(s.Search(query), filter)
+	items := page.apply(emails)
+
+	response := map[string]any{
+		"total": len(emails),
+		"count": len(items),
+		"items": items,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
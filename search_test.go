@@ -0,0 +1,119 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// subjects returns the subjects of emails.
+func subjects(emails []Email) []string {
+	var subjects []string
+	for _, e := range emails {
+		subjects = append(subjects, e.Subject)
+	}
+	return subjects
+}
+
+func TestSearch(t *testing.T) {
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	defer boltStore.Close()
+
+	// The memory store searches its index, the bolt store is scanned
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "bolt": boltStore} {
+		t.Run(name, func(t *testing.T) {
+			server := NewWithOptions(WithStore(store))
+			server.Send("shop@example.com", []string{"user@example.com"}, []byte("Subject: Order #1234 shipped\r\n\r\nThanks!\r\n"))
+			server.Send("shop@example.com", []string{"user@example.com"}, []byte("Subject: Receipt\r\nX-Order: 12345\r\n\r\nThanks!\r\n"))
+			server.Send("shop@example.com", []string{"user@example.com"}, []byte("Subject: Invoice\r\nContent-Type: text/html\r\n\r\n<p>Your <b>ORDER</b> 1234 is due</p>\r\n"))
+			server.Send("shop@example.com", []string{"user@example.com"}, []byte("Subject: Newsletter\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nAbout order=20=31234\r\n"))
+
+			if got := subjects(server.Search("order 1234")); !slices.Equal(got, []string{"Order #1234 shipped", "Invoice", "Newsletter"}) {
+				t.Errorf("Expected the emails mentioning order 1234, got %v", got)
+			}
+			if got := subjects(server.Search("12345")); !slices.Equal(got, []string{"Receipt"}) {
+				t.Errorf("Expected the email with the header, got %v", got)
+			}
+			if got := server.Search("#"); len(got) != 0 {
+				t.Errorf("Expected no emails for a query without words, got %v", subjects(got))
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSearchIndex(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	email, err := store.Add(ctx, newEmail("shop@example.com", nil, []byte("Subject: Order shipped\r\n\r\nBody\r\n")))
+	if err != nil {
+		t.Fatalf("Failed to add email: %v", err)
+	}
+	search := func(query string) []string {
+		emails, err := store.Search(ctx, query)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		return subjects(emails)
+	}
+
+	email.Text = "Refund issued"
+	if err := store.Update(ctx, email); err != nil {
+		t.Fatalf("Failed to update email: %v", err)
+	}
+	if got := search("body"); len(got) != 0 {
+		t.Errorf("Expected no emails for the old text, got %v", got)
+	}
+	if got := search("ORDER refund"); !slices.Equal(got, []string{"Order shipped"}) {
+		t.Errorf("Expected the updated email, got %v", got)
+	}
+
+	if err := store.Delete(ctx, email.ID); err != nil {
+		t.Fatalf("Failed to delete email: %v", err)
+	}
+	if got := search("order"); len(got) != 0 {
+		t.Errorf("Expected no emails after delete, got %v", got)
+	}
+	if n := len(store.byWord); n != 0 {
+		t.Errorf("Expected an empty index, got %d words", n)
+	}
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	server := New(0, 0)
+	server.Send("shop@example.com", []string{"alice@example.com"}, []byte("Subject: Order 1234\r\n\r\nBody\r\n"))
+	server.Send("shop@example.com", []string{"bob@example.com"}, []byte("Subject: Order 1234\r\n\r\nBody\r\n"))
+	ts := httptest.NewServer(server.HTTPServer().Handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/search?q=order+%231234&to=bob@example.com")
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Total int     `json:"total"`
+		Items []Email `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.Total != 1 || result.Items[0].To[0].Address != "bob@example.com" {
+		t.Errorf("Expected the email to bob, got %+v", result)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/search")
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without q, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,154 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	netsmtp "net/smtp"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+)
+
+// Sender delivers a message to its recipients. *Server implements it in
+// process, so code under test can be handed a Sender instead of an SMTP
+// address.
+type Sender interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+var _ Sender = (*Server)(nil)
+
+// Send captures msg without a network round trip. It goes through the
+// same sender and recipient checks, size limit, attachment policy,
+// OnAccept hooks and parsing as a message received over SMTP, so pure unit
+// tests can capture mail without any listener; the server does not need
+// to be started. Rejections are returned as *smtp.SMTPError.
+func (s *Server) Send(from string, to []string, msg []byte) error {
+	if len(to) == 0 {
+		return &smtp.SMTPError{
+			Code:         554,
+			EnhancedCode: smtp.EnhancedCode{5, 5, 1},
+			Message:      "No valid recipients",
+		}
+	}
+	if err := s.checkSenderRejections(from); err != nil {
+		return err
+	}
+	for i, rcpt := range to {
+		if err := s.checkRcpt(i, rcpt, int64(len(msg))); err != nil {
+			return err
+		}
+	}
+	if limit := s.smtpServer.MaxMessageBytes; limit > 0 && int64(len(msg)) > limit {
+		return s.recordOversized(Oversized{From: from, To: to, Size: int64(len(msg))})
+	}
+
+	email := newEmail(from, to, msg)
+	if err := s.checkAttachments(&email); err != nil {
+		return err
+	}
+	s.validate(&email)
+	if err := s.checkAccept(email); err != nil {
+		return err
+	}
+	_, err := s.addMessage(email)
+	return err
+}
+
+// SendMailFunc returns a function with the signature of net/smtp.SendMail
+// that delivers to the server in process, for code that takes the send
+// function as a dependency. The address and authentication are ignored.
+func (s *Server) SendMailFunc() func(addr string, a netsmtp.Auth, from string, to []string, msg []byte) error {
+	return func(_ string, _ netsmtp.Auth, from string, to []string, msg []byte) error {
+		return s.Send(from, to, msg)
+	}
+}
+
+// SendAndCapture delivers msg to the server's own SMTP port and returns the
+// email captured from it, so a test of an email template needs no SMTP
+// client and no waiting:
+//
+//	email, err := server.SendAndCapture(ctx, "app@example.com", []string{"user@example.com"}, msg)
+//
+// Unlike Send, the message takes the network path, so the session,
+// transcript and DATA findings are recorded as for any SMTP client. Held
+// emails are returned too. The server must be started; the credentials of
+// SetAuth are used if set. Rejections are returned as *smtp.SMTPError. If
+// the message is not stored, e.g. because a MessageProcessor dropped it,
+// SendAndCapture waits until ctx is done.
+func (s *Server) SendAndCapture(ctx context.Context, from string, to []string, msg []byte) (Email, error) {
+	addr := s.SMTPAddr()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	// The email is delivered to subscribers before DATA is answered, so
+	// subscribe first and pick it out by the address of our connection
+	emails, cancel := s.Subscribe(SubscribeBackpressure(Block))
+	defer cancel()
+	captured := make(chan Email, 1)
+	local := conn.LocalAddr().String()
+	go func() {
+		for email := range emails {
+			if email.RemoteAddr == local {
+				select {
+				case captured <- email:
+				default:
+				}
+			}
+		}
+	}()
+
+	if err := s.sendSMTP(conn, from, to, msg); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return Email{}, fmt.Errorf("failed to send email: %w", err)
+	}
+
+	select {
+	case email := <-captured:
+		return email, nil
+	case <-ctx.Done():
+		return Email{}, fmt.Errorf("failed to wait for email: %w", ctx.Err())
+	}
+}
+
+// sendSMTP runs one mail transaction on conn, authenticating with the
+// SetAuth credentials if there are any.
+func (s *Server) sendSMTP(conn net.Conn, from string, to []string, msg []byte) error {
+	c := smtp.NewClient(conn)
+	defer c.Close()
+
+	s.mu.RLock()
+	auth := s.auth
+	s.mu.RUnlock()
+	if auth != nil {
+		if err := c.Auth(sasl.NewPlainClient("", auth.username, auth.password)); err != nil {
+			return err
+		}
+	}
+	if err := c.SendMail(from, to, bytes.NewReader(msg)); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// checkRcpt applies the checks made on each RCPT TO, given the number of
+// recipients already accepted and the announced message size.
+func (s *Server) checkRcpt(count int, rcpt string, size int64) error {
+	if err := s.checkRecipients(count); err != nil {
+		return err
+	}
+	if err := s.checkRejections(rcpt); err != nil {
+		return err
+	}
+	return s.checkQuota(rcpt, size)
+}
@@ -0,0 +1,73 @@
+package mailcatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+func TestSend(t *testing.T) {
+	// No listener: the server is never started
+	server := New(0, 0)
+	server.SetMailboxQuota("full@example.com", Quota{Messages: 0, Bytes: 1})
+
+	var sender Sender = server
+	msg := []byte("From: App <app@example.com>\r\nSubject: In process\r\n\r\nHello\r\n")
+	if err := sender.Send("app@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	emails := server.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+	if emails[0].Subject != "In process" || emails[0].From.Name != "App" || !emails[0].HasRecipient("user@example.com") {
+		t.Errorf("Expected parsed email, got %+v", emails[0])
+	}
+
+	var smtpErr *smtp.SMTPError
+	err := sender.Send("app@example.com", []string{"full@example.com"}, msg)
+	if !errors.As(err, &smtpErr) || smtpErr.Code != 452 {
+		t.Errorf("Expected 452 mailbox full, got %v", err)
+	}
+	if err := sender.Send("app@example.com", nil, msg); err == nil {
+		t.Error("Expected error without recipients")
+	}
+
+	sendMail := server.SendMailFunc()
+	if err := sendMail("localhost:25", nil, "app@example.com", []string{"other@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send through SendMailFunc: %v", err)
+	}
+	if emails := server.Emails(); len(emails) != 2 {
+		t.Errorf("Expected 2 emails, got %d", len(emails))
+	}
+}
+
+func TestSendAndCapture(t *testing.T) {
+	server, _ := NewTestServer(t, WithAuth("app", "secret"))
+	server.RejectRecipient("blocked@example.com", &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 1}, Message: "No such user"})
+	server.AddHoldRule(func(e Email) bool { return e.Subject == "Held" })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, subject := range []string{"Welcome", "Held"} {
+		msg := fmt.Appendf(nil, "From: App <app@example.com>\r\nSubject: %s\r\n\r\nHello\r\n", subject)
+		email, err := server.SendAndCapture(ctx, "app@example.com", []string{"user@example.com"}, msg)
+		if err != nil {
+			t.Fatalf("Failed to send and capture: %v", err)
+		}
+		if email.Subject != subject || email.Auth == nil || email.Auth.Username != "app" || len(email.Transcript) == 0 {
+			t.Errorf("Expected the captured %s email with session details, got %+v", subject, email)
+		}
+	}
+
+	var smtpErr *smtp.SMTPError
+	_, err := server.SendAndCapture(ctx, "app@example.com", []string{"blocked@example.com"}, []byte("Subject: Blocked\r\n\r\nHello\r\n"))
+	if !errors.As(err, &smtpErr) || smtpErr.Code != 550 {
+		t.Errorf("Expected the 550 rejection, got %v", err)
+	}
+}
@@ -7,10 +7,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net"
 	"net/http"
+	"net/mail"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/emersion/go-smtp"
@@ -20,11 +26,163 @@ import (
 // Email represents a captured email message.
 type Email struct {
 	ID      string    `json:"id"`
-	From    string    `json:"from"`
+	From    Address   `json:"from"`
 	Subject string    `json:"subject"`
 	Body    string    `json:"body"`
 	Time    time.Time `json:"time"`
-	To      []string  `json:"to"`
+	To      []Address `json:"to"`
+	Cc      []Address `json:"cc,omitempty"`
+	// Bcc holds the addresses of a Bcc header the client left in, followed
+	// by the envelope recipients missing from the To, Cc and Bcc headers.
+	Bcc []Address `json:"bcc,omitempty"`
+
+	// Envelope is the SMTP envelope as received, independent of the
+	// message headers.
+	Envelope Envelope `json:"envelope,omitzero"`
+
+	// ReplyTo, MessageID and Date are parsed from the message header.
+	// MessageID has no angle brackets; Date is zero if missing or invalid.
+	ReplyTo   []Address `json:"reply_to,omitempty"`
+	MessageID string    `json:"message_id,omitempty"`
+	Date      time.Time `json:"date,omitzero"`
+
+	// Headers holds the message header, keyed by canonical name.
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// Text and HTML are the decoded plain-text and HTML bodies: the first
+	// part of each type that is not an attachment.
+	Text string `json:"text,omitempty"`
+	HTML string `json:"html,omitempty"`
+
+	// Parts lists the leaf MIME parts with their decoded content.
+	Parts []Part `json:"parts,omitempty"`
+
+	// Attachments lists the parts that are files, in message order.
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// ToGroups and CcGroups hold RFC 5322 groups found in the To and Cc
+	// headers. Group members are also included in To and Cc.
+	ToGroups []Group `json:"to_groups,omitempty"`
+	CcGroups []Group `json:"cc_groups,omitempty"`
+
+	// Size is the number of message bytes received.
+	Size int64 `json:"size"`
+	// Hash is the SHA-256 of the envelope and message without the Date,
+	// Message-ID and DKIM-Signature headers and with MIME boundaries
+	// normalized, so a message sent again has the same Hash.
+	Hash string `json:"hash,omitempty"`
+	// DataDuration is the time taken to receive the message content.
+	DataDuration time.Duration `json:"data_duration"`
+	// SessionDuration is the time from connection to the message being
+	// received, including any earlier messages on the same connection.
+	SessionDuration time.Duration `json:"session_duration"`
+
+	// Transcript holds the SMTP commands of the transaction that delivered
+	// the email, starting after the previous message on the same connection.
+	Transcript []Command `json:"transcript,omitempty"`
+
+	// Extensions lists the ESMTP extensions the client used to send the
+	// email, e.g. SMTPUTF8 for internationalized addresses or PIPELINING,
+	// sorted by name. See SetExtensions for the ones advertised.
+	Extensions []string `json:"extensions,omitempty"`
+
+	// DataFindings lists bare line endings, dot-stuffing errors and SMTP
+	// smuggling sequences in the DATA content as sent by the client.
+	DataFindings []DataFinding `json:"data_findings,omitempty"`
+
+	// PolicyViolations lists attachments breaking the AttachmentPolicy.
+	PolicyViolations []PolicyViolation `json:"policy_violations,omitempty"`
+
+	// Validation holds the results of the checks enabled with
+	// SetValidation: DKIM signatures, SPF and header lint.
+	Validation *ValidationReport `json:"validation,omitempty"`
+
+	// Truncated is set if content was dropped as set by SetCapture. Size
+	// is still the size received.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Held is set while the email is on hold by a HoldRule.
+	Held bool `json:"held,omitempty"`
+
+	// Unread is set on capture and cleared by MarkRead, so people checking
+	// mail by hand can tell which messages they have already looked at.
+	Unread bool `json:"unread,omitempty"`
+
+	// Tags are labels added with Tag or the HTTP API.
+	Tags []string `json:"tags,omitempty"`
+
+	// Annotations are computed fields added by a MessageProcessor.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// BounceOf is set on a delivery status notification generated by a
+	// BounceRecipient rule to the ID of the email that bounced.
+	BounceOf string `json:"bounce_of,omitempty"`
+
+	// RemoteAddr is the client address and Helo the hostname it announced
+	// in HELO or EHLO. TLS is set if the connection was encrypted, by
+	// STARTTLS or an ImplicitTLS listener. All three are empty for mail
+	// added through Send or the HTTP API.
+	RemoteAddr string   `json:"remote_addr,omitempty"`
+	Helo       string   `json:"helo,omitempty"`
+	TLS        *TLSInfo `json:"tls,omitempty"`
+
+	// Auth is set if the client authenticated before sending the email;
+	// Auth.Username is the authenticated user.
+	Auth *AuthInfo `json:"auth,omitempty"`
+
+	// Listener names the SMTP port the email arrived on: DefaultListener
+	// or the Name of a Listener. It is empty for mail added through Send
+	// or the HTTP API.
+	Listener string `json:"listener,omitempty"`
+
+	// Compression is set on the copies a CompressedStore passes to the
+	// store it wraps, whose Body, Text, HTML and part contents are then
+	// compressed with it. It is empty on emails read back.
+	Compression Compression `json:"compression,omitempty"`
+
+	hops int // number of mailcatcher instances that forwarded this email
+}
+
+// Envelope is the sender and recipients given in MAIL FROM and RCPT TO.
+// To is nil for messages stored through the HTTP API without recipients.
+type Envelope struct {
+	From string   `json:"from"`
+	To   []string `json:"to,omitempty"`
+}
+
+// Header returns the first value of the named header, or "" if the
+// message has no such header. The name is case-insensitive; Headers holds
+// every value.
+func (e *Email) Header(name string) string {
+	return mail.Header(e.Headers).Get(name)
+}
+
+// Raw returns the original RFC 5322 message as received, e.g. to feed it
+// to external spam or DKIM analyzers.
+func (e *Email) Raw() []byte {
+	return []byte(e.Body)
+}
+
+// HasRecipient reports whether addr appears in the To or Cc addresses or
+// among the envelope recipients, which include blind copies. See
+// Address.Matches for how internationalized addresses are compared.
+func (e *Email) HasRecipient(addr string) bool {
+	for _, a := range e.To {
+		if a.Matches(addr) {
+			return true
+		}
+	}
+	for _, a := range e.Cc {
+		if a.Matches(addr) {
+			return true
+		}
+	}
+	for _, to := range e.Envelope.To {
+		if parseAddress(to).Matches(addr) {
+			return true
+		}
+	}
+	return false
 }
 
 // Logger is a simple logging interface.
@@ -36,43 +194,128 @@ type Logger interface {
 type Server struct {
 	smtpServer *smtp.Server
 	httpServer *http.Server
-	logger     Logger
-	messages   []Email
+	mux        *http.ServeMux
+	log        *slog.Logger
+	store      Store
+	forwardURL string
+	holdRules  []HoldRule
+	quota      Quota
+	rejections Rejections
+	extensions Extensions
+	rateLimit  RateLimit
 	mu         sync.RWMutex
+	stopWatch  context.CancelFunc
+	host       string
 	smtpPort   int
 	httpPort   int
+
+	mailboxQuotas map[string]Quota
+	maxRecipients int
+	limits        limitState
+
+	recipientRejections []addressRejection
+	senderRejections    []addressRejection
+	faults              Faults
+	bounceRules         []bounceRule
+	latency             Latency
+	hooks               hooks
+	apiAuth             apiAuth
+	recordDir           string
+	notifiers           []Notifier
+	strictData          bool
+	attachmentPolicy    *AttachmentPolicy
+	validation          *Validation
+	alerts              alertState
+	push                *webPush
+	webhooks            *webhooks
+	arrived             chan struct{} // closed on the next arrival, see WaitFor
+	events              eventHub
+	subscribers         emailHub
+	auth                *credentials
+	authRejection       *smtp.SMTPError
+	retention           Retention
+	retentionChanged    chan struct{} // wakes the sweep, see SetRetention
+	evictions           retentionState
+	capture             Capture
+	captured            captureState
+	stopRetention       context.CancelFunc
+	stopOnDone          func() bool // unregisters the StartContext cancellation
+	errs                chan error
+	pop3                *mailboxListener
+	imap                *mailboxListener
+	listeners           []*smtpListener
+	smtpListener        net.Listener // closed by Stop too, see smtpListener.close
+	stopping            atomic.Bool
+	transactions        transactions
+	limiter             limiter
+	proxies             proxyState
+	oversized           []Oversized
+	relay               *Relay
+	relayRules          []RelayRule
+	forwardToken        string // see SetForwardToken
+	namespaceDomain     string // see SetNamespaceDomain
+	processors          []MessageProcessor
+	scenario            scenarioState
+	checkpoints         checkpointState
+	updates             sync.Mutex // serializes updateEmail
 }
 
 // New creates a new mail catcher server with custom ports.
 func New(smtpPort, httpPort int) *Server {
+	return NewWithOptions(WithSMTPPort(smtpPort), WithHTTPPort(httpPort))
+}
+
+// NewWithOptions creates a new mail catcher server configured by opts.
+// Without options it listens on the default ports on all interfaces.
+func NewWithOptions(opts ...Option) *Server {
 	s := &Server{
-		messages: make([]Email, 0),
-		smtpPort: smtpPort,
-		httpPort: httpPort,
+		store:    NewMemoryStore(),
+		smtpPort: defaultSMTPPort,
+		httpPort: defaultHTTPPort,
+		push:     newWebPush(),
+		errs:     make(chan error, 8),
+
+		retentionChanged: make(chan struct{}, 1),
 	}
+	s.webhooks = &webhooks{server: s, retryDelay: time.Second}
+	s.notifiers = []Notifier{s.push, s.webhooks}
 
 	// Setup SMTP server
 	backend := &backend{server: s}
 	s.smtpServer = smtp.NewServer(backend)
-	s.smtpServer.Addr = fmt.Sprintf(":%d", smtpPort)
 	s.smtpServer.Domain = "localhost"
 	s.smtpServer.AllowInsecureAuth = true
-	s.smtpServer.MaxLineLength = 16 * 1024 * 1024 // 16MB - allow long lines for HTML emails
+	s.setExtensions(DefaultExtensions())
+	s.smtpServer.MaxLineLength = defaultMaxLineLength // 16MB - allow long lines for HTML emails
 
 	// Setup HTTP API server
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /api/v1/emails", s.handleGetEmails)
-	mux.HandleFunc("GET /api/v1/emails/", s.handleGetEmail)
-	mux.HandleFunc("DELETE /api/v1/emails", s.handleDeleteEmails)
+	s.mux = mux
+	for pattern, handler := range s.routes() {
+		mux.HandleFunc(pattern, handler)
+	}
+	mux.Handle("GET /", uiHandler())
 
-	// Wrap with CORS middleware
-	handler := corsMiddleware(mux)
+	// Wrap with authentication and CORS middleware
+	handler := s.forwardedFor(s.logRequests(corsMiddleware(s.apiAuthMiddleware(mux))))
 
 	s.httpServer = &http.Server{
-		Addr:              fmt.Sprintf(":%d", httpPort),
 		Handler:           handler,
 		ReadHeaderTimeout: 10 * time.Second,
 	}
+	s.httpServer.RegisterOnShutdown(s.events.close)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.smtpServer.Addr = net.JoinHostPort(s.host, strconv.Itoa(s.smtpPort))
+	s.httpServer.Addr = net.JoinHostPort(s.host, strconv.Itoa(s.httpPort))
+	for _, l := range s.mailboxListeners() {
+		l.addr = net.JoinHostPort(s.host, strconv.Itoa(l.port))
+	}
+	for _, l := range s.listeners {
+		l.addr = net.JoinHostPort(s.host, strconv.Itoa(l.config.Port))
+	}
 
 	return s
 }
@@ -80,119 +323,398 @@ func New(smtpPort, httpPort int) *Server {
 // NewWithDefaults creates a new mail catcher server with default ports.
 // SMTP: 1025, HTTP: 8025
 func NewWithDefaults() *Server {
-	return New(1025, 8025)
+	return NewWithOptions()
+}
+
+// NewUnstarted returns a server on ephemeral ports that is not yet
+// listening, like httptest.NewUnstartedServer. Its TLS configuration,
+// store, SMTP backend and HTTP handlers can be adjusted through
+// SMTPServer, SetStore, HTTPServer and Mux before calling Start.
+func NewUnstarted() *Server {
+	return New(0, 0)
+}
+
+// SMTPServer returns the underlying SMTP server, e.g. to set TLSConfig
+// and enable STARTTLS. Its Addr holds the bound address once started.
+// Changes must be made before Start.
+func (s *Server) SMTPServer() *smtp.Server {
+	return s.smtpServer
+}
+
+// HTTPServer returns the underlying HTTP API server. Its Addr holds the
+// bound address once started. Changes must be made before Start.
+func (s *Server) HTTPServer() *http.Server {
+	return s.httpServer
+}
+
+// SMTPAddr returns the address of the SMTP listener, e.g. "127.0.0.1:40123".
+// After Start it reflects the bound port, so servers created with port 0
+// can be reached; an unspecified bind address is reported as 127.0.0.1.
+func (s *Server) SMTPAddr() string {
+	return dialAddr(s.smtpServer.Addr)
+}
+
+// HTTPAddr returns the address of the HTTP API listener, like SMTPAddr.
+func (s *Server) HTTPAddr() string {
+	return dialAddr(s.httpServer.Addr)
+}
+
+// SMTPPort returns the SMTP port, which is the bound port after Start.
+func (s *Server) SMTPPort() int {
+	return addrPort(s.smtpServer.Addr)
+}
+
+// HTTPPort returns the HTTP API port, which is the bound port after Start.
+func (s *Server) HTTPPort() int {
+	return addrPort(s.httpServer.Addr)
+}
+
+// dialAddr turns a listen address into one clients can connect to.
+func dialAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func addrPort(addr string) int {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// Mux returns the router of the HTTP API, so tests can register
+// additional handlers next to the built-in endpoints.
+func (s *Server) Mux() *http.ServeMux {
+	return s.mux
 }
 
 // Start starts the mail catcher server.
 func (s *Server) Start() error {
+	return s.StartContext(context.Background())
+}
+
+// StartContext starts the mail catcher server like Start, giving up if ctx
+// is canceled before the listeners are bound. Once started, the server is
+// stopped when ctx is done, so StartContext(t.Context()) ties it to a test.
+// Listener failures after startup are reported on Err.
+func (s *Server) StartContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to start mail catcher: %w", err)
+	}
 	lc := &net.ListenConfig{}
-	ctx := context.Background()
 
 	// Start SMTP server
 	smtpListener, err := lc.Listen(ctx, "tcp", s.smtpServer.Addr)
 	if err != nil {
 		return fmt.Errorf("failed to start SMTP server: %w", err)
 	}
+	s.smtpServer.Addr = smtpListener.Addr().String()
+	s.smtpListener = smtpListener
+
+	listener := &transcriptListener{Listener: &slowListener{Listener: &limitListener{Listener: newProxyListener(smtpListener, s), server: s}, server: s}, hidden: s.Extensions().hidden()}
+	if s.recordDir != "" {
+		listener.record = s.saveRecording
+	}
+
+	// The watch state decides who delivers new mail, so it is set before
+	// the first session can add any
+	watcher, watching := storeWatcher(s.store)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	if watching {
+		s.stopWatch = stopWatch
+	}
+	s.stopping.Store(false)
+	// abort undoes a partial start; stopping keeps the closed listeners
+	// from being reported as failures
+	abort := func() {
+		s.stopping.Store(true)
+		stopWatch()
+		s.stopWatch = nil
+		_ = smtpListener.Close()
+		s.closeListeners()
+	}
 
 	go func() {
-		if serveErr := s.smtpServer.Serve(smtpListener); serveErr != nil && !errors.Is(serveErr, smtp.ErrServerClosed) {
-			if s.logger != nil {
-				s.logger.Printf("SMTP server error: %v", serveErr)
-			}
+		if serveErr := s.smtpServer.Serve(listener); serveErr != nil && !errors.Is(serveErr, smtp.ErrServerClosed) && !s.stopping.Load() {
+			s.fail(fmt.Errorf("SMTP server failed: %w", serveErr))
 		}
 	}()
 
+	for _, l := range s.listeners {
+		if err := l.start(ctx, lc, s); err != nil {
+			abort()
+			return err
+		}
+	}
+
 	// Start HTTP server
 	httpListener, err := lc.Listen(ctx, "tcp", s.httpServer.Addr)
 	if err != nil {
-		_ = smtpListener.Close()
+		abort()
 		return fmt.Errorf("failed to start HTTP server: %w", err)
 	}
+	s.httpServer.Addr = httpListener.Addr().String()
 
 	go func() {
-		if err := s.httpServer.Serve(httpListener); err != nil && err != http.ErrServerClosed {
-			if s.logger != nil {
-				s.logger.Printf("HTTP server error: %v", err)
-			}
+		if err := s.httpServer.Serve(httpListener); err != nil && err != http.ErrServerClosed && !s.stopping.Load() {
+			s.fail(fmt.Errorf("HTTP server failed: %w", err))
 		}
 	}()
 
+	for _, l := range s.mailboxListeners() {
+		if err := l.start(ctx, lc, s.fail); err != nil {
+			abort()
+			_ = httpListener.Close()
+			for _, started := range s.mailboxListeners() {
+				_ = started.close()
+			}
+			return err
+		}
+	}
+
+	retentionCtx, stopRetention := context.WithCancel(context.Background())
+	s.stopRetention = stopRetention
+	s.startRetention(retentionCtx)
+
+	// Follow changes made by other replicas sharing the store
+	if watching {
+		go func() {
+			if err := watcher.Watch(watchCtx, s.handleEvent); err != nil {
+				s.fail(fmt.Errorf("store watch failed: %w", err))
+			}
+		}()
+	}
+
+	s.stopOnDone = context.AfterFunc(ctx, func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Stop(stopCtx); err != nil {
+			s.errorf("Failed to stop: %v", err)
+		}
+	})
+
 	return nil
 }
 
-// Stop stops the mail catcher server.
+// Err returns a channel receiving the errors that stop a listener, the
+// HTTP server or the store watch after a successful start. Without it,
+// such a failure shows only in the log and as mail that never arrives.
+// Errors are dropped if the channel is not drained.
+func (s *Server) Err() <-chan error {
+	return s.errs
+}
+
+// fail logs err and reports it on Err.
+func (s *Server) fail(err error) {
+	s.errorf("%v", err)
+	select {
+	case s.errs <- err:
+	default:
+	}
+}
+
+// Stop stops the mail catcher server. SMTP listeners stop accepting
+// connections first, and messages being sent are received before the
+// remaining sessions are closed; new transactions get a 421 reply. If ctx
+// expires first, the server is stopped anyway and the error returned.
+// Stopping a stopped server is a no-op.
 func (s *Server) Stop(ctx context.Context) error {
-	if err := s.smtpServer.Close(); err != nil {
+	if s.stopOnDone != nil {
+		s.stopOnDone()
+	}
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	if s.stopRetention != nil {
+		s.stopRetention()
+	}
+
+	drainErr := s.drain(ctx)
+	s.webhooks.stop()
+	if err := s.smtpServer.Close(); err != nil && !errors.Is(err, smtp.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
 		return fmt.Errorf("failed to close SMTP server: %w", err)
 	}
+	for _, l := range s.listeners {
+		if err := l.close(); err != nil {
+			return fmt.Errorf("failed to close SMTP listener %s: %w", l.config.Name, err)
+		}
+	}
+	s.subscribers.close()
 
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		return fmt.Errorf("failed to shutdown HTTP server: %w", err)
 	}
 
+	for _, l := range s.mailboxListeners() {
+		if err := l.close(); err != nil {
+			return fmt.Errorf("failed to close %s server: %w", l.name, err)
+		}
+	}
+
+	if drainErr != nil {
+		return fmt.Errorf("failed to drain SMTP sessions: %w", drainErr)
+	}
 	return nil
 }
 
-// Emails returns all captured email messages.
+// Emails returns all captured email messages, excluding held ones.
+// Store errors are reported to the logger and yield an empty list.
 func (s *Server) Emails() []Email {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	all, err := s.store.List(context.Background())
+	if err != nil {
+		s.errorf("Failed to list emails: %v", err)
+		return []Email{}
+	}
 
-	emails := make([]Email, len(s.messages))
-	copy(emails, s.messages)
+	emails := make([]Email, 0, len(all))
+	for _, email := range all {
+		if !email.Held {
+			emails = append(emails, email)
+		}
+	}
 	return emails
 }
 
-// Email returns a specific email by ID.
+// Email returns a specific email by ID, including held ones.
 // Returns nil if email with given ID is not found.
 func (s *Server) Email(id string) *Email {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	for i := range s.messages {
-		if s.messages[i].ID == id {
-			email := s.messages[i]
-			return &email
+	email, err := s.store.Get(context.Background(), id)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			s.errorf("Failed to get email %s: %v", id, err)
 		}
+		return nil
 	}
-	return nil
+	return &email
 }
 
 // Clear removes all captured messages.
 func (s *Server) Clear() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	err := s.store.Clear(context.Background())
+	s.forgetStoredBytes()
+	if err != nil {
+		s.errorf("Failed to clear emails: %v", err)
+		return
+	}
+	s.publish(Event{Type: EventCleared})
+}
 
-	s.messages = make([]Email, 0)
+// Delete removes the email with the given ID, including a held one.
+// It returns an error wrapping ErrNotFound if there is no such email.
+func (s *Server) Delete(id string) error {
+	if err := s.store.Delete(context.Background(), id); err != nil {
+		return err
+	}
+	s.forgetStoredBytes()
+	s.publish(Event{Type: EventDeleted, ID: id})
+	return nil
 }
 
-// SetLogger sets a custom logger for server errors.
-// By default, errors are silently ignored.
-func (s *Server) SetLogger(logger Logger) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.logger = logger
+// Store returns the message store.
+func (s *Server) Store() Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store
 }
 
-// addMessage adds a new email to the captured messages.
-func (s *Server) addMessage(email Email) {
+// SetStore replaces the message store. It must be called before Start.
+// Emails in the previous store are not copied.
+func (s *Server) SetStore(store Store) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.store = store
+	s.forgetStoredBytes()
+}
+
+// SetLogger sets a custom logger for server errors, warnings and
+// notable events, see SetLogHandler. By default, nothing is logged.
+func (s *Server) SetLogger(logger Logger) {
+	s.SetLogHandler(NewLoggerHandler(logger, slog.LevelInfo))
+}
 
-	email.ID = fmt.Sprintf("msg-%d", len(s.messages))
+// addMessage adds a new email to the captured messages.
+// It returns the stored email with its ID and capture time set.
+func (s *Server) addMessage(email Email) (Email, error) {
+	if keep, err := s.process(&email); err != nil || !keep {
+		return email, err
+	}
+	email.Hash = contentHash(email)
+	if !s.applyCapture(&email) {
+		return email, nil
+	}
+	email.Held = s.shouldHold(email)
+	email.Unread = true
 	email.Time = time.Now()
-	s.messages = append(s.messages, email)
+
+	stored, err := s.addEmail(context.Background(), email)
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to store email: %w", err)
+	}
+	s.logger().Info("Captured message", "id", stored.ID, "from", stored.From.Address, "to", stored.Envelope.To,
+		"size", stored.Size, "held", stored.Held)
+
+	s.mu.RLock()
+	forwardURL, forwardToken := s.forwardURL, s.forwardToken
+	s.mu.RUnlock()
+
+	if forwardURL != "" && stored.hops < maxForwardHops {
+		go s.forward(forwardURL, forwardToken, stored)
+	}
+	s.relayByRules(stored)
+	s.enforceRetention()
+	s.publish(Event{Type: EventAdded, ID: stored.ID, Email: &stored})
+	s.runMessageHooks(stored)
+	s.deliver(stored)
+	if !stored.Held {
+		s.notify(stored)
+		s.signalArrival()
+	}
+	s.checkThresholds(stored)
+	s.bounce(stored)
+	return stored, nil
+}
+
+// handleEvent is called for every change to a shared store.
+func (s *Server) handleEvent(event Event) {
+	if event.Type == EventAdded || event.Type == EventUpdated {
+		s.signalArrival()
+		event.Email = s.Email(event.ID)
+	}
+	if event.Type == EventAdded && event.Email != nil {
+		s.deliverAll(*event.Email)
+	}
+	s.broadcast(event)
+	s.logger().Debug("Store event", "type", event.Type, "id", event.ID)
 }
 
 // HTTP handlers
 
 func (s *Server) handleGetEmails(w http.ResponseWriter, r *http.Request) {
-	emails := s.Emails()
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	emails := s.Find(filter)
+	items := page.apply(emails)
 
 	response := map[string]any{
 		"total": len(emails),
-		"count": len(emails),
-		"items": emails,
+		"count": len(items),
+		"items": items,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -202,14 +724,7 @@ func (s *Server) handleGetEmails(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleGetEmail(w http.ResponseWriter, r *http.Request) {
-	// Extract email ID from path: /api/v1/emails/msg-0
-	id := r.URL.Path[len("/api/v1/emails/"):]
-	if id == "" {
-		http.Error(w, "Email ID is required", http.StatusBadRequest)
-		return
-	}
-
-	email := s.Email(id)
+	email := s.Email(r.PathValue("id"))
 	if email == nil {
 		http.Error(w, "Email not found", http.StatusNotFound)
 		return
@@ -221,71 +736,328 @@ func (s *Server) handleGetEmail(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) handleGetRawEmail(w http.ResponseWriter, r *http.Request) {
+	email := s.Email(r.PathValue("id"))
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	raw := email.Raw()
+	w.Header().Set("Content-Type", "message/rfc822")
+	w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": email.ID + ".eml"}))
+	_, _ = w.Write(raw)
+}
+
 func (s *Server) handleDeleteEmails(w http.ResponseWriter, r *http.Request) {
 	s.Clear()
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *Server) handleDeleteEmail(w http.ResponseWriter, r *http.Request) {
+	if err := s.Delete(r.PathValue("id")); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Email not found", http.StatusNotFound)
+		} else {
+			s.errorf("Failed to delete email: %v", err)
+			http.Error(w, "Failed to delete email", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // SMTP Backend implementation
 
 type backend struct {
-	server *Server
+	server   *Server
+	listener *Listener // nil for the main SMTP server
 }
 
-func (b *backend) NewSession(_ *smtp.Conn) (smtp.Session, error) {
-	return &session{server: b.server}, nil
+func (b *backend) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	sess := &session{server: b.server, conn: c.Conn(), smtpConn: c, listener: b.listener, start: time.Now()}
+	if tc, ok := c.Conn().(*transcriptConn); ok {
+		sess.transcript = tc
+		sess.start = tc.start
+	}
+	sess.replies = connReplies(c.Conn())
+	sess.info = SessionInfo{RemoteAddr: c.Conn().RemoteAddr().String(), Hostname: c.Hostname(), Start: time.Now()}
+	b.server.runSessionHooks(false, sess.info)
+	b.server.logger().Debug("SMTP session started", "remote", sess.info.RemoteAddr, "listener", sess.listenerName())
+	return sess, nil
 }
 
 type session struct {
-	server *Server
-	from   string
-	to     []string
-}
+	server     *Server
+	conn       net.Conn
+	smtpConn   *smtp.Conn
+	listener   *Listener       // nil for the main SMTP server
+	transcript *transcriptConn // nil if the connection is not recorded
+	start      time.Time
+	from       string
+	to         []string
+	size       int64    // declared with MAIL FROM SIZE=, or 0
+	params     []string // extensions used by MAIL FROM and RCPT TO parameters
 
-func (s *session) AuthPlain(username, password string) error {
-	return nil // Accept all auth
+	inTransaction bool            // counted in Server.transactions
+	rateSlot      time.Time       // message reserved under MessagesPerIP, until accepted
+	replies       *sessionReplies // nil if the session is not scripted
+
+	auth *AuthInfo // nil until the client authenticates
+	info SessionInfo
 }
 
-func (s *session) Mail(from string, opts *smtp.MailOptions) error {
+func (s *session) Mail(from string, opts *smtp.MailOptions) (err error) {
+	if s.server.auth != nil && s.auth == nil {
+		return errAuthRequired
+	}
+	if err := s.checkListener(); err != nil {
+		return err
+	}
+	if err := s.checkRateLimit(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.releaseRateSlot()
+		}
+	}()
+	if s.replies != nil {
+		if err := s.scripted(s.replies.mail); err != nil {
+			return err
+		}
+	}
+	if s.server.shouldDrop(DropAtMail) {
+		return s.drop()
+	}
+	if err := s.server.checkSenderRejections(from); err != nil {
+		return err
+	}
+	params, err := s.server.checkMailOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := s.beginTransaction(); err != nil {
+		return err
+	}
 	s.from = from
+	s.params = params
+	if opts != nil {
+		s.size = opts.Size
+	}
 	return nil
 }
 
 func (s *session) Rcpt(to string, opts *smtp.RcptOptions) error {
+	if s.server.shouldDrop(DropAtRcpt) {
+		return s.drop()
+	}
+	if s.replies != nil {
+		if err := s.scripted(s.replies.rcpt); err != nil {
+			return err
+		}
+	}
+	if s.server.scenario.greylisted(s.clientIP(), s.from, to, time.Now()) {
+		return errGreylisted
+	}
+	if err := s.server.checkRcpt(len(s.to), to, s.size); err != nil {
+		return err
+	}
 	s.to = append(s.to, to)
+	s.params = append(s.params, rcptExtensions(opts)...)
 	return nil
 }
 
 func (s *session) Data(r io.Reader) error {
+	dataStart := time.Now()
 	body, err := io.ReadAll(r)
+	if errors.Is(err, smtp.ErrDataTooLarge) {
+		return s.server.recordOversized(Oversized{
+			From:       s.from,
+			To:         s.to,
+			Listener:   s.listenerName(),
+			RemoteAddr: s.conn.RemoteAddr().String(),
+		})
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read email data: %w", err)
 	}
+	dataDuration := time.Since(dataStart)
 
-	// Parse subject from email headers
-	subject := parseSubject(body)
+	// Injected latency and faults apply once the whole message has been sent
+	s.server.delay(func(l Latency) time.Duration { return l.Data })
+	if s.server.shouldDrop(DropAtData) {
+		return s.drop()
+	}
+	if err := s.server.dataFailure(); err != nil {
+		return err
+	}
+	var accepted *smtp.SMTPError // scripted success reply
+	if s.replies != nil && s.replies.data != nil {
+		if s.replies.data.drop || s.replies.data.reply.Code >= 400 {
+			return s.scripted(s.replies.data)
+		}
+		accepted = s.replies.data.reply
+	}
 
-	// Store email
-	email := Email{
-		From:    s.from,
-		To:      s.to,
-		Subject: subject,
-		Body:    string(body),
+	var transcript []Command
+	var findings []DataFinding
+	var pipelined bool
+	if s.transcript != nil {
+		transcript, findings, pipelined = s.transcript.take()
+	}
+	if err := s.server.checkFindings(findings); err != nil {
+		return err
+	}
+
+	// Recheck quotas now that the actual size is known
+	for _, to := range s.to {
+		if err := s.server.checkQuota(to, int64(len(body))); err != nil {
+			return err
+		}
+	}
+
+	email := newEmail(s.from, s.to, body)
+	email.DataDuration = dataDuration
+	email.SessionDuration = time.Since(s.start)
+	email.Transcript = transcript
+	email.Extensions = transactionExtensions(s.params, transcript, pipelined)
+	email.DataFindings = findings
+	email.RemoteAddr = s.conn.RemoteAddr().String()
+	email.Helo = s.smtpConn.Hostname()
+	email.TLS = s.tlsInfo()
+	email.Auth = s.auth
+	email.Listener = s.listenerName()
+	if err := s.server.checkAttachments(&email); err != nil {
+		return err
+	}
+	s.server.validate(&email)
+	if err := s.server.checkAccept(email); err != nil {
+		return err
 	}
 
-	s.server.addMessage(email)
+	if _, err := s.server.addMessage(email); err != nil {
+		s.server.errorf("%v", err)
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 3, 0},
+			Message:      "Failed to store message",
+		}
+	}
+	s.info.Messages++
+	s.recordMessage()
+	if accepted != nil {
+		return accepted
+	}
 	return nil
 }
 
+// drop closes the connection without a reply, simulating a server crash
+// or network failure mid-transaction.
+func (s *session) drop() error {
+	s.server.infof("Dropping connection from %s", s.conn.RemoteAddr())
+	s.conn.Close()
+	return errDropped
+}
+
 func (s *session) Reset() {
 	s.from = ""
 	s.to = nil
+	s.size = 0
+	s.params = nil
+	s.releaseRateSlot()
+	s.endTransaction()
 }
 
 func (s *session) Logout() error {
+	s.releaseRateSlot()
+	s.endTransaction()
+	s.info.Duration = time.Since(s.info.Start)
+	s.server.runSessionHooks(true, s.info)
+	s.server.logger().Debug("SMTP session ended", "remote", s.info.RemoteAddr, "helo", s.smtpConn.Hostname(),
+		"messages", s.info.Messages, "duration", s.info.Duration)
 	return nil
 }
 
+// newEmail builds an Email from an envelope and the raw message,
+// parsing subject and addresses from the message headers.
+func newEmail(from string, rcpts []string, body []byte) Email {
+	// Parse subject and addresses from email headers
+	subject := parseSubject(body)
+	header := parseHeader(body)
+
+	email := Email{
+		From:    parseAddress(from),
+		To:      parseAddressList(header.Get("To")),
+		Cc:      parseAddressList(header.Get("Cc")),
+		Bcc:     parseAddressList(header.Get("Bcc")),
+		Subject: subject,
+		Body:    string(body),
+		Size:    int64(len(body)),
+
+		ReplyTo:   parseAddressList(header.Get("Reply-To")),
+		MessageID: strings.Trim(header.Get("Message-Id"), "<> "),
+
+		ToGroups: parseGroups(header.Get("To")),
+		CcGroups: parseGroups(header.Get("Cc")),
+
+		Headers: header,
+		Parts:   parseParts(body),
+
+		Envelope: Envelope{From: from, To: rcpts},
+	}
+
+	// Fall back to the envelope when the headers carry no addresses.
+	// A To header holding only an empty group is kept as is.
+	if from := parseAddressList(header.Get("From")); len(from) > 0 {
+		email.From = from[0]
+	}
+	if _, ok := header["To"]; !ok {
+		for _, to := range rcpts {
+			email.To = append(email.To, parseAddress(to))
+		}
+	}
+
+	// Envelope recipients the headers do not name were sent as blind copies
+	named := slices.Concat(email.To, email.Cc, email.Bcc)
+	for _, to := range rcpts {
+		addr := parseAddress(to)
+		if !slices.ContainsFunc(named, func(a Address) bool { return a.Matches(addr.Address) }) {
+			email.Bcc = append(email.Bcc, addr)
+		}
+	}
+
+	if date, err := header.Date(); err == nil {
+		email.Date = date
+	}
+
+	for _, part := range email.Parts {
+		if part.IsAttachment() {
+			continue
+		}
+		switch {
+		case part.ContentType == "text/plain" && email.Text == "":
+			email.Text = string(part.Content)
+		case part.ContentType == "text/html" && email.HTML == "":
+			email.HTML = string(part.Content)
+		}
+	}
+	email.Attachments = attachments(email.Parts)
+
+	return email
+}
+
+// parseHeader reads the header block of an email body.
+// A malformed header yields an empty header so callers fall back to envelope data.
+func parseHeader(body []byte) mail.Header {
+	msg, err := mail.ReadMessage(bytes.NewReader(body))
+	if err != nil {
+		return mail.Header{}
+	}
+	return msg.Header
+}
+
 // parseSubject extracts the Subject header from email body.
 func parseSubject(body []byte) string {
 	scanner := bufio.NewScanner(bytes.NewReader(body))
@@ -310,8 +1082,8 @@ func parseSubject(body []byte) string {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
 
 		// Handle preflight requests
 		if r.Method == http.MethodOptions {
@@ -3,9 +3,15 @@ package mailcatcher
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/smtp"
+	"net/textproto"
+	"strings"
 	"testing"
 	"time"
 )
@@ -27,6 +33,78 @@ func TestServerStartStop(t *testing.T) {
 	}
 }
 
+func TestStartContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := New(0, 0).StartContext(canceled); err == nil {
+		t.Fatal("Expected an error starting with a canceled context")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server := New(0, 0)
+	if err := server.StartContext(ctx); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	addr := server.SMTPAddr()
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the server to stop with its context")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := server.Stop(context.Background()); err != nil {
+		t.Errorf("Expected stopping a stopped server to succeed, got %v", err)
+	}
+}
+
+// failingWatchStore is a store whose watch breaks right away.
+type failingWatchStore struct {
+	*MemoryStore
+}
+
+func (failingWatchStore) Watch(context.Context, func(Event)) error {
+	return errors.New("connection lost")
+}
+
+func TestErr(t *testing.T) {
+	server, _ := NewTestServer(t, WithStore(failingWatchStore{NewMemoryStore()}))
+
+	select {
+	case err := <-server.Err():
+		if !strings.Contains(err.Error(), "connection lost") {
+			t.Errorf("Expected the watch error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the watch error on Err")
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer taken.Close()
+	server := New(0, taken.Addr().(*net.TCPAddr).Port)
+
+	if err := server.Start(); err == nil || !strings.Contains(err.Error(), "HTTP server") {
+		t.Fatalf("Expected the HTTP server to fail to start, got %v", err)
+	}
+	select {
+	case err := <-server.Err():
+		t.Errorf("Expected the SMTP teardown not to be reported, got %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
 func TestSendEmail(t *testing.T) {
 	server := New(10025, 10080)
 	err := server.Start()
@@ -68,11 +146,11 @@ func TestSendEmail(t *testing.T) {
 	}
 
 	email := emails[0]
-	if email.From != from {
+	if email.From.Address != from {
 		t.Errorf("Expected from=%s, got %s", from, email.From)
 	}
 
-	if len(email.To) != 1 || email.To[0] != to[0] {
+	if len(email.To) != 1 || email.To[0].Address != to[0] {
 		t.Errorf("Expected to=%v, got %v", to, email.To)
 	}
 
@@ -370,3 +448,373 @@ func TestCORSHeaders(t *testing.T) {
 		t.Errorf("Expected status 204 for OPTIONS, got %d", resp.StatusCode)
 	}
 }
+
+func TestHeaderAddresses(t *testing.T) {
+	server := New(10032, 10087)
+	err := server.Start()
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	msg := []byte("From: Acme Billing <billing@acme.com>\r\n" +
+		"To: Jane Doe <jane@example.com>\r\n" +
+		"Cc: bob@example.com\r\n" +
+		"Subject: Invoice\r\n" +
+		"\r\n" +
+		"Body\r\n")
+	err = smtp.SendMail("localhost:10032", nil, "bounces@acme.com",
+		[]string{"jane@example.com", "bob@example.com"}, msg)
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	emails := server.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+
+	email := emails[0]
+	if email.From.Name != "Acme Billing" || email.From.Address != "billing@acme.com" {
+		t.Errorf("Expected from='Acme Billing <billing@acme.com>', got '%s'", email.From)
+	}
+
+	if len(email.To) != 1 || email.To[0].Name != "Jane Doe" || email.To[0].Address != "jane@example.com" {
+		t.Errorf("Expected to=[Jane Doe <jane@example.com>], got %v", email.To)
+	}
+
+	if len(email.Cc) != 1 || email.Cc[0].Address != "bob@example.com" {
+		t.Errorf("Expected cc=[bob@example.com], got %v", email.Cc)
+	}
+}
+
+func TestInternationalizedRecipient(t *testing.T) {
+	server := New(10033, 10088)
+	err := server.Start()
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	msg := []byte("To: Клиент <клиент@пример.рф>\r\nSubject: Привет\r\n\r\nBody\r\n")
+	err = smtp.SendMail("localhost:10033", nil, "sender@example.com",
+		[]string{"клиент@пример.рф"}, msg)
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	emails := server.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+
+	email := emails[0]
+	if !email.HasRecipient("клиент@пример.рф") {
+		t.Errorf("Expected recipient to match Unicode form, got %v", email.To)
+	}
+	if !email.HasRecipient("клиент@xn--e1afmkfd.xn--p1ai") {
+		t.Errorf("Expected recipient to match punycode form, got %v", email.To)
+	}
+}
+
+func TestGroupAddresses(t *testing.T) {
+	server := New(10034, 10089)
+	err := server.Start()
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	msg := []byte("To: undisclosed-recipients:;\r\n" +
+		"Cc: Team: a@example.com, b@example.com;\r\n" +
+		"Subject: Groups\r\n" +
+		"\r\n" +
+		"Body\r\n")
+	err = smtp.SendMail("localhost:10034", nil, "sender@example.com",
+		[]string{"hidden@example.com"}, msg)
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	emails := server.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+
+	email := emails[0]
+	if len(email.To) != 0 {
+		t.Errorf("Expected no To addresses, got %v", email.To)
+	}
+	if len(email.ToGroups) != 1 || email.ToGroups[0].Name != "undisclosed-recipients" {
+		t.Errorf("Expected undisclosed-recipients group, got %+v", email.ToGroups)
+	}
+	if len(email.CcGroups) != 1 || email.CcGroups[0].Name != "Team" || len(email.CcGroups[0].Members) != 2 {
+		t.Errorf("Expected Team group with 2 members, got %+v", email.CcGroups)
+	}
+	if len(email.Cc) != 2 {
+		t.Errorf("Expected 2 Cc addresses, got %v", email.Cc)
+	}
+}
+
+func TestNewUnstarted(t *testing.T) {
+	server := NewUnstarted()
+	server.SMTPServer().Domain = "mx.test.example"
+	server.Mux().HandleFunc("GET /custom", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "custom")
+	})
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	_, smtpPort, _ := net.SplitHostPort(server.SMTPServer().Addr)
+	_, httpPort, _ := net.SplitHostPort(server.HTTPServer().Addr)
+	if smtpPort == "0" || httpPort == "0" {
+		t.Fatalf("Expected bound ports, got %s and %s", server.SMTPServer().Addr, server.HTTPServer().Addr)
+	}
+
+	conn, err := textproto.Dial("tcp", "localhost:"+smtpPort)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	_, greeting, _ := conn.ReadResponse(220)
+	conn.Close()
+	if !strings.HasPrefix(greeting, "mx.test.example") {
+		t.Errorf("Expected greeting from mx.test.example, got %q", greeting)
+	}
+
+	resp, err := http.Get("http://localhost:" + httpPort + "/custom")
+	if err != nil {
+		t.Fatalf("Failed to call custom handler: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "custom" {
+		t.Errorf("Expected custom handler response, got %q", body)
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") == "" {
+		t.Error("Expected custom handlers to be wrapped with CORS")
+	}
+}
+
+func TestListenerAddrs(t *testing.T) {
+	server := New(0, 0)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	if server.SMTPPort() == 0 || server.HTTPPort() == 0 {
+		t.Fatalf("Expected bound ports, got %d and %d", server.SMTPPort(), server.HTTPPort())
+	}
+	if want := fmt.Sprintf("127.0.0.1:%d", server.SMTPPort()); server.SMTPAddr() != want {
+		t.Errorf("Expected SMTP address %s, got %s", want, server.SMTPAddr())
+	}
+
+	msg := []byte("Subject: Ephemeral\r\n\r\nBody\r\n")
+	if err := smtp.SendMail(server.SMTPAddr(), nil, "sender@example.com", []string{"user@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	resp, err := http.Get("http://" + server.HTTPAddr() + "/api/v1/emails")
+	if err != nil {
+		t.Fatalf("Failed to GET emails: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestDialAddr(t *testing.T) {
+	for addr, want := range map[string]string{
+		"[::]:1025":      "127.0.0.1:1025",
+		"0.0.0.0:1025":   "127.0.0.1:1025",
+		":1025":          "127.0.0.1:1025",
+		"10.0.0.5:1025":  "10.0.0.5:1025",
+		"localhost:1025": "localhost:1025",
+	} {
+		if got := dialAddr(addr); got != want {
+			t.Errorf("Expected %s for %s, got %s", want, addr, got)
+		}
+	}
+}
+
+func TestDeleteEmail(t *testing.T) {
+	server := New(0, 0)
+	for _, subject := range []string{"Keep", "Drop"} {
+		msg := []byte("Subject: " + subject + "\r\n\r\nBody\r\n")
+		if err := server.Send("sender@example.com", []string{"user@example.com"}, msg); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+	emails := server.Emails()
+
+	if err := server.Delete(emails[1].ID); err != nil {
+		t.Fatalf("Failed to delete email: %v", err)
+	}
+	if err := server.Delete(emails[1].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	for id, want := range map[string]int{emails[0].ID: http.StatusNoContent, "msg-999": http.StatusNotFound} {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/emails/"+id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to DELETE email: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Expected status %d deleting %s, got %d", want, id, resp.StatusCode)
+		}
+	}
+
+	if n := len(server.Emails()); n != 0 {
+		t.Errorf("Expected no emails left, got %d", n)
+	}
+}
+
+func TestRawEmail(t *testing.T) {
+	server := New(0, 0)
+	msg := "From: sender@example.com\r\nSubject: Raw\r\nDKIM-Signature: v=1; a=rsa-sha256\r\n\r\nBody\r\n"
+	if err := server.Send("sender@example.com", []string{"user@example.com"}, []byte(msg)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	email := server.Emails()[0]
+	if string(email.Raw()) != msg {
+		t.Errorf("Expected raw message %q, got %q", msg, email.Raw())
+	}
+
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/emails/" + email.ID + "/raw")
+	if err != nil {
+		t.Fatalf("Failed to GET raw email: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != msg {
+		t.Errorf("Expected raw message %q, got %q", msg, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "message/rfc822" {
+		t.Errorf("Expected Content-Type message/rfc822, got %s", ct)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); cd != "attachment; filename="+email.ID+".eml" {
+		t.Errorf("Expected .eml download filename, got %s", cd)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/emails/msg-999/raw")
+	if err != nil {
+		t.Fatalf("Failed to GET raw email: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestParsedHeaders(t *testing.T) {
+	msg := "From: Shop <shop@example.com>\r\n" +
+		"To: user@example.com\r\n" +
+		"Bcc: audit@example.com\r\n" +
+		"Reply-To: Support <support@example.com>\r\n" +
+		"Message-ID: <abc123@mail.example.com>\r\n" +
+		"Date: Mon, 02 Jan 2006 15:04:05 -0700\r\n" +
+		"List-Unsubscribe: <https://example.com/unsubscribe?u=42>\r\n" +
+		"Subject: Offer\r\n\r\nBody\r\n"
+	email := newEmail("shop@example.com", []string{"user@example.com"}, []byte(msg))
+
+	if len(email.ReplyTo) != 1 || email.ReplyTo[0].Address != "support@example.com" || email.ReplyTo[0].Name != "Support" {
+		t.Errorf("Expected Reply-To Support <support@example.com>, got %v", email.ReplyTo)
+	}
+	if len(email.Bcc) != 1 || email.Bcc[0].Address != "audit@example.com" {
+		t.Errorf("Expected Bcc audit@example.com, got %v", email.Bcc)
+	}
+	if email.MessageID != "abc123@mail.example.com" {
+		t.Errorf("Expected Message-ID without brackets, got %q", email.MessageID)
+	}
+	if want := time.Date(2006, time.January, 2, 22, 4, 5, 0, time.UTC); !email.Date.Equal(want) {
+		t.Errorf("Expected Date %v, got %v", want, email.Date)
+	}
+	if got := email.Header("list-unsubscribe"); got != "<https://example.com/unsubscribe?u=42>" {
+		t.Errorf("Expected List-Unsubscribe header, got %q", got)
+	}
+	if got := email.Header("X-Missing"); got != "" {
+		t.Errorf("Expected empty missing header, got %q", got)
+	}
+}
+
+func TestEnvelopeBcc(t *testing.T) {
+	msg := "From: Shop <shop@example.com>\r\n" +
+		"To: user@example.com\r\n" +
+		"Cc: Team <team@example.com>\r\n" +
+		"Subject: Order\r\n\r\nBody\r\n"
+	email := newEmail("bounces@shop.example.com", []string{"User@Example.com", "team@example.com", "audit@example.com"}, []byte(msg))
+
+	if email.Envelope.From != "bounces@shop.example.com" || len(email.Envelope.To) != 3 {
+		t.Errorf("Expected the envelope as received, got %+v", email.Envelope)
+	}
+	if email.From.Address != "shop@example.com" {
+		t.Errorf("Expected From header shop@example.com, got %s", email.From.Address)
+	}
+	if len(email.Bcc) != 1 || email.Bcc[0].Address != "audit@example.com" {
+		t.Errorf("Expected Bcc audit@example.com, got %v", email.Bcc)
+	}
+
+	// The envelope survives stores that serialize emails
+	data, err := json.Marshal(email)
+	if err != nil {
+		t.Fatalf("Failed to encode email: %v", err)
+	}
+	var decoded Email
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode email: %v", err)
+	}
+	if decoded.Envelope.From != email.Envelope.From || len(decoded.Envelope.To) != 3 {
+		t.Errorf("Expected envelope %+v after decoding, got %+v", email.Envelope, decoded.Envelope)
+	}
+
+	// Without a To header the envelope recipients are not blind copies
+	email = newEmail("app@example.com", []string{"user@example.com"}, []byte("Subject: Hi\r\n\r\nBody\r\n"))
+	if len(email.Bcc) != 0 {
+		t.Errorf("Expected no Bcc without a To header, got %v", email.Bcc)
+	}
+}
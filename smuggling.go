@@ -0,0 +1,115 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/emersion/go-smtp"
+)
+
+// Types of DataFinding.
+const (
+	// FindingBareLF is a line ending in LF without the preceding CR.
+	FindingBareLF = "bare-lf"
+
+	// FindingBareCR is a CR not followed by LF.
+	FindingBareCR = "bare-cr"
+
+	// FindingDotStuffing is a line starting with a single dot, which the
+	// client should have doubled (RFC 5321, section 4.5.2). The receiver
+	// silently drops the dot.
+	FindingDotStuffing = "dot-stuffing"
+
+	// FindingSmuggling is an end-of-data lookalike such as <LF>.<LF> or
+	// <CR><LF>.<LF>, which receivers that end DATA on it would take as the
+	// end of the message (SMTP smuggling).
+	FindingSmuggling = "smuggling"
+)
+
+// DataFinding reports a protocol violation in the DATA content as sent by
+// the client, found before dot-unstuffing. Each type is reported once per
+// message, with the line it first occurred on and how often it occurred.
+type DataFinding struct {
+	Type  string `json:"type"`
+	Line  int    `json:"line"`
+	Count int    `json:"count"`
+}
+
+// dataScan inspects DATA content line by line.
+type dataScan struct {
+	line      int
+	lineStart bool // the previous line ended in CRLF
+	bareLF    bool // the previous line ended in a bare LF
+	findings  []DataFinding
+}
+
+// add records a finding on the current line.
+func (d *dataScan) add(typ string) {
+	for i := range d.findings {
+		if d.findings[i].Type == typ {
+			d.findings[i].Count++
+			return
+		}
+	}
+	d.findings = append(d.findings, DataFinding{Type: typ, Line: d.line, Count: 1})
+}
+
+// dataLine inspects one raw line of DATA content, ending in LF. Only
+// <CR><LF>.<CR><LF> ends the content, as in go-smtp.
+func (c *transcriptConn) dataLine(raw []byte) {
+	d := &c.data
+	d.line++
+
+	if d.lineStart && string(raw) == ".\r\n" {
+		c.inData = false
+		return
+	}
+
+	content, crlf := bytes.CutSuffix(raw, []byte("\r\n"))
+	if !crlf {
+		content = bytes.TrimSuffix(raw, []byte("\n"))
+		d.add(FindingBareLF)
+	}
+	if bytes.IndexByte(content, '\r') >= 0 {
+		d.add(FindingBareCR)
+	}
+
+	switch {
+	case bytes.Equal(content, []byte(".")) && (!crlf || d.bareLF),
+		bytes.HasSuffix(content, []byte("\r.")),
+		bytes.Contains(content, []byte("\r.\r")):
+		d.add(FindingSmuggling)
+	case d.lineStart && len(content) > 1 && content[0] == '.' && content[1] != '.':
+		d.add(FindingDotStuffing)
+	}
+
+	d.lineStart = crlf
+	d.bareLF = !crlf
+}
+
+// SetStrictData makes the server reject messages whose DATA content has
+// bare line endings, improper dot-stuffing or end-of-data lookalikes
+// instead of only recording them on the Email. It must be called before
+// Start.
+func (s *Server) SetStrictData(strict bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strictData = strict
+}
+
+// checkFindings rejects a message with findings in strict mode.
+func (s *Server) checkFindings(findings []DataFinding) error {
+	s.mu.RLock()
+	strict := s.strictData
+	s.mu.RUnlock()
+
+	if !strict || len(findings) == 0 {
+		return nil
+	}
+	f := findings[0]
+	return &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 6, 0},
+		Message:      fmt.Sprintf("Message rejected: %s at line %d", f.Type, f.Line),
+	}
+}
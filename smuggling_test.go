@@ -0,0 +1,97 @@
+package mailcatcher
+
+import (
+	"context"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+// sendRawData delivers content, which must include the terminating
+// <CR><LF>.<CR><LF>, without any normalization and returns the DATA reply.
+func sendRawData(t *testing.T, conn *textproto.Conn, content string) (int, string) {
+	t.Helper()
+
+	smtpCommand(t, conn, "MAIL FROM:<sender@example.com>")
+	smtpCommand(t, conn, "RCPT TO:<user@example.com>")
+	if code := smtpCommand(t, conn, "DATA"); code != 354 {
+		t.Fatalf("Expected 354 for DATA, got %d", code)
+	}
+	conn.W.WriteString(content)
+	conn.W.Flush()
+	code, msg, _ := conn.ReadResponse(0)
+	return code, msg
+}
+
+func TestDataFindings(t *testing.T) {
+	server := NewUnstarted()
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	conn := dialSMTP(t, server.SMTPServer().Addr)
+	defer conn.Close()
+	smtpCommand(t, conn, "EHLO client.example.com")
+
+	content := "Subject: Smuggled\r\n\r\nline\nbare\r\n.hidden\r\nfoo\r\n.\nMAIL FROM:<evil@example.com>\r\n.\r\n"
+	if code, msg := sendRawData(t, conn, content); code != 250 {
+		t.Fatalf("Expected 250 for DATA, got %d %s", code, msg)
+	}
+	if code, _ := sendRawData(t, conn, "Subject: Clean\r\n\r\n..stuffed\r\n.\r\n"); code != 250 {
+		t.Fatalf("Expected 250 for clean DATA, got %d", code)
+	}
+
+	emails := server.Emails()
+	if len(emails) != 2 {
+		t.Fatalf("Expected 2 emails, got %d", len(emails))
+	}
+
+	want := map[string]DataFinding{
+		FindingBareLF:      {Type: FindingBareLF, Line: 3, Count: 2},
+		FindingDotStuffing: {Type: FindingDotStuffing, Line: 5, Count: 1},
+		FindingSmuggling:   {Type: FindingSmuggling, Line: 7, Count: 1},
+	}
+	if len(emails[0].DataFindings) != len(want) {
+		t.Errorf("Expected %d findings, got %+v", len(want), emails[0].DataFindings)
+	}
+	for _, f := range emails[0].DataFindings {
+		if f != want[f.Type] {
+			t.Errorf("Expected %+v, got %+v", want[f.Type], f)
+		}
+	}
+	if len(emails[1].DataFindings) != 0 {
+		t.Errorf("Expected no findings for clean email, got %+v", emails[1].DataFindings)
+	}
+}
+
+func TestStrictData(t *testing.T) {
+	server := NewUnstarted()
+	server.SetStrictData(true)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	conn := dialSMTP(t, server.SMTPServer().Addr)
+	defer conn.Close()
+	smtpCommand(t, conn, "EHLO client.example.com")
+
+	if code, msg := sendRawData(t, conn, "Subject: Bare\r\n\r\nline\nmore\r\n.\r\n"); code != 550 {
+		t.Errorf("Expected 550 for bare LF in strict mode, got %d %s", code, msg)
+	}
+	if code, _ := sendRawData(t, conn, "Subject: Clean\r\n\r\nline\r\n.\r\n"); code != 250 {
+		t.Errorf("Expected 250 for clean DATA, got %d", code)
+	}
+	if emails := server.Emails(); len(emails) != 1 || emails[0].Subject != "Clean" {
+		t.Errorf("Expected only the clean email to be stored, got %d", len(emails))
+	}
+}
@@ -0,0 +1,288 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strings"
+)
+
+// VolatileHeaders change on every send of the same message and are left
+// out of snapshots.
+var VolatileHeaders = []string{
+	"Date", "Message-Id", "Received", "Return-Path", "Dkim-Signature",
+	"Arc-Seal", "Arc-Message-Signature", "Arc-Authentication-Results",
+	"Authentication-Results", "X-Mailer",
+}
+
+// Snapshot is the stable content of an email, for comparing it with a
+// golden file: the header without volatile fields or MIME boundaries, the
+// decoded bodies and the attachments by checksum.
+type Snapshot struct {
+	Headers     map[string][]string  `json:"headers"`
+	Text        string               `json:"text,omitempty"`
+	HTML        string               `json:"html,omitempty"`
+	Attachments []SnapshotAttachment `json:"attachments,omitempty"`
+}
+
+// SnapshotAttachment identifies an attachment in a Snapshot.
+type SnapshotAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+}
+
+// Snapshot returns the stable content of the email. The VolatileHeaders
+// and the named headers are left out.
+func (e *Email) Snapshot(ignore ...string) Snapshot {
+	snap := Snapshot{
+		Headers: map[string][]string{},
+		Text:    normalizeNewlines(e.Text),
+		HTML:    normalizeNewlines(e.HTML),
+	}
+	for name, values := range e.Headers {
+		if ignoredHeader(name, ignore) {
+			continue
+		}
+		if name == "Content-Type" {
+			values = []string{stripBoundary(values[0])}
+		}
+		snap.Headers[name] = values
+	}
+	for _, a := range e.Attachments {
+		sum := sha256.Sum256(a.Content)
+		snap.Attachments = append(snap.Attachments, SnapshotAttachment{
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Size:        int64(len(a.Content)),
+			SHA256:      hex.EncodeToString(sum[:]),
+		})
+	}
+	return snap
+}
+
+// ignoredHeader reports whether the named header is volatile or in ignore.
+func ignoredHeader(name string, ignore []string) bool {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	return slices.ContainsFunc(slices.Concat(VolatileHeaders, ignore), func(h string) bool {
+		return textproto.CanonicalMIMEHeaderKey(h) == name
+	})
+}
+
+// ParseSnapshot reads a golden file: a Snapshot as JSON, an Email as
+// returned by the HTTP API, or a raw RFC 5322 message (.eml). The
+// VolatileHeaders and the named headers are left out.
+func ParseSnapshot(data []byte, ignore ...string) (Snapshot, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var golden struct {
+			Snapshot
+			Body string `json:"body"`
+		}
+		if err := json.Unmarshal(trimmed, &golden); err != nil {
+			return Snapshot{}, fmt.Errorf("failed to parse snapshot: %w", err)
+		}
+		if golden.Body == "" {
+			headers := map[string][]string{}
+			for name, values := range golden.Headers {
+				if !ignoredHeader(name, ignore) {
+					headers[name] = values
+				}
+			}
+			golden.Headers = headers
+			return golden.Snapshot, nil
+		}
+		data = []byte(golden.Body)
+	}
+	email := newEmail("", nil, data)
+	return email.Snapshot(ignore...), nil
+}
+
+// stripBoundary removes the boundary parameter from a Content-Type.
+func stripBoundary(contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	delete(params, "boundary")
+	return mime.FormatMediaType(mediaType, params)
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// lines renders the snapshot as lines of text for diffing.
+func (s Snapshot) lines() []string {
+	var lines []string
+	names := make([]string, 0, len(s.Headers))
+	for name := range s.Headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range s.Headers[name] {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	if s.Text != "" {
+		lines = append(lines, "", "--- text")
+		lines = append(lines, strings.Split(strings.TrimSuffix(s.Text, "\n"), "\n")...)
+	}
+	if s.HTML != "" {
+		lines = append(lines, "", "--- html")
+		lines = append(lines, strings.Split(strings.TrimSuffix(s.HTML, "\n"), "\n")...)
+	}
+	for _, a := range s.Attachments {
+		lines = append(lines, "", fmt.Sprintf("--- attachment %s (%s, %d bytes, sha256 %s)", a.Filename, a.ContentType, a.Size, a.SHA256))
+	}
+	return lines
+}
+
+// maxDiffCells bounds the line comparison table, beyond which a diff
+// replaces everything.
+const maxDiffCells = 1 << 24
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 2
+
+// DiffSnapshots returns a line diff from want to got, with "-" for missing
+// and "+" for unexpected lines, or "" if they are equal.
+func DiffSnapshots(want, got Snapshot) string {
+	a, b := want.lines(), got.lines()
+	if slices.Equal(a, b) {
+		return ""
+	}
+
+	// Longest common subsequence of the lines
+	type edit struct {
+		op   byte // ' ', '-' or '+'
+		line string
+	}
+	var edits []edit
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			edits = append(edits, edit{'-', line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{'+', line})
+		}
+	} else {
+		lcs := make([][]int32, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				edits = append(edits, edit{' ', a[i]})
+				i++
+				j++
+			case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+				edits = append(edits, edit{'-', a[i]})
+				i++
+			default:
+				edits = append(edits, edit{'+', b[j]})
+				j++
+			}
+		}
+	}
+
+	// Show changes with a few lines of context
+	show := make([]bool, len(edits))
+	for k, e := range edits {
+		if e.op != ' ' {
+			for c := max(k-diffContext, 0); c <= min(k+diffContext, len(edits)-1); c++ {
+				show[c] = true
+			}
+		}
+	}
+	var out strings.Builder
+	for k, e := range edits {
+		if !show[k] {
+			if k == 0 || show[k-1] {
+				out.WriteString("...\n")
+			}
+			continue
+		}
+		fmt.Fprintf(&out, "%c %s\n", e.op, e.line)
+	}
+	return out.String()
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetSnapshot(w http.ResponseWriter, r *http.Request) {
+	email := s.Email(r.PathValue("id"))
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ") // golden files are read by people
+	if err := enc.Encode(email.Snapshot(ignoredHeaders(r)...)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// handleDiffEmail compares an email with the golden file in the request
+// body.
+func (s *Server) handleDiffEmail(w http.ResponseWriter, r *http.Request) {
+	email := s.Email(r.PathValue("id"))
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxInjectBytes))
+	if err != nil {
+		http.Error(w, "Failed to read golden file", http.StatusBadRequest)
+		return
+	}
+	ignore := ignoredHeaders(r)
+	golden, err := ParseSnapshot(data, ignore...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	diff := DiffSnapshots(golden, email.Snapshot(ignore...))
+	response := map[string]any{
+		"match": diff == "",
+		"diff":  diff,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// ignoredHeaders returns the headers named by the comma-separated ignore
+// query parameter.
+func ignoredHeaders(r *http.Request) []string {
+	var names []string
+	for _, name := range strings.Split(r.URL.Query().Get("ignore"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,123 @@
+package mailcatcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// welcome returns a rendering of a welcome template with the given
+// volatile values.
+func welcome(date, id, boundary, name string) string {
+	return "From: app@example.com\r\nTo: user@example.com\r\nSubject: Welcome\r\n" +
+		"Date: " + date + "\r\nMessage-ID: <" + id + ">\r\nX-Campaign: " + id + "\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=" + boundary + "\r\n\r\n" +
+		"--" + boundary + "\r\nContent-Type: text/plain\r\n\r\nHello " + name + ",\r\nwelcome aboard.\r\nThe team\r\n" +
+		"--" + boundary + "\r\nContent-Type: text/html\r\n\r\n<p>Hello " + name + "</p>\r\n" +
+		"--" + boundary + "--\r\n"
+}
+
+func TestSnapshot(t *testing.T) {
+	a := newEmail("", nil, []byte(welcome("Mon, 02 Jan 2006 15:04:05 +0000", "1@example.com", "aaa", "Ann")))
+	b := newEmail("", nil, []byte(welcome("Tue, 03 Jan 2006 10:00:00 +0000", "2@example.com", "bbb", "Ann")))
+
+	snap := a.Snapshot()
+	if _, ok := snap.Headers["Date"]; ok {
+		t.Error("Expected no Date in the snapshot")
+	}
+	if ct := snap.Headers["Content-Type"]; len(ct) != 1 || ct[0] != "multipart/alternative" {
+		t.Errorf("Expected the boundary to be removed, got %v", ct)
+	}
+	if diff := DiffSnapshots(snap, b.Snapshot()); !strings.Contains(diff, "X-Campaign") {
+		t.Errorf("Expected X-Campaign to differ, got %q", diff)
+	}
+	if diff := DiffSnapshots(a.Snapshot("X-Campaign"), b.Snapshot("x-campaign")); diff != "" {
+		t.Errorf("Expected renderings to match, got\n%s", diff)
+	}
+
+	c := newEmail("", nil, []byte(welcome("Mon, 02 Jan 2006 15:04:05 +0000", "1@example.com", "aaa", "Bob")))
+	diff := DiffSnapshots(a.Snapshot(), c.Snapshot())
+	for _, want := range []string{"- Hello Ann,\n+ Hello Bob,\n  welcome aboard.\n", "- <p>Hello Ann</p>\n+ <p>Hello Bob</p>\n"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("Expected %q in the diff, got\n%s", want, diff)
+		}
+	}
+	if !strings.HasPrefix(diff, "...\n") {
+		t.Errorf("Expected unchanged headers to be elided, got\n%s", diff)
+	}
+}
+
+func TestParseSnapshot(t *testing.T) {
+	raw := welcome("Mon, 02 Jan 2006 15:04:05 +0000", "1@example.com", "aaa", "Ann")
+	email := newEmail("", nil, []byte(raw))
+	want := email.Snapshot()
+
+	fromEML, err := ParseSnapshot([]byte(raw))
+	if err != nil || DiffSnapshots(want, fromEML) != "" {
+		t.Errorf("Expected the .eml to give the same snapshot, got %v", err)
+	}
+
+	snapJSON, _ := json.Marshal(want)
+	fromJSON, err := ParseSnapshot(snapJSON)
+	if err != nil || DiffSnapshots(want, fromJSON) != "" {
+		t.Errorf("Expected the JSON snapshot to round-trip, got %v", err)
+	}
+
+	emailJSON, _ := json.Marshal(email)
+	fromAPI, err := ParseSnapshot(emailJSON)
+	if err != nil || DiffSnapshots(want, fromAPI) != "" {
+		t.Errorf("Expected the API email to give the same snapshot, got %v", err)
+	}
+
+	if _, err := ParseSnapshot([]byte("{not json")); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestDiffEmailAPI(t *testing.T) {
+	server, _ := NewTestServer(t)
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte(welcome("Mon, 02 Jan 2006 15:04:05 +0000", "1@example.com", "aaa", "Ann"))); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	base := "http://" + server.HTTPAddr() + "/api/v1/emails/msg-0"
+
+	diff := func(golden, query string) (int, bool, string) {
+		resp, err := http.Post(base+"/diff"+query, "message/rfc822", strings.NewReader(golden))
+		if err != nil {
+			t.Fatalf("Failed to diff: %v", err)
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Match bool   `json:"match"`
+			Diff  string `json:"diff"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result.Match, result.Diff
+	}
+
+	golden := welcome("Fri, 06 Jan 2006 09:00:00 +0000", "9@example.com", "zzz", "Ann")
+	if code, match, d := diff(golden, ""); code != http.StatusOK || match || !strings.Contains(d, "X-Campaign") {
+		t.Errorf("Expected X-Campaign to differ, got %d %v %q", code, match, d)
+	}
+	if _, match, d := diff(golden, "?ignore=X-Campaign"); !match {
+		t.Errorf("Expected a match ignoring X-Campaign, got %q", d)
+	}
+
+	resp, err := http.Get(base + "/snapshot?ignore=X-Campaign")
+	if err != nil {
+		t.Fatalf("Failed to get snapshot: %v", err)
+	}
+	var snap Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+	resp.Body.Close()
+	if _, ok := snap.Headers["X-Campaign"]; ok || !strings.Contains(snap.Text, "Hello Ann") {
+		t.Errorf("Expected a snapshot without X-Campaign, got %+v", snap)
+	}
+
+	if code, _, _ := diff("{", ""); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid golden file, got %d", code)
+	}
+}
@@ -0,0 +1,117 @@
+package mailcatcher
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// maxSPFLookups limits include and redirect, like the DNS lookup limit of
+// RFC 7208 section 4.6.4.
+const maxSPFLookups = 10
+
+// spfQualifiers maps mechanism qualifiers to results.
+var spfQualifiers = map[byte]string{
+	'+': ResultPass,
+	'-': ResultFail,
+	'~': ResultSoftFail,
+	'?': ResultNeutral,
+}
+
+// checkSPF evaluates the SPF policy of the envelope sender domain of
+// email for the client IP, using records instead of DNS.
+func checkSPF(email *Email, records map[string]string) *SPFResult {
+	domain := email.Helo
+	if _, d, ok := strings.Cut(email.Envelope.From, "@"); ok {
+		domain = d
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, ">"))
+	ip := remoteIP(email.RemoteAddr)
+
+	result := &SPFResult{Domain: domain, IP: ip.String()}
+	lookups := 0
+	result.Result, result.Reason = evalSPF(domain, ip, records, &lookups)
+	return result
+}
+
+// evalSPF evaluates the record of domain for ip (RFC 7208 section 4).
+func evalSPF(domain string, ip net.IP, records map[string]string, lookups *int) (string, string) {
+	record, ok := lookupKey(records, domain)
+	if !ok {
+		return ResultNone, "no SPF record for " + domain
+	}
+	terms := strings.Fields(record)
+	if len(terms) == 0 || !strings.EqualFold(terms[0], "v=spf1") {
+		return ResultNone, "no SPF record for " + domain
+	}
+
+	redirect := ""
+	for _, term := range terms[1:] {
+		if name, value, ok := strings.Cut(term, "="); ok {
+			if strings.EqualFold(name, "redirect") {
+				redirect = value
+			}
+			continue // other modifiers are ignored
+		}
+
+		qualifier := ResultPass
+		if q, ok := spfQualifiers[term[0]]; ok {
+			qualifier = q
+			term = term[1:]
+		}
+		mechanism, arg, _ := strings.Cut(term, ":")
+		switch strings.ToLower(mechanism) {
+		case "all":
+			return qualifier, "matched " + term
+		case "ip4", "ip6":
+			matched, err := matchIP(arg, ip)
+			if err != nil {
+				return ResultPermError, err.Error()
+			}
+			if matched {
+				return qualifier, "matched " + term
+			}
+		case "include":
+			if *lookups++; *lookups > maxSPFLookups {
+				return ResultPermError, "too many includes"
+			}
+			switch result, reason := evalSPF(arg, ip, records, lookups); result {
+			case ResultPass:
+				return qualifier, "matched " + term
+			case ResultNone, ResultPermError:
+				return ResultPermError, reason
+			}
+		default:
+			return ResultPermError, fmt.Sprintf("mechanism %s needs DNS and is not supported", mechanism)
+		}
+	}
+
+	if redirect != "" {
+		if *lookups++; *lookups > maxSPFLookups {
+			return ResultPermError, "too many includes"
+		}
+		result, reason := evalSPF(redirect, ip, records, lookups)
+		if result == ResultNone {
+			return ResultPermError, reason
+		}
+		return result, reason
+	}
+	return ResultNeutral, "no mechanism matched"
+}
+
+// matchIP reports whether ip is in the network of an ip4 or ip6
+// mechanism, given as an address or CIDR.
+func matchIP(network string, ip net.IP) (bool, error) {
+	if !strings.Contains(network, "/") {
+		addr := net.ParseIP(network)
+		if addr == nil {
+			return false, fmt.Errorf("invalid address %q", network)
+		}
+		return addr.Equal(ip), nil
+	}
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		return false, fmt.Errorf("invalid network %q", network)
+	}
+	return ipNet.Contains(ip), nil
+}
@@ -0,0 +1,31 @@
+package mailcatcher
+
+import "testing"
+
+func TestCheckSPF(t *testing.T) {
+	records := map[string]string{
+		"example.com":      "v=spf1 ip4:192.0.2.0/24 include:_spf.example.net ~all",
+		"_spf.example.net": "v=spf1 ip6:2001:db8::/32 ip4:198.51.100.7 -all",
+		"strict.example":   "v=spf1 redirect=example.com",
+		"dns.example":      "v=spf1 a mx -all",
+	}
+
+	for _, tc := range []struct {
+		from, remote, want string
+	}{
+		{"app@example.com", "192.0.2.10:25", ResultPass},
+		{"app@example.com", "198.51.100.7:25", ResultPass},
+		{"app@example.com", "[2001:db8::1]:25", ResultPass},
+		{"app@example.com", "203.0.113.1:25", ResultSoftFail},
+		{"app@strict.example", "192.0.2.10:25", ResultPass},
+		{"app@strict.example", "203.0.113.1:25", ResultSoftFail},
+		{"app@dns.example", "192.0.2.10:25", ResultPermError},
+		{"app@unknown.example", "192.0.2.10:25", ResultNone},
+		{"", "192.0.2.10:25", ResultPass}, // HELO identity
+	} {
+		email := &Email{Envelope: Envelope{From: tc.from}, RemoteAddr: tc.remote, Helo: "example.com"}
+		if got := checkSPF(email, records); got.Result != tc.want {
+			t.Errorf("Expected %s for %q from %s, got %+v", tc.want, tc.from, tc.remote, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Stats summarizes the captured emails, including held ones.
+type Stats struct {
+	Messages int   `json:"messages"`
+	Bytes    int64 `json:"bytes"`
+
+	// DATA transfer and session timings over messages received via SMTP
+	AvgDataDuration    time.Duration `json:"avg_data_duration"`
+	MaxDataDuration    time.Duration `json:"max_data_duration"`
+	AvgSessionDuration time.Duration `json:"avg_session_duration"`
+	MaxSessionDuration time.Duration `json:"max_session_duration"`
+
+	// Messages and bytes evicted by the Retention limits since start
+	Evicted      int64 `json:"evicted"`
+	EvictedBytes int64 `json:"evicted_bytes"`
+
+	// Messages and bytes received in CaptureCount mode, which are counted
+	// but not stored
+	Counted      int64 `json:"counted"`
+	CountedBytes int64 `json:"counted_bytes"`
+
+	// Commands refused at the server limits since start: recipients over
+	// SetMaxRecipients, connections over MaxMessagesPerConnection,
+	// messages over SetMaxMessageBytes and connections closed after
+	// SetReadTimeout
+	RejectedRecipients int64 `json:"rejected_recipients"`
+	RejectedMessages   int64 `json:"rejected_messages"`
+	RejectedOversized  int64 `json:"rejected_oversized"`
+	ReadTimeouts       int64 `json:"read_timeouts"`
+
+	// Message counts by envelope sender and recipient, lowercased, and by
+	// subject. A message to several recipients counts for each.
+	BySender    map[string]int `json:"by_sender,omitempty"`
+	ByRecipient map[string]int `json:"by_recipient,omitempty"`
+	BySubject   map[string]int `json:"by_subject,omitempty"`
+
+	// Buckets counts the messages by capture time, see StatsByTime.
+	Buckets []StatsBucket `json:"buckets,omitempty"`
+}
+
+// StatsBucket counts the messages captured in a time window.
+type StatsBucket struct {
+	Start    time.Time `json:"start"`
+	Messages int       `json:"messages"`
+	Bytes    int64     `json:"bytes"`
+}
+
+// Stats returns aggregate statistics over all captured emails.
+func (s *Server) Stats() Stats {
+	return s.StatsByTime(0)
+}
+
+// StatsByTime is Stats with Buckets counting the messages captured in
+// each window of length bucket, oldest first. Windows without messages
+// are left out. A bucket of 0 yields no Buckets.
+func (s *Server) StatsByTime(bucket time.Duration) Stats {
+	emails, err := s.store.List(context.Background())
+	if err != nil {
+		s.errorf("Failed to list emails: %v", err)
+		return Stats{}
+	}
+
+	var (
+		stats   Stats
+		timed   int
+		data    time.Duration
+		session time.Duration
+		buckets = map[time.Time]*StatsBucket{}
+	)
+	for i := range emails {
+		e := &emails[i]
+		stats.Messages++
+		stats.Bytes += e.Size
+		stats.count(e)
+		if bucket > 0 {
+			start := e.Time.Truncate(bucket)
+			b, ok := buckets[start]
+			if !ok {
+				b = &StatsBucket{Start: start}
+				buckets[start] = b
+			}
+			b.Messages++
+			b.Bytes += e.Size
+		}
+
+		// Injected messages have no SMTP timings
+		if e.SessionDuration == 0 {
+			continue
+		}
+		timed++
+		data += e.DataDuration
+		session += e.SessionDuration
+		stats.MaxDataDuration = max(stats.MaxDataDuration, e.DataDuration)
+		stats.MaxSessionDuration = max(stats.MaxSessionDuration, e.SessionDuration)
+	}
+
+	stats.Evicted = s.evictions.evicted.Load()
+	stats.EvictedBytes = s.evictions.evictedBytes.Load()
+	stats.Counted = s.captured.counted.Load()
+	stats.CountedBytes = s.captured.countedBytes.Load()
+	stats.RejectedRecipients = s.limits.recipients.Load()
+	stats.RejectedMessages = s.limits.messages.Load()
+	stats.RejectedOversized = s.limits.oversized.Load()
+	stats.ReadTimeouts = s.limits.timeouts.Load()
+
+	if timed > 0 {
+		stats.AvgDataDuration = data / time.Duration(timed)
+		stats.AvgSessionDuration = session / time.Duration(timed)
+	}
+	for _, b := range buckets {
+		stats.Buckets = append(stats.Buckets, *b)
+	}
+	slices.SortFunc(stats.Buckets, func(a, b StatsBucket) int { return a.Start.Compare(b.Start) })
+	return stats
+}
+
+// count adds e to the counts by sender, recipient and subject.
+func (stats *Stats) count(e *Email) {
+	if stats.BySender == nil {
+		stats.BySender = map[string]int{}
+		stats.ByRecipient = map[string]int{}
+		stats.BySubject = map[string]int{}
+	}
+
+	sender := e.Envelope.From
+	if sender == "" {
+		sender = e.From.Address
+	}
+	stats.BySender[strings.ToLower(sender)]++
+
+	rcpts := e.Envelope.To
+	if len(rcpts) == 0 {
+		// Mail injected without an envelope
+		for _, addr := range slices.Concat(e.To, e.Cc) {
+			rcpts = append(rcpts, addr.Address)
+		}
+	}
+	for _, rcpt := range rcpts {
+		stats.ByRecipient[strings.ToLower(rcpt)]++
+	}
+	stats.BySubject[e.Subject]++
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	var bucket time.Duration
+	if value := r.URL.Query().Get("bucket"); value != "" {
+		var err error
+		if bucket, err = time.ParseDuration(value); err != nil || bucket <= 0 {
+			http.Error(w, fmt.Sprintf("invalid bucket %q: expected a positive duration", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.StatsByTime(bucket)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
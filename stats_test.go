@@ -0,0 +1,146 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMessageTimingAndStats(t *testing.T) {
+	server := New(10043, 10098)
+	err := server.Start()
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	conn := dialSMTP(t, "localhost:10043")
+	defer conn.Close()
+
+	smtpCommand(t, conn, "EHLO client.example.com")
+	smtpCommand(t, conn, "MAIL FROM:<sender@example.com>")
+	smtpCommand(t, conn, "RCPT TO:<recipient@example.com>")
+	if code := smtpCommand(t, conn, "DATA"); code != 354 {
+		t.Fatalf("Expected 354 for DATA, got %d", code)
+	}
+
+	// Stall halfway through the content
+	w := conn.DotWriter()
+	w.Write([]byte("Subject: Slow\r\n\r\n"))
+	time.Sleep(50 * time.Millisecond)
+	w.Write([]byte("Body\r\n"))
+	w.Close()
+	if _, _, err := conn.ReadResponse(250); err != nil {
+		t.Fatalf("Expected message to be accepted: %v", err)
+	}
+	smtpCommand(t, conn, "QUIT")
+
+	time.Sleep(100 * time.Millisecond)
+
+	emails := server.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+
+	email := emails[0]
+	if email.Size != int64(len(email.Body)) || email.Size == 0 {
+		t.Errorf("Expected size=%d, got %d", len(email.Body), email.Size)
+	}
+	if email.DataDuration < 50*time.Millisecond {
+		t.Errorf("Expected DATA duration >= 50ms, got %v", email.DataDuration)
+	}
+	if email.SessionDuration < email.DataDuration {
+		t.Errorf("Expected session duration >= DATA duration, got %v < %v", email.SessionDuration, email.DataDuration)
+	}
+
+	resp, err := http.Get("http://localhost:10098/api/v1/stats")
+	if err != nil {
+		t.Fatalf("Failed to GET stats: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var stats Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+
+	if stats.Messages != 1 || stats.Bytes != email.Size {
+		t.Errorf("Expected 1 message of %d bytes, got %+v", email.Size, stats)
+	}
+	if stats.MaxDataDuration != email.DataDuration || stats.AvgSessionDuration != email.SessionDuration {
+		t.Errorf("Expected timings to match the single email, got %+v", stats)
+	}
+}
+
+func TestStatsGroups(t *testing.T) {
+	server := New(0, 0)
+	for i := range 10 {
+		to := []string{"user0@example.com", "User1@example.com"}[i%2]
+		if err := server.Send("App@example.com", []string{to, "audit@example.com"}, []byte("Subject: Load\r\n\r\nBody\r\n")); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	stats := server.Stats()
+	if stats.Messages != 10 || stats.BySender["app@example.com"] != 10 || stats.BySubject["Load"] != 10 {
+		t.Errorf("Expected 10 messages from app@example.com, got %+v", stats)
+	}
+	for rcpt, n := range map[string]int{"user0@example.com": 5, "user1@example.com": 5, "audit@example.com": 10} {
+		if stats.ByRecipient[rcpt] != n {
+			t.Errorf("Expected %d messages to %s, got %d", n, rcpt, stats.ByRecipient[rcpt])
+		}
+	}
+	if stats.Buckets != nil {
+		t.Errorf("Expected no buckets, got %+v", stats.Buckets)
+	}
+}
+
+func TestStatsBuckets(t *testing.T) {
+	server := New(0, 0)
+	for range 3 {
+		server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Load\r\n\r\nBody\r\n"))
+	}
+
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/api/v1/stats?bucket=24h")
+	if err != nil {
+		t.Fatalf("Failed to GET stats: %v", err)
+	}
+	defer resp.Body.Close()
+	var stats Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+
+	var messages int
+	var bytes int64
+	for i, b := range stats.Buckets {
+		if i > 0 && !b.Start.After(stats.Buckets[i-1].Start) {
+			t.Errorf("Expected buckets oldest first, got %+v", stats.Buckets)
+		}
+		messages += b.Messages
+		bytes += b.Bytes
+	}
+	if messages != 3 || bytes != stats.Bytes {
+		t.Errorf("Expected buckets to add up to 3 messages of %d bytes, got %d of %d", stats.Bytes, messages, bytes)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/v1/stats?bucket=-1m")
+	if err != nil {
+		t.Fatalf("Failed to GET stats: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative bucket, got %d", resp.StatusCode)
+	}
+}
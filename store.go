@@ -0,0 +1,381 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// ErrNotFound is returned when no email with the given ID exists.
+var ErrNotFound = errors.Base("email not found")
+
+// Store holds captured emails. Implementations must be safe for concurrent use.
+//
+// The default store keeps emails in memory. BoltStore keeps them in a file
+// across restarts, and a store shared between several servers, such as
+// RedisStore, lets replicas see the same mailbox.
+type Store interface {
+	// Add stores a new email, assigning its ID, and returns the stored copy.
+	// IDs are never reused, even after Delete or Clear.
+	Add(ctx context.Context, email Email) (Email, error)
+
+	// Get returns the email with the given ID, or ErrNotFound.
+	Get(ctx context.Context, id string) (Email, error)
+
+	// List returns all emails in the order they were added.
+	List(ctx context.Context) ([]Email, error)
+
+	// Count returns the number of stored emails.
+	Count(ctx context.Context) (int, error)
+
+	// Update replaces a stored email with the same ID, or returns ErrNotFound.
+	Update(ctx context.Context, email Email) error
+
+	// Delete removes the email with the given ID, or returns ErrNotFound.
+	Delete(ctx context.Context, id string) error
+
+	// Clear removes all emails.
+	Clear(ctx context.Context) error
+}
+
+// Event types reported by a Watcher.
+const (
+	EventAdded   = "added"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+	EventCleared = "cleared"
+)
+
+// Event describes a change to a Store.
+type Event struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+
+	// Email is the added or updated email on GET /api/v1/events.
+	// Stores leave it unset.
+	Email *Email `json:"email,omitempty"`
+}
+
+// Watcher is implemented by stores that are shared between servers and
+// can report changes made by any of them.
+type Watcher interface {
+	// Watch calls fn for every change until ctx is canceled.
+	Watch(ctx context.Context, fn func(Event)) error
+}
+
+// storeWatcher returns the Watcher of a shared store. A CompressedStore
+// only watches if the store it wraps does.
+func storeWatcher(store Store) (Watcher, bool) {
+	if c, ok := store.(*CompressedStore); ok {
+		if _, ok := c.Store.(Watcher); !ok {
+			return nil, false
+		}
+	}
+	watcher, ok := store.(Watcher)
+	return watcher, ok
+}
+
+// RecipientLister is implemented by stores that index emails by
+// recipient, so lookups for one address do not scan every email.
+type RecipientLister interface {
+	// ListByRecipient returns the emails with addr among their To and Cc
+	// addresses or envelope recipients, in the order they were added.
+	// Addresses are compared ignoring case, with domains in ASCII form.
+	ListByRecipient(ctx context.Context, addr string) ([]Email, error)
+}
+
+// OldestLister is implemented by stores that can return the IDs of their
+// oldest emails without loading the others, so retention limits evict
+// without listing every email.
+type OldestLister interface {
+	// OldestIDs returns the IDs of up to n emails, the first added first.
+	OldestIDs(ctx context.Context, n int) ([]string, error)
+}
+
+var (
+	_ OldestLister = (*MemoryStore)(nil)
+	_ OldestLister = (*BoltStore)(nil)
+	_ OldestLister = (*RedisStore)(nil)
+	_ OldestLister = (*CompressedStore)(nil)
+)
+
+// MemoryStore is the default in-memory Store. Emails are indexed by ID,
+// recipient and the words Search finds them by, so lookups stay fast with
+// many thousands of messages.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	seqs        []uint64 // in the order added, which is ascending
+	emails      map[uint64]Email
+	byRecipient map[string][]uint64
+	byWord      map[string][]uint64
+	nextID      uint64
+}
+
+var (
+	_ RecipientLister = (*MemoryStore)(nil)
+	_ Searcher        = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		emails:      make(map[uint64]Email),
+		byRecipient: make(map[string][]uint64),
+		byWord:      make(map[string][]uint64),
+	}
+}
+
+// Add implements Store.
+func (m *MemoryStore) Add(_ context.Context, email Email) (Email, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seq := m.nextID
+	m.nextID++
+	email.ID = fmt.Sprintf("msg-%d", seq)
+	m.seqs = append(m.seqs, seq)
+	m.emails[seq] = email
+	for _, key := range recipientKeys(&email) {
+		m.byRecipient[key] = append(m.byRecipient[key], seq)
+	}
+	for _, word := range emailWords(&email) {
+		m.byWord[word] = append(m.byWord[word], seq)
+	}
+	return email, nil
+}
+
+// Get implements Store.
+func (m *MemoryStore) Get(_ context.Context, id string) (Email, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if seq, ok := idSeq(id); ok {
+		if email, ok := m.emails[seq]; ok {
+			return email, nil
+		}
+	}
+	return Email{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// List implements Store.
+func (m *MemoryStore) List(_ context.Context) ([]Email, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.list(m.seqs), nil
+}
+
+// ListByRecipient implements RecipientLister.
+func (m *MemoryStore) ListByRecipient(_ context.Context, addr string) ([]Email, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.list(m.byRecipient[recipientKey(addr)]), nil
+}
+
+// Search implements Searcher, returning the emails with every word of
+// query.
+func (m *MemoryStore) Search(_ context.Context, query string) ([]Email, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	words := searchWords(query)
+	if len(words) == 0 {
+		return []Email{}, nil
+	}
+	// Intersect starting from the rarest word
+	slices.SortFunc(words, func(a, b string) int { return len(m.byWord[a]) - len(m.byWord[b]) })
+	seqs := slices.Clone(m.byWord[words[0]])
+	for _, word := range words[1:] {
+		list := m.byWord[word]
+		seqs = slices.DeleteFunc(seqs, func(seq uint64) bool {
+			_, ok := slices.BinarySearch(list, seq)
+			return !ok
+		})
+	}
+	return m.list(seqs), nil
+}
+
+// list returns the emails with the given sequence numbers.
+func (m *MemoryStore) list(seqs []uint64) []Email {
+	emails := make([]Email, len(seqs))
+	for i, seq := range seqs {
+		emails[i] = m.emails[seq]
+	}
+	return emails
+}
+
+// OldestIDs implements OldestLister.
+func (m *MemoryStore) OldestIDs(_ context.Context, n int) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, min(max(n, 0), len(m.seqs)))
+	for _, seq := range m.seqs[:cap(ids)] {
+		ids = append(ids, fmt.Sprintf("msg-%d", seq))
+	}
+	return ids, nil
+}
+
+// Count implements Store.
+func (m *MemoryStore) Count(_ context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.seqs), nil
+}
+
+// Update implements Store.
+func (m *MemoryStore) Update(_ context.Context, email Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seq, ok := idSeq(email.ID)
+	old, found := m.emails[seq]
+	if !ok || !found {
+		return fmt.Errorf("%w: %s", ErrNotFound, email.ID)
+	}
+
+	oldKeys, newKeys := recipientKeys(&old), recipientKeys(&email)
+	if !slices.Equal(oldKeys, newKeys) {
+		unindexSeq(m.byRecipient, seq, oldKeys)
+		indexSeq(m.byRecipient, seq, newKeys)
+	}
+	// Tags and read state change far more often than the content
+	if old.Body != email.Body || old.Subject != email.Subject || old.Text != email.Text || old.HTML != email.HTML {
+		unindexSeq(m.byWord, seq, emailWords(&old))
+		indexSeq(m.byWord, seq, emailWords(&email))
+	}
+	m.emails[seq] = email
+	return nil
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seq, ok := idSeq(id)
+	email, found := m.emails[seq]
+	if !ok || !found {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	delete(m.emails, seq)
+	if i, ok := slices.BinarySearch(m.seqs, seq); ok {
+		m.seqs = slices.Delete(m.seqs, i, i+1)
+	}
+	unindexSeq(m.byRecipient, seq, recipientKeys(&email))
+	unindexSeq(m.byWord, seq, emailWords(&email))
+	return nil
+}
+
+// indexSeq adds seq to the lists of keys in idx, keeping them sorted.
+func indexSeq(idx map[string][]uint64, seq uint64, keys []string) {
+	for _, key := range keys {
+		list := idx[key]
+		i, _ := slices.BinarySearch(list, seq)
+		idx[key] = slices.Insert(list, i, seq)
+	}
+}
+
+// unindexSeq removes seq from the lists of keys in idx.
+func unindexSeq(idx map[string][]uint64, seq uint64, keys []string) {
+	for _, key := range keys {
+		list := idx[key]
+		if i, ok := slices.BinarySearch(list, seq); ok {
+			list = slices.Delete(list, i, i+1)
+		}
+		if len(list) == 0 {
+			delete(idx, key)
+		} else {
+			idx[key] = list
+		}
+	}
+}
+
+// Clear implements Store.
+func (m *MemoryStore) Clear(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// nextID is kept so IDs of cleared emails are not reused
+	m.seqs = nil
+	clear(m.emails)
+	clear(m.byRecipient)
+	clear(m.byWord)
+	return nil
+}
+
+// idSeq returns the sequence number of an ID such as "msg-42".
+func idSeq(id string) (uint64, bool) {
+	n, ok := strings.CutPrefix(id, "msg-")
+	if !ok {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(n, 10, 64)
+	if err != nil || strconv.FormatUint(seq, 10) != n {
+		return 0, false // not canonical, e.g. "msg-01"
+	}
+	return seq, true
+}
+
+// recipientKey returns the index key of an address.
+func recipientKey(addr string) string {
+	ascii, _ := normalizeAddress(strings.TrimSpace(addr))
+	return strings.ToLower(ascii)
+}
+
+// recipientKeys returns the sorted, distinct index keys of an email's To,
+// Cc and envelope recipients.
+func recipientKeys(e *Email) []string {
+	var keys []string
+	for _, list := range [][]Address{e.To, e.Cc} {
+		for _, a := range list {
+			keys = append(keys, recipientKey(a.Address))
+		}
+	}
+	for _, to := range e.Envelope.To {
+		keys = append(keys, recipientKey(parseAddress(to).Address))
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// storedEmail is the encoding of emails in persistent stores. JSON replaces
+// invalid UTF-8 in strings, so the message, which may be 8bit text in any
+// charset, is kept as bytes to make Raw return exactly what was received.
+// Records written before Raw was added still decode from Body. BoltStore
+// and RedisStore use it.
+type storedEmail struct {
+	emailFields
+	Raw []byte `json:"raw,omitempty"`
+}
+
+// encodeEmail encodes email for a persistent store.
+func encodeEmail(email Email) ([]byte, error) {
+	stored := storedEmail{emailFields: emailFields(email), Raw: []byte(email.Body)}
+	stored.Body = ""
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode email: %w", err)
+	}
+	return data, nil
+}
+
+// decodeEmail decodes an email written by encodeEmail.
+func decodeEmail(data []byte) (Email, error) {
+	var stored storedEmail
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return Email{}, err
+	}
+	email := Email(stored.emailFields)
+	if stored.Raw != nil {
+		email.Body = string(stored.Raw)
+	}
+	email.linkAttachments()
+	return email, nil
+}
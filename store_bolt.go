@@ -0,0 +1,216 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("emails")
+
+// dataDirFile is the database file NewDataDirStore keeps in its directory.
+const dataDirFile = "mail.db"
+
+// BoltStore is a Store persisting emails in a bbolt database file, so a
+// long-lived catcher keeps its mail across restarts. Only one process can
+// open the file at a time.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens or creates the database file at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create bucket: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// NewDataDirStore opens or creates a BoltStore in dir, creating the
+// directory if needed. Bodies live in the database file rather than in
+// memory, so a long-running catcher stays small and reloads its mail
+// after a restart.
+func NewDataDirStore(dir string) (*BoltStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	return NewBoltStore(filepath.Join(dir, dataDirFile))
+}
+
+// Close closes the database file.
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+// boltKey maps an email ID to its key. Keys are big-endian sequence
+// numbers, so iteration returns emails in the order they were added.
+func boltKey(id string) ([]byte, bool) {
+	n, ok := idSeq(id)
+	if !ok {
+		return nil, false
+	}
+	return binary.BigEndian.AppendUint64(nil, n), true
+}
+
+// Add implements Store.
+func (b *BoltStore) Add(_ context.Context, email Email) (Email, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		email.ID = fmt.Sprintf("msg-%d", seq-1)
+
+		data, err := encodeEmail(email)
+		if err != nil {
+			return err
+		}
+		key, _ := boltKey(email.ID)
+		return bucket.Put(key, data)
+	})
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to store email: %w", err)
+	}
+	return email, nil
+}
+
+// Get implements Store.
+func (b *BoltStore) Get(_ context.Context, id string) (Email, error) {
+	key, ok := boltKey(id)
+	if !ok {
+		return Email{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	var email Email
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltBucket).Get(key)
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		var err error
+		if email, err = decodeEmail(data); err != nil {
+			return fmt.Errorf("failed to decode email %s: %w", id, err)
+		}
+		return nil
+	})
+	return email, err
+}
+
+// List implements Store.
+func (b *BoltStore) List(_ context.Context) ([]Email, error) {
+	emails := []Email{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(_, data []byte) error {
+			email, err := decodeEmail(data)
+			if err != nil {
+				return fmt.Errorf("failed to decode email: %w", err)
+			}
+			emails = append(emails, email)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// OldestIDs implements OldestLister, reading only the keys.
+func (b *BoltStore) OldestIDs(_ context.Context, n int) ([]string, error) {
+	ids := []string{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltBucket).Cursor()
+		for key, _ := cursor.First(); key != nil && len(ids) < n; key, _ = cursor.Next() {
+			ids = append(ids, fmt.Sprintf("msg-%d", binary.BigEndian.Uint64(key)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Count implements Store.
+func (b *BoltStore) Count(_ context.Context) (int, error) {
+	var n int
+	err := b.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(boltBucket).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// Update implements Store.
+func (b *BoltStore) Update(_ context.Context, email Email) error {
+	key, ok := boltKey(email.ID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, email.ID)
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		if bucket.Get(key) == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, email.ID)
+		}
+
+		data, err := encodeEmail(email)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+}
+
+// Delete implements Store.
+func (b *BoltStore) Delete(_ context.Context, id string) error {
+	key, ok := boltKey(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		if bucket.Get(key) == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return bucket.Delete(key)
+	})
+}
+
+// Clear implements Store.
+func (b *BoltStore) Clear(_ context.Context) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		// The sequence is kept so IDs of cleared emails are not reused
+		seq := tx.Bucket(boltBucket).Sequence()
+		if err := tx.DeleteBucket(boltBucket); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(boltBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.SetSequence(seq)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear emails: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects the algorithm used by a CompressedStore.
+type Compression string
+
+// Supported compression algorithms.
+const (
+	CompressGzip Compression = "gzip"
+	CompressZstd Compression = "zstd"
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// CompressedStore wraps a Store and compresses the raw message and the
+// parsed text, HTML and part contents before they are stored,
+// decompressing them transparently on read. HTML-heavy mail typically
+// takes 5-10x less space, which matters for long-running catchers. Emails
+// that would not get smaller are stored as is.
+//
+// The wrapped store receives compressed emails with Email.Compression set
+// to the algorithm and the contents base64-encoded, so they survive stores
+// that serialize to JSON. Emails read back have Compression cleared.
+type CompressedStore struct {
+	Store
+	compression Compression
+}
+
+// NewCompressedStore wraps store with body compression.
+func NewCompressedStore(store Store, compression Compression) (*CompressedStore, error) {
+	switch compression {
+	case CompressGzip, CompressZstd:
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+	return &CompressedStore{Store: store, compression: compression}, nil
+}
+
+// Add implements Store.
+func (c *CompressedStore) Add(ctx context.Context, email Email) (Email, error) {
+	stored, err := c.Store.Add(ctx, c.compressEmail(email))
+	if err != nil {
+		return Email{}, err
+	}
+	email.ID = stored.ID
+	return email, nil
+}
+
+// Get implements Store.
+func (c *CompressedStore) Get(ctx context.Context, id string) (Email, error) {
+	email, err := c.Store.Get(ctx, id)
+	if err != nil {
+		return Email{}, err
+	}
+	return email, decompressEmail(&email)
+}
+
+// List implements Store.
+func (c *CompressedStore) List(ctx context.Context) ([]Email, error) {
+	emails, err := c.Store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range emails {
+		if err := decompressEmail(&emails[i]); err != nil {
+			return nil, err
+		}
+	}
+	return emails, nil
+}
+
+// Update implements Store.
+func (c *CompressedStore) Update(ctx context.Context, email Email) error {
+	return c.Store.Update(ctx, c.compressEmail(email))
+}
+
+// OldestIDs implements OldestLister, listing the wrapped store if it does
+// not.
+func (c *CompressedStore) OldestIDs(ctx context.Context, n int) ([]string, error) {
+	return oldestIDs(ctx, c.Store, n)
+}
+
+// Watch implements Watcher if the wrapped store does.
+func (c *CompressedStore) Watch(ctx context.Context, fn func(Event)) error {
+	if watcher, ok := c.Store.(Watcher); ok {
+		return watcher.Watch(ctx, fn)
+	}
+	return nil
+}
+
+// compress returns value compressed and base64-encoded. Empty values stay
+// empty.
+func (c *CompressedStore) compress(value []byte) string {
+	if len(value) == 0 {
+		return ""
+	}
+	var compressed []byte
+	switch c.compression {
+	case CompressZstd:
+		compressed = zstdEncoder.EncodeAll(value, nil)
+	case CompressGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(value)
+		_ = zw.Close()
+		compressed = buf.Bytes()
+	}
+	return base64.StdEncoding.EncodeToString(compressed)
+}
+
+// compressEmail returns a copy of email with the raw message and the
+// decoded text, HTML and part contents compressed, as the parsed copies
+// take as much memory as the message itself. Attachments share the
+// contents of their parts.
+func (c *CompressedStore) compressEmail(email Email) Email {
+	email.Attachments = slices.Clone(email.Attachments)
+	for i := range email.Attachments {
+		email.Attachments[i].Content = nil // linked again to the part
+	}
+
+	compressed := email
+	compressed.Compression = c.compression
+	compressed.Body = c.compress([]byte(email.Body))
+	compressed.Text = c.compress([]byte(email.Text))
+	compressed.HTML = c.compress([]byte(email.HTML))
+	compressed.Parts = slices.Clone(email.Parts)
+	for i := range compressed.Parts {
+		if content := compressed.Parts[i].Content; len(content) > 0 {
+			compressed.Parts[i].Content = []byte(c.compress(content))
+		}
+	}
+	if contentSize(compressed) >= contentSize(email) {
+		return email
+	}
+	return compressed
+}
+
+// contentSize returns the bytes an email holds in its message and parsed
+// contents.
+func contentSize(e Email) int {
+	n := len(e.Body) + len(e.Text) + len(e.HTML)
+	for _, p := range e.Parts {
+		n += len(p.Content)
+	}
+	for _, a := range e.Attachments {
+		n += len(a.Content)
+	}
+	return n
+}
+
+// decompressEmail restores the contents of an email stored by a
+// CompressedStore. Emails stored without compression are left unchanged.
+func decompressEmail(email *Email) error {
+	email.Attachments = slices.Clone(email.Attachments)
+	if email.Compression == "" {
+		email.linkAttachments()
+		return nil
+	}
+
+	var err error
+	for _, s := range []*string{&email.Body, &email.Text, &email.HTML} {
+		if *s, err = decompress(email.Compression, *s); err != nil {
+			return fmt.Errorf("failed to decompress %s: %w", email.ID, err)
+		}
+	}
+	email.Parts = slices.Clone(email.Parts)
+	for i := range email.Parts {
+		content := &email.Parts[i].Content
+		if len(*content) == 0 {
+			continue
+		}
+		s, err := decompress(email.Compression, string(*content))
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s: %w", email.ID, err)
+		}
+		*content = []byte(s)
+	}
+	email.Compression = ""
+	email.linkAttachments()
+	return nil
+}
+
+// decompress restores a value compressed by compress with algorithm.
+func decompress(algorithm Compression, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	compressed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode: %w", err)
+	}
+
+	var data []byte
+	switch algorithm {
+	case CompressZstd:
+		data, err = zstdDecoder.DecodeAll(compressed, nil)
+	case CompressGzip:
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(compressed)); err == nil {
+			data, err = io.ReadAll(zr)
+		}
+	default:
+		err = fmt.Errorf("unsupported compression %q", algorithm)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,150 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedStore(t *testing.T) {
+	body := "Subject: Newsletter\r\nContent-Type: text/html\r\n\r\n" +
+		strings.Repeat("<tr><td style=\"padding:8px;font-family:Arial\">Item</td></tr>\r\n", 500)
+
+	for _, compression := range []Compression{CompressGzip, CompressZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			ctx := context.Background()
+			inner := NewMemoryStore()
+			store, err := NewCompressedStore(inner, compression)
+			if err != nil {
+				t.Fatalf("Failed to create store: %v", err)
+			}
+
+			added, err := store.Add(ctx, Email{Body: body})
+			if err != nil {
+				t.Fatalf("Failed to add email: %v", err)
+			}
+			if added.Body != body {
+				t.Error("Expected Add to return the uncompressed body")
+			}
+
+			raw, _ := inner.Get(ctx, added.ID)
+			if len(raw.Body)*5 > len(body) {
+				t.Errorf("Expected at least 5x compression, stored %d of %d bytes", len(raw.Body), len(body))
+			}
+
+			got, err := store.Get(ctx, added.ID)
+			if err != nil || got.Body != body {
+				t.Errorf("Expected Get to return the original body (%v)", err)
+			}
+
+			emails, err := store.List(ctx)
+			if err != nil || len(emails) != 1 || emails[0].Body != body {
+				t.Errorf("Expected List to return the original body (%v)", err)
+			}
+		})
+	}
+
+	// Tiny emails are not worth compressing
+	inner := NewMemoryStore()
+	store, _ := NewCompressedStore(inner, CompressGzip)
+	added, _ := store.Add(context.Background(), Email{Body: "hi"})
+	if raw, _ := inner.Get(context.Background(), added.ID); raw.Body != "hi" || raw.Compression != "" {
+		t.Errorf("Expected small email stored as is, got %q compressed with %q", raw.Body, raw.Compression)
+	}
+
+	if _, err := NewCompressedStore(NewMemoryStore(), "lz4"); err == nil {
+		t.Error("Expected error for unsupported compression")
+	}
+}
+
+// newsletter returns an HTML-heavy multipart message with an attachment.
+func newsletter() []byte {
+	rows := strings.Repeat("<tr><td style=\"padding:8px;font-family:Arial\">Item</td></tr>\r\n", 1000)
+	return []byte("Subject: Newsletter\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\n" + strings.Repeat("Item\r\n", 1000) +
+		"--b\r\nContent-Type: text/html\r\n\r\n<table>" + rows + "</table>\r\n" +
+		"--b\r\nContent-Type: text/csv\r\nContent-Disposition: attachment; filename=items.csv\r\n\r\n" + strings.Repeat("item,1\r\n", 1000) +
+		"--b--\r\n")
+}
+
+func TestCompressedStoreContent(t *testing.T) {
+	ctx := context.Background()
+	email := newEmail("app@example.com", []string{"user@example.com"}, newsletter())
+	if email.HTML == "" || email.Text == "" || len(email.Attachments) != 1 {
+		t.Fatalf("Expected a parsed newsletter, got %d attachments", len(email.Attachments))
+	}
+	store, _ := NewCompressedStore(NewMemoryStore(), CompressZstd)
+
+	added, err := store.Add(ctx, email)
+	if err != nil {
+		t.Fatalf("Failed to add email: %v", err)
+	}
+	got, err := store.Get(ctx, added.ID)
+	if err != nil {
+		t.Fatalf("Failed to get email: %v", err)
+	}
+	if got.Text != email.Text || got.HTML != email.HTML {
+		t.Error("Expected the original text and HTML bodies")
+	}
+	for i, part := range got.Parts {
+		if !bytes.Equal(part.Content, email.Parts[i].Content) {
+			t.Errorf("Expected the original content of part %d", i)
+		}
+	}
+	if !bytes.Equal(got.Attachments[0].Content, email.Attachments[0].Content) {
+		t.Error("Expected the original attachment content")
+	}
+
+	// Reading does not decompress the stored copy in place
+	if again, _ := store.Get(ctx, added.ID); !bytes.Equal(again.Parts[0].Content, email.Parts[0].Content) {
+		t.Error("Expected the same content on a second read")
+	}
+}
+
+func TestCompressedStoreSize(t *testing.T) {
+	ctx := context.Background()
+	email := newEmail("app@example.com", []string{"user@example.com"}, newsletter())
+	inner := NewMemoryStore()
+	store, _ := NewCompressedStore(inner, CompressZstd)
+
+	added, err := store.Add(ctx, email)
+	if err != nil {
+		t.Fatalf("Failed to add email: %v", err)
+	}
+	stored, _ := inner.Get(ctx, added.ID)
+	if total, size := contentSize(email), contentSize(stored); size*5 > total {
+		t.Errorf("Expected at least 5x less stored content, stored %d of %d bytes", size, total)
+	}
+}
+
+func TestCompressedStoreLiteralContent(t *testing.T) {
+	ctx := context.Background()
+	// Content that looks like a compressed value is stored and read
+	// back as is
+	text := "mailcatcher-compressed:gzip:aGk="
+	email := newEmail("app@example.com", []string{"user@example.com"}, []byte("Subject: Hi\r\n\r\n"+text))
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	defer bolt.Close()
+
+	for name, inner := range map[string]Store{"memory": NewMemoryStore(), "bolt": bolt} {
+		t.Run(name, func(t *testing.T) {
+			store, _ := NewCompressedStore(inner, CompressGzip)
+			added, err := store.Add(ctx, email)
+			if err != nil {
+				t.Fatalf("Failed to add email: %v", err)
+			}
+			got, err := store.Get(ctx, added.ID)
+			if err != nil {
+				t.Fatalf("Failed to get email: %v", err)
+			}
+			if got.Text != email.Text || got.Body != email.Body || got.Compression != "" {
+				t.Errorf("Expected the original text %q, got %q", email.Text, got.Text)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// updateScript replaces a stored email only if it still exists, in one
+// step, so an update racing a Delete or Clear on another replica cannot
+// bring the email back.
+var updateScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// RedisStore is a Store backed by Redis, letting several mailcatcher
+// replicas share one mailbox. IDs come from a shared counter so they are
+// consistent across replicas, and every change is published so each
+// replica's Watch sees mail received by the others.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore connects to the Redis server at url, e.g.
+// "redis://localhost:6379/0". Keys are prefixed with "mailcatcher:", so
+// independent clusters should use separate databases.
+func NewRedisStore(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &RedisStore{client: client, prefix: "mailcatcher:"}, nil
+}
+
+// Close closes the Redis connection.
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
+
+func (r *RedisStore) key(name string) string {
+	return r.prefix + name
+}
+
+// Add implements Store.
+func (r *RedisStore) Add(ctx context.Context, email Email) (Email, error) {
+	seq, err := r.client.Incr(ctx, r.key("seq")).Result()
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to allocate email ID: %w", err)
+	}
+	email.ID = fmt.Sprintf("msg-%d", seq-1)
+
+	data, err := encodeEmail(email)
+	if err != nil {
+		return Email{}, err
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.key("emails"), email.ID, data)
+		pipe.RPush(ctx, r.key("ids"), email.ID)
+		return nil
+	})
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to store email: %w", err)
+	}
+
+	r.publish(ctx, Event{Type: EventAdded, ID: email.ID})
+	return email, nil
+}
+
+// Get implements Store.
+func (r *RedisStore) Get(ctx context.Context, id string) (Email, error) {
+	data, err := r.client.HGet(ctx, r.key("emails"), id).Bytes()
+	if err == redis.Nil {
+		return Email{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to load email: %w", err)
+	}
+
+	email, err := decodeEmail(data)
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to decode email %s: %w", id, err)
+	}
+	return email, nil
+}
+
+// List implements Store.
+func (r *RedisStore) List(ctx context.Context) ([]Email, error) {
+	ids, err := r.client.LRange(ctx, r.key("ids"), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list emails: %w", err)
+	}
+	if len(ids) == 0 {
+		return []Email{}, nil
+	}
+
+	values, err := r.client.HMGet(ctx, r.key("emails"), ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load emails: %w", err)
+	}
+
+	emails := make([]Email, 0, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // deleted between LRANGE and HMGET
+		}
+
+		email, err := decodeEmail([]byte(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode email %s: %w", ids[i], err)
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// OldestIDs implements OldestLister.
+func (r *RedisStore) OldestIDs(ctx context.Context, n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+	ids, err := r.client.LRange(ctx, r.key("ids"), 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list emails: %w", err)
+	}
+	return ids, nil
+}
+
+// Count implements Store.
+func (r *RedisStore) Count(ctx context.Context) (int, error) {
+	n, err := r.client.LLen(ctx, r.key("ids")).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count emails: %w", err)
+	}
+	return int(n), nil
+}
+
+// Update implements Store.
+func (r *RedisStore) Update(ctx context.Context, email Email) error {
+	data, err := encodeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	updated, err := updateScript.Run(ctx, r.client, []string{r.key("emails")}, email.ID, data).Int()
+	if err != nil {
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, email.ID)
+	}
+
+	r.publish(ctx, Event{Type: EventUpdated, ID: email.ID})
+	return nil
+}
+
+// Delete implements Store.
+func (r *RedisStore) Delete(ctx context.Context, id string) error {
+	var deleted *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.HDel(ctx, r.key("emails"), id)
+		pipe.LRem(ctx, r.key("ids"), 1, id)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete email: %w", err)
+	}
+	if deleted.Val() == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	r.publish(ctx, Event{Type: EventDeleted, ID: id})
+	return nil
+}
+
+// Clear implements Store.
+func (r *RedisStore) Clear(ctx context.Context) error {
+	// The sequence is kept so IDs of cleared emails are not reused
+	if err := r.client.Del(ctx, r.key("emails"), r.key("ids")).Err(); err != nil {
+		return fmt.Errorf("failed to clear emails: %w", err)
+	}
+
+	r.publish(ctx, Event{Type: EventCleared})
+	return nil
+}
+
+// Watch implements Watcher.
+func (r *RedisStore) Watch(ctx context.Context, fn func(Event)) error {
+	sub := r.client.Subscribe(ctx, r.key("events"))
+	defer sub.Close()
+
+	// Wait for the subscription to be confirmed so no event is missed
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to events: %w", err)
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err == nil {
+				fn(event)
+			}
+		}
+	}
+}
+
+// publish notifies watchers of a change. Events are best effort: the
+// change itself has already been stored.
+func (r *RedisStore) publish(ctx context.Context, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_ = r.client.Publish(ctx, r.key("events"), data).Err()
+}
@@ -0,0 +1,401 @@
+package mailcatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("Failed to open Redis store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, mr
+}
+
+func TestStores(t *testing.T) {
+	redisStore, _ := newTestRedisStore(t)
+	compressedRedisStore, _ := newTestRedisStore(t)
+	compressedStore, err := NewCompressedStore(compressedRedisStore, CompressZstd)
+	if err != nil {
+		t.Fatalf("Failed to create compressed store: %v", err)
+	}
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	defer boltStore.Close()
+
+	stores := map[string]Store{
+		"memory":     NewMemoryStore(),
+		"redis":      redisStore,
+		"compressed": compressedStore,
+		"bolt":       boltStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			first, err := store.Add(ctx, Email{Subject: "First"})
+			if err != nil {
+				t.Fatalf("Failed to add email: %v", err)
+			}
+			second, err := store.Add(ctx, Email{Subject: "Second"})
+			if err != nil {
+				t.Fatalf("Failed to add email: %v", err)
+			}
+			if first.ID != "msg-0" || second.ID != "msg-1" {
+				t.Errorf("Expected IDs msg-0 and msg-1, got %s and %s", first.ID, second.ID)
+			}
+
+			if n, err := store.Count(ctx); err != nil || n != 2 {
+				t.Errorf("Expected count 2, got %d (%v)", n, err)
+			}
+
+			got, err := store.Get(ctx, second.ID)
+			if err != nil || got.Subject != "Second" {
+				t.Errorf("Expected to get 'Second', got %+v (%v)", got, err)
+			}
+			if _, err := store.Get(ctx, "msg-999"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+
+			first.Held = true
+			if err := store.Update(ctx, first); err != nil {
+				t.Errorf("Failed to update email: %v", err)
+			}
+			if err := store.Update(ctx, Email{ID: "msg-999"}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound updating missing email, got %v", err)
+			}
+
+			if err := store.Delete(ctx, second.ID); err != nil {
+				t.Errorf("Failed to delete email: %v", err)
+			}
+			if err := store.Delete(ctx, second.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+			}
+
+			emails, err := store.List(ctx)
+			if err != nil {
+				t.Fatalf("Failed to list emails: %v", err)
+			}
+			if len(emails) != 1 || emails[0].ID != first.ID || !emails[0].Held {
+				t.Errorf("Expected only the updated first email, got %+v", emails)
+			}
+
+			if err := store.Clear(ctx); err != nil {
+				t.Errorf("Failed to clear store: %v", err)
+			}
+			if emails, _ := store.List(ctx); len(emails) != 0 {
+				t.Errorf("Expected empty store after clear, got %d emails", len(emails))
+			}
+
+			third, err := store.Add(ctx, Email{Subject: "Third"})
+			if err != nil {
+				t.Fatalf("Failed to add email: %v", err)
+			}
+			if third.ID != "msg-2" {
+				t.Errorf("Expected ID msg-2 after clear, got %s", third.ID)
+			}
+		})
+	}
+}
+
+func TestRedisStoreCluster(t *testing.T) {
+	_, mr := newTestRedisStore(t)
+
+	// Two replicas, each with its own connection to the shared Redis
+	replicas := make([]*Server, 2)
+	for i := range replicas {
+		store, err := NewRedisStore("redis://" + mr.Addr())
+		if err != nil {
+			t.Fatalf("Failed to open Redis store: %v", err)
+		}
+		defer store.Close()
+
+		replicas[i] = New(10039+i, 10094+i)
+		replicas[i].SetStore(store)
+		if err := replicas[i].Start(); err != nil {
+			t.Fatalf("Failed to start replica %d: %v", i, err)
+		}
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, s := range replicas {
+			s.Stop(ctx)
+		}
+	}()
+
+	// Watch events from the second replica's point of view
+	var (
+		mu     sync.Mutex
+		events []Event
+	)
+	watcher, _ := NewRedisStore("redis://" + mr.Addr())
+	defer watcher.Close()
+	watchCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Watch(watchCtx, func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+
+	time.Sleep(100 * time.Millisecond)
+
+	for i := range replicas {
+		msg := []byte("Subject: Shard\r\n\r\nBody\r\n")
+		if err := smtp.SendMail(fmt.Sprintf("localhost:%d", 10039+i), nil, "sender@example.com",
+			[]string{"recipient@example.com"}, msg); err != nil {
+			t.Fatalf("Failed to send email to replica %d: %v", i, err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	for i, s := range replicas {
+		emails := s.Emails()
+		if len(emails) != 2 {
+			t.Fatalf("Expected replica %d to see 2 emails, got %d", i, len(emails))
+		}
+		if emails[0].ID != "msg-0" || emails[1].ID != "msg-1" {
+			t.Errorf("Expected consistent IDs on replica %d, got %s and %s", i, emails[0].ID, emails[1].ID)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0].Type != EventAdded {
+		t.Errorf("Expected 2 added events, got %+v", events)
+	}
+}
+
+func TestStoresKeepRawBytes(t *testing.T) {
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	defer boltStore.Close()
+
+	redisStore, _ := newTestRedisStore(t)
+
+	// An 8bit ISO-8859-1 body is not valid UTF-8
+	raw := "Subject: Menu\r\nContent-Type: text/plain; charset=iso-8859-1\r\nContent-Transfer-Encoding: 8bit\r\n\r\nCaf\xe9\r\n"
+	for name, store := range map[string]Store{"bolt": boltStore, "redis": redisStore} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			email, err := store.Add(ctx, newEmail("app@example.com", []string{"user@example.com"}, []byte(raw)))
+			if err != nil {
+				t.Fatalf("Failed to add email: %v", err)
+			}
+			got, err := store.Get(ctx, email.ID)
+			if err != nil {
+				t.Fatalf("Failed to get email: %v", err)
+			}
+			if string(got.Raw()) != raw {
+				t.Errorf("Expected the raw bytes received, got %q", got.Raw())
+			}
+
+			got.Tags = []string{"checked"}
+			if err := store.Update(ctx, got); err != nil {
+				t.Fatalf("Failed to update email: %v", err)
+			}
+			emails, err := store.List(ctx)
+			if err != nil {
+				t.Fatalf("Failed to list emails: %v", err)
+			}
+			if len(emails) != 1 || string(emails[0].Raw()) != raw {
+				t.Errorf("Expected the raw bytes after an update, got %+v", emails)
+			}
+		})
+	}
+
+	// Records written before the raw bytes were kept separately
+	email, err := decodeEmail([]byte(`{"id":"msg-0","body":"Subject: Old\r\n\r\nBody\r\n"}`))
+	if err != nil || email.Body != "Subject: Old\r\n\r\nBody\r\n" {
+		t.Errorf("Expected the body of an old record, got %q (%v)", email.Body, err)
+	}
+}
+
+func TestBoltStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.db")
+	ctx := context.Background()
+
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	if _, err := store.Add(ctx, Email{Subject: "Kept"}); err != nil {
+		t.Fatalf("Failed to add email: %v", err)
+	}
+	store.Close()
+
+	store, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen bolt store: %v", err)
+	}
+	defer store.Close()
+
+	emails, err := store.List(ctx)
+	if err != nil || len(emails) != 1 || emails[0].Subject != "Kept" {
+		t.Fatalf("Expected the email to survive a restart, got %+v (%v)", emails, err)
+	}
+
+	// IDs continue after the stored ones
+	next, err := store.Add(ctx, Email{Subject: "Next"})
+	if err != nil || next.ID != "msg-1" {
+		t.Errorf("Expected ID msg-1, got %s (%v)", next.ID, err)
+	}
+}
+
+func TestDataDirStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data", "mailcatcher")
+	server := New(0, 0)
+	store, err := NewDataDirStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open data dir: %v", err)
+	}
+	server.SetStore(store)
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Durable\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	store.Close()
+
+	// A new server on the same directory reloads the mail
+	server = New(0, 0)
+	store, err = NewDataDirStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen data dir: %v", err)
+	}
+	defer store.Close()
+	server.SetStore(store)
+	emails := server.Emails()
+	if len(emails) != 1 || emails[0].Subject != "Durable" || emails[0].Envelope.From != "app@example.com" {
+		t.Fatalf("Expected the email after a restart, got %+v", emails)
+	}
+}
+
+func TestMemoryStoreRecipientIndex(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	add := func(subject string, to ...string) Email {
+		email, err := store.Add(ctx, newEmail("sender@example.com", to, []byte("Subject: "+subject+"\r\n\r\nBody\r\n")))
+		if err != nil {
+			t.Fatalf("Failed to add email: %v", err)
+		}
+		return email
+	}
+	subjects := func(addr string) []string {
+		emails, err := store.ListByRecipient(ctx, addr)
+		if err != nil {
+			t.Fatalf("Failed to list emails: %v", err)
+		}
+		var subjects []string
+		for _, e := range emails {
+			subjects = append(subjects, e.Subject)
+		}
+		return subjects
+	}
+
+	add("One", "alice@example.com")
+	two := add("Two", "bob@example.com", "Alice@Example.com")
+	add("Three", "user@bücher.example")
+
+	if got := subjects("ALICE@example.com"); !slices.Equal(got, []string{"One", "Two"}) {
+		t.Errorf("Expected One and Two for alice, got %v", got)
+	}
+	if got := subjects("user@xn--bcher-kva.example"); !slices.Equal(got, []string{"Three"}) {
+		t.Errorf("Expected Three for the punycode address, got %v", got)
+	}
+
+	two.To = []Address{{Address: "carol@example.com"}}
+	two.Envelope.To = nil
+	if err := store.Update(ctx, two); err != nil {
+		t.Fatalf("Failed to update email: %v", err)
+	}
+	if got := subjects("alice@example.com"); !slices.Equal(got, []string{"One"}) {
+		t.Errorf("Expected One for alice after update, got %v", got)
+	}
+	if got := subjects("carol@example.com"); !slices.Equal(got, []string{"Two"}) {
+		t.Errorf("Expected Two for carol after update, got %v", got)
+	}
+
+	if err := store.Delete(ctx, "msg-0"); err != nil {
+		t.Fatalf("Failed to delete email: %v", err)
+	}
+	if got := subjects("alice@example.com"); len(got) != 0 {
+		t.Errorf("Expected no emails for alice after delete, got %v", got)
+	}
+	if _, err := store.Get(ctx, "msg-01"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a non-canonical ID, got %v", err)
+	}
+}
+
+func BenchmarkMemoryStoreGet(b *testing.B) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	for i := range 100000 {
+		store.Add(ctx, Email{Subject: fmt.Sprint(i)})
+	}
+
+	for b.Loop() {
+		if _, err := store.Get(ctx, "msg-99999"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStoresOldestIDs(t *testing.T) {
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	defer boltStore.Close()
+	redisStore, _ := newTestRedisStore(t)
+	compressed, err := NewCompressedStore(NewMemoryStore(), CompressGzip)
+	if err != nil {
+		t.Fatalf("Failed to create compressed store: %v", err)
+	}
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "bolt": boltStore, "redis": redisStore, "compressed": compressed} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for range 4 {
+				if _, err := store.Add(ctx, newEmail("app@example.com", []string{"user@example.com"}, []byte("Subject: Hi\r\n\r\nBody\r\n"))); err != nil {
+					t.Fatalf("Failed to add email: %v", err)
+				}
+			}
+			if err := store.Delete(ctx, "msg-0"); err != nil {
+				t.Fatalf("Failed to delete email: %v", err)
+			}
+
+			lister := store.(OldestLister)
+			ids, err := lister.OldestIDs(ctx, 2)
+			if err != nil {
+				t.Fatalf("Failed to list the oldest IDs: %v", err)
+			}
+			if !slices.Equal(ids, []string{"msg-1", "msg-2"}) {
+				t.Errorf("Expected msg-1 and msg-2, got %v", ids)
+			}
+			if ids, _ := lister.OldestIDs(ctx, 10); len(ids) != 3 {
+				t.Errorf("Expected all 3 IDs, got %v", ids)
+			}
+		})
+	}
+}
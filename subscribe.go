@@ -0,0 +1,189 @@
+package mailcatcher
+
+import "sync"
+
+// subscribeBuffer is the default number of emails queued for a subscriber.
+const subscribeBuffer = 64
+
+// Backpressure is what Subscribe does with an email for a subscriber whose
+// buffer is full.
+type Backpressure int
+
+const (
+	// DropNewest discards the new email, so a slow subscriber misses the
+	// latest mail. It is the default.
+	DropNewest Backpressure = iota
+	// DropOldest discards the oldest queued email to make room, so a slow
+	// subscriber misses the earliest mail.
+	DropOldest
+	// Block waits until the subscriber makes room, holding up the reply
+	// to the SMTP client or the caller of Send, so no email is missed.
+	Block
+)
+
+// SubscribeOption configures a subscription created by Subscribe.
+type SubscribeOption func(*subscriber)
+
+// SubscribeBuffer sets the number of emails queued for the subscriber,
+// 64 by default. Zero makes the channel unbuffered.
+func SubscribeBuffer(n int) SubscribeOption {
+	return func(sub *subscriber) { sub.buffer = max(n, 0) }
+}
+
+// SubscribeBackpressure sets what happens to emails while the buffer is
+// full, DropNewest by default.
+func SubscribeBackpressure(b Backpressure) SubscribeOption {
+	return func(sub *subscriber) { sub.backpressure = b }
+}
+
+// subscriber is a channel returned by Subscribe.
+type subscriber struct {
+	buffer       int
+	backpressure Backpressure
+
+	mu     sync.Mutex // held while sending, so cancel cannot close ch midway
+	ch     chan Email
+	done   chan struct{} // closed by close
+	closed sync.Once
+}
+
+// emailHub fans out stored emails to the channels of Subscribe.
+type emailHub struct {
+	mu     sync.Mutex
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+// Subscribe returns a channel receiving every stored email, including
+// held ones, for consumers that want new mail pushed to them rather than
+// polling Emails. With a shared store, this includes the emails received
+// by other replicas; they arrive through its change stream, which Block
+// holds up instead of an SMTP reply. The channel is closed when cancel is
+// called or the server stops. See Backpressure for what happens when the
+// consumer falls behind.
+//
+//	emails, cancel := server.Subscribe(mailcatcher.SubscribeBackpressure(mailcatcher.DropOldest))
+//	defer cancel()
+//	for email := range emails {
+//	    log.Printf("Captured %s: %s", email.ID, email.Subject)
+//	}
+func (s *Server) Subscribe(opts ...SubscribeOption) (emails <-chan Email, cancel func()) {
+	sub := &subscriber{buffer: subscribeBuffer, done: make(chan struct{})}
+	for _, opt := range opts {
+		opt(sub)
+	}
+	sub.ch = make(chan Email, sub.buffer)
+
+	h := &s.subscribers
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+	if h.subs == nil {
+		h.subs = make(map[*subscriber]struct{})
+	}
+	h.subs[sub] = struct{}{}
+
+	return sub.ch, func() {
+		h.mu.Lock()
+		delete(h.subs, sub)
+		h.mu.Unlock()
+		sub.close()
+	}
+}
+
+// deliver sends a locally stored email to every subscriber. When a shared
+// store is watched, handleEvent delivers it instead, together with the
+// emails stored by other replicas.
+func (s *Server) deliver(email Email) {
+	if s.stopWatch != nil {
+		return
+	}
+	s.deliverAll(email)
+}
+
+func (s *Server) deliverAll(email Email) {
+	h := &s.subscribers
+	h.mu.Lock()
+	subs := make([]*subscriber, 0, len(h.subs))
+	for sub := range h.subs {
+		subs = append(subs, sub)
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.send(email) {
+			s.warnf("dropped email %s for a slow subscriber", email.ID)
+		}
+	}
+}
+
+// send queues email according to the backpressure policy and reports
+// whether an email had to be dropped.
+func (sub *subscriber) send(email Email) (dropped bool) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	select {
+	case <-sub.done:
+		return false
+	default:
+	}
+
+	switch sub.backpressure {
+	case Block:
+		select {
+		case sub.ch <- email:
+		case <-sub.done:
+		}
+		return false
+	case DropOldest:
+		for {
+			select {
+			case sub.ch <- email:
+				return dropped
+			default:
+			}
+			if sub.buffer == 0 {
+				return true // nothing queued to drop
+			}
+			select {
+			case <-sub.ch:
+				dropped = true
+			default: // the subscriber made room meanwhile
+			}
+		}
+	default:
+		select {
+		case sub.ch <- email:
+			return false
+		default:
+			return true
+		}
+	}
+}
+
+// close closes the channel, waking a blocked send first. It may be called
+// more than once.
+func (sub *subscriber) close() {
+	sub.closed.Do(func() {
+		close(sub.done)
+		sub.mu.Lock()
+		defer sub.mu.Unlock()
+		close(sub.ch)
+	})
+}
+
+// close ends all subscriptions when the server stops.
+func (h *emailHub) close() {
+	h.mu.Lock()
+	subs := h.subs
+	h.subs = nil
+	h.closed = true
+	h.mu.Unlock()
+
+	for sub := range subs {
+		sub.close()
+	}
+}
@@ -0,0 +1,152 @@
+package mailcatcher
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// sendN sends n emails with the subjects "0" to n-1.
+func sendN(t *testing.T, server *Server, n int) {
+	t.Helper()
+	for i := range n {
+		if err := server.Send("app@example.com", []string{"user@example.com"}, fmt.Appendf(nil, "Subject: %d\r\n\r\nBody\r\n", i)); err != nil {
+			t.Fatalf("Failed to send email: %v", err)
+		}
+	}
+}
+
+// receive returns the subjects of the emails queued on ch.
+func receive(ch <-chan Email) []string {
+	var subjects []string
+	for {
+		select {
+		case email, ok := <-ch:
+			if !ok {
+				return subjects
+			}
+			subjects = append(subjects, email.Subject)
+		default:
+			return subjects
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	server := New(0, 0)
+	emails, cancel := server.Subscribe()
+	sendN(t, server, 2)
+
+	if got := receive(emails); fmt.Sprint(got) != "[0 1]" {
+		t.Errorf("Expected both emails, got %v", got)
+	}
+
+	cancel()
+	cancel() // cancelling again is harmless
+	if _, ok := <-emails; ok {
+		t.Error("Expected the channel to be closed")
+	}
+	sendN(t, server, 1) // no longer delivered
+}
+
+func TestSubscribeBackpressure(t *testing.T) {
+	for _, tt := range []struct {
+		policy Backpressure
+		want   string
+	}{
+		{DropNewest, "[0 1]"},
+		{DropOldest, "[2 3]"},
+	} {
+		server := New(0, 0)
+		emails, cancel := server.Subscribe(SubscribeBuffer(2), SubscribeBackpressure(tt.policy))
+		sendN(t, server, 4)
+		if got := receive(emails); fmt.Sprint(got) != tt.want {
+			t.Errorf("Expected %s for policy %d, got %v", tt.want, tt.policy, got)
+		}
+		cancel()
+	}
+}
+
+func TestSubscribeBlock(t *testing.T) {
+	server := New(0, 0)
+	emails, cancel := server.Subscribe(SubscribeBuffer(1), SubscribeBackpressure(Block))
+	defer cancel()
+
+	sent := make(chan struct{})
+	go func() {
+		sendN(t, server, 3)
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("Expected Send to wait for the subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var got []string
+	for range 3 {
+		got = append(got, (<-emails).Subject)
+	}
+	<-sent
+	if fmt.Sprint(got) != "[0 1 2]" {
+		t.Errorf("Expected every email in order, got %v", got)
+	}
+}
+
+func TestSubscribeStop(t *testing.T) {
+	server, _ := NewTestServer(t)
+	emails, cancel := server.Subscribe(SubscribeBackpressure(Block), SubscribeBuffer(0))
+	defer cancel()
+
+	ctx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	if err := server.Stop(ctx); err != nil {
+		t.Fatalf("Failed to stop server: %v", err)
+	}
+	if _, ok := <-emails; ok {
+		t.Error("Expected the channel to be closed when the server stops")
+	}
+
+	emails, _ = server.Subscribe()
+	if _, ok := <-emails; ok {
+		t.Error("Expected a closed channel after the server stopped")
+	}
+}
+
+func TestSubscribeSharedStore(t *testing.T) {
+	_, mr := newTestRedisStore(t)
+	replica := func() *Server {
+		store, err := NewRedisStore("redis://" + mr.Addr())
+		if err != nil {
+			t.Fatalf("Failed to open Redis store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		server, _ := NewTestServer(t, WithStore(store))
+		return server
+	}
+	first, second := replica(), replica()
+	emails, cancel := second.Subscribe()
+	defer cancel()
+	time.Sleep(100 * time.Millisecond) // let the replicas watch the store
+
+	// Mail received by either replica is delivered once
+	first.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: First\r\n\r\nBody\r\n"))
+	second.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Second\r\n\r\nBody\r\n"))
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for len(got) < 2 {
+		select {
+		case email := <-emails:
+			got = append(got, email.Subject)
+		case <-timeout:
+			t.Fatalf("Expected 2 emails, got %v", got)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	got = append(got, receive(emails)...)
+	if !slices.Equal(got, []string{"First", "Second"}) {
+		t.Errorf("Expected First and Second once each, got %v", got)
+	}
+}
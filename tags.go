@@ -0,0 +1,124 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// MarkRead clears the Unread flag of the email with the given ID.
+func (s *Server) MarkRead(id string) error {
+	return s.updateEmail(id, func(e *Email) { e.Unread = false })
+}
+
+// MarkUnread sets the Unread flag of the email with the given ID again.
+func (s *Server) MarkUnread(id string) error {
+	return s.updateEmail(id, func(e *Email) { e.Unread = true })
+}
+
+// Tag adds tags to the email with the given ID. Tags are arbitrary
+// strings, e.g. "checked" or "bug-123", kept in the order first added.
+func (s *Server) Tag(id string, tags ...string) error {
+	return s.updateEmail(id, func(e *Email) { e.Tags = normalizeTags(append(slices.Clone(e.Tags), tags...)) })
+}
+
+// Untag removes tags from the email with the given ID.
+func (s *Server) Untag(id string, tags ...string) error {
+	return s.updateEmail(id, func(e *Email) {
+		e.Tags = slices.DeleteFunc(slices.Clone(e.Tags), func(tag string) bool { return slices.Contains(tags, tag) })
+		if len(e.Tags) == 0 {
+			e.Tags = nil
+		}
+	})
+}
+
+// SetTags replaces the tags of the email with the given ID.
+func (s *Server) SetTags(id string, tags ...string) error {
+	return s.updateEmail(id, func(e *Email) { e.Tags = normalizeTags(tags) })
+}
+
+// updateEmail applies change to a stored email and reports the update.
+// Updates are serialized, so concurrent changes to one email, such as two
+// tags added at once, are not lost.
+func (s *Server) updateEmail(id string, change func(*Email)) error {
+	return s.tryUpdateEmail(id, func(e *Email) error {
+		change(e)
+		return nil
+	})
+}
+
+// tryUpdateEmail is updateEmail with a change that can refuse: the email
+// is left as it is and the error of change returned.
+func (s *Server) tryUpdateEmail(id string, change func(*Email) error) error {
+	ctx := context.Background()
+	s.updates.Lock()
+	defer s.updates.Unlock()
+
+	email, err := s.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := change(&email); err != nil {
+		return err
+	}
+	if err := s.store.Update(ctx, email); err != nil {
+		return err
+	}
+	s.publish(Event{Type: EventUpdated, ID: email.ID, Email: &email})
+	return nil
+}
+
+// normalizeTags trims tags and drops empty and repeated ones.
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// HTTP handlers
+
+// handlePatchEmail updates the flags of an email. Fields left out of the
+// request are not changed; "tags" replaces all tags.
+func (s *Server) handlePatchEmail(w http.ResponseWriter, r *http.Request) {
+	var patch struct {
+		Unread *bool     `json:"unread"`
+		Tags   *[]string `json:"tags"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&patch); err != nil {
+		http.Error(w, "Invalid update", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	err := s.updateEmail(id, func(e *Email) {
+		if patch.Unread != nil {
+			e.Unread = *patch.Unread
+		}
+		if patch.Tags != nil {
+			e.Tags = normalizeTags(*patch.Tags)
+		}
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Email not found", http.StatusNotFound)
+		} else {
+			s.errorf("Failed to update email: %v", err)
+			http.Error(w, "Failed to update email", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Email(id)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,151 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadAndTags(t *testing.T) {
+	server := New(0, 0)
+	for _, subject := range []string{"First", "Second"} {
+		if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: "+subject+"\r\n\r\nBody\r\n")); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	if email := server.Email("msg-0"); !email.Unread {
+		t.Error("Expected a new email to be unread")
+	}
+	if err := server.MarkRead("msg-0"); err != nil {
+		t.Fatalf("Failed to mark read: %v", err)
+	}
+	if unread := server.Find(Filter{Unread: true}); len(unread) != 1 || unread[0].ID != "msg-1" {
+		t.Errorf("Expected only msg-1 unread, got %v", unread)
+	}
+	if err := server.MarkUnread("msg-0"); err != nil || !server.Email("msg-0").Unread {
+		t.Errorf("Expected msg-0 to be unread again, got %v", err)
+	}
+
+	if err := server.Tag("msg-1", "checked", " bug-123 ", "checked", ""); err != nil {
+		t.Fatalf("Failed to tag: %v", err)
+	}
+	if tags := server.Email("msg-1").Tags; !slices.Equal(tags, []string{"checked", "bug-123"}) {
+		t.Errorf("Expected [checked bug-123], got %v", tags)
+	}
+	if tagged := server.Find(Filter{Tag: "bug-123"}); len(tagged) != 1 || tagged[0].ID != "msg-1" {
+		t.Errorf("Expected msg-1 tagged bug-123, got %v", tagged)
+	}
+	if err := server.Untag("msg-1", "checked"); err != nil {
+		t.Fatalf("Failed to untag: %v", err)
+	}
+	if tags := server.Email("msg-1").Tags; !slices.Equal(tags, []string{"bug-123"}) {
+		t.Errorf("Expected [bug-123], got %v", tags)
+	}
+	if err := server.SetTags("msg-1"); err != nil || server.Email("msg-1").Tags != nil {
+		t.Errorf("Expected no tags, got %v", err)
+	}
+
+	if err := server.Tag("msg-9", "x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPatchEmail(t *testing.T) {
+	server, _ := NewTestServer(t)
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Hi\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	base := "http://" + server.HTTPAddr() + "/api/v1/emails"
+
+	patch := func(id, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPatch, base+"/"+id, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to patch: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := patch("msg-0", `{"unread": false, "tags": ["checked"]}`)
+	var email Email
+	if err := json.NewDecoder(resp.Body).Decode(&email); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || email.Unread || !slices.Equal(email.Tags, []string{"checked"}) {
+		t.Errorf("Expected a read email tagged checked, got %d %+v", resp.StatusCode, email)
+	}
+
+	patch("msg-0", `{"unread": true}`)
+	if got := server.Email("msg-0"); !got.Unread || !slices.Equal(got.Tags, []string{"checked"}) {
+		t.Errorf("Expected the tags to be kept, got %+v", got)
+	}
+
+	resp, err := http.Get(base + "?unread=true&tag=checked")
+	if err != nil {
+		t.Fatalf("Failed to list emails: %v", err)
+	}
+	var list struct {
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	resp.Body.Close()
+	if list.Total != 1 {
+		t.Errorf("Expected 1 unread email tagged checked, got %d", list.Total)
+	}
+
+	if resp := patch("msg-9", `{}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing email, got %d", resp.StatusCode)
+	}
+	if resp := patch("msg-0", `{"unread": "no"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid update, got %d", resp.StatusCode)
+	}
+}
+
+// slowStore widens the window between reading and updating an email.
+type slowStore struct {
+	*MemoryStore
+}
+
+func (s slowStore) Get(ctx context.Context, id string) (Email, error) {
+	email, err := s.MemoryStore.Get(ctx, id)
+	time.Sleep(time.Millisecond)
+	return email, err
+}
+
+func TestConcurrentTags(t *testing.T) {
+	server := NewWithOptions(WithStore(slowStore{NewMemoryStore()}))
+	server.AddHoldRule(HoldSubject("review"))
+	server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Please review\r\n\r\nBody\r\n"))
+
+	// Each change starts from the email as left by the previous one
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.Tag("msg-0", "tag-"+strconv.Itoa(i))
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		server.Approve("msg-0")
+	}()
+	wg.Wait()
+
+	email := server.Email("msg-0")
+	if len(email.Tags) != 50 || email.Held {
+		t.Errorf("Expected 50 tags on the approved email, got %d held=%v", len(email.Tags), email.Held)
+	}
+}
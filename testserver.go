@@ -0,0 +1,53 @@
+package mailcatcher
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// NewTestServer starts a server on free loopback ports for the duration of
+// a test and returns it with its SMTP address. The server is stopped by
+// t.Cleanup and logs through t.Logf. Options are applied after the test
+// defaults, so they can override the host and ports.
+func NewTestServer(t testing.TB, opts ...Option) (*Server, string) {
+	t.Helper()
+
+	logger := &testLogger{t: t}
+	opts = append([]Option{WithHost("127.0.0.1"), WithSMTPPort(0), WithHTTPPort(0), WithLogger(logger)}, opts...)
+	server := NewWithOptions(opts...)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start mail catcher: %v", err)
+	}
+
+	t.Cleanup(func() {
+		// Like httptest.Server.Close: a connection the default client dialed
+		// but never used would otherwise hold up Shutdown until the timeout.
+		if tr, ok := http.DefaultTransport.(*http.Transport); ok {
+			tr.CloseIdleConnections()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Stop(ctx); err != nil {
+			t.Errorf("Failed to stop mail catcher: %v", err)
+		}
+		logger.done.Store(true)
+	})
+
+	return server, server.SMTPAddr()
+}
+
+// testLogger sends log output to the test, dropping output from background
+// work that outlives it, which t.Logf does not allow.
+type testLogger struct {
+	t    testing.TB
+	done atomic.Bool
+}
+
+func (l *testLogger) Printf(format string, v ...any) {
+	if !l.done.Load() {
+		l.t.Logf(format, v...)
+	}
+}
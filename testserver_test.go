@@ -0,0 +1,39 @@
+package mailcatcher
+
+import (
+	"context"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTestServer(t *testing.T) {
+	var stopped *Server
+	for _, name := range []string{"first", "second"} {
+		t.Run(name, func(t *testing.T) {
+			server, addr := NewTestServer(t, WithDomain(name+".test"))
+			if !strings.HasPrefix(addr, "127.0.0.1:") {
+				t.Errorf("Expected loopback address, got %s", addr)
+			}
+
+			msg := []byte("Subject: " + name + "\r\n\r\nBody\r\n")
+			if err := smtp.SendMail(addr, nil, "sender@example.com", []string{"user@example.com"}, msg); err != nil {
+				t.Fatalf("Failed to send email: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			email, err := server.WaitForEmail(ctx)
+			if err != nil || email.Subject != name {
+				t.Errorf("Expected email %q, got %q (%v)", name, email.Subject, err)
+			}
+			stopped = server
+		})
+	}
+
+	// Cleanup has closed the listener of the last subtest
+	if err := smtp.SendMail(stopped.SMTPAddr(), nil, "sender@example.com", []string{"user@example.com"}, []byte("\r\n")); err == nil {
+		t.Error("Expected server to be stopped after the test")
+	}
+}
@@ -0,0 +1,362 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Command is one SMTP command from a session transcript, with the reply
+// the server gave to it.
+type Command struct {
+	Time  time.Time `json:"time"`
+	Verb  string    `json:"verb"`
+	Args  string    `json:"args,omitempty"`
+	Reply string    `json:"reply,omitempty"`
+
+	// Unknown is set for commands the server does not recognize,
+	// such as XCLIENT or other X- extensions.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// knownCommands are the verbs go-smtp recognizes, including the ones it
+// answers with "502 not implemented".
+var knownCommands = map[string]bool{
+	"HELO": true, "EHLO": true, "LHLO": true, "MAIL": true, "RCPT": true,
+	"DATA": true, "BDAT": true, "RSET": true, "VRFY": true, "NOOP": true,
+	"QUIT": true, "AUTH": true, "STARTTLS": true, "SEND": true, "SOML": true,
+	"SAML": true, "EXPN": true, "HELP": true, "TURN": true,
+}
+
+// transcriptListener wraps accepted connections in a transcriptConn.
+// If record is set, each session is also recorded and passed to it when
+// the connection closes. Extensions in hidden are removed from the EHLO
+// reply.
+type transcriptListener struct {
+	net.Listener
+	record func(*Recording)
+	hidden map[string]bool
+}
+
+func (l *transcriptListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	conn := &transcriptConn{Conn: c, start: time.Now(), record: l.record, hidden: l.hidden}
+	if l.record != nil {
+		conn.recording = &Recording{Start: conn.start, Remote: c.RemoteAddr().String()}
+	}
+	return conn, nil
+}
+
+// transcriptConn records the SMTP commands and replies exchanged on a
+// connection. Message content is skipped, AUTH credentials are replaced
+// with Redacted, and recording stops once the connection switches to TLS
+// via STARTTLS.
+type transcriptConn struct {
+	net.Conn
+	start time.Time
+
+	mu       sync.Mutex
+	commands []Command
+	pending  []int // indexes of commands awaiting their final reply
+
+	line      []byte // partial client line
+	reply     []byte // partial server reply
+	replyText []string
+
+	inData      bool     // between 354 and the terminating "."
+	data        dataScan // findings about the DATA content
+	chunkLeft   int64    // remaining BDAT chunk bytes
+	authPending bool     // the next client line answers a 334 challenge
+	encrypted   bool     // STARTTLS succeeded
+	pipelined   bool     // a command was sent before the previous reply
+
+	hidden map[string]bool // extensions removed from the EHLO reply
+	ehlo   []byte          // EHLO reply lines held back until filtered
+
+	recording *Recording
+	record    func(*Recording)
+	closeOnce sync.Once
+}
+
+func (c *transcriptConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mu.Lock()
+		c.addStep(true, c.readClient(b[:n]))
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *transcriptConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	out := b
+	if c.hidden != nil && c.ehloPending() {
+		// go-smtp writes the reply line by line, so hold the lines back
+		// until the last one to rebuild the continuation markers
+		c.ehlo = append(c.ehlo, b...)
+		if !replyComplete(c.ehlo) {
+			c.mu.Unlock()
+			return len(b), nil
+		}
+		out = filterEHLO(c.ehlo, c.hidden)
+		c.ehlo = nil
+	}
+	c.addStep(false, out)
+	c.readServer(out)
+	c.mu.Unlock()
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// ehloPending reports whether the server is answering EHLO or LHLO.
+func (c *transcriptConn) ehloPending() bool {
+	if c.encrypted || len(c.pending) == 0 {
+		return false
+	}
+	verb := c.commands[c.pending[0]].Verb
+	return verb == "EHLO" || verb == "LHLO"
+}
+
+// replyComplete reports whether reply ends with the last line of an SMTP
+// reply.
+func replyComplete(reply []byte) bool {
+	if !bytes.HasSuffix(reply, []byte("\n")) {
+		return false
+	}
+	lines := strings.Split(strings.TrimRight(string(reply), "\r\n"), "\n")
+	last := lines[len(lines)-1]
+	return len(last) <= 3 || last[3] != '-'
+}
+
+// filterEHLO removes the hidden extensions from an EHLO reply. The first
+// line holds the greeting and is always kept.
+func filterEHLO(reply []byte, hidden map[string]bool) []byte {
+	lines := strings.Split(strings.TrimRight(string(reply), "\r\n"), "\n")
+	if len(lines[0]) < 4 {
+		return reply
+	}
+	code := lines[0][:3]
+
+	var kept []string
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if len(line) < 4 {
+			return reply
+		}
+		text := line[4:]
+		keyword, _, _ := strings.Cut(text, " ")
+		if i > 0 && hidden[strings.ToUpper(keyword)] {
+			continue
+		}
+		kept = append(kept, text)
+	}
+
+	var b strings.Builder
+	for i, text := range kept {
+		sep := "-"
+		if i == len(kept)-1 {
+			sep = " "
+		}
+		b.WriteString(code + sep + text + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+func (c *transcriptConn) Close() error {
+	c.closeOnce.Do(func() {
+		// Reads on other goroutines may still be adding steps
+		c.mu.Lock()
+		var recording *Recording
+		if c.recording != nil && len(c.recording.Steps) > 0 {
+			snapshot := *c.recording
+			snapshot.Steps = slices.Clone(c.recording.Steps)
+			recording = &snapshot
+		}
+		c.mu.Unlock()
+		if recording != nil {
+			c.record(recording)
+		}
+	})
+	return c.Conn.Close()
+}
+
+// addStep appends bytes to the session recording, if any.
+func (c *transcriptConn) addStep(client bool, b []byte) {
+	if c.recording == nil || c.encrypted || len(b) == 0 {
+		return
+	}
+	c.recording.Steps = append(c.recording.Steps, Step{
+		Offset: time.Since(c.start),
+		Client: client,
+		Data:   bytes.Clone(b),
+	})
+}
+
+// readClient parses bytes sent by the client and returns them as they
+// are recorded: command lines once complete, with AUTH credentials
+// redacted.
+func (c *transcriptConn) readClient(b []byte) []byte {
+	var recorded []byte
+	for len(b) > 0 && !c.encrypted {
+		if c.chunkLeft > 0 {
+			n := min(int64(len(b)), c.chunkLeft)
+			c.chunkLeft -= n
+			recorded = append(recorded, b[:n]...)
+			b = b[n:]
+			continue
+		}
+
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			c.line = append(c.line, b...)
+			return recorded
+		}
+		c.line = append(c.line, b[:i+1]...)
+		b = b[i+1:]
+
+		if c.inData {
+			c.dataLine(c.line)
+			recorded = append(recorded, c.line...)
+		} else if line := strings.TrimRight(string(c.line), "\r\n"); c.clientLine(line) {
+			recorded = append(recorded, c.line...)
+		} else {
+			recorded = append(recorded, redactAuth(line)+"\r\n"...)
+		}
+		c.line = c.line[:0]
+	}
+	return recorded
+}
+
+// redactAuth replaces the credentials in a client line holding them: the
+// initial response of an AUTH command, or a whole SASL response.
+func redactAuth(line string) string {
+	verb, args, _ := strings.Cut(line, " ")
+	if !strings.EqualFold(verb, "AUTH") {
+		return Redacted
+	}
+	mechanism, _, _ := strings.Cut(args, " ")
+	return verb + " " + mechanism + " " + Redacted
+}
+
+// clientLine parses a client command line and reports whether it may be
+// recorded as is; lines carrying credentials may not.
+func (c *transcriptConn) clientLine(line string) bool {
+	if c.authPending {
+		c.authPending = false
+		return false
+	}
+
+	verb, args, _ := strings.Cut(line, " ")
+	verb = strings.ToUpper(verb)
+	safe := true
+	if mechanism, response, ok := strings.Cut(args, " "); verb == "AUTH" && ok && response != "" {
+		args, safe = mechanism+" "+Redacted, false
+	}
+	if len(c.pending) > 0 {
+		c.pipelined = true
+	}
+	c.pending = append(c.pending, len(c.commands))
+	c.commands = append(c.commands, Command{
+		Time:    time.Now(),
+		Verb:    verb,
+		Args:    args,
+		Unknown: !knownCommands[verb],
+	})
+
+	if verb == "BDAT" {
+		size, _, _ := strings.Cut(args, " ")
+		c.chunkLeft, _ = strconv.ParseInt(size, 10, 64)
+	}
+	return safe
+}
+
+// readServer parses bytes sent by the server.
+func (c *transcriptConn) readServer(b []byte) {
+	for len(b) > 0 && !c.encrypted {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			c.reply = append(c.reply, b...)
+			return
+		}
+		c.reply = append(c.reply, b[:i+1]...)
+		b = b[i+1:]
+
+		line := strings.TrimRight(string(c.reply), "\r\n")
+		c.reply = c.reply[:0]
+		c.replyText = append(c.replyText, line)
+
+		// "250-..." continues a multi-line reply, "250 ..." ends it
+		if len(line) > 3 && line[3] == '-' {
+			continue
+		}
+		c.serverReply(line, strings.Join(c.replyText, "\n"))
+		c.replyText = c.replyText[:0]
+	}
+}
+
+func (c *transcriptConn) serverReply(last, text string) {
+	code := last
+	if len(code) > 3 {
+		code = code[:3]
+	}
+
+	// Intermediate replies leave the command waiting for its final reply
+	switch code {
+	case "354":
+		c.inData = true
+		c.data = dataScan{lineStart: true}
+		return
+	case "334":
+		c.authPending = true
+		return
+	}
+
+	if len(c.pending) == 0 {
+		return // greeting or unsolicited reply
+	}
+	idx := c.pending[0]
+	c.pending = c.pending[1:]
+	c.commands[idx].Reply = text
+
+	if c.commands[idx].Verb == "STARTTLS" && code == "220" {
+		c.encrypted = true
+	}
+}
+
+// take returns the commands recorded so far, the findings about the last
+// DATA content and whether commands were pipelined, and starts a new
+// transcript, so each message carries the commands of its own
+// transaction. It is called right after the content has been read, so
+// the final DATA reply is not part of the transcript.
+func (c *transcriptConn) take() ([]Command, []DataFinding, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	commands, findings, pipelined := c.commands, c.data.findings, c.pipelined
+	c.commands = nil
+	c.pending = nil
+	c.data.findings = nil
+	c.pipelined = false
+	return commands, findings, pipelined
+}
+
+// UnknownCommands returns the unrecognized commands from the transcript.
+func (e *Email) UnknownCommands() []Command {
+	var commands []Command
+	for _, cmd := range e.Transcript {
+		if cmd.Unknown {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
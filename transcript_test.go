@@ -0,0 +1,189 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/base64"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialSMTP opens a raw SMTP connection and consumes the greeting.
+func dialSMTP(t *testing.T, addr string) *textproto.Conn {
+	t.Helper()
+
+	conn, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		t.Fatalf("Failed to read greeting: %v", err)
+	}
+	return conn
+}
+
+// smtpCommand sends a command and returns the reply code.
+func smtpCommand(t *testing.T, conn *textproto.Conn, format string, args ...any) int {
+	t.Helper()
+
+	id, err := conn.Cmd(format, args...)
+	if err != nil {
+		t.Fatalf("Failed to send %q: %v", format, err)
+	}
+	conn.StartResponse(id)
+	defer conn.EndResponse(id)
+
+	code, _, _ := conn.ReadResponse(0)
+	return code
+}
+
+func TestTranscriptUnknownCommands(t *testing.T) {
+	server := New(10042, 10097)
+	err := server.Start()
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	conn := dialSMTP(t, "localhost:10042")
+	defer conn.Close()
+
+	smtpCommand(t, conn, "EHLO client.example.com")
+	if code := smtpCommand(t, conn, "XCLIENT ADDR=192.0.2.1"); code < 500 {
+		t.Errorf("Expected 5xx for XCLIENT, got %d", code)
+	}
+	smtpCommand(t, conn, "MAIL FROM:<sender@example.com>")
+	smtpCommand(t, conn, "RCPT TO:<recipient@example.com>")
+	if code := smtpCommand(t, conn, "DATA"); code != 354 {
+		t.Fatalf("Expected 354 for DATA, got %d", code)
+	}
+
+	// A body line looking like a command must not show up in the transcript
+	w := conn.DotWriter()
+	w.Write([]byte("Subject: Transcript\r\n\r\nXFOO not a command\r\n"))
+	w.Close()
+	if _, _, err := conn.ReadResponse(250); err != nil {
+		t.Fatalf("Expected message to be accepted: %v", err)
+	}
+	smtpCommand(t, conn, "QUIT")
+
+	time.Sleep(100 * time.Millisecond)
+
+	emails := server.Emails()
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(emails))
+	}
+
+	var verbs []string
+	for _, cmd := range emails[0].Transcript {
+		verbs = append(verbs, cmd.Verb)
+	}
+	if strings.Join(verbs, " ") != "EHLO XCLIENT MAIL RCPT DATA" {
+		t.Errorf("Expected transcript 'EHLO XCLIENT MAIL RCPT DATA', got '%s'", strings.Join(verbs, " "))
+	}
+
+	unknown := emails[0].UnknownCommands()
+	if len(unknown) != 1 {
+		t.Fatalf("Expected 1 unknown command, got %+v", unknown)
+	}
+	if unknown[0].Verb != "XCLIENT" || unknown[0].Args != "ADDR=192.0.2.1" {
+		t.Errorf("Expected XCLIENT ADDR=192.0.2.1, got %s %s", unknown[0].Verb, unknown[0].Args)
+	}
+	if !strings.HasPrefix(unknown[0].Reply, "50") {
+		t.Errorf("Expected recorded 5xx reply, got '%s'", unknown[0].Reply)
+	}
+	if ehlo := emails[0].Transcript[0]; !strings.HasPrefix(ehlo.Reply, "250-") {
+		t.Errorf("Expected multi-line EHLO reply, got '%s'", ehlo.Reply)
+	}
+}
+
+func TestTranscriptRedactsAuth(t *testing.T) {
+	dir := t.TempDir()
+	server := New(0, 0)
+	server.SetRecordDir(dir)
+	if err := server.StartContext(t.Context()); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+
+	initial := base64.StdEncoding.EncodeToString([]byte("\x00app\x00initial-secret"))
+	response := base64.StdEncoding.EncodeToString([]byte("\x00app\x00response-secret"))
+	conn := dialSMTP(t, server.SMTPAddr())
+	smtpCommand(t, conn, "EHLO client.example.com")
+	if code := smtpCommand(t, conn, "AUTH PLAIN %s", initial); code != 235 {
+		t.Fatalf("Expected 235 for AUTH, got %d", code)
+	}
+	smtpCommand(t, conn, "MAIL FROM:<sender@example.com>")
+	smtpCommand(t, conn, "RCPT TO:<recipient@example.com>")
+	smtpCommand(t, conn, "DATA")
+	w := conn.DotWriter()
+	w.Write([]byte("Subject: Secret\r\n\r\nBody\r\n"))
+	w.Close()
+	if _, _, err := conn.ReadResponse(250); err != nil {
+		t.Fatalf("Expected message to be accepted: %v", err)
+	}
+	smtpCommand(t, conn, "QUIT")
+	conn.Close()
+
+	// The response can also follow a 334 challenge
+	conn = dialSMTP(t, server.SMTPAddr())
+	smtpCommand(t, conn, "EHLO client.example.com")
+	if code := smtpCommand(t, conn, "AUTH PLAIN"); code != 334 {
+		t.Fatalf("Expected a 334 challenge, got %d", code)
+	}
+	if code := smtpCommand(t, conn, "%s", response); code != 235 {
+		t.Fatalf("Expected 235 for the SASL response, got %d", code)
+	}
+	smtpCommand(t, conn, "QUIT")
+	conn.Close()
+
+	email, err := server.WaitFor(t.Context(), func(Email) bool { return true })
+	if err != nil {
+		t.Fatalf("Expected the email: %v", err)
+	}
+	for _, cmd := range email.Transcript {
+		if cmd.Verb == "AUTH" && cmd.Args != "PLAIN "+Redacted && cmd.Args != "PLAIN" {
+			t.Errorf("Expected AUTH without credentials, got %q", cmd.Args)
+		}
+	}
+
+	var files []string
+	for range 20 {
+		if files, _ = filepath.Glob(filepath.Join(dir, "*.json")); len(files) == 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 recordings, got %d", len(files))
+	}
+	var client strings.Builder
+	for _, file := range files {
+		rec, err := LoadRecording(file)
+		if err != nil {
+			t.Fatalf("Failed to load recording: %v", err)
+		}
+		for _, step := range rec.Steps {
+			if step.Client {
+				client.Write(step.Data)
+			}
+		}
+	}
+	for _, secret := range []string{initial, response} {
+		if strings.Contains(client.String(), secret) {
+			t.Errorf("Expected the recordings not to contain %s", secret)
+		}
+	}
+	for _, want := range []string{"AUTH PLAIN " + Redacted + "\r\nMAIL FROM:", "AUTH PLAIN\r\n" + Redacted + "\r\nQUIT"} {
+		if !strings.Contains(client.String(), want) {
+			t.Errorf("Expected the redacted exchange %q, got %q", want, client.String())
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// mailcatcher web UI. Email content is only ever inserted as text or into
+// the sandboxed iframe, never as markup into this page.
+(function () {
+  'use strict';
+
+  const api = 'api/v1/';
+  const list = document.querySelector('#list tbody');
+  const empty = document.getElementById('empty');
+  const filter = document.getElementById('filter');
+  const message = document.getElementById('message');
+  const frame = document.getElementById('html');
+  const pre = document.getElementById('text');
+
+  let emails = [];
+  let selected = null;
+  let view = 'html';
+
+  function addresses(list) {
+    return (list || []).map(a => a.name ? a.name + ' <' + a.address + '>' : a.address).join(', ');
+  }
+
+  function cell(row, text) {
+    const td = document.createElement('td');
+    td.textContent = text;
+    td.title = text;
+    row.appendChild(td);
+  }
+
+  function render() {
+    const query = filter.value.trim().toLowerCase();
+    list.replaceChildren();
+
+    const shown = emails.filter(e => !query ||
+      [e.subject, addresses([e.from]), addresses(e.to), addresses(e.cc)].concat(e.tags || []).join(' ').toLowerCase().includes(query));
+    empty.hidden = shown.length > 0;
+
+    // Newest first
+    for (const email of shown.slice().reverse()) {
+      const row = document.createElement('tr');
+      if (email.id === selected) row.classList.add('selected');
+      if (email.held) row.classList.add('held');
+      if (email.unread) row.classList.add('unread');
+      cell(row, addresses([email.from]));
+      cell(row, addresses(email.to));
+      cell(row, (email.held ? '[held] ' : '') + (email.subject || '(no subject)') +
+        (email.tags ? ' [' + email.tags.join(', ') + ']' : ''));
+      cell(row, new Date(email.time).toLocaleString());
+      row.addEventListener('click', () => select(email.id));
+      list.appendChild(row);
+    }
+  }
+
+  async function load() {
+    const [released, held] = await Promise.all([
+      fetch(api + 'emails').then(r => r.json()),
+      fetch(api + 'emails/held').then(r => r.json()),
+    ]);
+    emails = released.items.concat(held.items).sort((a, b) => new Date(a.time) - new Date(b.time));
+    render();
+
+    if (selected && !emails.some(e => e.id === selected)) {
+      selected = null;
+      message.hidden = true;
+    }
+  }
+
+  function show() {
+    const email = emails.find(e => e.id === selected);
+    if (!email) return;
+
+    document.querySelectorAll('.tabs button').forEach(b => b.classList.toggle('active', b.dataset.view === view));
+    frame.hidden = view !== 'html';
+    pre.hidden = view === 'html';
+
+    switch (view) {
+    case 'html':
+      // The preview endpoint resolves inline cid: images
+      frame.src = email.html ? api + 'emails/' + encodeURIComponent(email.id) + '/html' : 'about:blank';
+      break;
+    case 'text':
+      pre.textContent = email.text || '';
+      break;
+    case 'headers':
+      pre.textContent = Object.keys(email.headers || {}).sort()
+        .flatMap(name => email.headers[name].map(value => name + ': ' + value)).join('\n');
+      break;
+    case 'source':
+      pre.textContent = email.body;
+      break;
+    }
+  }
+
+  function select(id) {
+    selected = id;
+    const email = emails.find(e => e.id === id);
+    if (email.unread) {
+      email.unread = false;
+      fetch(api + 'emails/' + encodeURIComponent(id), { method: 'PATCH', body: JSON.stringify({ unread: false }) });
+    }
+    render();
+
+    const headers = document.getElementById('headers');
+    headers.replaceChildren();
+    for (const [name, value] of [
+      ['From', addresses([email.from])],
+      ['To', addresses(email.to)],
+      ['Cc', addresses(email.cc)],
+      ['Subject', email.subject],
+      ['Received', new Date(email.time).toLocaleString()],
+      ['Size', email.size + ' bytes'],
+      ['Tags', (email.tags || []).join(', ')],
+    ]) {
+      if (!value) continue;
+      const dt = document.createElement('dt');
+      const dd = document.createElement('dd');
+      dt.textContent = name;
+      dd.textContent = value;
+      headers.append(dt, dd);
+    }
+
+    const attachments = document.getElementById('attachments');
+    attachments.replaceChildren();
+    (email.attachments || []).forEach((a, i) => {
+      const li = document.createElement('li');
+      const link = document.createElement('a');
+      link.href = api + 'emails/' + encodeURIComponent(email.id) + '/attachments/' + i;
+      link.textContent = (a.filename || 'attachment-' + i) + ' (' + a.content_type + ', ' + a.size + ' bytes)';
+      li.appendChild(link);
+      attachments.appendChild(li);
+    });
+
+    document.getElementById('raw').href = api + 'emails/' + encodeURIComponent(email.id) + '/raw';
+
+    view = email.html ? 'html' : 'text';
+    message.hidden = false;
+    show();
+  }
+
+  document.querySelectorAll('.tabs button').forEach(button => {
+    button.addEventListener('click', () => {
+      view = button.dataset.view;
+      show();
+    });
+  });
+
+  document.getElementById('clear').addEventListener('click', async () => {
+    if (!confirm('Delete all captured emails?')) return;
+    await fetch(api + 'emails', { method: 'DELETE' });
+    await load();
+  });
+
+  document.getElementById('release').addEventListener('click', async () => {
+    if (!selected || !confirm('Send this email to its recipients through the relay?')) return;
+    const resp = await fetch(api + 'emails/' + encodeURIComponent(selected) + '/release', { method: 'POST' });
+    alert(resp.ok ? 'Released' : 'Release failed: ' + await resp.text());
+  });
+
+  document.getElementById('delete').addEventListener('click', async () => {
+    if (!selected) return;
+    await fetch(api + 'emails/' + encodeURIComponent(selected), { method: 'DELETE' });
+    await load();
+  });
+
+  filter.addEventListener('input', render);
+
+  // Web Push: the service worker shows a notification for each new email,
+  // even while this page is closed
+  const notify = document.getElementById('notify');
+  if ('serviceWorker' in navigator && 'PushManager' in window) {
+    const registered = navigator.serviceWorker.register('sw.js');
+
+    function key(base64url) {
+      const raw = atob(base64url.replace(/-/g, '+').replace(/_/g, '/'));
+      return Uint8Array.from(raw, c => c.charCodeAt(0));
+    }
+
+    function post(sub) {
+      // Subscriptions live in server memory, so they are posted again on load
+      return fetch(api + 'push/subscriptions', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(sub) });
+    }
+
+    async function update() {
+      const sub = await (await registered).pushManager.getSubscription();
+      notify.textContent = sub ? 'Notifications on' : 'Notify me';
+      notify.hidden = false;
+      return sub;
+    }
+
+    notify.addEventListener('click', async () => {
+      const registration = await registered;
+      const sub = await registration.pushManager.getSubscription();
+      if (sub) {
+        await fetch(api + 'push/subscriptions', { method: 'DELETE', body: JSON.stringify(sub) });
+        await sub.unsubscribe();
+      } else if (await Notification.requestPermission() === 'granted') {
+        const { public_key } = await (await fetch(api + 'push/key')).json();
+        await post(await registration.pushManager.subscribe({ userVisibleOnly: true, applicationServerKey: key(public_key) }));
+      }
+      await update();
+    });
+
+    update().then(sub => sub && post(sub));
+  }
+
+  // Live updates; EventSource reconnects by itself after errors
+  const status = document.getElementById('status');
+  const events = new EventSource(api + 'events');
+  events.onopen = () => { status.textContent = 'live'; load(); };
+  events.onerror = () => { status.textContent = 'reconnecting…'; };
+  for (const type of ['added', 'updated', 'deleted', 'cleared']) {
+    events.addEventListener(type, load);
+  }
+
+  load();
+})();
@@ -0,0 +1,33 @@
+// mailcatcher service worker. Pushes carry no payload, so the new mail is
+// fetched from the API and announced as a notification.
+'use strict';
+
+const api = 'api/v1/';
+
+self.addEventListener('push', event => {
+  event.waitUntil((async () => {
+    let title = 'New mail';
+    let options = { tag: 'mailcatcher' };
+    try {
+      const { items } = await (await fetch(api + 'emails?sort=desc&limit=1')).json();
+      const email = items[0];
+      if (email) {
+        title = 'New mail from ' + (email.from.name || email.from.address);
+        options = { body: email.subject || '(no subject)', tag: email.id };
+      }
+    } catch (err) {
+      // Still show a notification: push services require a visible one
+    }
+    await self.registration.showNotification(title, options);
+  })());
+});
+
+self.addEventListener('notificationclick', event => {
+  event.notification.close();
+  event.waitUntil((async () => {
+    const windows = await self.clients.matchAll({ type: 'window' });
+    const open = windows.find(w => w.url.startsWith(self.registration.scope));
+    if (open) return open.focus();
+    return self.clients.openWindow(self.registration.scope);
+  })());
+});
@@ -0,0 +1,46 @@
+package mailcatcher
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebUI(t *testing.T) {
+	server := New(0, 0)
+	ts := httptest.NewServer(server.Mux())
+	defer ts.Close()
+
+	for path, want := range map[string]string{
+		"/":          `<iframe id="html" sandbox `, // email HTML must not run scripts
+		"/app.js":    "new EventSource(",
+		"/sw.js":     "showNotification(",
+		"/style.css": "iframe",
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to GET %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200 for %s, got %d", path, resp.StatusCode)
+		}
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %s to contain %q", path, want)
+		}
+	}
+
+	// API routes still take precedence
+	resp, err := http.Get(ts.URL + "/api/v1/emails/msg-999")
+	if err != nil {
+		t.Fatalf("Failed to GET email: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,198 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// Results of DKIM and SPF checks, as in an Authentication-Results header
+// (RFC 8601).
+const (
+	ResultPass      = "pass"
+	ResultFail      = "fail"
+	ResultSoftFail  = "softfail"
+	ResultNeutral   = "neutral"
+	ResultNone      = "none"
+	ResultPermError = "permerror"
+)
+
+// Validation configures the checks applied to received messages. Results
+// are recorded on Email.Validation.
+type Validation struct {
+	// Headers lints the message header, see HeaderIssue.
+	Headers bool
+
+	// DKIMKeys holds DNS TXT records of DKIM public keys by name, e.g.
+	// "mail._domainkey.example.com" to "v=DKIM1; k=rsa; p=MIIBIjAN...".
+	// DKIM-Signature headers are verified against these keys only; DNS is
+	// never queried. DKIM is not checked if the map is nil.
+	DKIMKeys map[string]string
+
+	// SPFRecords holds SPF policies by domain, e.g. "example.com" to
+	// "v=spf1 ip4:192.0.2.0/24 include:_spf.example.net -all", which are
+	// evaluated for the client IP and MAIL FROM domain (or HELO name for
+	// bounces). Only the ip4, ip6, include and all mechanisms and the
+	// redirect modifier are supported, as the others need DNS. SPF is not
+	// checked if the map is nil.
+	SPFRecords map[string]string
+}
+
+// ValidationReport holds the results of the Validation checks on an email.
+type ValidationReport struct {
+	DKIM    []DKIMResult  `json:"dkim,omitempty"`
+	SPF     *SPFResult    `json:"spf,omitempty"`
+	Headers []HeaderIssue `json:"headers,omitempty"`
+}
+
+// DKIMResult is the outcome of verifying one DKIM-Signature header.
+type DKIMResult struct {
+	Domain   string `json:"domain"`
+	Selector string `json:"selector"`
+	Result   string `json:"result"` // ResultPass, ResultFail or ResultPermError
+	Reason   string `json:"reason,omitempty"`
+}
+
+// SPFResult is the outcome of evaluating the SPF policy of the sender
+// domain.
+type SPFResult struct {
+	Domain string `json:"domain"`
+	IP     string `json:"ip"`
+	Result string `json:"result"` // ResultPass, ResultFail, ResultSoftFail, ResultNeutral, ResultNone or ResultPermError
+	Reason string `json:"reason,omitempty"`
+}
+
+// HeaderIssue is a problem found in the message header: a missing or
+// repeated required field, an unparsable Date, a line over the RFC 5322
+// limit of 998 characters, or 8-bit bytes without SMTPUTF8.
+type HeaderIssue struct {
+	Header  string `json:"header"`
+	Problem string `json:"problem"`
+}
+
+// Passed reports whether every DKIM signature verified, SPF did not fail
+// and the header has no issues. A nil report, for mail captured without
+// validation, passes.
+func (r *ValidationReport) Passed() bool {
+	if r == nil {
+		return true
+	}
+	for _, d := range r.DKIM {
+		if d.Result != ResultPass {
+			return false
+		}
+	}
+	if r.SPF != nil && r.SPF.Result != ResultPass && r.SPF.Result != ResultNone {
+		return false
+	}
+	return len(r.Headers) == 0
+}
+
+// SetValidation enables validation of received messages.
+func (s *Server) SetValidation(v Validation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validation = &v
+}
+
+// validate records the results of the configured checks on email.
+func (s *Server) validate(email *Email) {
+	s.mu.RLock()
+	v := s.validation
+	s.mu.RUnlock()
+
+	if v == nil {
+		return
+	}
+	raw := crlf([]byte(email.Body))
+	fields, body := splitHeader(raw)
+
+	report := &ValidationReport{}
+	if v.Headers {
+		report.Headers = lintHeader(email, fields)
+	}
+	if v.DKIMKeys != nil {
+		report.DKIM = verifyDKIM(fields, body, v.DKIMKeys)
+	}
+	if v.SPFRecords != nil && email.RemoteAddr != "" {
+		report.SPF = checkSPF(email, v.SPFRecords)
+	}
+	email.Validation = report
+}
+
+// splitHeader splits a CRLF message into its header fields, each with
+// its folded continuation lines and final CRLF, and the body.
+func splitHeader(raw []byte) ([]string, []byte) {
+	var fields []string
+	for len(raw) > 0 {
+		var line string
+		if i := bytes.Index(raw, []byte("\r\n")); i >= 0 {
+			line, raw = string(raw[:i+2]), raw[i+2:]
+		} else {
+			line, raw = string(raw)+"\r\n", nil // last line without CRLF
+		}
+		if line == "\r\n" {
+			return fields, raw
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+		} else {
+			fields = append(fields, line)
+		}
+	}
+	return fields, nil
+}
+
+// fieldName returns the name of a header field, as written.
+func fieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimSpace(name)
+}
+
+// singleFields may appear at most once (RFC 5322 section 3.6).
+var singleFields = []string{"Date", "From", "Sender", "Reply-To", "To", "Cc", "Bcc", "Message-ID", "In-Reply-To", "References", "Subject"}
+
+// lintHeader returns the problems in the header fields of email.
+func lintHeader(email *Email, fields []string) []HeaderIssue {
+	var issues []HeaderIssue
+	counts := map[string]int{}
+	for _, f := range fields {
+		name := fieldName(f)
+		counts[strings.ToLower(name)]++
+		for _, line := range strings.Split(strings.TrimSuffix(f, "\r\n"), "\r\n") {
+			if len(line) > 998 {
+				issues = append(issues, HeaderIssue{Header: name, Problem: fmt.Sprintf("line of %d characters exceeds 998", len(line))})
+				break
+			}
+		}
+		if !slices.Contains(email.Extensions, ExtensionSMTPUTF8) && strings.IndexFunc(f, func(r rune) bool { return r > 0x7f }) >= 0 {
+			issues = append(issues, HeaderIssue{Header: name, Problem: "8-bit characters without SMTPUTF8; use RFC 2047 encoding"})
+		}
+	}
+
+	for _, name := range []string{"Date", "From", "Message-ID"} {
+		if counts[strings.ToLower(name)] == 0 {
+			issues = append(issues, HeaderIssue{Header: name, Problem: "missing"})
+		}
+	}
+	for _, name := range singleFields {
+		if n := counts[strings.ToLower(name)]; n > 1 {
+			issues = append(issues, HeaderIssue{Header: name, Problem: fmt.Sprintf("appears %d times", n)})
+		}
+	}
+	if counts["date"] > 0 && email.Date.IsZero() {
+		issues = append(issues, HeaderIssue{Header: "Date", Problem: "not a valid RFC 5322 date"})
+	}
+	return issues
+}
+
+// remoteIP returns the IP address of a host:port remote address.
+func remoteIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,68 @@
+package mailcatcher
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/smtp"
+	"slices"
+	"testing"
+)
+
+func TestValidation(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	server, addr := NewTestServer(t)
+	server.SetValidation(Validation{
+		Headers:    true,
+		DKIMKeys:   map[string]string{"mail._domainkey.example.com": dkimRecord(t, key)},
+		SPFRecords: map[string]string{"example.com": "v=spf1 ip4:127.0.0.0/8 -all"},
+	})
+
+	msg := "From: app@example.com\r\nTo: user@example.com\r\nSubject: Hi\r\n" +
+		"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\nMessage-ID: <1@example.com>\r\n\r\nBody\r\n"
+	if err := smtp.SendMail(addr, nil, "app@example.com", []string{"user@example.com"}, []byte(signDKIM(t, msg, key, "relaxed"))); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	report := server.Emails()[0].Validation
+	if report == nil || !report.Passed() {
+		t.Fatalf("Expected the signed message to pass, got %+v", report)
+	}
+	if report.SPF == nil || report.SPF.Result != ResultPass || report.SPF.IP != "127.0.0.1" {
+		t.Errorf("Expected SPF to pass for 127.0.0.1, got %+v", report.SPF)
+	}
+
+	// Unsigned, no Date or Message-ID, two Subjects and a raw UTF-8 header
+	bad := "From: app@example.com\r\nSubject: A\r\nSubject: Grüße\r\n\r\nBody\r\n"
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte(bad)); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	report = server.Emails()[1].Validation
+	if report == nil || report.Passed() || report.DKIM != nil || report.SPF != nil {
+		t.Fatalf("Expected only header issues, got %+v", report)
+	}
+	var problems []string
+	for _, issue := range report.Headers {
+		problems = append(problems, issue.Header+": "+issue.Problem)
+	}
+	want := []string{
+		"Subject: 8-bit characters without SMTPUTF8; use RFC 2047 encoding",
+		"Date: missing",
+		"Message-ID: missing",
+		"Subject: appears 2 times",
+	}
+	if !slices.Equal(problems, want) {
+		t.Errorf("Expected %q, got %q", want, problems)
+	}
+}
+
+func TestValidationDisabled(t *testing.T) {
+	server := New(0, 0)
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Hi\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if v := server.Emails()[0].Validation; v != nil {
+		t.Errorf("Expected no validation by default, got %+v", v)
+	}
+}
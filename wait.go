@@ -0,0 +1,54 @@
+package mailcatcher
+
+import (
+	"context"
+	"fmt"
+)
+
+// WaitForEmail blocks until an email has been captured and returns the
+// first one. It returns immediately if an email is already present.
+func (s *Server) WaitForEmail(ctx context.Context) (Email, error) {
+	return s.WaitFor(ctx, func(Email) bool { return true })
+}
+
+// WaitFor blocks until a captured email matches and returns it, or returns
+// an error when ctx is done. Emails captured before the call are checked
+// first, so a message that arrived early is not missed. Held emails match
+// once they are approved.
+func (s *Server) WaitFor(ctx context.Context, match func(Email) bool) (Email, error) {
+	for {
+		// Take the channel before listing so an arrival in between wakes us
+		arrived := s.arrivals()
+		for _, email := range s.Emails() {
+			if match(email) {
+				return email, nil
+			}
+		}
+
+		select {
+		case <-arrived:
+		case <-ctx.Done():
+			return Email{}, fmt.Errorf("failed to wait for email: %w", ctx.Err())
+		}
+	}
+}
+
+// arrivals returns a channel that is closed on the next arrival.
+func (s *Server) arrivals() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.arrived == nil {
+		s.arrived = make(chan struct{})
+	}
+	return s.arrived
+}
+
+// signalArrival wakes all waiters.
+func (s *Server) signalArrival() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.arrived != nil {
+		close(s.arrived)
+		s.arrived = nil
+	}
+}
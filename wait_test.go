@@ -0,0 +1,75 @@
+package mailcatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitFor(t *testing.T) {
+	server := New(0, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan Email, 1)
+	go func() {
+		email, err := server.WaitFor(ctx, func(e Email) bool { return e.Subject == "Reset your password" })
+		if err != nil {
+			t.Errorf("Failed to wait for email: %v", err)
+		}
+		done <- email
+	}()
+
+	for _, subject := range []string{"Welcome", "Reset your password"} {
+		msg := []byte("Subject: " + subject + "\r\n\r\nBody\r\n")
+		if err := server.Send("app@example.com", []string{"user@example.com"}, msg); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	if email := <-done; email.Subject != "Reset your password" {
+		t.Errorf("Expected the password reset email, got %q", email.Subject)
+	}
+
+	// Already captured mail is returned without waiting
+	email, err := server.WaitForEmail(ctx)
+	if err != nil || email.Subject != "Welcome" {
+		t.Errorf("Expected the first email immediately, got %q (%v)", email.Subject, err)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShort()
+	_, err = server.WaitFor(short, func(e Email) bool { return e.Subject == "Never sent" })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestWaitForApproved(t *testing.T) {
+	server := New(0, 0)
+	server.AddHoldRule(HoldSubject("contract"))
+
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Contract\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		if err := server.Approve(server.Held()[0].ID); err != nil {
+			t.Errorf("Failed to approve: %v", err)
+		}
+	}()
+
+	email, err := server.WaitForEmail(ctx)
+	if err != nil {
+		t.Fatalf("Failed to wait for email: %v", err)
+	}
+	if email.Held {
+		t.Error("Expected the approved email to be released")
+	}
+}
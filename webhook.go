@@ -0,0 +1,224 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// webhookAttempts is how often a delivery is tried before giving up.
+	webhookAttempts = 4
+
+	// SignatureHeader carries the HMAC-SHA256 of a webhook body, as
+	// "sha256=" and the hex digest, when the webhook has a secret.
+	SignatureHeader = "X-Mailcatcher-Signature"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Webhook receives a JSON POST of an Event of type EventAdded for every
+// captured email, so other services can react to mail without polling.
+type Webhook struct {
+	URL string `json:"url"`
+
+	// Secret, if set, signs each body in the SignatureHeader, so the
+	// receiver can check it came from this server.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Sign returns the SignatureHeader value of body for the webhook.
+func (w Webhook) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhooks delivers new messages to the registered webhooks. Failed
+// deliveries are retried with exponential backoff.
+type webhooks struct {
+	server     *Server
+	retryDelay time.Duration // before the first retry, doubled for each one
+
+	mu     sync.Mutex
+	hooks  []Webhook
+	ctx    context.Context // of pending deliveries, canceled by stop
+	cancel context.CancelFunc
+}
+
+// AddWebhook registers a webhook for new messages, replacing one with the
+// same URL. Like other notifiers, held messages are delivered once
+// approved and failures are reported to the logger. Deliveries still
+// being retried are abandoned when the server stops.
+func (s *Server) AddWebhook(w Webhook) {
+	s.webhooks.mu.Lock()
+	defer s.webhooks.mu.Unlock()
+	s.webhooks.hooks = slices.DeleteFunc(s.webhooks.hooks, func(h Webhook) bool { return h.URL == w.URL })
+	s.webhooks.hooks = append(s.webhooks.hooks, w)
+}
+
+// RemoveWebhook unregisters the webhook with the given URL and reports
+// whether there was one.
+func (s *Server) RemoveWebhook(url string) bool {
+	s.webhooks.mu.Lock()
+	defer s.webhooks.mu.Unlock()
+	n := len(s.webhooks.hooks)
+	s.webhooks.hooks = slices.DeleteFunc(s.webhooks.hooks, func(h Webhook) bool { return h.URL == url })
+	return len(s.webhooks.hooks) < n
+}
+
+// Webhooks returns the registered webhooks.
+func (s *Server) Webhooks() []Webhook {
+	s.webhooks.mu.Lock()
+	defer s.webhooks.mu.Unlock()
+	return slices.Clone(s.webhooks.hooks)
+}
+
+// Notify implements Notifier.
+func (w *webhooks) Notify(email Email) error {
+	w.mu.Lock()
+	hooks := slices.Clone(w.hooks)
+	if w.ctx == nil {
+		w.ctx, w.cancel = context.WithCancel(context.Background())
+	}
+	ctx := w.ctx
+	w.mu.Unlock()
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(Event{Type: EventAdded, ID: email.ID, Email: &email})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+	for _, hook := range hooks {
+		go func() {
+			if err := w.deliver(ctx, hook, body); err != nil {
+				w.server.errorf("Failed to deliver %s to webhook %s: %v", email.ID, hook.URL, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// deliver posts body to the webhook, retrying network errors, 429 and
+// server errors until ctx is canceled.
+func (w *webhooks) deliver(ctx context.Context, hook Webhook, body []byte) error {
+	delay := w.retryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		if retry, err = w.post(ctx, hook, body); err == nil || !retry || attempt == webhookAttempts {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("server stopped: %w", err)
+		}
+		delay *= 2
+	}
+}
+
+// stop abandons the deliveries in progress.
+func (w *webhooks) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.ctx, w.cancel = nil, nil
+}
+
+// post makes one delivery attempt and reports whether a failure may be
+// retried.
+func (w *webhooks) post(ctx context.Context, hook Webhook, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mailcatcher")
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, hook.Sign(body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return false, nil
+}
+
+// validWebhookURL reports whether raw is an absolute HTTP(S) URL.
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks := s.Webhooks()
+	items := make([]map[string]any, len(hooks))
+	for i, hook := range hooks {
+		items[i] = map[string]any{"url": hook.URL, "signed": hook.Secret != ""}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"count": len(items), "items": items}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// handleAddWebhook registers a webhook. Since every captured email is then
+// posted to the URL, it needs API authentication; -webhook and AddWebhook
+// do not.
+func (s *Server) handleAddWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAPIAuth(w, "Adding a webhook") || !requireJSON(w, r) {
+		return
+	}
+	var hook Webhook
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&hook); err != nil {
+		http.Error(w, "Invalid webhook", http.StatusBadRequest)
+		return
+	}
+	if hook.URL = strings.TrimSpace(hook.URL); !validWebhookURL(hook.URL) {
+		http.Error(w, "Invalid webhook URL", http.StatusBadRequest)
+		return
+	}
+
+	s.AddWebhook(hook)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{"url": hook.URL, "signed": hook.Secret != ""}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleRemoveWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.RemoveWebhook(r.URL.Query().Get("url")) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
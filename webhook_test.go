@@ -0,0 +1,141 @@
+package mailcatcher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	hook := Webhook{Secret: "s3cret"}
+	var attempts atomic.Int32
+	received := make(chan Event, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first delivery fails and must be retried
+		if attempts.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(SignatureHeader), hook.Sign(body); got != want {
+			t.Errorf("Expected signature %s, got %s", want, got)
+		}
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+		received <- event
+	}))
+	defer receiver.Close()
+	hook.URL = receiver.URL
+
+	server := New(0, 0)
+	server.webhooks.retryDelay = time.Millisecond
+	server.AddWebhook(hook)
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Hooked\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	select {
+	case event := <-received:
+		if event.Type != EventAdded || event.Email == nil || event.Email.Subject != "Hooked" {
+			t.Errorf("Expected an added event for the email, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook not called")
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("Expected 2 attempts, got %d", n)
+	}
+}
+
+func TestWebhookStop(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	logger := &bufferLogger{}
+	server, _ := NewTestServer(t, WithLogger(logger))
+	server.webhooks.retryDelay = time.Hour
+	server.AddWebhook(Webhook{URL: receiver.URL})
+	if err := server.Send("app@example.com", []string{"user@example.com"}, []byte("Subject: Hooked\r\n\r\nBody\r\n")); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := server.Stop(context.Background()); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logger.String(), "server stopped") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the retry to be abandoned on Stop, got %q", logger.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookAPI(t *testing.T) {
+	server, _ := NewTestServer(t)
+	base := "http://" + server.HTTPAddr() + "/api/v1/webhooks"
+	add := func(contentType, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, base, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer t0ken")
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to add webhook: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Any web page could register a webhook on an open API
+	if status := add("application/json", `{"url": "http://hooks.example.com/mail"}`); status != http.StatusForbidden {
+		t.Errorf("Expected 403 without API authentication, got %d", status)
+	}
+	server.SetAPIToken("t0ken")
+	if status := add("text/plain", `{"url": "http://hooks.example.com/mail"}`); status != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for a text body, got %d", status)
+	}
+	if status := add("application/json", `{"url": "ftp://example.com"}`); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-HTTP URL, got %d", status)
+	}
+	if status := add("application/json", `{"url": "http://hooks.example.com/mail", "secret": "x"}`); status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if hooks := server.Webhooks(); len(hooks) != 1 || hooks[0].Secret != "x" {
+		t.Fatalf("Expected the webhook to be registered, got %+v", hooks)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, base, nil)
+	req.Header.Set("Authorization", "Bearer t0ken")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to list webhooks: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"signed":true`) || strings.Contains(string(body), `"x"`) {
+		t.Errorf("Expected the webhook without its secret, got %s", body)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, base+"?url=http://hooks.example.com/mail", nil)
+	req.Header.Set("Authorization", "Bearer t0ken")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to remove webhook: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || len(server.Webhooks()) != 0 {
+		t.Errorf("Expected the webhook to be removed, got %d", resp.StatusCode)
+	}
+}
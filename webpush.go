@@ -0,0 +1,238 @@
+package mailcatcher
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// pushSubject identifies this server to push services (RFC 8292).
+const pushSubject = "mailto:mailcatcher@localhost"
+
+// pushClient posts to push services, which are public: it refuses to
+// dial private, loopback and link-local addresses, so a subscription
+// cannot make the server send requests into its own network.
+var pushClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublicOnly}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// dialPublicOnly is a net.Dialer Control refusing non-public addresses.
+// It runs for the resolved address, so DNS cannot point around it.
+func dialPublicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if ip = ip.Unmap(); !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("push endpoint address %s is not public", ip)
+	}
+	return nil
+}
+
+// PushSubscription is a browser Web Push subscription, as returned by
+// PushManager.subscribe() and posted by the web UI.
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// webPush sends Web Push notifications to subscribed browsers whenever a
+// message lands. Pushes carry no payload, so no message content leaves
+// the catcher; the web UI service worker (ui/sw.js) fetches the latest
+// email from the API and shows it.
+// Requests are authenticated with a VAPID key generated at startup.
+type webPush struct {
+	key    *ecdsa.PrivateKey
+	client *http.Client
+
+	mu            sync.Mutex
+	subscriptions map[string]PushSubscription // by endpoint
+}
+
+func newWebPush() *webPush {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate VAPID key: %v", err))
+	}
+	return &webPush{key: key, client: pushClient, subscriptions: make(map[string]PushSubscription)}
+}
+
+// publicKey returns the VAPID public key as the web UI passes it to
+// PushManager.subscribe() as applicationServerKey.
+func (p *webPush) publicKey() string {
+	pub, _ := p.key.PublicKey.ECDH()
+	return base64.RawURLEncoding.EncodeToString(pub.Bytes())
+}
+
+func (p *webPush) subscribe(sub PushSubscription) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscriptions[sub.Endpoint] = sub
+}
+
+func (p *webPush) unsubscribe(endpoint string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.subscriptions[endpoint]
+	delete(p.subscriptions, endpoint)
+	return ok
+}
+
+// Notify implements Notifier.
+func (p *webPush) Notify(_ Email) error {
+	p.mu.Lock()
+	endpoints := make([]string, 0, len(p.subscriptions))
+	for endpoint := range p.subscriptions {
+		endpoints = append(endpoints, endpoint)
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, endpoint := range endpoints {
+		if err := p.push(endpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// push sends a payload-less push message to one subscription. Expired
+// subscriptions are dropped.
+func (p *webPush) push(endpoint string) error {
+	auth, err := p.vapid(endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("TTL", "60")
+	req.Header.Set("Urgency", "high")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push to %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		p.unsubscribe(endpoint)
+		return nil
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("failed to push to %s: %s", endpoint, resp.Status)
+	}
+	return nil
+}
+
+// vapid returns the Authorization header for a push to endpoint: a JWT
+// for the push service's origin signed with ES256 (RFC 8292).
+func (p *webPush) vapid(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid push endpoint: %w", err)
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": pushSubject,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode VAPID claims: %w", err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) +
+		"." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, p.key, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return "vapid t=" + unsigned + "." + base64.RawURLEncoding.EncodeToString(sig) + ", k=" + p.publicKey(), nil
+}
+
+// HTTP handlers
+
+func (s *Server) handleGetPushKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"public_key": s.push.publicKey()}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// handleSubscribePush registers a browser subscription. Anyone reaching
+// the UI may subscribe, so endpoints must be HTTPS and pushClient only
+// reaches public hosts.
+func (s *Server) handleSubscribePush(w http.ResponseWriter, r *http.Request) {
+	if !requireJSON(w, r) {
+		return
+	}
+	var sub PushSubscription
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&sub); err != nil {
+		http.Error(w, "Invalid subscription", http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(sub.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+		http.Error(w, "Invalid subscription endpoint", http.StatusBadRequest)
+		return
+	}
+
+	s.push.subscribe(sub)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(sub); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleUnsubscribePush(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Query().Get("endpoint")
+	if endpoint == "" {
+		var sub PushSubscription
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&sub); err == nil {
+			endpoint = strings.TrimSpace(sub.Endpoint)
+		}
+	}
+
+	if !s.push.unsubscribe(endpoint) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
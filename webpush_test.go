@@ -0,0 +1,141 @@
+package mailcatcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebPush(t *testing.T) {
+	pushed := make(chan string, 1)
+	pushService := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushed <- r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer pushService.Close()
+
+	server := New(10047, 10102)
+	server.push.client = pushService.Client() // the push service runs on loopback
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Stop(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get("http://localhost:10102/api/v1/push/key")
+	if err != nil {
+		t.Fatalf("Failed to get push key: %v", err)
+	}
+	var key struct {
+		PublicKey string `json:"public_key"`
+	}
+	json.NewDecoder(resp.Body).Decode(&key)
+	resp.Body.Close()
+
+	subscription := `{"endpoint":"` + pushService.URL + `/push/abc","keys":{"p256dh":"x","auth":"y"}}`
+	resp, err = http.Post("http://localhost:10102/api/v1/push/subscriptions", "application/json", strings.NewReader(subscription))
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	msg := []byte("Subject: Landed\r\n\r\nBody\r\n")
+	if err := smtp.SendMail("localhost:10047", nil, "sender@example.com", []string{"qa@example.com"}, msg); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	var auth string
+	select {
+	case auth = <-pushed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a push message")
+	}
+	verifyVAPID(t, auth, key.PublicKey, pushService.URL)
+
+	req, _ := http.NewRequest(http.MethodDelete, "http://localhost:10102/api/v1/push/subscriptions", strings.NewReader(subscription))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to unsubscribe: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+
+	for _, tt := range []struct {
+		contentType, body string
+		want              int
+	}{
+		{"application/json", `{"endpoint":"file:///etc"}`, http.StatusBadRequest},
+		{"application/json", `{"endpoint":"http://push.example.com/abc"}`, http.StatusBadRequest},
+		{"text/plain", subscription, http.StatusUnsupportedMediaType},
+	} {
+		resp, err := http.Post("http://localhost:10102/api/v1/push/subscriptions", tt.contentType, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("Expected status %d for %s %s, got %d", tt.want, tt.contentType, tt.body, resp.StatusCode)
+		}
+	}
+
+	// Subscriptions cannot make the server post into its own network
+	if resp, err := pushClient.Post(pushService.URL, "", nil); err == nil {
+		resp.Body.Close()
+		t.Error("Expected the push client to refuse a loopback address")
+	}
+}
+
+// verifyVAPID checks the ES256 signature and audience of a VAPID header.
+func verifyVAPID(t *testing.T, auth, publicKey, origin string) {
+	t.Helper()
+
+	token, k, ok := strings.Cut(strings.TrimPrefix(auth, "vapid t="), ", k=")
+	if !ok || k != publicKey {
+		t.Fatalf("Expected vapid header with the server's key, got %q", auth)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a JWT, got %q", token)
+	}
+
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if !bytes.Contains(claims, []byte(`"aud":"`+origin+`"`)) {
+		t.Errorf("Expected audience %s, got %s", origin, claims)
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(publicKey)
+	if len(raw) != 65 || raw[0] != 4 {
+		t.Fatalf("Expected an uncompressed P-256 point, got %d bytes", len(raw))
+	}
+	ecdsaKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(raw[1:33]),
+		Y:     new(big.Int).SetBytes(raw[33:]),
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if len(sig) != 64 || !ecdsa.Verify(ecdsaKey, hash[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Error("Expected a valid ES256 signature")
+	}
+}